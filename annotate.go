@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// annotations are read-only columns which can be shown after each path
+const (
+	annotateMIME  = "mime"
+	annotateDupes = "dupes"
+)
+
+var annotationKinds = []string{annotateMIME, annotateDupes}
+
+// annotateCmd is the prefix of annotations which are the output of a command
+// run for each path, from -annotate-cmd, written like a shell line in the
+// buffer
+const annotateCmd = "! "
+
+// readAnnotations returns the values of the annotations of each path, to be
+// shown in columns after any attributes
+func readAnnotations(paths, kinds []string) [][]string {
+	var dupes []string
+	if slices.Contains(kinds, annotateDupes) {
+		dupes = dupeIDs(paths)
+	}
+	columns := make([][]string, 0, len(paths))
+	for i, path := range paths {
+		values := make([]string, 0, len(kinds))
+		for _, kind := range kinds {
+			switch kind {
+			case annotateMIME:
+				values = append(values, mimeType(path))
+			case annotateDupes:
+				values = append(values, dupes[i])
+			default:
+				if command, ok := strings.CutPrefix(kind, annotateCmd); ok {
+					values = append(values, commandOutput(command, path))
+				}
+			}
+		}
+		columns = append(columns, values)
+	}
+	return columns
+}
+
+// mimeType sniffs the content type of the file at path from its first bytes,
+// ignoring its extension, since that's what might be missing or wrong.
+// directories and empty files have the types file(1) gives them, and paths
+// which can't be read are shown as a dash
+func mimeType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "-"
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	switch {
+	case err != nil:
+		return "-"
+	case stat.IsDir():
+		return "inode/directory"
+	case stat.Size() == 0:
+		return "inode/x-empty"
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && n == 0 {
+		return "-"
+	}
+	typ, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "-"
+	}
+	return typ
+}
+
+// dupeIDs gives the files in each group of identical ones the same id, like
+// dupe1, numbered from the group wasting the most space. other paths, and
+// all of them if the files can't be read, are shown as a dash
+func dupeIDs(paths []string) []string {
+	ids := make([]string, len(paths))
+	for i := range ids {
+		ids[i] = "-"
+	}
+	dupes, err := groupDupes(paths)
+	if err != nil {
+		return ids
+	}
+	index := make(map[string]int, len(paths))
+	for i, path := range paths {
+		index[path] = i
+	}
+	var group int
+	for i, path := range dupes.paths {
+		if dupes.original[i] == i {
+			group++
+		}
+		ids[index[path]] = fmt.Sprintf("dupe%d", group)
+	}
+	return ids
+}
+
+// commandOutput runs the shell command for path, with placeholders like {}
+// replaced as in the buffer, and returns the first line it prints. commands
+// which fail or print nothing are shown as a dash
+func commandOutput(command, path string) string {
+	cmd := vipaths.ShellCommand(vipaths.Shell{Name: path, Command: command}.Expand())
+	cmd.Stderr = io.Discard
+	out, err := cmd.Output()
+	if err != nil {
+		return "-"
+	}
+	line, _, _ := bufio.NewReader(bytes.NewReader(out)).ReadLine()
+	return cmp.Or(strings.TrimSpace(string(line)), "-")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// linkAttr is the column of symlink targets edited with -edit-links, shown
+// before any extended attributes
+const linkAttr = "target"
+
+// symlinks returns the paths which are symlinks themselves, for -edit-links
+func symlinks(paths []string) []string {
+	var links []string
+	for _, path := range paths {
+		if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			links = append(links, path)
+		}
+	}
+	return links
+}
+
+// readAttrs returns the values of the extended attributes of each path, for
+// editing in columns. SELinux contexts are shown without their trailing NUL,
+// and other values are quoted like paths, since they can hold any bytes
+func readAttrs(paths, attrs []string) ([][]string, error) {
+	columns := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		values := make([]string, 0, len(attrs))
+		for _, attr := range attrs {
+			value, err := readAttr(path, attr)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s of %s: %w", attr, vipaths.Quote(path), err)
+			}
+			values = append(values, value)
+		}
+		columns = append(columns, values)
+	}
+	return columns, nil
+}
+
+func readAttr(path, attr string) (string, error) {
+	switch attr {
+	case vipaths.SELinuxAttr:
+		return vipaths.Context(path)
+	case linkAttr:
+		target, err := os.Readlink(path)
+		return vipaths.Quote(target), err
+	}
+	value, err := vipaths.Xattr(path, attr)
+	return vipaths.Quote(value), err
+}
+
+// attrInstructions turns the edited attributes of paths into instructions to
+// set them, in the order of the paths
+func attrInstructions(paths []string, columns [][]string, edited map[string][]string, attrs []string) (vipaths.Plan, error) {
+	var plan vipaths.Plan
+	var errs []error
+	for i, path := range paths {
+		values, ok := edited[path]
+		if !ok {
+			continue
+		}
+		for j, attr := range attrs {
+			if values[j] == columns[i][j] {
+				continue
+			}
+			if attr == linkAttr {
+				target, err := vipaths.Unquote(values[j])
+				if err == nil && target == "" {
+					err = errors.New("empty target")
+				}
+				if err != nil {
+					errs = append(errs, fmt.Errorf("target of %s: %w", vipaths.Quote(path), err))
+					continue
+				}
+				plan = append(plan, vipaths.Relink{Name: path, Target: target})
+				continue
+			}
+			if attr == vipaths.SELinuxAttr {
+				if values[j] == "" {
+					errs = append(errs, fmt.Errorf("empty context for %s", vipaths.Quote(path)))
+					continue
+				}
+				plan = append(plan, vipaths.Relabel{Name: path, Context: values[j]})
+				continue
+			}
+			value, err := vipaths.Unquote(values[j])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s of %s: %w", attr, vipaths.Quote(path), err))
+				continue
+			}
+			plan = append(plan, vipaths.SetXattr{Name: path, Attr: attr, Value: value})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("parse attributes:\n%w", errors.Join(errs...))
+	}
+	return plan, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// auditLog appends a record of each operation run to a shared file, with who
+// ran it and where. each entry has the hash of the one before, so entries
+// which are edited or removed, other than from the end, break the chain, see
+// auditVerify
+type auditLog struct {
+	f    *os.File
+	fs   vipaths.FS
+	user string
+	host string
+	cwd  string
+}
+
+type auditEntry struct {
+	Time  string `json:"time"`
+	User  string `json:"user"`
+	Host  string `json:"host"`
+	Cwd   string `json:"cwd"`
+	Op    string `json:"op"`
+	Src   string `json:"src"`
+	Dst   string `json:"dst,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Prev is the Hash of the entry before, empty for the first
+	Prev string `json:"prev"`
+	// Hash is the SHA-256 of the entry's JSON with Hash empty
+	Hash string `json:"hash"`
+}
+
+// sum is the entry's hash, of its JSON without one
+func (e auditEntry) sum() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// openAuditLog opens the log at path for appending. cwd is the directory
+// vi-paths was started in
+func openAuditLog(path, cwd string, fsys vipaths.FS) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return &auditLog{f: f, fs: fsys, user: name, host: host, cwd: cwd}, nil
+}
+
+// record appends an operation which ran, or failed with err. the log is
+// locked while the last entry is read and the next written, so several
+// sessions can share it. a nil auditLog records nothing
+func (a *auditLog) record(inst vipaths.Instruction, err error) error {
+	if a == nil {
+		return nil
+	}
+	if err := a.lock(); err != nil {
+		return err
+	}
+	defer unlockFile(a.f)
+
+	prev, err2 := lastAuditHash(a.f)
+	if err2 != nil {
+		return fmt.Errorf("reading audit log: %w", err2)
+	}
+	src, dst := inst.Paths()
+	entry := auditEntry{
+		Time: time.Now().UTC().Format(time.RFC3339Nano),
+		User: a.user,
+		Host: a.host,
+		Cwd:  a.cwd,
+		Op:   vipaths.OpName(inst),
+		Src:  a.path(src),
+		Dst:  a.path(dst),
+		Prev: prev,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.Hash = entry.sum()
+	data, err2 := json.Marshal(entry)
+	if err2 != nil {
+		return err2
+	}
+	if _, err := a.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
+
+// lock takes an exclusive lock on the log, waiting for other sessions
+// appending to it for a few seconds
+func (a *auditLog) lock() error {
+	for wait := 10 * time.Millisecond; ; wait *= 2 {
+		err := lockFile(a.f, true)
+		if !errors.Is(err, errLocked) || wait > 5*time.Second {
+			if err != nil {
+				return fmt.Errorf("locking audit log: %w", err)
+			}
+			return nil
+		}
+		time.Sleep(wait)
+	}
+}
+
+// path is absolute for local paths, like the manifest's
+func (a *auditLog) path(path string) string {
+	if path == "" || a.fs != vipaths.OS {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func (a *auditLog) close() {
+	if a == nil {
+		return
+	}
+	a.f.Close()
+}
+
+// maxAuditEntry is how far back from the end of the log the last entry is
+// looked for
+const maxAuditEntry = 256 << 10
+
+// lastAuditHash returns the hash of the last entry in the log, or empty if
+// it's empty
+func lastAuditHash(f *os.File) (string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	start := max(stat.Size()-maxAuditEntry, 0)
+	buf := make([]byte, stat.Size()-start)
+	if _, err := f.ReadAt(buf, start); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	lines := bytes.Split(bytes.TrimRight(buf, "\n"), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return "", nil
+	}
+	var entry auditEntry
+	if err := json.Unmarshal(last, &entry); err != nil {
+		return "", fmt.Errorf("last entry: %w", err)
+	}
+	return entry.Hash, nil
+}
+
+// auditVerify checks the hash chain of an audit log, failing at the first
+// entry which was changed, or which doesn't follow the one before it because
+// entries were removed or reordered
+func auditVerify(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s audit-verify audit.log", program)
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var prev string
+	var n int
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxAuditEntry)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		var entry auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			return &exitError{exitInvalidPlan, fmt.Errorf("line %d: %w", lineNum, err)}
+		}
+		if entry.sum() != entry.Hash {
+			return &exitError{exitInvalidPlan, fmt.Errorf("line %d: entry was changed, its hash doesn't match", lineNum)}
+		}
+		if entry.Prev != prev {
+			return &exitError{exitInvalidPlan, fmt.Errorf("line %d: entry doesn't follow the one before, entries were removed or reordered", lineNum)}
+		}
+		prev = entry.Hash
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	log.Printf("ok, %d entries, last %s", n, prev)
+	return nil
+}
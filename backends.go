@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/davfs"
+	"go.senan.xyz/vi-paths/pkg/dockerfs"
+	"go.senan.xyz/vi-paths/pkg/rclonefs"
+	"go.senan.xyz/vi-paths/pkg/s3fs"
+	"go.senan.xyz/vi-paths/pkg/sftpfs"
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// openFS finds the filesystem for the paths given on the command line. local
+// paths use the OS, while URLs like sftp://host/path, s3://bucket/prefix,
+// davs://host/path, or rclone://remote/path open a remote backend. all
+// URLs must point to the same remote. glob patterns in remote paths are expanded
+// by the backend, since the shell can't
+func openFS(args []string) (vipaths.FS, []string, io.Closer, error) {
+	if !isURL(args[0]) {
+		for _, arg := range args {
+			if isURL(arg) {
+				return nil, nil, nil, fmt.Errorf("can't mix local paths and remote %q", arg)
+			}
+		}
+		return vipaths.OS, args, io.NopCloser(nil), nil
+	}
+
+	first, err := url.Parse(args[0])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parsing %q: %w", args[0], err)
+	}
+	var remotePaths []string
+	for _, arg := range args {
+		u, err := url.Parse(arg)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing %q: %w", arg, err)
+		}
+		if u.Scheme != first.Scheme || u.Host != first.Host {
+			return nil, nil, nil, fmt.Errorf("all paths must be on the same remote, found %q and %q", args[0], arg)
+		}
+		remotePaths = append(remotePaths, remotePath(u))
+	}
+
+	var fsys vipaths.FS
+	var closer io.Closer
+	switch first.Scheme {
+	case "sftp":
+		sfs, err := sftpfs.Dial(first)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("connecting to %q: %w", first.Host, err)
+		}
+		fsys, closer = sfs, sfs
+	case "s3":
+		s3, err := s3fs.New(first.Host)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("opening bucket %q: %w", first.Host, err)
+		}
+		fsys, closer = s3, io.NopCloser(nil)
+	case "dav", "davs":
+		dav, err := davfs.New(first)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("opening %q: %w", first.Host, err)
+		}
+		fsys, closer = dav, io.NopCloser(nil)
+	case "rclone":
+		rc, err := rclonefs.New(first.Host)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("opening remote %q: %w", first.Host, err)
+		}
+		fsys, closer = rc, io.NopCloser(nil)
+	case "docker", "podman":
+		// the container may be written docker://name:/path, like docker cp
+		dfs, err := dockerfs.New(first.Scheme, first.Hostname())
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("opening container %q: %w", first.Hostname(), err)
+		}
+		fsys, closer = dfs, io.NopCloser(nil)
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown scheme %q", first.Scheme)
+	}
+
+	paths, err := expandGlobs(fsys, remotePaths)
+	if err != nil {
+		closer.Close()
+		return nil, nil, nil, err
+	}
+	return fsys, paths, closer, nil
+}
+
+func isURL(arg string) bool {
+	scheme, _, ok := strings.Cut(arg, "://")
+	return ok && scheme != "" && !strings.ContainsAny(scheme, "/.")
+}
+
+// hostURLs turns paths on host, like user@server or server:2222, into sftp
+// URLs. relative paths are relative to the remote home directory
+func hostURLs(host string, paths []string) ([]string, error) {
+	base, err := url.Parse("sftp://" + host)
+	if err != nil || base.Host == "" || base.Path != "" {
+		return nil, fmt.Errorf("expected a host like user@server, not %q", host)
+	}
+	urls := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if isURL(path) {
+			return nil, fmt.Errorf("can't mix a host with the URL %q", path)
+		}
+		u := *base
+		u.Path = path
+		if !strings.HasPrefix(path, "/") {
+			u.Path = "/~/" + strings.TrimPrefix(path, "~/")
+		}
+		urls = append(urls, u.String())
+	}
+	return urls, nil
+}
+
+// remotePath is the path part of a URL. a leading /~/ is relative to the remote
+// home directory
+func remotePath(u *url.URL) string {
+	path := u.Path
+	if rel, ok := strings.CutPrefix(path, "/~/"); ok {
+		return rel
+	}
+	return path
+}
+
+func expandGlobs(fsys vipaths.FS, patterns []string) ([]string, error) {
+	globber, ok := fsys.(vipaths.Globber)
+	if !ok {
+		return patterns, nil
+	}
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := globber.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("expanding %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no remote matches for %q", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// how -sort orders the paths
+const (
+	sortNone   = ""
+	sortName   = "name"
+	sortLocale = "locale"
+)
+
+// sortPaths sorts paths in place by order. name compares raw bytes, and
+// locale uses the collation rules of the user's locale, so that accented and
+// non latin names sort where a reader of that language would look for them
+func sortPaths(paths []string, order string) error {
+	switch order {
+	case sortNone:
+	case sortName:
+		slices.Sort(paths)
+	case sortLocale:
+		collate.New(userLanguage("LC_COLLATE"), collate.Loose).SortStrings(paths)
+	default:
+		return fmt.Errorf("expected %s or %s, not %q", sortName, sortLocale, order)
+	}
+	return nil
+}
+
+// userLanguage is the language of a locale category from the environment,
+// like de_DE.UTF-8 from $LC_ALL, $LC_COLLATE, or $LANG for LC_COLLATE
+func userLanguage(category string) language.Tag {
+	for _, env := range []string{"LC_ALL", category, "LANG"} {
+		locale := os.Getenv(env)
+		if locale == "" {
+			continue
+		}
+		locale, _, _ = strings.Cut(locale, ".")
+		locale, _, _ = strings.Cut(locale, "@")
+		if tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-")); err == nil {
+			return tag
+		}
+		break
+	}
+	return language.Und
+}
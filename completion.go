@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// completion prints a completion script for a shell, generated from the flags
+// and subcommands so that it stays in sync with them
+func completion(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s completion bash|zsh|fish", program)
+	}
+
+	var flags []*flag.Flag
+	flag.CommandLine.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+
+	switch shell := args[0]; shell {
+	case "bash":
+		fmt.Fprint(os.Stdout, bashCompletion(flags))
+	case "zsh":
+		fmt.Fprint(os.Stdout, zshCompletion(flags))
+	case "fish":
+		fmt.Fprint(os.Stdout, fishCompletion(flags))
+	default:
+		return fmt.Errorf("unknown shell %q, expected one of bash, zsh, fish", shell)
+	}
+	return nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func subcommandNames() []string {
+	var names []string
+	for _, sub := range subcommands {
+		names = append(names, sub.name)
+	}
+	return names
+}
+
+func bashCompletion(flags []*flag.Flag) string {
+	var flagNames, valueFlags []string
+	for _, f := range flags {
+		flagNames = append(flagNames, "-"+f.Name)
+		if !isBoolFlag(f) {
+			valueFlags = append(valueFlags, "-"+f.Name)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s, generated by %s completion bash\n", program, program)
+	fmt.Fprintf(&b, "_vi_paths() {\n")
+	fmt.Fprintf(&b, "  local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	fmt.Fprintf(&b, "  if [[ $COMP_CWORD -eq 2 ]]; then\n")
+	fmt.Fprintf(&b, "    case $prev in\n")
+	for _, sub := range subcommands {
+		if len(sub.args) == 0 {
+			// subcommands without fixed arguments take files
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", sub.name)
+			continue
+		}
+		fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", sub.name, strings.Join(sub.args, " "))
+	}
+	fmt.Fprintf(&b, "    esac\n")
+	fmt.Fprintf(&b, "  fi\n")
+	fmt.Fprintf(&b, "  case $prev in\n")
+	fmt.Fprintf(&b, "  %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", strings.Join(valueFlags, "|"))
+	fmt.Fprintf(&b, "  esac\n")
+	fmt.Fprintf(&b, "  if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(flagNames, " "))
+	fmt.Fprintf(&b, "    return\n")
+	fmt.Fprintf(&b, "  fi\n")
+	fmt.Fprintf(&b, "  COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(&b, "  if [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(&b, "    COMPREPLY+=($(compgen -W %q -- \"$cur\"))\n", strings.Join(subcommandNames(), " "))
+	fmt.Fprintf(&b, "  fi\n")
+	fmt.Fprintf(&b, "}\n")
+	fmt.Fprintf(&b, "complete -o filenames -F _vi_paths %s\n", program)
+	return b.String()
+}
+
+func zshCompletion(flags []*flag.Flag) string {
+	escape := strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`).Replace
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#compdef %s\n", program)
+	fmt.Fprintf(&b, "# zsh completion for %s, generated by %s completion zsh\n\n", program, program)
+	fmt.Fprintf(&b, "if (( CURRENT == 3 )); then\n")
+	fmt.Fprintf(&b, "  case $words[2] in\n")
+	for _, sub := range subcommands {
+		if len(sub.args) == 0 {
+			fmt.Fprintf(&b, "  %s) _files; return ;;\n", sub.name)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s) _values %s %s; return ;;\n", sub.name, sub.name, strings.Join(sub.args, " "))
+	}
+	fmt.Fprintf(&b, "  esac\n")
+	fmt.Fprintf(&b, "fi\n")
+	fmt.Fprintf(&b, "if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n")
+	fmt.Fprintf(&b, "  _alternative 'commands:command:(%s)' 'files:file:_files'\n", strings.Join(subcommandNames(), " "))
+	fmt.Fprintf(&b, "  return\n")
+	fmt.Fprintf(&b, "fi\n")
+	fmt.Fprintf(&b, "_arguments -s \\\n")
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.Name, escape(f.Usage))
+		if !isBoolFlag(f) {
+			spec += ":" + f.Name + ":_files"
+		}
+		fmt.Fprintf(&b, "  '%s' \\\n", spec)
+	}
+	fmt.Fprintf(&b, "  '*:file:_files'\n")
+	return b.String()
+}
+
+func fishCompletion(flags []*flag.Flag) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s, generated by %s completion fish\n", program, program)
+	fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand' -a %q\n", program, strings.Join(subcommandNames(), " "))
+	for _, sub := range subcommands {
+		if len(sub.args) == 0 {
+			// fish falls back to files
+			continue
+		}
+		fmt.Fprintf(&b, "complete -c %s -n '__fish_seen_subcommand_from %s' -x -a %q\n", program, sub.name, strings.Join(sub.args, " "))
+	}
+	for _, f := range flags {
+		var requires string
+		if !isBoolFlag(f) {
+			requires = " -r"
+		}
+		fmt.Fprintf(&b, "complete -c %s -o %s%s -d %s\n", program, f.Name, requires, fishQuote(f.Usage))
+	}
+	return b.String()
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configDir is $XDG_CONFIG_HOME/vi-paths
+func configDir() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, program), nil
+}
+
+// configPath is $XDG_CONFIG_HOME/vi-paths/config.toml
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// loadConfig sets flags from the config file, if there is one. keys are flag
+// names, so that
+//
+//	editor = "code --wait"
+//	strip-prefix = true
+//
+// is the same as passing -editor "code --wait" -strip-prefix. flags given on the
+// command line are parsed afterwards, and take precedence
+func loadConfig(flags *flag.FlagSet) error {
+	path, err := configPath()
+	if err != nil {
+		return fmt.Errorf("finding config: %w", err)
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening config: %w", err)
+	}
+	defer f.Close()
+	return setConfigFlags(flags, path, f)
+}
+
+// loadProfile sets flags from $XDG_CONFIG_HOME/vi-paths/profiles/<name>.toml,
+// for a bundle of flags given as @name before the others. it's in the same
+// format as the config file, and is loaded after it
+func loadProfile(flags *flag.FlagSet, name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	dir, err := configDir()
+	if err != nil {
+		return fmt.Errorf("finding config: %w", err)
+	}
+	path := filepath.Join(dir, "profiles", name+".toml")
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no profile @%s, expected %s", name, path)
+	}
+	if err != nil {
+		return fmt.Errorf("opening profile: %w", err)
+	}
+	defer f.Close()
+	return setConfigFlags(flags, path, f)
+}
+
+// setConfigFlags sets flags from the lines of a config file at path
+func setConfigFlags(flags *flag.FlagSet, path string, f *os.File) error {
+	sc := bufio.NewScanner(f)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		key, values, err := parseConfigLine(sc.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		if key == "" {
+			continue
+		}
+		if flags.Lookup(key) == nil {
+			return fmt.Errorf("%s:%d: unknown option %q", path, lineNum, key)
+		}
+		for _, v := range values {
+			if err := flags.Set(key, v); err != nil {
+				return fmt.Errorf("%s:%d: setting %q: %w", path, lineNum, key, err)
+			}
+		}
+	}
+	return sc.Err()
+}
+
+// envPrefix is the prefix of environment variables which set flags
+const envPrefix = "VI_PATHS_"
+
+// loadEnv sets flags from the environment, after the config file and before the
+// command line. each flag can be set with a variable like VI_PATHS_STRIP_PREFIX=true,
+// and VI_PATHS_OPTS can hold several flags like they'd be passed on the command line
+func loadEnv(flags *flag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		key := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		v, ok := os.LookupEnv(key)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := flags.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("$%s: %w", key, setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := os.Getenv(envPrefix + "OPTS")
+	if opts == "" {
+		return nil
+	}
+	args, err := splitArgs(opts)
+	if err != nil {
+		return fmt.Errorf("$%sOPTS: %w", envPrefix, err)
+	}
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("$%sOPTS: %w", envPrefix, err)
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("$%sOPTS: unexpected argument %q", envPrefix, flags.Arg(0))
+	}
+	return nil
+}
+
+// parseConfigLine parses a subset of TOML: `key = value` pairs where values are
+// strings, numbers, booleans, or arrays of those on one line. tables aren't
+// supported. an empty key is returned for blank and comment lines
+func parseConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	if strings.HasPrefix(line, "[") {
+		return "", nil, fmt.Errorf("tables aren't supported")
+	}
+	key, rest, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", nil, fmt.Errorf("expected key = value")
+	}
+	key = strings.Trim(strings.TrimSpace(key), `"`)
+	rest = strings.TrimSpace(rest)
+
+	if !strings.HasPrefix(rest, "[") {
+		v, rest, err := parseConfigValue(rest)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := expectConfigEnd(rest); err != nil {
+			return "", nil, err
+		}
+		return key, []string{v}, nil
+	}
+
+	var values []string
+	rest = strings.TrimSpace(rest[1:])
+	for !strings.HasPrefix(rest, "]") {
+		v, r, err := parseConfigValue(rest)
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, v)
+		rest = strings.TrimSpace(r)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return "", nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+	if err := expectConfigEnd(rest[1:]); err != nil {
+		return "", nil, err
+	}
+	return key, values, nil
+}
+
+// parseConfigValue parses a single value from the start of s, returning the rest
+func parseConfigValue(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+				continue
+			}
+			if s[end] == '"' {
+				break
+			}
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		v, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", fmt.Errorf("parsing string: %w", err)
+		}
+		return v, s[end+1:], nil
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	default:
+		end := strings.IndexAny(s, ",]#")
+		if end < 0 {
+			end = len(s)
+		}
+		v := strings.TrimSpace(s[:end])
+		if v == "" {
+			return "", "", fmt.Errorf("missing value")
+		}
+		return v, s[end:], nil
+	}
+}
+
+func expectConfigEnd(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after value", rest)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"slices"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// confirmRemoves lists the plan's removes and asks on the terminal before
+// running them. if they're declined, or there's nobody to ask, the plan is
+// returned without them and everything else still runs
+func confirmRemoves(plan vipaths.Plan) vipaths.Plan {
+	var removes []string
+	for _, inst := range plan {
+		if r, ok := inst.(vipaths.Remove); ok {
+			removes = append(removes, r.Name)
+		}
+	}
+	if len(removes) == 0 {
+		return plan
+	}
+	if !askRemoves(removes) {
+		log.Printf("skipping %d removes", len(removes))
+		return slices.DeleteFunc(slices.Clone(plan), func(inst vipaths.Instruction) bool {
+			_, ok := inst.(vipaths.Remove)
+			return ok
+		})
+	}
+	return plan
+}
+
+func askRemoves(removes []string) bool {
+	in, out, err := openTTY()
+	if err != nil {
+		return false
+	}
+	defer in.Close()
+	defer out.Close()
+
+	for _, name := range removes {
+		fmt.Fprintf(out, "  %s\n", vipaths.Quote(name))
+	}
+	fmt.Fprint(out, tr("remove these %d paths? [y/N] ", len(removes)))
+	line, err := bufio.NewReader(in).ReadString('\n')
+	return err == nil && answeredYes(line)
+}
+
+// allowedOps returns which operations may run given the restricting flags, or
+// nil if there are no restrictions
+func allowedOps(renameOnly, noRemove, noCopy bool) func(op string) bool {
+	if !renameOnly && !noRemove && !noCopy {
+		return nil
+	}
+	return func(op string) bool {
+		switch {
+		case renameOnly:
+			return op == "rename"
+		case noRemove && op == "remove", noCopy && op == "copy":
+			return false
+		}
+		return true
+	}
+}
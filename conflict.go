@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// conflictAsk prompts for each conflict on the terminal
+const conflictAsk = "ask"
+
+func validConflict(resolution string) bool {
+	switch resolution {
+	case conflictAsk, vipaths.ConflictOverwrite, vipaths.ConflictSkip, vipaths.ConflictRename, vipaths.ConflictAbort:
+		return true
+	}
+	return false
+}
+
+// validMerge reports whether policy is a merge policy, or empty for none
+func validMerge(policy string) bool {
+	switch policy {
+	case "", vipaths.MergeFail, vipaths.MergeSkip, vipaths.MergeOverwrite:
+		return true
+	}
+	return false
+}
+
+// conflictPrompter asks how to resolve conflicts on the terminal. choices made
+// with an upper case letter apply to every conflict after
+type conflictPrompter struct {
+	always string
+}
+
+func (p *conflictPrompter) resolve(dst string) string {
+	if p.always != "" {
+		return p.always
+	}
+	in, out, err := openTTY()
+	if err != nil {
+		// nobody to ask
+		return vipaths.ConflictAbort
+	}
+	defer in.Close()
+	defer out.Close()
+
+	keys := bufio.NewReader(in)
+	for {
+		fmt.Fprint(out, tr("%q already exists. [o]verwrite, [s]kip, [r]ename, [a]bort (upper case for all)? ", dst))
+		line, err := keys.ReadString('\n')
+		if err != nil {
+			return vipaths.ConflictAbort
+		}
+		line = strings.TrimSpace(line)
+		var resolution string
+		switch strings.ToLower(line) {
+		case "o":
+			resolution = vipaths.ConflictOverwrite
+		case "s":
+			resolution = vipaths.ConflictSkip
+		case "r":
+			resolution = vipaths.ConflictRename
+		case "a":
+			resolution = vipaths.ConflictAbort
+		default:
+			continue
+		}
+		if line != strings.ToLower(line) {
+			p.always = resolution
+		}
+		return resolution
+	}
+}
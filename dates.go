@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// dateField matches date helpers in templates like {mtime:2006/01}, which
+// format when each path was modified, or when a photo was taken for exif,
+// with a Go time layout
+var dateField = regexp.MustCompile(`\{(mtime|exif):([^}]*)\}`)
+
+// expandDates replaces the date helpers in template with the dates of path.
+// dollar signs in the dates are escaped, since the template is for a regexp
+func expandDates(fsys vipaths.FS, template, path string) (string, error) {
+	var errs []error
+	expanded := dateField.ReplaceAllStringFunc(template, func(field string) string {
+		m := dateField.FindStringSubmatch(field)
+		var t time.Time
+		var err error
+		switch m[1] {
+		case "mtime":
+			var stat os.FileInfo
+			if stat, err = fsys.Stat(path); err == nil {
+				t = stat.ModTime()
+			}
+		case "exif":
+			if fsys != vipaths.OS {
+				err = errors.New("exif dates can only be read from local files")
+				break
+			}
+			t, err = exifDate(path)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s of %s: %w", m[1], vipaths.Quote(path), err))
+			return ""
+		}
+		return strings.ReplaceAll(t.Format(m[2]), "$", "$$")
+	})
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return expanded, nil
+}
+
+// exif tags holding when a photo was taken, and the sub IFD holding the
+// original time
+const (
+	exifTagDateTime         = 0x0132
+	exifTagSubIFD           = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// exifDate returns when a JPEG photo was taken, from its EXIF DateTimeOriginal,
+// or DateTime if that's missing. EXIF times have no zone, so are local
+func exifDate(name string) (time.Time, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return time.Time{}, errors.New("not a JPEG")
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil || header[0] != 0xff {
+			return time.Time{}, errors.New("no EXIF data")
+		}
+		// the image data starts at SOS, after any metadata
+		if header[1] == 0xda || header[1] == 0xd9 {
+			return time.Time{}, errors.New("no EXIF data")
+		}
+		size := int(binary.BigEndian.Uint16(header[2:])) - 2
+		if size < 0 {
+			return time.Time{}, errors.New("invalid JPEG segment")
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return time.Time{}, fmt.Errorf("reading JPEG segment: %w", err)
+		}
+		if header[1] == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffDate(segment[6:])
+		}
+	}
+}
+
+// tiffDate finds the date in the TIFF structure of EXIF data
+func tiffDate(b []byte) (time.Time, error) {
+	if len(b) < 8 {
+		return time.Time{}, errors.New("invalid EXIF data")
+	}
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, errors.New("invalid EXIF byte order")
+	}
+
+	// entry returns the value or offset of tag in the IFD at offset
+	entry := func(offset uint32, tag uint16) (count, value uint32, ok bool) {
+		if int(offset)+2 > len(b) {
+			return 0, 0, false
+		}
+		n := int(order.Uint16(b[offset:]))
+		for i := range n {
+			e := int(offset) + 2 + i*12
+			if e+12 > len(b) {
+				return 0, 0, false
+			}
+			if order.Uint16(b[e:]) == tag {
+				return order.Uint32(b[e+4:]), order.Uint32(b[e+8:]), true
+			}
+		}
+		return 0, 0, false
+	}
+	// date reads the ASCII date of tag, always longer than 4 bytes so stored
+	// at an offset
+	date := func(offset uint32, tag uint16) (time.Time, bool) {
+		count, value, ok := entry(offset, tag)
+		if !ok || int(value)+int(count) > len(b) {
+			return time.Time{}, false
+		}
+		s := strings.TrimRight(string(b[value:value+count]), "\x00 ")
+		t, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+		return t, err == nil
+	}
+
+	ifd0 := order.Uint32(b[4:])
+	if _, sub, ok := entry(ifd0, exifTagSubIFD); ok {
+		if t, ok := date(sub, exifTagDateTimeOriginal); ok {
+			return t, nil
+		}
+	}
+	if t, ok := date(ifd0, exifTagDateTime); ok {
+		return t, nil
+	}
+	return time.Time{}, errors.New("no date in EXIF data")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// diffTrees returns the paths which are in one of the directories a and b but
+// not the other, a's first. a directory missing from the other side is listed
+// without its contents. notes title the two groups for the buffer. with
+// oneFS, directories mounted inside a or b aren't descended into. ignored
+// paths are left out on both sides
+func diffTrees(a, b string, oneFS bool, ignores *ignoreRules) ([]string, map[int]string, error) {
+	onlyA, err := missingFrom(a, b, oneFS, ignores)
+	if err != nil {
+		return nil, nil, err
+	}
+	onlyB, err := missingFrom(b, a, oneFS, ignores)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes := map[int]string{}
+	if len(onlyA) > 0 {
+		notes[0] = fmt.Sprintf("only in %s", a)
+	}
+	if len(onlyB) > 0 {
+		notes[len(onlyA)] = fmt.Sprintf("only in %s", b)
+	}
+	return append(onlyA, onlyB...), notes, nil
+}
+
+// missingFrom walks the directory from and returns its paths which don't
+// exist at the same place under to
+func missingFrom(from, to string, oneFS bool, ignores *ignoreRules) ([]string, error) {
+	var missing []string
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != from {
+			if skip, err := ignores.skip(path, d); skip {
+				return err
+			}
+		}
+		if oneFS && d.IsDir() && path != from {
+			mount, err := otherFilesystem(path, from)
+			if err != nil {
+				return err
+			}
+			if mount {
+				return filepath.SkipDir
+			}
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		_, err = os.Lstat(filepath.Join(to, rel))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			missing = append(missing, path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+		return nil
+	})
+	return missing, err
+}
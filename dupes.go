@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// dupeGroups is the result of groupDupes. paths are the duplicated files with
+// each group adjacent, notes title each group for the buffer, and original
+// maps each path's index to the index of the first path in its group
+type dupeGroups struct {
+	paths    []string
+	notes    map[int]string
+	original map[int]int
+}
+
+// groupDupes hashes the regular files in paths, only those with the same size
+// as another, and groups the identical ones. groups are ordered by the space
+// they waste, most first
+func groupDupes(paths []string) (*dupeGroups, error) {
+	bySize := map[int64][]string{}
+	for _, path := range paths {
+		stat, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.Mode().IsRegular() {
+			continue
+		}
+		bySize[stat.Size()] = append(bySize[stat.Size()], path)
+	}
+
+	type group struct {
+		size  int64
+		paths []string
+	}
+	var groups []group
+	for size, same := range bySize {
+		if len(same) < 2 {
+			continue
+		}
+		byHash := map[string][]string{}
+		var hashes []string
+		for _, path := range same {
+			sum, err := hashFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := byHash[sum]; !ok {
+				hashes = append(hashes, sum)
+			}
+			byHash[sum] = append(byHash[sum], path)
+		}
+		for _, sum := range hashes {
+			if len(byHash[sum]) > 1 {
+				groups = append(groups, group{size, byHash[sum]})
+			}
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		wi := groups[i].size * int64(len(groups[i].paths)-1)
+		wj := groups[j].size * int64(len(groups[j].paths)-1)
+		if wi != wj {
+			return wi > wj
+		}
+		return groups[i].paths[0] < groups[j].paths[0]
+	})
+
+	dupes := &dupeGroups{notes: map[int]string{}, original: map[int]int{}}
+	for _, g := range groups {
+		sort.Strings(g.paths)
+		first := len(dupes.paths)
+		dupes.notes[first] = fmt.Sprintf("%d identical files of %s", len(g.paths), vipaths.FormatBytes(g.size))
+		for i, path := range g.paths {
+			dupes.original[first+i] = first
+			dupes.paths = append(dupes.paths, path)
+		}
+	}
+	return dupes, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package main
+
+// defaultEditor is used when neither $EDITOR nor -editor are set
+const defaultEditor = ""
@@ -0,0 +1,4 @@
+package main
+
+// defaultEditor is used when neither $EDITOR nor -editor are set
+const defaultEditor = "notepad"
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// editorSetup writes syntax and filetype support for *.vipaths buffers into the
+// config directory of the given editor
+func editorSetup(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s editor-setup vim|nvim|helix", program)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("finding home dir: %w", err)
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	switch editor := args[0]; editor {
+	case "vim":
+		return writeVimFiles(filepath.Join(home, ".vim"))
+	case "nvim":
+		return writeVimFiles(filepath.Join(configHome, "nvim"))
+	case "helix":
+		return writeHelixFiles(filepath.Join(configHome, "helix"))
+	default:
+		return fmt.Errorf("unknown editor %q, expected one of vim, nvim, helix", editor)
+	}
+}
+
+func writeVimFiles(root string) error {
+	files := []struct{ path, contents string }{
+		{filepath.Join(root, "ftdetect", "vipaths.vim"), vimFtdetect},
+		{filepath.Join(root, "syntax", "vipaths.vim"), vimSyntax()},
+		{filepath.Join(root, "ftplugin", "vipaths.vim"), vimFtplugin},
+	}
+	for _, f := range files {
+		if err := writeSetupFile(f.path, f.contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHelixFiles(root string) error {
+	path := filepath.Join(root, "languages.toml")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading %q: %w", path, err)
+	}
+	if strings.Contains(string(existing), `name = "vipaths"`) {
+		fmt.Printf("%s already configured\n", path)
+		return nil
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("creating %q: %w", root, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(helixLanguage); err != nil {
+		return fmt.Errorf("writing %q: %w", path, err)
+	}
+	fmt.Printf("appended to %s\n", path)
+	return nil
+}
+
+func writeSetupFile(path, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating %q: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		return fmt.Errorf("writing %q: %w", path, err)
+	}
+	fmt.Printf("wrote %s\n", path)
+	return nil
+}
+
+func vimSyntax() string {
+	var names []string
+	for _, cmd := range vipaths.Commands {
+		names = append(names, cmd.Name)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\" generated by %s editor-setup\n", program)
+	fmt.Fprintf(&b, "if exists(\"b:current_syntax\")\n  finish\nendif\n\n")
+	fmt.Fprintf(&b, "syntax match vipathsComment \"^#.*$\"\n")
+	// commands start a line or follow a "; "
+	fmt.Fprintf(&b, "syntax match vipathsCommand \"\\%%(^\\s*\\|;\\s\\+\\)\\zs\\%%(%s\\)\\ze\\%%(\\s\\|;\\|$\\)\"\n\n", strings.Join(names, `\|`))
+	fmt.Fprintf(&b, "highlight default link vipathsComment Comment\n")
+	fmt.Fprintf(&b, "highlight default link vipathsCommand Keyword\n\n")
+	fmt.Fprintf(&b, "let b:current_syntax = \"vipaths\"\n")
+	return b.String()
+}
+
+const vimFtdetect = `" generated by vi-paths editor-setup
+autocmd BufRead,BufNewFile *.vipaths setfiletype vipaths
+`
+
+// vimFtplugin highlights lines which differ from the buffer as it was first loaded
+const vimFtplugin = `" generated by vi-paths editor-setup
+if exists("b:did_ftplugin")
+  finish
+endif
+let b:did_ftplugin = 1
+
+setlocal commentstring=#\ %s
+let b:vipaths_original = getline(1, '$')
+
+function! s:HighlightChanged() abort
+  for id in get(w:, 'vipaths_matches', [])
+    silent! call matchdelete(id)
+  endfor
+  let w:vipaths_matches = []
+  let lines = getline(1, '$')
+  for i in range(len(lines))
+    if i >= len(b:vipaths_original) || lines[i] !=# b:vipaths_original[i]
+      call add(w:vipaths_matches, matchaddpos('DiffChange', [i + 1]))
+    endif
+  endfor
+endfunction
+
+augroup vipaths
+  autocmd! * <buffer>
+  autocmd TextChanged,TextChangedI <buffer> call s:HighlightChanged()
+augroup END
+`
+
+const helixLanguage = `
+# generated by vi-paths editor-setup
+[[language]]
+name = "vipaths"
+scope = "source.vipaths"
+file-types = ["vipaths"]
+comment-token = "#"
+`
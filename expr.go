@@ -0,0 +1,435 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// substitution is a sed style s/regexp/replacement/flags expression
+type substitution struct {
+	re *regexp.Regexp
+	// replacement is expanded a segment at a time, so each can change case
+	replacement []segment
+	// global replaces every match rather than the first
+	global bool
+	// base matches only against the base name of each path
+	base bool
+	// exts, if set, change extensions instead of re, see parseExtMap
+	exts []extMapping
+	// address renames files by their content instead of re, into depth
+	// levels of directories, see contentAddress
+	address bool
+	depth   int
+	// command, if set, prints the new name of each path instead of re, see
+	// mapCommand
+	command string
+}
+
+// segment is part of a replacement, a regexp template whose expansion is
+// passed through fold if it's set
+type segment struct {
+	template string
+	fold     func(string) string
+}
+
+// caseFolds returns the upper and lower case mappings for lang, which differ
+// from the defaults for a few languages, like the dotted and dotless i in
+// turkish
+func caseFolds(lang language.Tag) (upper, lower func(string) string) {
+	return cases.Upper(lang).String, cases.Lower(lang).String
+}
+
+// parseExpr parses s/regexp/replacement/flags, where the regexp is RE2. any
+// character can stand in for the /. in the replacement \1 to \9 are capture
+// groups, & is the whole match, and \& and \\ are literal. \U and \L turn what
+// follows to upper or lower case in lang, until \E. the flags are g to
+// replace every match, i to ignore case, and b to only match the base name
+func parseExpr(expr string, lang language.Tag) (*substitution, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nil, fmt.Errorf("expected an expression like s/regexp/replacement/")
+	}
+	delim := expr[1:2]
+	parts := splitUnescaped(expr[2:], delim)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected an expression like s%sregexp%sreplacement%s", delim, delim, delim)
+	}
+	pattern := strings.ReplaceAll(parts[0], `\`+delim, delim)
+	var s substitution
+	for _, flag := range parts[2] {
+		switch flag {
+		case 'g':
+			s.global = true
+		case 'i':
+			pattern = "(?i)" + pattern
+		case 'b':
+			s.base = true
+		default:
+			return nil, fmt.Errorf("unknown flag %q, expected g, i, or b", flag)
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regexp: %w", err)
+	}
+	s.re = re
+	s.replacement = expandTemplate(parts[1], lang)
+	return &s, nil
+}
+
+// parseGlob makes a substitution from a glob like IMG_*.jpg and a template
+// like photo-{1}.jpg, where {1} is what the first wildcard matched and so on,
+// and {1:upper} or {1:lower} is that in upper or lower case in lang. *, ?,
+// and [...] are wildcards, and a glob without a / only matches the base name.
+// paths which don't match are left alone
+func parseGlob(glob, to string, lang language.Tag) (*substitution, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	var groups int
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			pattern.WriteString("([^/]*?)")
+			groups++
+		case '?':
+			pattern.WriteString("([^/])")
+			groups++
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in glob")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			pattern.WriteString("([" + class + "])")
+			groups++
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			pattern.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	pattern.WriteString("$")
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("compiling glob: %w", err)
+	}
+
+	upper, lower := caseFolds(lang)
+	var segments []segment
+	var literal strings.Builder
+	for i := 0; i < len(to); i++ {
+		switch c := to[i]; {
+		case c == '$':
+			literal.WriteString("$$")
+		case c == '{':
+			end := strings.IndexByte(to[i:], '}')
+			field, fold, _ := strings.Cut(to[i+1:i+max(end, 1)], ":")
+			n, err := strconv.Atoi(field)
+			if end < 0 || err != nil {
+				literal.WriteByte(c)
+				continue
+			}
+			if n < 1 || n > groups {
+				return nil, fmt.Errorf("{%d} in template, but the glob has %d wildcards", n, groups)
+			}
+			var seg segment
+			switch fold {
+			case "":
+			case "upper":
+				seg.fold = upper
+			case "lower":
+				seg.fold = lower
+			default:
+				return nil, fmt.Errorf("unknown case %q in template, expected upper or lower", fold)
+			}
+			seg.template = fmt.Sprintf("${%d}", n)
+			segments = append(segments, segment{template: literal.String()}, seg)
+			literal.Reset()
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	segments = append(segments, segment{template: literal.String()})
+	return &substitution{re: re, replacement: segments, base: !strings.Contains(glob, "/")}, nil
+}
+
+// caseSubstitution renames the base name of every path to upper or lower
+// case in lang, for -upper and -lower
+func caseSubstitution(toUpper bool, lang language.Tag) *substitution {
+	upper, lower := caseFolds(lang)
+	fold := lower
+	if toUpper {
+		fold = upper
+	}
+	return &substitution{re: regexp.MustCompile(`^.+$`), replacement: []segment{{template: "${0}", fold: fold}}, base: true}
+}
+
+// mapCommand renames each path to what a shell command prints for it, for
+// -map-cmd. the path is written to the command's stdin, and placeholders like
+// {} are replaced as on ! lines in the buffer
+func mapCommand(command string) (*substitution, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("empty command")
+	}
+	return &substitution{command: command}, nil
+}
+
+// commandName runs the substitution's command for the path at full, and
+// returns the first line it prints, taken literally as the new path, relative
+// to any prefix like lines in the buffer. nothing printed leaves the path alone
+func (s *substitution) commandName(full string) (string, error) {
+	cmd := vipaths.ShellCommand(vipaths.Shell{Name: full, Command: s.command}.Expand())
+	cmd.Stdin = strings.NewReader(full + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running -map-cmd for %s: %w", vipaths.Quote(full), err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// extMapping is an extension, without its dot, and what -ext-map changes it to
+type extMapping struct{ from, to string }
+
+// parseExtMap parses a list of extension changes like jpeg=jpg,tif=tiff into a
+// substitution of the extensions of base names. extensions match ignoring case
+// and can have several parts, like tar.gz=tgz, which are tried longest first.
+// an extension changed to nothing is removed
+func parseExtMap(list string) (*substitution, error) {
+	var exts []extMapping
+	for pair := range strings.SplitSeq(list, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		from, to = strings.TrimPrefix(from, "."), strings.TrimPrefix(to, ".")
+		if !ok || from == "" || strings.ContainsAny(from+to, `/\`) {
+			return nil, fmt.Errorf("expected extensions like jpeg=jpg, not %q", pair)
+		}
+		if slices.ContainsFunc(exts, func(e extMapping) bool { return strings.EqualFold(e.from, from) }) {
+			return nil, fmt.Errorf("%q is changed twice", from)
+		}
+		exts = append(exts, extMapping{from, to})
+	}
+	slices.SortStableFunc(exts, func(a, b extMapping) int { return len(b.from) - len(a.from) })
+	return &substitution{exts: exts, base: true}, nil
+}
+
+// mapExt changes the extension of name by the first of exts it has, keeping
+// at least one character before it
+func mapExt(name string, exts []extMapping) string {
+	for _, e := range exts {
+		n := len(name) - len(e.from) - 1
+		if n < 1 || !strings.EqualFold(name[n:], "."+e.from) {
+			continue
+		}
+		if e.to == "" {
+			return name[:n]
+		}
+		return name[:n] + "." + e.to
+	}
+	return name
+}
+
+// contentAddress renames each regular file by the sha256 of its contents,
+// keeping its extension, into depth levels of directories named after pairs of
+// the hash's leading characters, like ab/cd/abcdef....jpg for a depth of 2
+func contentAddress(depth int) (*substitution, error) {
+	if depth < 0 || depth > sha256.Size {
+		return nil, fmt.Errorf("expected a depth from 0 to %d", sha256.Size)
+	}
+	return &substitution{address: true, depth: depth, base: true}, nil
+}
+
+// addressName returns the content address of the file at full, named as
+// contentAddress does, or "" if it isn't a regular file
+func (s *substitution) addressName(full, name string) (string, error) {
+	stat, err := os.Stat(full)
+	if err != nil || !stat.Mode().IsRegular() {
+		return "", err
+	}
+	sum, err := hashFile(full)
+	if err != nil {
+		return "", fmt.Errorf("checksum of %s: %w", vipaths.Quote(full), err)
+	}
+	var parts []string
+	for i := range s.depth {
+		parts = append(parts, sum[i*2:i*2+2])
+	}
+	return filepath.Join(append(parts, sum+filepath.Ext(name))...), nil
+}
+
+// splitUnescaped splits s on delim where it isn't escaped with a backslash,
+// keeping any escapes
+func splitUnescaped(s, delim string) []string {
+	var parts []string
+	var start int
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case strings.HasPrefix(s[i:], delim):
+			parts = append(parts, s[start:i])
+			start = i + len(delim)
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// expandTemplate turns a sed style replacement into regexp templates, split
+// where \U, \L, and \E change case
+func expandTemplate(replacement string, lang language.Tag) []segment {
+	upper, lower := caseFolds(lang)
+	var segments []segment
+	var cur segment
+	var b strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		switch {
+		case c == '$':
+			b.WriteString("$$")
+		case c == '&':
+			b.WriteString("${0}")
+		case c == '\\' && i+1 < len(replacement):
+			i++
+			next := replacement[i]
+			switch {
+			case next >= '0' && next <= '9':
+				fmt.Fprintf(&b, "${%c}", next)
+			case next == '$':
+				b.WriteString("$$")
+			case next == 'U', next == 'L', next == 'E':
+				cur.template = b.String()
+				segments = append(segments, cur)
+				b.Reset()
+				cur = segment{}
+				switch next {
+				case 'U':
+					cur.fold = upper
+				case 'L':
+					cur.fold = lower
+				}
+			default:
+				// \&, \\, and an escaped delimiter are literal
+				b.WriteByte(next)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	cur.template = b.String()
+	return append(segments, cur)
+}
+
+// expand expands the replacement for the match at loc in target, with the
+// segments' templates as given
+func (s *substitution) expand(templates []string, target string, loc []int) string {
+	var b strings.Builder
+	for i, seg := range s.replacement {
+		expanded := string(s.re.ExpandString(nil, templates[i], target, loc))
+		if seg.fold != nil {
+			expanded = seg.fold(expanded)
+		}
+		b.WriteString(expanded)
+	}
+	return b.String()
+}
+
+// apply returns path with the substitution made, expanding any date helpers
+// in the replacement for the file at full, the path before any prefix was
+// stripped
+func (s *substitution) apply(fsys vipaths.FS, path, full string) (string, error) {
+	var dir string
+	target := path
+	if s.base {
+		dir, target = filepath.Split(path)
+	}
+	if s.exts != nil {
+		return dir + mapExt(target, s.exts), nil
+	}
+	if s.command != "" {
+		name, err := s.commandName(full)
+		if name == "" || err != nil {
+			return path, err
+		}
+		return name, nil
+	}
+	if s.address {
+		name, err := s.addressName(full, target)
+		if name == "" || err != nil {
+			return path, err
+		}
+		return dir + name, nil
+	}
+	if !s.re.MatchString(target) {
+		return path, nil
+	}
+	templates := make([]string, len(s.replacement))
+	for i, seg := range s.replacement {
+		var err error
+		if templates[i], err = expandDates(fsys, seg.template, full); err != nil {
+			return "", err
+		}
+	}
+	n := 1
+	if s.global {
+		n = -1
+	}
+	var b strings.Builder
+	var last int
+	for _, loc := range s.re.FindAllStringSubmatchIndex(target, n) {
+		b.WriteString(target[last:loc[0]])
+		b.WriteString(s.expand(templates, target, loc))
+		last = loc[1]
+	}
+	b.WriteString(target[last:])
+	return dir + b.String(), nil
+}
+
+// exprChanges returns the paths the substitution changes and their new names,
+// as edited lines ready for vipaths.Parse without expansion. the paths are
+// relative to prefix if it's set. a path can't be substituted away entirely,
+// that would be a remove, and two paths can't get the same name, like
+// duplicate files with -content-address
+func exprChanges(fsys vipaths.FS, s *substitution, prefix string, before []string) (changedBefore, changedAfter []string, err error) {
+	renamedFrom := map[string]string{}
+	for _, path := range before {
+		full := path
+		if prefix != "" {
+			full = filepath.Join(prefix, path)
+		}
+		after, err := s.apply(fsys, path, full)
+		if err != nil {
+			return nil, nil, err
+		}
+		if after == path {
+			continue
+		}
+		if _, base := filepath.Split(after); base == "" {
+			return nil, nil, fmt.Errorf("the expression leaves no name for %s", vipaths.Quote(path))
+		}
+		if other, ok := renamedFrom[after]; ok {
+			return nil, nil, fmt.Errorf("both %s and %s would be renamed to %s", vipaths.Quote(other), vipaths.Quote(path), vipaths.Quote(after))
+		}
+		renamedFrom[after] = path
+		changedBefore = append(changedBefore, path)
+		changedAfter = append(changedAfter, vipaths.Quote(after))
+	}
+	return changedBefore, changedAfter, nil
+}
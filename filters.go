@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// sizeAgeFilter keeps paths within a range of sizes and modification times.
+// zero values are unbounded
+type sizeAgeFilter struct {
+	minSize, maxSize int64
+	newer, older     time.Time
+}
+
+func (f sizeAgeFilter) enabled() bool {
+	return f.minSize > 0 || f.maxSize > 0 || !f.newer.IsZero() || !f.older.IsZero()
+}
+
+// filter returns the paths which pass. a directory's size is the total of
+// the files in it
+func (f sizeAgeFilter) filter(fsys vipaths.FS, paths []string) ([]string, error) {
+	var kept []string
+	for _, path := range paths {
+		stat, err := fsys.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if mtime := stat.ModTime(); !f.newer.IsZero() && !mtime.After(f.newer) || !f.older.IsZero() && !mtime.Before(f.older) {
+			continue
+		}
+		if f.minSize > 0 || f.maxSize > 0 {
+			size := vipaths.Size(fsys, path)
+			if size < f.minSize || f.maxSize > 0 && size > f.maxSize {
+				continue
+			}
+		}
+		kept = append(kept, path)
+	}
+	return kept, nil
+}
+
+// ageUnits are the units an age can be given in beyond time.ParseDuration's
+var ageUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// parseAge parses an age like 30d, 2w, 1y, or 12h into the time that long
+// ago, or a time like 2020-01-01 as it is
+func parseAge(s string) (time.Time, error) {
+	if t, err := vipaths.ParseTime(s); err == nil {
+		return t, nil
+	}
+	if n := len(s); n > 1 {
+		if unit, ok := ageUnits[s[n-1]]; ok {
+			if v, err := strconv.ParseFloat(s[:n-1], 64); err == nil && v >= 0 {
+				return time.Now().Add(-time.Duration(v * float64(unit))), nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || strings.HasPrefix(s, "-") {
+		return time.Time{}, fmt.Errorf("expected an age like 30d, 2w, 1y, or a time like 2020-01-01, not %q", s)
+	}
+	return time.Now().Add(-d), nil
+}
@@ -1,3 +1,14 @@
 module go.senan.xyz/vi-paths
 
-go 1.18
+go 1.24.0
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/pkg/sftp v1.13.10
+	golang.org/x/crypto v0.48.0
+	golang.org/x/sys v0.41.0
+	golang.org/x/term v0.40.0
+	golang.org/x/text v0.34.0
+)
+
+require github.com/kr/fs v0.1.0 // indirect
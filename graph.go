@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// graphFormats are the formats -graph can write the plan in
+var graphFormats = []string{"dot"}
+
+// dependency is why one operation has to run before another
+type dependency struct {
+	from, to int
+	why      string
+}
+
+// planDependencies returns the pairs of operations which have to run in the
+// order they're in, because of the paths they share. renames run deepest
+// first, so a path inside a renamed directory is handled before it, a path
+// has to be moved out of the way before something else takes its name, and
+// operations on a path made by an earlier one, or in a directory it made,
+// have to wait for it
+func planDependencies(plan vipaths.Plan) []dependency {
+	var deps []dependency
+	for j, later := range plan {
+		laterSrcs, laterDst := planSources(later), planDst(later)
+		for i, earlier := range plan[:j] {
+			earlierSrcs, earlierDst := planSources(earlier), planDst(earlier)
+			var why string
+			switch {
+			case earlierDst != "" && anyWithin(earlierDst, laterSrcs):
+				why = "made by"
+			case earlierDst != "" && laterDst != "" && vipaths.OpName(earlier) == "mkdir" && inside(earlierDst, laterDst):
+				why = "into"
+			case laterDst != "" && anyWithin(laterDst, earlierSrcs):
+				why = "frees"
+			case anyInside(earlierSrcs, laterSrcs):
+				why = "inside"
+			case slices.ContainsFunc(earlierSrcs, func(src string) bool { return slices.Contains(laterSrcs, src) }):
+				why = "same path"
+			}
+			if why != "" {
+				deps = append(deps, dependency{from: i, to: j, why: why})
+			}
+		}
+	}
+	return deps
+}
+
+// writeDot writes the plan as a Graphviz digraph for -graph dot. each
+// operation is a node numbered as -review and check number them, solid edges
+// are the dependencies which fix their order, labelled with why, and dashed
+// edges join operations which run one after the other for no other reason
+// than the order they were planned in
+func writeDot(w io.Writer, plan vipaths.Plan) error {
+	deps := planDependencies(plan)
+	depends := map[[2]int]bool{}
+	for _, dep := range deps {
+		depends[[2]int{dep.from, dep.to}] = true
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph plan {")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=monospace];")
+	for i, inst := range plan {
+		fmt.Fprintf(bw, "\top%d [label=%s];\n", i+1, strconv.Quote(fmt.Sprintf("%d. %s", i+1, inst)))
+	}
+	for _, dep := range deps {
+		fmt.Fprintf(bw, "\top%d -> op%d [label=%s];\n", dep.from+1, dep.to+1, strconv.Quote(dep.why))
+	}
+	for i := 1; i < len(plan); i++ {
+		if !depends[[2]int{i - 1, i}] {
+			fmt.Fprintf(bw, "\top%d -> op%d [style=dashed, color=gray];\n", i, i+1)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// planSources are the paths an operation reads or changes in place, cleaned
+func planSources(inst vipaths.Instruction) []string {
+	if a, ok := inst.(vipaths.Archive); ok {
+		srcs := make([]string, 0, len(a.Names))
+		for _, name := range a.Names {
+			srcs = append(srcs, filepath.Clean(name))
+		}
+		return srcs
+	}
+	if src, _ := inst.Paths(); src != "" {
+		return []string{filepath.Clean(src)}
+	}
+	return nil
+}
+
+// planDst is the path an operation makes, cleaned, or "" if it makes none
+func planDst(inst vipaths.Instruction) string {
+	if _, dst := inst.Paths(); dst != "" {
+		return filepath.Clean(dst)
+	}
+	return ""
+}
+
+// anyWithin reports whether any of paths is dir or inside it
+func anyWithin(dir string, paths []string) bool {
+	for _, path := range paths {
+		if _, ok := within(dir, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inside reports whether path is inside dir, and isn't dir itself
+func inside(dir, path string) bool {
+	rel, ok := within(dir, path)
+	return ok && rel != "."
+}
+
+// anyInside reports whether any of paths is inside any of dirs
+func anyInside(paths, dirs []string) bool {
+	for _, dir := range dirs {
+		for _, path := range paths {
+			if inside(dir, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// headerWidth is roughly how wide header comments are wrapped to
+const headerWidth = 100
+
+// headerComments are the comments written at the top of the buffer after
+// vipaths.Header, so occasional users can see the commands they can type,
+// what they're editing, and the flags in effect without looking them up
+func headerComments(before []string, opts options) []string {
+	if opts.mark {
+		return []string{markComment, headerCount(before, opts)}
+	}
+	var usages []string
+	for _, cmd := range vipaths.Commands {
+		usages = append(usages, "`"+cmd.Usage+"`")
+	}
+	comments := wrapList("commands: ", usages, headerWidth)
+	if len(vipaths.Aliases) > 0 {
+		var aliases []string
+		for _, alias := range slices.Sorted(maps.Keys(vipaths.Aliases)) {
+			aliases = append(aliases, "`"+alias+"` "+vipaths.Aliases[alias])
+		}
+		comments = append(comments, wrapList("aliases: ", aliases, headerWidth)...)
+	}
+	comments = append(comments, "run several on one line with `; `, or after a rename with ` | `, like `new.jpg | chmod 644`")
+	comments = append(comments, headerCount(before, opts))
+	if len(opts.flags) > 0 {
+		comments = append(comments, wrapList("flags: ", opts.flags, headerWidth)...)
+	}
+	return comments
+}
+
+// headerCount says how many paths are being edited, and where
+func headerCount(before []string, opts options) string {
+	count := fmt.Sprintf("%d paths", len(before))
+	if len(before) == 1 {
+		count = "1 path"
+	}
+	if dir := vipaths.CommonDir(before); dir != "" && !opts.stripPrefix {
+		if opts.fs == vipaths.OS {
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+		}
+		count += " in " + vipaths.Quote(dir)
+	}
+	return count
+}
+
+// setFlags are the flags given on the command line or set by the config file
+// and environment, as they'd be typed
+func setFlags(fs *flag.FlagSet) []string {
+	var flags []string
+	fs.Visit(func(f *flag.Flag) {
+		// flag.Func values, like repeated ones, don't print themselves
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && f.Value.String() == "true" || f.Value.String() == "" {
+			flags = append(flags, "-"+f.Name)
+			return
+		}
+		flags = append(flags, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+	})
+	return flags
+}
+
+// wrapList joins items after prefix into lines of about width, continuing
+// lines with an indent
+func wrapList(prefix string, items []string, width int) []string {
+	var lines []string
+	line := prefix
+	for i, item := range items {
+		if i < len(items)-1 {
+			item += ","
+		}
+		if len(line) > len(prefix) && len(line)+1+len(item) > width {
+			lines = append(lines, line)
+			line = strings.Repeat(" ", len(prefix)-1)
+		}
+		if !strings.HasSuffix(line, " ") {
+			line += " "
+		}
+		line += item
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// matchHook is a -post-match hook, a shell command run after renames and
+// copies whose destination matches a pattern
+type matchHook struct {
+	pattern string
+	command string
+}
+
+// parseMatchHook parses a hook like `*.go -> goimports -w {dst}`
+func parseMatchHook(s string) (matchHook, error) {
+	pattern, command, ok := strings.Cut(s, "->")
+	pattern, command = strings.TrimSpace(pattern), strings.TrimSpace(command)
+	if !ok || pattern == "" || command == "" {
+		return matchHook{}, fmt.Errorf("expected pattern -> command")
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return matchHook{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return matchHook{pattern: pattern, command: command}, nil
+}
+
+// matches reports whether the hook applies to a destination. patterns with a
+// separator match the whole path, others only its base name
+func (h matchHook) matches(dst string) bool {
+	name := filepath.Base(dst)
+	if strings.ContainsRune(h.pattern, '/') || strings.ContainsRune(h.pattern, filepath.Separator) {
+		name = dst
+	}
+	ok, _ := filepath.Match(h.pattern, name)
+	return ok
+}
+
+// runMatchHooks runs the hooks matching the destination of a rename or copy,
+// in the order they were given
+func runMatchHooks(hooks []matchHook, inst vipaths.Instruction, dryRun bool) error {
+	switch inst.(type) {
+	case vipaths.Rename, vipaths.Copy:
+	default:
+		return nil
+	}
+	src, dst := inst.Paths()
+	for _, h := range hooks {
+		if !h.matches(dst) {
+			continue
+		}
+		if err := runHook(h.command, src, dst, dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
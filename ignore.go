@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile is the name of the files of patterns for paths to leave out of
+// listings, read from the working directory and the config directory
+const ignoreFile = ".viignore"
+
+// ignoreRule is a pattern from an ignore file, in gitignore syntax
+type ignoreRule struct {
+	// segments are the pattern split on slashes, where ** is any number of
+	// them
+	segments []string
+	// anchored patterns match from the working directory, others match at
+	// any depth
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// ignoreRules leave paths out of listings. paths are matched relative to dir,
+// the working directory, and a nil *ignoreRules ignores nothing
+type ignoreRules struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// loadIgnores reads the ignore files in the config directory and the working
+// directory, in that order, so the working directory's can override. it's nil
+// if there are none
+func loadIgnores() (*ignoreRules, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if dir, err := configDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, ignoreFile))
+	}
+	paths = append(paths, filepath.Join(wd, ignoreFile))
+
+	ignores := &ignoreRules{dir: wd}
+	for _, p := range paths {
+		rules, err := readIgnoreFile(p)
+		if err != nil {
+			return nil, err
+		}
+		ignores.rules = append(ignores.rules, rules...)
+	}
+	if len(ignores.rules) == 0 {
+		return nil, nil
+	}
+	return ignores, nil
+}
+
+func readIgnoreFile(p string) ([]ignoreRule, error) {
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", p, err)
+	}
+	defer f.Close()
+	var rules []ignoreRule
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rule, ok := parseIgnoreRule(sc.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", p, err)
+	}
+	return rules, nil
+}
+
+// parseIgnoreRule parses a line of an ignore file. blank lines and comments
+// starting with # are skipped, ! negates a pattern, a trailing / only matches
+// directories, and a / anywhere else anchors the pattern to the directory.
+// \# and \! start a pattern with a literal # or !
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var rule ignoreRule
+	if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+		line = line[1:]
+	}
+	if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+		line = strings.TrimRight(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// match reports whether the rule matches the slash separated segments of a
+// path. anchored rules only match paths inside the working directory
+func (r ignoreRule) match(segments []string, inside, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return inside && matchSegments(r.segments, segments)
+	}
+	return matchSegments(r.segments, segments[len(segments)-1:])
+}
+
+// matchSegments matches path segments against pattern segments, where **
+// matches any number of segments, and other segments are matched by
+// path.Match
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, err := path.Match(pattern[0], segments[0])
+	return ok && err == nil && matchSegments(pattern[1:], segments[1:])
+}
+
+// ignored reports whether p, or any directory it's in, is matched by the
+// rules, the last matching rule winning like in gitignore. as there, a path
+// in an ignored directory can't be negated back in
+func (ig *ignoreRules) ignored(p string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(ig.dir, abs)
+	inside := err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	if !inside {
+		rel = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	}
+	segments := strings.Split(strings.Trim(filepath.ToSlash(rel), "/"), "/")
+	if rel == "." || len(segments) == 0 || segments[0] == "" {
+		return false
+	}
+	for i := 1; i <= len(segments); i++ {
+		dir := i < len(segments) || isDir
+		var matched bool
+		for _, rule := range ig.rules {
+			if rule.match(segments[:i], inside, dir) {
+				matched = !rule.negate
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the paths which aren't ignored
+func (ig *ignoreRules) filter(paths []string) []string {
+	if ig == nil {
+		return paths
+	}
+	var kept []string
+	for _, p := range paths {
+		stat, err := os.Lstat(p)
+		if !ig.ignored(p, err == nil && stat.IsDir()) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// skip is for filepath.WalkDir, skipping ignored paths and not descending
+// into ignored directories
+func (ig *ignoreRules) skip(p string, d fs.DirEntry) (bool, error) {
+	if !ig.ignored(p, d.IsDir()) {
+		return false, nil
+	}
+	if d.IsDir() {
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
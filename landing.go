@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// landingExamples is how many of the entries already in a directory are
+// named when warning about it
+const landingExamples = 3
+
+// checkLanding warns about local directories the plan moves or copies paths
+// into from other directories, which already have entries that weren't in
+// the buffer, and about destinations which are such entries, so paths don't
+// land next to or replace files the user never saw
+func checkLanding(plan vipaths.Plan, listed []string) {
+	landings, replacing := plan.Landings(vipaths.OS, listed)
+	for _, inst := range replacing {
+		src, dst := inst.Paths()
+		log.Printf("%s %s: %s already exists and wasn't listed", vipaths.OpName(inst), vipaths.Quote(src), vipaths.Quote(dst))
+	}
+	for _, l := range landings {
+		if len(l.Existing) == 0 {
+			continue
+		}
+		var examples []string
+		for _, name := range l.Existing[:min(len(l.Existing), landingExamples)] {
+			examples = append(examples, vipaths.Quote(name))
+		}
+		if len(l.Existing) > landingExamples {
+			examples = append(examples, "...")
+		}
+		log.Printf("%d paths will land in %s next to %d existing entries which weren't listed: %s",
+			l.Arrivals, vipaths.Quote(l.Dir), len(l.Existing), strings.Join(examples, ", "))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// lineEditHelp is shown before the built-in editor starts
+const lineEditHelp = "enter keeps a line, text replaces it, :d removes it, :w keeps the rest, :q quits without changes"
+
+// lineEdit is a minimal editor for when no other is available, like in
+// containers or rescue shells. it shows each line of the buffer on the
+// terminal in turn, replacing it with whatever is typed. comments are skipped
+func lineEdit(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("reading buffer: %w", err)
+	}
+	in, out, err := openTTY()
+	if err != nil {
+		return fmt.Errorf("no terminal for the built-in editor: %w", err)
+	}
+	defer in.Close()
+	defer out.Close()
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var total int
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			total++
+		}
+	}
+
+	fmt.Fprintln(out, lineEditHelp)
+	keys := bufio.NewReader(in)
+	var n int
+edit:
+	for i, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		n++
+		fmt.Fprintf(out, "[%d/%d] %s\n> ", n, total, line)
+		input, err := keys.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// ctrl-d keeps the rest, like :w
+			fmt.Fprintln(out)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+		switch input = strings.TrimRight(input, "\r\n"); input {
+		case "":
+		case ":d":
+			lines[i] = "rm"
+		case ":w":
+			break edit
+		case ":q":
+			return nil
+		default:
+			lines[i] = input
+		}
+	}
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("writing buffer: %w", err)
+	}
+	return nil
+}
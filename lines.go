@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// bufferLine is a changed line of the buffer, for errors to point to
+type bufferLine struct {
+	num           int
+	before, after string
+}
+
+func (l bufferLine) String() string {
+	if l.before == "" {
+		return fmt.Sprintf("line %d, %s", l.num, l.after)
+	}
+	return fmt.Sprintf("line %d, %s -> %s", l.num, vipaths.Quote(l.before), l.after)
+}
+
+// bufferLines are the changed lines of the buffer by their original path,
+// joined to any stripped prefix, or by their text for added lines without
+// one, so that errors can say which line to fix
+type bufferLines map[string]bufferLine
+
+func newBufferLines(prefix string, changes vipaths.Changes) bufferLines {
+	lines := bufferLines{}
+	for i, num := range changes.Lines {
+		line := bufferLine{num: num, before: changes.Before[i], after: strings.TrimSpace(changes.After[i])}
+		if line.before == "" {
+			lines[line.after] = line
+			continue
+		}
+		lines[filepath.Join(prefix, line.before)] = line
+	}
+	return lines
+}
+
+// at prefixes err with the line of a cleaned path, or the text of an added
+// line, if there is one
+func (l bufferLines) at(path string, err error) error {
+	if line, ok := l[path]; ok && path != "" {
+		return fmt.Errorf("%s: %w", line, err)
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// readListing reads the paths from a listing written by -list, or any file of
+// one path a line quoted as in the buffer. comments are skipped, and so are
+// any columns after a path, like its attributes or id
+func readListing(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines, err := vipaths.ReadBuffer(f)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range lines {
+		line, _, _ = strings.Cut(line, "\t")
+		if line = strings.TrimRight(line, " "); line == "" {
+			continue
+		}
+		path, err := vipaths.Unquote(line)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errLocked is returned by the platform lockFile when another process holds the lock
+var errLocked = errors.New("locked")
+
+// treeLock is an advisory lock over a directory tree. the root is locked
+// exclusively and each of its ancestors is locked shared, so that sessions over
+// overlapping trees conflict while sessions over sibling trees don't
+type treeLock struct {
+	files []*os.File
+}
+
+// lockTree locks the tree at root, which should be absolute. key distinguishes
+// trees on different remotes
+func lockTree(key, root string) (*treeLock, error) {
+	dir := filepath.Join(os.TempDir(), program+"-locks")
+	if err := os.MkdirAll(dir, 0777|os.ModeSticky); err != nil {
+		return nil, fmt.Errorf("creating lock dir: %w", err)
+	}
+	// let other users lock the same trees
+	_ = os.Chmod(dir, 0777|os.ModeSticky)
+
+	lock := &treeLock{}
+	for path, exclusive := root, true; ; path, exclusive = filepath.Dir(path), false {
+		f, err := openLockFile(dir, key+path)
+		if err != nil {
+			lock.release()
+			return nil, err
+		}
+		if err := lockFile(f, exclusive); err != nil {
+			f.Close()
+			lock.release()
+			if errors.Is(err, errLocked) {
+				return nil, lockConflict(dir, key, root, path, exclusive)
+			}
+			return nil, fmt.Errorf("locking %q: %w", path, err)
+		}
+		lock.files = append(lock.files, f)
+		if exclusive {
+			// the lock is ours, so record who holds it
+			f.Truncate(0)
+			f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+		}
+		if path == filepath.Dir(path) {
+			break
+		}
+	}
+	return lock, nil
+}
+
+func (l *treeLock) release() {
+	if l == nil {
+		return
+	}
+	for i, f := range l.files {
+		if i == 0 {
+			// the root's exclusive lock, so forget its holder
+			f.Truncate(0)
+		}
+		unlockFile(f)
+		f.Close()
+	}
+	l.files = nil
+}
+
+func openLockFile(dir, id string) (*os.File, error) {
+	sum := sha256.Sum256([]byte(id))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:12])+".lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if errors.Is(err, os.ErrPermission) {
+		// created by another user, we can still lock it
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	return f, nil
+}
+
+// lockConflict describes who holds a lock we couldn't take
+func lockConflict(dir, key, root, path string, exclusive bool) error {
+	if exclusive {
+		// either a session over the same root, or over a tree inside it
+		if pid := lockHolder(dir, key+path); pid != "" {
+			return fmt.Errorf("%q is being edited by another %s session (pid %s)", root, program, pid)
+		}
+		return fmt.Errorf("paths under %q are being edited by another %s session", root, program)
+	}
+	// a session over an ancestor of our root
+	pid := lockHolder(dir, key+path)
+	if pid == "" {
+		pid = "unknown"
+	}
+	return fmt.Errorf("%q is inside %q, which is being edited by another %s session (pid %s)", root, path, program, pid)
+}
+
+func lockHolder(dir, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	data, err := os.ReadFile(filepath.Join(dir, hex.EncodeToString(sum[:12])+".lock"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
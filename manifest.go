@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// manifest writes a JSON lines record of each completed operation, for tools
+// like media indexers to update references to moved files
+type manifest struct {
+	f   *os.File
+	enc *json.Encoder
+	fs  vipaths.FS
+}
+
+type manifestEntry struct {
+	Op  string `json:"op"`
+	Src string `json:"src"`
+	Dst string `json:"dst,omitempty"`
+	// SHA256 is the checksum of a copied file
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func openManifest(path string, fsys vipaths.FS) (*manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest: %w", err)
+	}
+	return &manifest{f: f, enc: json.NewEncoder(f), fs: fsys}, nil
+}
+
+// record adds a completed instruction. archives get an entry for each of
+// their sources. a nil manifest records nothing
+func (m *manifest) record(inst vipaths.Instruction) error {
+	if m == nil {
+		return nil
+	}
+	src, dst := inst.Paths()
+	srcs := []string{src}
+	if a, ok := inst.(vipaths.Archive); ok {
+		srcs = a.Names
+	}
+	var sum string
+	if c, ok := inst.(vipaths.Copy); ok && m.fs == vipaths.OS {
+		if stat, err := os.Stat(c.To); err == nil && stat.Mode().IsRegular() {
+			var err error
+			if sum, err = hashFile(c.To); err != nil {
+				return fmt.Errorf("checksum: %w", err)
+			}
+		}
+	}
+	for _, src := range srcs {
+		entry := manifestEntry{Op: vipaths.OpName(inst), Src: m.path(src), Dst: m.path(dst), SHA256: sum}
+		if err := m.enc.Encode(entry); err != nil {
+			return fmt.Errorf("writing manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// path is absolute for local paths, so the manifest doesn't depend on the
+// directory vi-paths was run from
+func (m *manifest) path(path string) string {
+	if path == "" || m.fs != vipaths.OS {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// readManifest reads the operations recorded in a manifest back as a plan, so
+// a run can be inverted after the fact. the entries of an archive are joined
+// back into one operation, though copies lose their checksum
+func readManifest(r io.Reader) (vipaths.Plan, error) {
+	type op struct {
+		Op   string   `json:"op"`
+		Src  string   `json:"src,omitempty"`
+		Srcs []string `json:"srcs,omitempty"`
+		Dst  string   `json:"dst,omitempty"`
+	}
+	ops := []op{}
+	dec := json.NewDecoder(r)
+	for {
+		var entry manifestEntry
+		if err := dec.Decode(&entry); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding manifest: %w", err)
+		}
+		if entry.Op == "archive" {
+			if n := len(ops); n > 0 && ops[n-1].Op == "archive" && ops[n-1].Dst == entry.Dst {
+				ops[n-1].Srcs = append(ops[n-1].Srcs, entry.Src)
+				continue
+			}
+			ops = append(ops, op{Op: entry.Op, Srcs: []string{entry.Src}, Dst: entry.Dst})
+			continue
+		}
+		ops = append(ops, op{Op: entry.Op, Src: entry.Src, Dst: entry.Dst})
+	}
+	raw, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return vipaths.ReadPlan(bytes.NewReader(raw))
+}
+
+func (m *manifest) close() error {
+	if m == nil {
+		return nil
+	}
+	return m.f.Close()
+}
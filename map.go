@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// mapPaths runs a plan from pairs of source and destination arguments without
+// an editor, for scripts. destinations are taken literally, so they're never
+// commands or expanded
+func mapPaths(args []string) error {
+	flags := flag.NewFlagSet("map", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "don't execute any operations, just print")
+	jobs := flags.Int("jobs", 1, "number of copies to run at once")
+	onConflict := flags.String("on-conflict", conflictAsk, "what to do when a destination exists: ask, overwrite, skip, rename, or abort")
+	merge := flags.String("merge", "", "merge directories renamed onto existing ones, with a policy for conflicting files: fail, skip, or overwrite")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 || flags.NArg()%2 != 0 {
+		return fmt.Errorf("usage: %s map [-dry-run] [-jobs n] [-on-conflict resolution] [-merge policy] src dst [src dst ...]", program)
+	}
+	if !validConflict(*onConflict) {
+		return fmt.Errorf("invalid -on-conflict %q, expected ask, overwrite, skip, rename, or abort", *onConflict)
+	}
+	if !validMerge(*merge) {
+		return fmt.Errorf("invalid -merge %q, expected fail, skip, or overwrite", *merge)
+	}
+
+	var before, after []string
+	for i := 0; i < flags.NArg(); i += 2 {
+		src, dst := flags.Arg(i), flags.Arg(i+1)
+		if src == "" || dst == "" {
+			return fmt.Errorf("empty path in pair %d", i/2+1)
+		}
+		before = append(before, src)
+		after = append(after, vipaths.Quote(dst))
+	}
+	plan, err := vipaths.Parse(before, after, vipaths.ParseOptions{
+		Merge: *merge,
+		Taken: func(name string) bool { _, err := os.Stat(name); return err == nil },
+	})
+	if err != nil {
+		return &exitError{exitInvalidPlan, fmt.Errorf("parse instructions: %w", err)}
+	}
+	if err := plan.CheckLengths(); err != nil {
+		return &exitError{exitInvalidPlan, fmt.Errorf("checking lengths:\n%w", err)}
+	}
+	if err := plan.CheckDevices(); err != nil {
+		return &exitError{exitInvalidPlan, fmt.Errorf("checking filesystems:\n%w", err)}
+	}
+	if len(plan) == 0 {
+		return errNothingToDo
+	}
+	return executePlan(plan, nil, options{
+		fs:         vipaths.OS,
+		dryRun:     *dryRun,
+		jobs:       *jobs,
+		onConflict: *onConflict,
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// markComment replaces the usual header with -mark, where nothing is run
+const markComment = "read-only: mark a line needing attention with a leading `!`, any other edits are ignored"
+
+// markedPaths are the paths of the lines marked with a leading `!` for -mark,
+// in buffer order. added lines and other edits are ignored
+func markedPaths(prefix string, changes vipaths.Changes) []string {
+	var marked []string
+	for i, before := range changes.Before {
+		if before == "" || !strings.HasPrefix(strings.TrimSpace(changes.After[i]), "!") {
+			continue
+		}
+		marked = append(marked, filepath.Join(prefix, before))
+	}
+	return marked
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// messagesDir holds the translations installed with vi-paths. packagers can
+// move it with -ldflags "-X main.messagesDir=/usr/local/share/vi-paths/messages"
+var messagesDir = "/usr/share/vi-paths/messages"
+
+// printer formats the messages of the prompts, confirmations, and plan tree
+// in the language of $LC_ALL, $LC_MESSAGES, or $LANG. translations are read
+// from <lang>.json in messagesDir and then $XDG_CONFIG_HOME/vi-paths/messages,
+// so a user's own override the installed ones, as an object of each message's
+// English format to its translation, like
+//
+//	{"run these %d operations? [y/N] ": "diese %d Operationen ausführen? [j/N] ", "yes": "ja"}
+//
+// messages without a translation are printed in English
+var printer = sync.OnceValue(func() *message.Printer {
+	lang := userLanguage("LC_MESSAGES")
+	translations := catalog.NewBuilder(catalog.Fallback(language.English))
+	dirs := []string{messagesDir}
+	if dir, err := configDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "messages"))
+	}
+	// de.json, then de-AT.json for what differs in austria
+	names := []string{lang.String()}
+	if base, _ := lang.Base(); base.String() != lang.String() {
+		names = []string{base.String(), lang.String()}
+	}
+	for _, dir := range dirs {
+		for _, name := range names {
+			if err := loadMessages(translations, lang, filepath.Join(dir, name+".json")); err != nil {
+				log.Printf("loading translations: %v", err)
+			}
+		}
+	}
+	return message.NewPrinter(lang, message.Catalog(translations))
+})
+
+func loadMessages(translations *catalog.Builder, lang language.Tag, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for key, msg := range messages {
+		if err := translations.SetString(lang, key, msg); err != nil {
+			return fmt.Errorf("%s: %q: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// tr formats a user facing message in the user's language
+func tr(format string, args ...any) string {
+	return printer().Sprintf(format, args...)
+}
+
+// answeredYes is whether a line typed at a [y/N] prompt is yes, in English
+// or the user's language
+func answeredYes(line string) bool {
+	line = strings.ToLower(strings.TrimSpace(line))
+	switch line {
+	case "":
+		return false
+	case "y", "yes":
+		return true
+	}
+	// or its first letter, like j for ja
+	yes := []rune(strings.ToLower(tr("yes")))
+	return len(yes) > 0 && (line == string(yes) || line == string(yes[:1]))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// mirrorTrees walks the directory src and returns its files, with the
+// destination side of a pairs line copying each to the same place under dst.
+// files already there with the same size and no older are left out, and
+// directories are made as needed by the copies. ignored paths aren't mirrored
+func mirrorTrees(src, dst string, ignores *ignoreRules) ([]string, map[string]string, error) {
+	var paths []string
+	dsts := map[string]string{}
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != src {
+			if skip, err := ignores.skip(path, d); skip {
+				return err
+			}
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dst, rel)
+		if same, err := sameFile(path, to); err != nil {
+			return err
+		} else if same {
+			return nil
+		}
+		paths = append(paths, path)
+		dsts[path] = "copy " + vipaths.Quote(to)
+		return nil
+	})
+	return paths, dsts, err
+}
+
+// sameFile reports whether to exists with the size of from and was modified
+// no earlier, so is likely already a copy of it. copies don't keep the
+// modification time, so it can't be compared exactly
+func sameFile(from, to string) (bool, error) {
+	toStat, err := os.Lstat(to)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	fromStat, err := os.Lstat(from)
+	if err != nil {
+		return false, err
+	}
+	return toStat.Mode().Type() == fromStat.Mode().Type() && toStat.Size() == fromStat.Size() && !toStat.ModTime().Before(fromStat.ModTime()), nil
+}
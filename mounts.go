@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// otherFilesystem reports whether the local path is on a different filesystem
+// to root, as when it's mounted somewhere inside it. it's false where devices
+// can't be told apart, as on windows
+func otherFilesystem(path, root string) (bool, error) {
+	rootStat, err := os.Stat(root)
+	if err != nil {
+		return false, err
+	}
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	rootDev, ok1 := vipaths.DeviceID(rootStat)
+	dev, ok2 := vipaths.DeviceID(stat)
+	return ok1 && ok2 && dev != rootDev, nil
+}
+
+// oneFilesystem drops the local paths which aren't on the same filesystem as
+// their common directory, like find -xdev
+func oneFilesystem(paths []string) ([]string, error) {
+	abs, err := absPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	root := vipaths.CommonDir(abs)
+	var kept []string
+	for i, path := range paths {
+		other, err := otherFilesystem(abs[i], root)
+		if err != nil {
+			return nil, err
+		}
+		if !other {
+			kept = append(kept, path)
+		}
+	}
+	if skipped := len(paths) - len(kept); skipped > 0 {
+		log.Printf("skipping %d paths on other filesystems to %s", skipped, root)
+	}
+	return kept, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// notifyDone sends a desktop notification that a plan finished or failed, for
+// long plans which run while the user is in another window. problems sending
+// it are only logged, since the plan has already run
+func notifyDone(stats *vipaths.Stats, total int, elapsed time.Duration, err error) {
+	var ops int
+	for _, n := range stats.Counts {
+		ops += n
+	}
+	title := program + " finished"
+	body := fmt.Sprintf("ran %d of %d operations in %s", ops, total, elapsed.Round(time.Second))
+	if err != nil {
+		title = program + " failed"
+		body = fmt.Sprintf("%s: %v", body, err)
+	}
+	if err := notify(title, body); err != nil {
+		log.Printf("sending notification: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// notify sends a desktop notification with osascript on macOS, and
+// notify-send elsewhere
+func notify(title, body string) error {
+	if runtime.GOOS == "darwin" {
+		script := "display notification " + strconv.Quote(body) + " with title " + strconv.Quote(title)
+		return exec.Command("osascript", "-e", script).Run()
+	}
+	return exec.Command("notify-send", "--app-name", program, title, body).Run()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// notifyScript shows a balloon from the notification area, which windows
+// shows as a toast. the title and body are passed in the environment rather
+// than quoted into the script
+const notifyScript = `Add-Type -AssemblyName System.Windows.Forms
+$icon = New-Object System.Windows.Forms.NotifyIcon
+$icon.Icon = [System.Drawing.SystemIcons]::Information
+$icon.Visible = $true
+$icon.ShowBalloonTip(10000, $env:VIPATHS_TITLE, $env:VIPATHS_BODY, 'Info')
+Start-Sleep -Seconds 5
+$icon.Dispose()`
+
+// notify sends a desktop notification with powershell
+func notify(title, body string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", notifyScript)
+	cmd.Env = append(os.Environ(), "VIPATHS_TITLE="+title, "VIPATHS_BODY="+body)
+	return cmd.Start()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// what to do about paths open in other processes, see -check-open
+const (
+	openWarn = "warn"
+	openAsk  = "ask"
+)
+
+var errOpenDeclined = errors.New("paths are open in other processes")
+
+// openFiles finds which of a set of paths are open in other processes,
+// either themselves or, for directories, any file under them
+type openFiles struct {
+	paths map[string]bool
+	// found maps each path open to one process holding it, like "vim (1234)"
+	found map[string]string
+}
+
+func newOpenFiles(paths []string) *openFiles {
+	o := &openFiles{paths: map[string]bool{}, found: map[string]string{}}
+	for _, path := range paths {
+		o.paths[path] = true
+	}
+	return o
+}
+
+// add records that proc has the absolute path open
+func (o *openFiles) add(open, proc string) {
+	for p := filepath.Clean(open); ; p = filepath.Dir(p) {
+		if _, ok := o.found[p]; !ok && o.paths[p] {
+			o.found[p] = proc
+		}
+		if filepath.Dir(p) == p {
+			return
+		}
+	}
+}
+
+// checkOpen looks for the local paths the plan renames or removes being open
+// in other processes, so they aren't pulled out from under a running program.
+// with openWarn they're logged, and with openAsk the user is asked whether to
+// run the plan anyway
+func checkOpen(plan vipaths.Plan, mode string) error {
+	var paths, names []string
+	for _, inst := range plan {
+		var path string
+		switch inst := inst.(type) {
+		case vipaths.Rename:
+			path = inst.Before
+		case vipaths.Remove:
+			path = inst.Name
+		default:
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, abs)
+		names = append(names, path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	open := newOpenFiles(paths)
+	if err := findOpen(open); err != nil {
+		return fmt.Errorf("checking for open files: %w", err)
+	}
+	var busy []string
+	for i, path := range paths {
+		if proc, ok := open.found[path]; ok {
+			busy = append(busy, fmt.Sprintf("%s is open in %s", vipaths.Quote(names[i]), proc))
+		}
+	}
+	if len(busy) == 0 {
+		return nil
+	}
+	if mode == openWarn {
+		for _, line := range busy {
+			log.Printf("warning: %s", line)
+		}
+		return nil
+	}
+	if !askOpen(busy) {
+		return errOpenDeclined
+	}
+	return nil
+}
+
+func askOpen(busy []string) bool {
+	in, out, err := openTTY()
+	if err != nil {
+		return false
+	}
+	defer in.Close()
+	defer out.Close()
+
+	for _, line := range busy {
+		fmt.Fprintf(out, "  %s\n", line)
+	}
+	fmt.Fprint(out, tr("%d paths are open in other processes, run anyway? [y/N] ", len(busy)))
+	line, err := bufio.NewReader(in).ReadString('\n')
+	return err == nil && answeredYes(line)
+}
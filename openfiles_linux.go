@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findOpen reads the file descriptors of every process in /proc. those of
+// other users' processes can't be read without root, so are missed
+func findOpen(open *openFiles) error {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	self := os.Getpid()
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", proc.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+		desc := fmt.Sprintf("%s (%d)", strings.TrimSpace(string(comm)), pid)
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !filepath.IsAbs(target) {
+				// sockets and pipes, like socket:[1234]
+				continue
+			}
+			open.add(strings.TrimSuffix(target, " (deleted)"), desc)
+		}
+	}
+	return nil
+}
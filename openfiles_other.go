@@ -0,0 +1,48 @@
+//go:build !linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// findOpen lists every open file with lsof
+func findOpen(open *openFiles) error {
+	lsof, err := exec.LookPath("lsof")
+	if err != nil {
+		return err
+	}
+	// -F prints a field per line: p for a process, c its command, and n each
+	// file it has open. lsof exits 1 when it can't read some processes
+	out, err := exec.Command(lsof, "-w", "-n", "-P", "-F", "pcn").Output()
+	if err != nil && len(out) == 0 {
+		return err
+	}
+	self := os.Getpid()
+	var pid int
+	var comm string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		switch field, value := line[0], line[1:]; field {
+		case 'p':
+			pid, _ = strconv.Atoi(value)
+		case 'c':
+			comm = value
+		case 'n':
+			if pid != self && filepath.IsAbs(value) {
+				open.add(value, fmt.Sprintf("%s (%d)", comm, pid))
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// ownerInherit is the -dir-owner which copies the owner of each created
+// directory's closest existing ancestor
+const ownerInherit = "inherit"
+
+// parseOwner parses an owner like user or user:group, by name or id. without
+// a group, the user's primary group is used
+func parseOwner(s string) (*vipaths.Owner, error) {
+	name, group, hasGroup := strings.Cut(s, ":")
+	u, err := lookupUser(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric id", name)
+	}
+	gidStr := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(group)
+		if _, numeric := strconv.Atoi(group); numeric == nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return nil, err
+		}
+		gidStr = g.Gid
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return nil, fmt.Errorf("group of %q has no numeric id", s)
+	}
+	return &vipaths.Owner{UID: uid, GID: gid}, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
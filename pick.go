@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pickPaths shows a fuzzy filter over the paths, so only a few of many can be
+// chosen for editing. tab marks paths and enter returns the marked ones, or
+// every path matching the query if none are marked
+func pickPaths(paths []string) ([]string, error) {
+	t, err := openTerminal()
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	marked := make([]bool, len(paths))
+	var query string
+	var cursor, top int
+	for {
+		matches := fuzzyFilter(query, paths)
+		cursor = min(cursor, max(len(matches)-1, 0))
+
+		// prompt, header, list
+		listHeight := max(t.height()-2, 1)
+		if cursor < top {
+			top = cursor
+		}
+		if cursor >= top+listHeight {
+			top = cursor - listHeight + 1
+		}
+		drawPick(t.out, paths, matches, marked, query, cursor, top, listHeight)
+
+		key, err := readKey(t.keys)
+		if err != nil {
+			return nil, fmt.Errorf("reading key: %w", err)
+		}
+		switch key {
+		case "\x0e", "\x1b[B": // ctrl-n, down
+			cursor = min(cursor+1, max(len(matches)-1, 0))
+		case "\x10", "\x1b[A": // ctrl-p, up
+			cursor = max(cursor-1, 0)
+		case "\t":
+			if len(matches) > 0 {
+				marked[matches[cursor]] = !marked[matches[cursor]]
+				cursor = min(cursor+1, len(matches)-1)
+			}
+		case "\x01": // ctrl-a
+			for _, i := range matches {
+				marked[i] = true
+			}
+		case "\x7f", "\x08": // backspace
+			if query != "" {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+			}
+		case "\x15": // ctrl-u
+			query = ""
+		case "\r", "\n":
+			var picked []string
+			for i, path := range paths {
+				if marked[i] {
+					picked = append(picked, path)
+				}
+			}
+			if picked == nil {
+				for _, i := range matches {
+					picked = append(picked, paths[i])
+				}
+			}
+			return picked, nil
+		case "\x1b", "\x03":
+			return nil, errAborted
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); len(key) > 0 && unicode.IsPrint(r) {
+				query += key
+				cursor, top = 0, 0
+			}
+		}
+	}
+}
+
+func drawPick(out *os.File, paths []string, matches []int, marked []bool, query string, cursor, top, listHeight int) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	nmarked := 0
+	for _, m := range marked {
+		if m {
+			nmarked++
+		}
+	}
+	fmt.Fprintf(&b, "> %s\r\n", query)
+	fmt.Fprintf(&b, "  %d/%d, %d marked. tab mark, ctrl-a mark all, enter edit, esc quit\r\n", len(matches), len(paths), nmarked)
+	for i := top; i < len(matches) && i < top+listHeight; i++ {
+		mark := "  "
+		if marked[matches[i]] {
+			mark = "* "
+		}
+		line := mark + oneLinePath(paths[matches[i]])
+		if i == cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString(line + "\r\n")
+	}
+	out.WriteString(b.String())
+}
+
+// oneLinePath keeps control characters in a path from breaking the list
+func oneLinePath(path string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, path)
+}
+
+// fuzzyFilter returns the indexes of the paths which contain the query as a
+// subsequence, best matches first. matching ignores case unless the query
+// has upper case letters
+func fuzzyFilter(query string, paths []string) []int {
+	ignoreCase := strings.ToLower(query) == query
+	type match struct{ index, score int }
+	var matches []match
+	for i, path := range paths {
+		if ignoreCase {
+			path = strings.ToLower(path)
+		}
+		if score, ok := fuzzyScore(query, path); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int {
+		return b.score - a.score
+	})
+	indexes := make([]int, len(matches))
+	for i, m := range matches {
+		indexes[i] = m.index
+	}
+	return indexes
+}
+
+// fuzzyScore matches query as a subsequence of s, scoring consecutive
+// characters and characters at the start of path segments and words higher
+func fuzzyScore(query, s string) (int, bool) {
+	var score int
+	prev, last := rune(0), -2
+	qi := 0
+	q := []rune(query)
+	for si, r := range []rune(s) {
+		if qi < len(q) && r == q[qi] {
+			score++
+			if last == si-1 {
+				score += 2
+			}
+			if si == 0 || strings.ContainsRune("/\\_-. ", prev) {
+				score += 3
+			}
+			last = si
+			qi++
+		}
+		prev = r
+	}
+	return score, qi == len(q)
+}
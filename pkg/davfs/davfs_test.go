@@ -0,0 +1,244 @@
+package davfs
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDAV is a WebDAV server with just enough of the protocol for FS. paths
+// ending in a slash are collections
+type fakeDAV struct {
+	mu    sync.Mutex
+	files map[string]string
+	// vanish is a collection which stats, but is gone when it's listed
+	vanish string
+}
+
+func (s *fakeDAV) exists(name string) (string, bool) {
+	if _, ok := s.files[name]; ok {
+		return name, true
+	}
+	if _, ok := s.files[name+"/"]; ok {
+		return name + "/", true
+	}
+	return "", false
+}
+
+func (s *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimSuffix(r.URL.Path, "/")
+	if name == "" {
+		name = "/"
+	}
+	switch r.Method {
+	case "PROPFIND":
+		s.propfind(w, r, name)
+	case "MOVE", "COPY":
+		dest, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil || dest.Host != r.Host {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		key, ok := s.exists(name)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, ok := s.exists(path.Dir(dest.Path)); !ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		for k, v := range maps.Clone(s.files) {
+			if k == key || strings.HasPrefix(k, key) && strings.HasSuffix(key, "/") {
+				s.files[dest.Path+strings.TrimPrefix(k, name)] = v
+				if r.Method == "MOVE" {
+					delete(s.files, k)
+				}
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		key, ok := s.exists(name)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k := range maps.Clone(s.files) {
+			if k == key || strings.HasPrefix(k, name+"/") {
+				delete(s.files, k)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "MKCOL":
+		if _, ok := s.exists(name); ok {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := s.exists(path.Dir(name)); !ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.files[name+"/"] = ""
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeDAV) propfind(w http.ResponseWriter, r *http.Request, name string) {
+	key, ok := s.exists(name)
+	if !ok || r.Header.Get("Depth") == "1" && name == s.vanish {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	keys := []string{key}
+	if r.Header.Get("Depth") == "1" && strings.HasSuffix(key, "/") {
+		prefix := strings.TrimSuffix(key, "/") + "/"
+		for _, k := range slices.Sorted(maps.Keys(s.files)) {
+			if rest, ok := strings.CutPrefix(k, prefix); ok && rest != "" && !strings.Contains(strings.TrimSuffix(rest, "/"), "/") {
+				keys = append(keys, k)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+	for _, k := range keys {
+		var props string
+		if strings.HasSuffix(k, "/") {
+			props = "<d:resourcetype><d:collection/></d:resourcetype>"
+		} else {
+			props = fmt.Sprintf("<d:resourcetype/><d:getcontentlength>%d</d:getcontentlength><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified>", len(s.files[k]))
+		}
+		href := (&url.URL{Path: k}).EscapedPath()
+		fmt.Fprintf(w, "<d:response><d:href>%s</d:href><d:propstat><d:prop>%s</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>", escapeXML(href), props)
+	}
+	fmt.Fprint(w, "</d:multistatus>")
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func newFake(t *testing.T, files map[string]string) (*FS, *fakeDAV) {
+	t.Helper()
+	fake := &fakeDAV{files: files}
+	fake.files["/"] = ""
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := New(&url.URL{Scheme: "dav", Host: u.Host, User: url.UserPassword("user", "pass")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys, fake
+}
+
+func TestNew(t *testing.T) {
+	for scheme, want := range map[string]string{"dav": "http", "davs": "https"} {
+		fsys, err := New(&url.URL{Scheme: scheme, Host: "host"})
+		if err != nil || fsys.base.Scheme != want {
+			t.Errorf("New(%s://) = %v, %v, want %s", scheme, fsys, err, want)
+		}
+	}
+	if _, err := New(&url.URL{Scheme: "http", Host: "host"}); err == nil {
+		t.Error("New of an http URL succeeded")
+	}
+}
+
+func TestStat(t *testing.T) {
+	fsys, _ := newFake(t, map[string]string{"/dir/": "", "/dir/a b.txt": "abc"})
+	stat, err := fsys.Stat("/dir/a b.txt")
+	if err != nil || stat.IsDir() || stat.Size() != 3 || stat.Name() != "a b.txt" || stat.ModTime().Year() != 2006 {
+		t.Errorf("Stat of a file = %+v, %v", stat, err)
+	}
+	if stat, err := fsys.Stat("/dir"); err != nil || !stat.IsDir() || stat.Name() != "dir" {
+		t.Errorf("Stat of a collection = %+v, %v", stat, err)
+	}
+	if _, err := fsys.Stat("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing path = %v, want not exist", err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	fsys, fake := newFake(t, map[string]string{"/dir/": "", "/dir/a": "a", "/b": "b"})
+	if err := fsys.MkdirAll("/new/sub", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := fsys.MkdirAll("/new/sub", 0755); err != nil {
+		t.Fatalf("MkdirAll of existing collections: %v", err)
+	}
+	if err := fsys.Rename("/dir/a", "/new/sub/a"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := fsys.Copy("/b", "/new/b"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if err := fsys.RemoveAll("/dir"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if err := fsys.RemoveAll("/dir"); err != nil {
+		t.Fatalf("RemoveAll of a missing path: %v", err)
+	}
+	want := map[string]string{"/": "", "/b": "b", "/new/": "", "/new/sub/": "", "/new/sub/a": "a", "/new/b": "b"}
+	if !maps.Equal(fake.files, want) {
+		t.Errorf("files = %v, want %v", fake.files, want)
+	}
+	if err := fsys.Rename("/missing", "/b"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Rename of a missing path = %v, want its status", err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	fsys, fake := newFake(t, map[string]string{
+		"/photos/":        "",
+		"/photos/a.jpg":   "",
+		"/photos/b.png":   "",
+		"/photos/c/":      "",
+		"/photos/c/d.jpg": "",
+		"/gone/":          "",
+		"/gone/e.jpg":     "",
+	})
+	fake.vanish = "/gone"
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/photos/*.jpg", []string{"/photos/a.jpg"}},
+		{"/photos/*/*.jpg", []string{"/photos/c/d.jpg"}},
+		{"/photos/b.png", []string{"/photos/b.png"}},
+		{"/missing/*", nil},
+		// removed between stat and listing, so nothing matches
+		{"/gone/*", nil},
+	}
+	for _, tt := range tests {
+		got, err := fsys.Glob(tt.pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Glob(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package dockerfs is a vipaths.FS for the files inside a running docker or
+// podman container, by running shell tools in it with exec.
+package dockerfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// FS is a vipaths.FS for a single container. The container needs a POSIX sh
+// and the usual mv, cp, rm, mkdir, chmod, and stat, which busybox has
+type FS struct {
+	container string
+	bin       string
+}
+
+var _ vipaths.FS = (*FS)(nil)
+
+// New returns an FS for a running container, by name or id. engine is the
+// command to exec with, docker or podman
+func New(engine, container string) (*FS, error) {
+	bin, err := exec.LookPath(engine)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in $PATH", engine)
+	}
+	f := &FS{container: container, bin: bin}
+	if _, err := f.run("true"); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// exitNotFound is the exit code of scripts for a path which doesn't exist
+const exitNotFound = 44
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	out, err := f.script(`[ -e "$1" ] || exit 44; stat -L -c '%f %s %Y' -- "$1"`, name)
+	if isNotFound(err) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rawMode string
+	var size, mtime int64
+	if _, err := fmt.Sscan(string(out), &rawMode, &size, &mtime); err != nil {
+		return nil, fmt.Errorf("parsing stat of %q: %w", name, err)
+	}
+	mode, err := strconv.ParseUint(rawMode, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parsing mode of %q: %w", name, err)
+	}
+	return info{name: path.Base(name), size: size, mtime: time.Unix(mtime, 0), mode: uint32(mode)}, nil
+}
+
+// Rename moves oldname to newname, replacing a file or empty directory there
+// like rename(2) rather than moving into it like mv
+func (f *FS) Rename(oldname, newname string) error {
+	_, err := f.script(`if [ -d "$2" ] && [ ! -L "$2" ]; then rmdir -- "$2" || exit; fi; mv -f -- "$1" "$2"`, oldname, newname)
+	return err
+}
+
+func (f *FS) Copy(from, to string) error {
+	_, err := f.script(`cp -p -- "$1" "$2"`, from, to)
+	return err
+}
+
+func (f *FS) RemoveAll(name string) error {
+	_, err := f.script(`rm -rf -- "$1"`, name)
+	return err
+}
+
+// MkdirAll creates name and its parents, with modes from the container's umask
+func (f *FS) MkdirAll(name string, _ fs.FileMode) error {
+	_, err := f.script(`mkdir -p -- "$1"`, name)
+	return err
+}
+
+func (f *FS) Chmod(name string, mode fs.FileMode) error {
+	_, err := f.script(`chmod "$2" -- "$1"`, name, fmt.Sprintf("%o", mode.Perm()))
+	return err
+}
+
+// Glob expands pattern with the container's shell
+func (f *FS) Glob(pattern string) ([]string, error) {
+	out, err := f.script(`IFS=; for p in $1; do [ -e "$p" ] || [ -L "$p" ] && printf '%s\0' "$p"; done; true`, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for match := range strings.SplitSeq(string(out), "\x00") {
+		if match != "" {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+// script runs a sh script in the container, with args as $1 and on
+func (f *FS) script(script string, args ...string) ([]byte, error) {
+	return f.run(append([]string{"sh", "-c", script, "sh"}, args...)...)
+}
+
+func (f *FS) run(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(f.bin, append([]string{"exec", f.container}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &runError{container: f.container, stderr: strings.TrimSpace(stderr.String()), err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+type runError struct {
+	container string
+	stderr    string
+	err       error
+}
+
+func (e *runError) Error() string {
+	return fmt.Sprintf("exec in %s: %v: %s", e.container, e.err, e.stderr)
+}
+func (e *runError) Unwrap() error { return e.err }
+
+func isNotFound(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == exitNotFound
+}
+
+// info is a file's stat, with mode in the raw st_mode format of stat %f
+type info struct {
+	name  string
+	size  int64
+	mtime time.Time
+	mode  uint32
+}
+
+// the file type bits of st_mode
+const (
+	typeMask    = 0o170000
+	typeDir     = 0o040000
+	typeSymlink = 0o120000
+)
+
+func (i info) Name() string       { return i.name }
+func (i info) Size() int64        { return i.size }
+func (i info) ModTime() time.Time { return i.mtime }
+func (i info) IsDir() bool        { return i.mode&typeMask == typeDir }
+func (i info) Sys() any           { return nil }
+func (i info) Mode() fs.FileMode {
+	mode := fs.FileMode(i.mode & 0o777)
+	switch i.mode & typeMask {
+	case typeDir:
+		mode |= fs.ModeDir
+	case typeSymlink:
+		mode |= fs.ModeSymlink
+	}
+	return mode
+}
@@ -0,0 +1,152 @@
+package dockerfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMain runs fakeDocker instead of the tests in the copies of the test
+// binary FS runs as docker
+func TestMain(m *testing.M) {
+	if container := os.Getenv("FAKE_DOCKER_CONTAINER"); container != "" {
+		os.Exit(fakeDocker(container, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeDocker runs docker exec for a container which is the local machine
+func fakeDocker(container string, args []string) int {
+	if len(args) < 3 || args[0] != "exec" {
+		fmt.Fprintf(os.Stderr, "unknown command %q", args)
+		return 1
+	}
+	if args[1] != container {
+		fmt.Fprintf(os.Stderr, "Error response from daemon: No such container: %s", args[1])
+		return 1
+	}
+	cmd := exec.Command(args[2], args[3:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		fmt.Fprint(os.Stderr, err)
+		return 127
+	}
+	return 0
+}
+
+// newLocal returns an FS for a fake container, which runs the scripts on the
+// local machine
+func newLocal(t *testing.T) *FS {
+	t.Helper()
+	// the scripts need sh and GNU stat
+	if runtime.GOOS != "linux" {
+		t.Skip("needs a linux userland")
+	}
+	t.Setenv("FAKE_DOCKER_CONTAINER", "box")
+	fsys, err := New(os.Args[0], "box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+func TestNew(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs a linux userland")
+	}
+	t.Setenv("FAKE_DOCKER_CONTAINER", "box")
+	if _, err := New(os.Args[0], "other"); err == nil || !strings.Contains(err.Error(), "No such container") {
+		t.Errorf("New of a missing container = %v, want the daemon's error", err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	fsys := newLocal(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/a b", []byte("abc"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := fsys.Stat(dir + "/a b")
+	if err != nil || stat.IsDir() || stat.Size() != 3 || stat.Name() != "a b" || stat.Mode() != 0640 {
+		t.Errorf("Stat = %+v, %v, want a file of 3 bytes", stat, err)
+	}
+	if _, err := fsys.Stat(dir + "/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing path = %v, want not exist", err)
+	}
+	if err := fsys.MkdirAll(dir+"/new/sub", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if stat, err := fsys.Stat(dir + "/new"); err != nil || !stat.IsDir() {
+		t.Errorf("Stat of a directory = %+v, %v", stat, err)
+	}
+	if err := fsys.Copy(dir+"/a b", dir+"/new/c"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if err := fsys.Chmod(dir+"/new/c", 0600); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	if stat, err := os.Stat(dir + "/new/c"); err != nil || stat.Mode() != 0600 {
+		t.Errorf("copy = %v, %v, want mode 0600", stat, err)
+	}
+	// replaces an empty directory, like rename(2), rather than moving into it
+	if err := fsys.Rename(dir+"/a b", dir+"/new/sub"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if data, err := os.ReadFile(dir + "/new/sub"); err != nil || string(data) != "abc" {
+		t.Errorf("renamed file has %q, %v", data, err)
+	}
+	// but not a full one
+	if err := fsys.Rename(dir+"/new/c", dir+"/new"); err == nil {
+		t.Errorf("Rename onto a non-empty directory succeeded")
+	}
+	if err := fsys.RemoveAll(dir + "/new"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("left %v, %v, want nothing", entries, err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	fsys := newLocal(t)
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b c.jpg", "d.png", "*.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("missing", dir+"/broken.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{dir + "/*.jpg", []string{dir + "/*.jpg", dir + "/a.jpg", dir + "/b c.jpg", dir + "/broken.jpg"}},
+		{dir + "/b c.jpg", []string{dir + "/b c.jpg"}},
+		{dir + "/*.gif", nil},
+		{dir + "/missing/*", nil},
+	}
+	for _, tt := range tests {
+		got, err := fsys.Glob(tt.pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Glob(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package rclonefs is a vipaths.FS for any rclone remote, like gdrive: or
+// dropbox:, by running the rclone command.
+package rclonefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// FS is an rclone backed vipaths.FS for a single configured remote
+type FS struct {
+	remote string
+	bin    string
+}
+
+var _ vipaths.FS = (*FS)(nil)
+
+// New returns an FS for a remote from the user's rclone config, named without
+// the trailing colon
+func New(remote string) (*FS, error) {
+	bin, err := exec.LookPath("rclone")
+	if err != nil {
+		return nil, fmt.Errorf("rclone not found in $PATH")
+	}
+	return &FS{remote: remote, bin: bin}, nil
+}
+
+// rclone's exit codes for missing directories and files
+const (
+	exitDirNotFound  = 3
+	exitFileNotFound = 4
+)
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	out, err := f.run("lsjson", "--stat", f.path(name))
+	if isNotFound(err) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry entry
+	if err := json.Unmarshal(out, &entry); err != nil {
+		return nil, fmt.Errorf("decoding stat: %w", err)
+	}
+	return entry, nil
+}
+
+func (f *FS) Rename(oldname, newname string) error {
+	_, err := f.run("moveto", f.path(oldname), f.path(newname))
+	return err
+}
+
+func (f *FS) Copy(from, to string) error {
+	_, err := f.run("copyto", f.path(from), f.path(to))
+	return err
+}
+
+func (f *FS) RemoveAll(name string) error {
+	stat, err := f.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		_, err = f.run("purge", f.path(name))
+		return err
+	}
+	_, err = f.run("deletefile", f.path(name))
+	return err
+}
+
+// MkdirAll creates name and its parents. Modes aren't supported by rclone
+func (f *FS) MkdirAll(name string, _ fs.FileMode) error {
+	_, err := f.run("mkdir", f.path(name))
+	return err
+}
+
+// Glob expands wildcards in each segment of pattern by listing directories
+func (f *FS) Glob(pattern string) ([]string, error) {
+	matches := []string{""}
+	for _, segment := range strings.Split(strings.Trim(path.Clean(pattern), "/"), "/") {
+		var next []string
+		for _, dir := range matches {
+			if !strings.ContainsAny(segment, `*?[\`) {
+				candidate := path.Join(dir, segment)
+				if _, err := f.Stat(candidate); err == nil {
+					next = append(next, candidate)
+				}
+				continue
+			}
+			out, err := f.run("lsjson", f.path(dir))
+			// a file, or removed since it matched
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			var entries []entry
+			if err := json.Unmarshal(out, &entries); err != nil {
+				return nil, fmt.Errorf("decoding list: %w", err)
+			}
+			for _, entry := range entries {
+				if ok, _ := path.Match(segment, entry.EntryName); ok {
+					next = append(next, path.Join(dir, entry.EntryName))
+				}
+			}
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+func (f *FS) path(name string) string {
+	return f.remote + ":" + strings.TrimPrefix(name, "/")
+}
+
+func (f *FS) run(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(f.bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &runError{args: args, stderr: strings.TrimSpace(stderr.String()), err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+type runError struct {
+	args   []string
+	stderr string
+	err    error
+}
+
+func (e *runError) Error() string {
+	return fmt.Sprintf("rclone %s: %v: %s", strings.Join(e.args, " "), e.err, e.stderr)
+}
+func (e *runError) Unwrap() error { return e.err }
+
+func isNotFound(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	code := exitErr.ExitCode()
+	return code == exitDirNotFound || code == exitFileNotFound
+}
+
+type entry struct {
+	EntryName  string    `json:"Name"`
+	EntrySize  int64     `json:"Size"`
+	EntryTime  time.Time `json:"ModTime"`
+	EntryIsDir bool      `json:"IsDir"`
+}
+
+func (e entry) Name() string       { return e.EntryName }
+func (e entry) Size() int64        { return e.EntrySize }
+func (e entry) ModTime() time.Time { return e.EntryTime }
+func (e entry) IsDir() bool        { return e.EntryIsDir }
+func (e entry) Sys() any           { return nil }
+func (e entry) Mode() fs.FileMode {
+	if e.EntryIsDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,187 @@
+package rclonefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestMain runs fakeRclone instead of the tests in the copies of the test
+// binary FS runs as rclone
+func TestMain(m *testing.M) {
+	if root := os.Getenv("FAKE_RCLONE_ROOT"); root != "" {
+		os.Exit(fakeRclone(root, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeRclone runs the rclone commands FS uses on the remote "fake:", whose
+// paths are under root on the local disk
+func fakeRclone(root string, args []string) int {
+	if len(args) == 0 {
+		return 1
+	}
+	cmd, args := args[0], args[1:]
+	if cmd == "lsjson" && len(args) > 0 && args[0] == "--stat" {
+		cmd, args = "stat", args[1:]
+	}
+	var paths []string
+	for _, arg := range args {
+		rel, ok := strings.CutPrefix(arg, "fake:")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "didn't find section in config file (%q)", arg)
+			return 1
+		}
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(rel)))
+	}
+	toEntry := func(stat fs.FileInfo) entry {
+		return entry{EntryName: stat.Name(), EntrySize: stat.Size(), EntryTime: stat.ModTime(), EntryIsDir: stat.IsDir()}
+	}
+	var err error
+	switch cmd {
+	case "stat":
+		var stat fs.FileInfo
+		if stat, err = os.Stat(paths[0]); err == nil {
+			err = json.NewEncoder(os.Stdout).Encode(toEntry(stat))
+		}
+	case "lsjson":
+		var dirEntries []fs.DirEntry
+		if dirEntries, err = os.ReadDir(paths[0]); err == nil {
+			entries := []entry{}
+			for _, d := range dirEntries {
+				stat, _ := d.Info()
+				entries = append(entries, toEntry(stat))
+			}
+			err = json.NewEncoder(os.Stdout).Encode(entries)
+		}
+	case "moveto":
+		if err = os.MkdirAll(filepath.Dir(paths[1]), 0755); err == nil {
+			err = os.Rename(paths[0], paths[1])
+		}
+	case "copyto":
+		var data []byte
+		if data, err = os.ReadFile(paths[0]); err == nil {
+			err = os.WriteFile(paths[1], data, 0644)
+		}
+	case "purge":
+		if _, err = os.Stat(paths[0]); err == nil {
+			err = os.RemoveAll(paths[0])
+		}
+	case "deletefile":
+		err = os.Remove(paths[0])
+	case "mkdir":
+		err = os.MkdirAll(paths[0], 0755)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		fmt.Fprint(os.Stderr, "directory not found")
+		return exitDirNotFound
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func newFake(t *testing.T) (*FS, string) {
+	t.Helper()
+	root := t.TempDir()
+	t.Setenv("FAKE_RCLONE_ROOT", root)
+	return &FS{remote: "fake", bin: os.Args[0]}, root
+}
+
+func TestOperations(t *testing.T) {
+	fsys, root := newFake(t)
+	if err := os.WriteFile(filepath.Join(root, "a b.txt"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := fsys.Stat("/a b.txt")
+	if err != nil || stat.IsDir() || stat.Size() != 3 || stat.Name() != "a b.txt" {
+		t.Errorf("Stat = %+v, %v, want a file of 3 bytes", stat, err)
+	}
+	if _, err := fsys.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing path = %v, want not exist", err)
+	}
+	if err := fsys.MkdirAll("dir/sub", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if stat, err := fsys.Stat("dir"); err != nil || !stat.IsDir() {
+		t.Errorf("Stat of a directory = %+v, %v", stat, err)
+	}
+	if err := fsys.Copy("a b.txt", "dir/sub/copy.txt"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if err := fsys.Rename("a b.txt", "moved/a.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := fsys.RemoveAll("moved/a.txt"); err != nil {
+		t.Fatalf("RemoveAll of a file: %v", err)
+	}
+	if err := fsys.RemoveAll("dir"); err != nil {
+		t.Fatalf("RemoveAll of a directory: %v", err)
+	}
+	if err := fsys.RemoveAll("dir"); err != nil {
+		t.Fatalf("RemoveAll of a missing path: %v", err)
+	}
+	var left []string
+	filepath.WalkDir(root, func(path string, _ fs.DirEntry, _ error) error {
+		rel, _ := filepath.Rel(root, path)
+		left = append(left, filepath.ToSlash(rel))
+		return nil
+	})
+	if want := []string{".", "moved"}; !slices.Equal(left, want) {
+		t.Errorf("left %q, want %q", left, want)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	fsys, _ := newFake(t)
+	fsys.remote = "other"
+	err := fsys.Copy("a", "b")
+	var runErr *runError
+	if !errors.As(err, &runErr) || !strings.Contains(err.Error(), "rclone copyto other:a other:b") || !strings.Contains(err.Error(), "didn't find section") {
+		t.Errorf("Copy = %v, want the command and its stderr", err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	fsys, root := newFake(t)
+	for _, name := range []string{"photos/a.jpg", "photos/b.png", "photos/c/d.jpg"} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/photos/*.jpg", []string{"photos/a.jpg"}},
+		{"photos/*/*.jpg", []string{"photos/c/d.jpg"}},
+		{"photos/b.png", []string{"photos/b.png"}},
+		{"missing/*", nil},
+	}
+	for _, tt := range tests {
+		got, err := fsys.Glob(tt.pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Glob(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
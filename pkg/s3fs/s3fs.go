@@ -0,0 +1,324 @@
+// Package s3fs is a vipaths.FS for object keys in an S3 bucket. Renames become
+// CopyObject and DeleteObject calls, and directories are key prefixes.
+package s3fs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// FS is an S3 backed vipaths.FS for a single bucket
+type FS struct {
+	bucket   string
+	endpoint *url.URL
+	// pathStyle puts the bucket in the path rather than the host, for S3 compatible endpoints
+	pathStyle bool
+	creds     credentials
+	client    *http.Client
+}
+
+var _ vipaths.FS = (*FS)(nil)
+
+type credentials struct {
+	accessKey, secretKey, sessionToken string
+	region                             string
+}
+
+// New returns an FS for bucket using the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, and AWS_REGION environment variables.
+// AWS_ENDPOINT_URL may be set to use an S3 compatible service
+func New(bucket string) (*FS, error) {
+	creds := credentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region:       firstNonEmpty(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	f := &FS{bucket: bucket, creds: creds, client: http.DefaultClient}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parsing endpoint: %w", err)
+		}
+		f.endpoint, f.pathStyle = u, true
+	} else {
+		f.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, creds.region)}
+	}
+	return f, nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	key := toKey(name)
+	resp, err := f.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return info{name: path.Base(key), size: resp.ContentLength, modTime: modTime}, nil
+	case http.StatusNotFound:
+	default:
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fmt.Errorf("status %s", resp.Status)}
+	}
+
+	// no object, but it may be a prefix with keys under it
+	objects, err := f.list(dirPrefix(key), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return info{name: path.Base(key), dir: true}, nil
+}
+
+// Rename copies every object at or under oldname, then deletes the originals
+// once all of them are copied, so a failure part way through leaves them all
+// where they were. Copies made before the failure are deleted again
+func (f *FS) Rename(oldname, newname string) error {
+	keys, err := f.keys(oldname)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		dest := toKey(newname) + strings.TrimPrefix(key, toKey(oldname))
+		if err := f.copyObject(key, dest); err != nil {
+			for _, key := range keys[:i] {
+				f.deleteObject(toKey(newname) + strings.TrimPrefix(key, toKey(oldname)))
+			}
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := f.deleteObject(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FS) RemoveAll(name string) error {
+	keys, err := f.keys(name)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := f.deleteObject(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FS) Copy(from, to string) error {
+	return f.copyObject(toKey(from), toKey(to))
+}
+
+// MkdirAll does nothing, since S3 has no directories
+func (f *FS) MkdirAll(string, fs.FileMode) error { return nil }
+
+// Glob lists keys matching pattern. A pattern with no wildcards lists every
+// key under it as a prefix
+func (f *FS) Glob(pattern string) ([]string, error) {
+	pattern = toKey(pattern)
+	meta := strings.IndexAny(pattern, `*?[\`)
+	if meta < 0 {
+		objects, err := f.list(pattern, 0)
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+		return keys, nil
+	}
+
+	objects, err := f.list(pattern[:meta], 0)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, obj := range objects {
+		if ok, _ := path.Match(pattern, obj.Key); ok {
+			keys = append(keys, obj.Key)
+		}
+	}
+	return keys, nil
+}
+
+// keys returns the object name, and every object under the prefix name/
+func (f *FS) keys(name string) ([]string, error) {
+	key := toKey(name)
+	objects, err := f.list(dirPrefix(key), 0)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	// a prefix stats as a directory, only an object at name itself is a key
+	if stat, err := f.Stat(key); err == nil && !stat.IsDir() {
+		keys = append(keys, key)
+	}
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	if len(keys) == 0 {
+		return nil, &fs.PathError{Op: "list", Path: name, Err: fs.ErrNotExist}
+	}
+	return keys, nil
+}
+
+type object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// list returns objects with keys starting with prefix, up to limit if it's not 0
+func (f *FS) list(prefix string, limit int) ([]object, error) {
+	var objects []object
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		if limit > 0 {
+			query.Set("max-keys", fmt.Sprint(limit))
+		}
+		resp, err := f.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp, "list"); err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents              []object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding list: %w", err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || (limit > 0 && len(objects) >= limit) {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// copyObject copies within the bucket. objects over 5GB are not supported
+func (f *FS) copyObject(from, to string) error {
+	source := "/" + f.bucket + "/" + escapePath(from)
+	resp, err := f.do(http.MethodPut, to, nil, http.Header{"X-Amz-Copy-Source": {source}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp, "copy "+from)
+}
+
+func (f *FS) deleteObject(key string) error {
+	resp, err := f.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp, "delete "+key)
+}
+
+func (f *FS) do(method, key string, query url.Values, header http.Header) (*http.Response, error) {
+	u := *f.endpoint
+	if f.pathStyle {
+		u.Path = "/" + f.bucket + "/" + key
+	} else {
+		u.Path = "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sign(req, f.creds, time.Now())
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+func checkStatus(resp *http.Response, op string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		return fmt.Errorf("%s: %s: %s", op, s3err.Code, s3err.Message)
+	}
+	return fmt.Errorf("%s: status %s", op, resp.Status)
+}
+
+func toKey(name string) string { return strings.TrimPrefix(name, "/") }
+
+func dirPrefix(key string) string {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return key
+	}
+	return key + "/"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type info struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i info) Name() string       { return i.name }
+func (i info) Size() int64        { return i.size }
+func (i info) ModTime() time.Time { return i.modTime }
+func (i info) IsDir() bool        { return i.dir }
+func (i info) Sys() any           { return nil }
+func (i info) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
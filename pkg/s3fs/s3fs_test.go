@@ -0,0 +1,160 @@
+package s3fs
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is a path style bucket with just enough of the API for FS
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]string
+	// failCopy is a destination key whose copy fails
+	failCopy string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.bucket+"/")
+	if !ok {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case http.MethodGet:
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []object `xml:"Contents"`
+		}
+		prefix := r.URL.Query().Get("prefix")
+		for _, k := range slices.Sorted(maps.Keys(s.objects)) {
+			if strings.HasPrefix(k, prefix) {
+				result.Contents = append(result.Contents, object{Key: k, Size: int64(len(s.objects[k]))})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	case http.MethodPut:
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		data, ok := s.objects[strings.TrimPrefix(source, "/"+s.bucket+"/")]
+		switch {
+		case key == s.failCopy:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("<Error><Code>InternalError</Code><Message>try again</Message></Error>"))
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>no such key</Message></Error>"))
+		default:
+			s.objects[key] = data
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFake(t *testing.T, objects map[string]string) (*FS, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{bucket: "bucket", objects: objects}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	fsys, err := New("bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys, fake
+}
+
+func TestStat(t *testing.T) {
+	fsys, _ := newFake(t, map[string]string{"a.txt": "a", "dir/b.txt": "bb"})
+	if stat, err := fsys.Stat("/a.txt"); err != nil || stat.IsDir() || stat.Size() != 1 {
+		t.Errorf("Stat(a.txt) = %v, %v, want a file of 1 byte", stat, err)
+	}
+	if stat, err := fsys.Stat("dir"); err != nil || !stat.IsDir() {
+		t.Errorf("Stat(dir) = %v, %v, want a directory", stat, err)
+	}
+	if _, err := fsys.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(missing) = %v, want not exist", err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	fsys, fake := newFake(t, map[string]string{"dir/a": "a", "dir/sub/b": "b", "dirty": "c"})
+	if err := fsys.Rename("dir", "new dir"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	want := map[string]string{"new dir/a": "a", "new dir/sub/b": "b", "dirty": "c"}
+	if !maps.Equal(fake.objects, want) {
+		t.Errorf("objects = %v, want %v", fake.objects, want)
+	}
+}
+
+func TestRenameFailure(t *testing.T) {
+	objects := map[string]string{"dir/a": "a", "dir/b": "b", "dir/c": "c"}
+	fsys, fake := newFake(t, maps.Clone(objects))
+	fake.failCopy = "new/b"
+	err := fsys.Rename("dir", "new")
+	if err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Fatalf("Rename = %v, want the copy's error", err)
+	}
+	// nothing is deleted until everything's copied, and copies are undone
+	if !maps.Equal(fake.objects, objects) {
+		t.Errorf("objects = %v, want them left as %v", fake.objects, objects)
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	fsys, fake := newFake(t, map[string]string{"dir/a": "a", "dir/sub/b": "b", "other": "c"})
+	if err := fsys.RemoveAll("dir"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if want := map[string]string{"other": "c"}; !maps.Equal(fake.objects, want) {
+		t.Errorf("objects = %v, want %v", fake.objects, want)
+	}
+	if err := fsys.RemoveAll("dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RemoveAll of nothing = %v, want not exist", err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	fsys, _ := newFake(t, map[string]string{"photos/a.jpg": "", "photos/b.png": "", "photos/sub/c.jpg": "", "other.jpg": ""})
+	got, err := fsys.Glob("/photos/*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"photos/a.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("Glob = %q, want %q", got, want)
+	}
+	got, err = fsys.Glob("photos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"photos/a.jpg", "photos/b.png", "photos/sub/c.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("Glob of a prefix = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,240 @@
+// Package sftpfs is a vipaths.FS for paths on a remote server, accessed over SFTP.
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// FS is an SFTP backed vipaths.FS. Paths are absolute or relative to the
+// remote user's home directory
+type FS struct {
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+var (
+	_ vipaths.FS        = (*FS)(nil)
+	_ vipaths.Commander = (*FS)(nil)
+)
+
+// Dial connects to the host in a URL like sftp://user@host:port. The ssh agent,
+// default keys in ~/.ssh, and a password in the URL are tried for auth, and the
+// host key is checked against ~/.ssh/known_hosts
+func Dial(u *url.URL) (*FS, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("finding home dir: %w", err)
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods(u, home),
+		HostKeyCallback: hostKeys,
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %q: %w", addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("starting sftp: %w", err)
+	}
+	return &FS{conn: conn, client: client}, nil
+}
+
+func authMethods(u *url.URL, home string) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if password, ok := u.User.Password(); ok {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods
+}
+
+// Close closes the SFTP session and the underlying connection
+func (f *FS) Close() error {
+	return errors.Join(f.client.Close(), f.conn.Close())
+}
+
+// remote is a path as the server expects it. the engine joins paths with the
+// local separator, which is a backslash on windows
+func remote(name string) string { return filepath.ToSlash(name) }
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) { return f.client.Stat(remote(name)) }
+func (f *FS) RemoveAll(name string) error           { return f.client.RemoveAll(remote(name)) }
+func (f *FS) Chmod(name string, mode fs.FileMode) error {
+	return f.client.Chmod(remote(name), mode)
+}
+func (f *FS) Chown(name string, uid, gid int) error {
+	return f.client.Chown(remote(name), uid, gid)
+}
+func (f *FS) Symlink(oldname, newname string) error {
+	return f.client.Symlink(remote(oldname), remote(newname))
+}
+func (f *FS) Chtimes(name string, atime, mtime time.Time) error {
+	return f.client.Chtimes(remote(name), atime, mtime)
+}
+
+func (f *FS) Rename(oldname, newname string) error {
+	oldname, newname = remote(oldname), remote(newname)
+	if _, ok := f.client.HasExtension("posix-rename@openssh.com"); ok {
+		return f.client.PosixRename(oldname, newname)
+	}
+	return f.client.Rename(oldname, newname)
+}
+
+// MkdirAll creates name and its parents with perm, less the server's umask
+// like os.MkdirAll. directories which already exist are left alone
+func (f *FS) MkdirAll(name string, perm fs.FileMode) error {
+	name = remote(name)
+	var missing []string
+	for dir := path.Clean(name); ; dir = path.Dir(dir) {
+		if _, err := f.client.Stat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if path.Dir(dir) == dir {
+			break
+		}
+	}
+	if err := f.client.MkdirAll(name); err != nil {
+		return err
+	}
+	// the server makes them 0777 less its umask, so clearing the bits perm
+	// doesn't have applies the same umask to perm
+	for _, dir := range missing {
+		stat, err := f.client.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if mode := stat.Mode().Perm(); mode&perm != mode {
+			if err := f.client.Chmod(dir, mode&perm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Copy copies a file by streaming it through the local machine. special files
+// like FIFOs can't be made over SFTP, and aren't read
+func (f *FS) Copy(from, to string) error {
+	from, to = remote(from), remote(to)
+	if stat, err := f.client.Stat(from); err == nil && stat.Mode()&(fs.ModeNamedPipe|fs.ModeSocket|fs.ModeDevice|fs.ModeCharDevice) != 0 {
+		return fmt.Errorf("%w: can't be made over sftp", vipaths.ErrSpecialFile)
+	}
+	in, err := f.client.Open(from)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	out, err := f.client.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return f.client.Chmod(to, stat.Mode())
+}
+
+// Command runs a command on the server, for copies made there with rsync.
+// its output goes to stderr, and it's stopped if ctx is done
+func (f *FS) Command(ctx context.Context, name string, args ...string) error {
+	session, err := f.conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("new session: %w", err)
+	}
+	defer session.Close()
+	session.Stdout = os.Stderr
+	session.Stderr = os.Stderr
+
+	line := shellQuote(name)
+	for _, arg := range args {
+		line += " " + shellQuote(arg)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Signal(ssh.SIGTERM)
+			session.Close()
+		case <-done:
+		}
+	}()
+	if err := session.Run(line); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// shellQuote quotes s for the server's shell, which is assumed to be POSIX
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Glob expands a pattern on the remote server
+func (f *FS) Glob(pattern string) ([]string, error) { return f.client.Glob(remote(pattern)) }
@@ -0,0 +1,146 @@
+package sftpfs
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// newLocal returns an FS talking to an sftp server in the test process, which
+// serves the local disk
+func newLocal(t *testing.T) *FS {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	server, err := sftp.NewServer(serverConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return &FS{client: client}
+}
+
+func TestOperations(t *testing.T) {
+	fsys := newLocal(t)
+	dir := filepath.ToSlash(t.TempDir())
+	if err := os.WriteFile(dir+"/a", []byte("abc"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if stat, err := fsys.Stat(dir + "/a"); err != nil || stat.Size() != 3 {
+		t.Errorf("Stat = %v, %v, want 3 bytes", stat, err)
+	}
+	if _, err := fsys.Stat(dir + "/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing path = %v, want not exist", err)
+	}
+	if err := fsys.Copy(dir+"/a", dir+"/b"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if data, err := os.ReadFile(dir + "/b"); err != nil || string(data) != "abc" {
+		t.Errorf("copy has %q, %v", data, err)
+	}
+	if stat, err := os.Stat(dir + "/b"); err == nil && runtime.GOOS != "windows" && stat.Mode().Perm() != 0640 {
+		t.Errorf("copy has mode %v, want 0640", stat.Mode().Perm())
+	}
+	// replaces the destination, like rename(2)
+	if err := fsys.Rename(dir+"/b", dir+"/a"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := os.Stat(dir + "/b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("renamed path still exists: %v", err)
+	}
+	if err := os.MkdirAll(dir+"/full/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveAll(dir + "/full"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err := os.Stat(dir + "/full"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("removed path still exists: %v", err)
+	}
+
+	matches, err := fsys.Glob(dir + "/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dir + "/a"}; !slices.Equal(matches, want) {
+		t.Errorf("Glob = %q, want %q", matches, want)
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes aren't kept on windows")
+	}
+	fsys := newLocal(t)
+	dir := filepath.ToSlash(t.TempDir())
+	if err := os.Mkdir(dir+"/shared", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir+"/shared", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll(dir+"/shared/new/sub", 0700); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	for name, want := range map[string]fs.FileMode{"shared": 0777, "shared/new": 0700, "shared/new/sub": 0700} {
+		stat, err := os.Stat(dir + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stat.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %v, want %v", name, got, want)
+		}
+	}
+	// bits the server's umask clears stay cleared, as for a local mkdir
+	if err := os.Mkdir(dir+"/local", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll(dir+"/open", 0777); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	local, err := os.Stat(dir + "/local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := os.Stat(dir + "/open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.Mode().Perm() != local.Mode().Perm() {
+		t.Errorf("open has mode %v, want %v", open.Mode().Perm(), local.Mode().Perm())
+	}
+}
+
+func TestRemote(t *testing.T) {
+	if got := remote(filepath.Join("dir", "sub", "a")); got != "dir/sub/a" {
+		t.Errorf("remote = %q, want slashes", got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package vipaths
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Aliases are other names commands can be typed by in the buffer, like c for
+// copy, see RegisterAlias
+var Aliases = map[string]string{}
+
+// RegisterAlias adds alias as another name for the command name, built in or
+// from a plugin. Aliases can't replace commands or other aliases
+func RegisterAlias(alias, name string) error {
+	if alias == "" || strings.ContainsAny(alias, " \t;|\"") {
+		return fmt.Errorf("alias %q isn't a valid command name", alias)
+	}
+	if slices.ContainsFunc(Commands, func(cmd Command) bool { return cmd.Name == alias }) {
+		return fmt.Errorf("alias %q is already a command", alias)
+	}
+	if _, ok := Aliases[alias]; ok {
+		return fmt.Errorf("alias %q is already an alias for %s", alias, Aliases[alias])
+	}
+	if !slices.ContainsFunc(Commands, func(cmd Command) bool { return cmd.Name == name }) {
+		return fmt.Errorf("alias %q is for %q, which isn't a command", alias, name)
+	}
+	Aliases[alias] = name
+	return nil
+}
+
+// expandAlias replaces an alias at the start of a line with the name of its
+// command
+func expandAlias(line string) string {
+	for alias, name := range Aliases {
+		if line == alias || strings.HasPrefix(line, alias+" ") || strings.HasPrefix(line, alias+"; ") {
+			return name + line[len(alias):]
+		}
+	}
+	return line
+}
@@ -0,0 +1,533 @@
+package vipaths
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Archive packs files and directories into a new archive, then removes them.
+// The format is chosen by the archive's extension, one of .zip, .tar, .tar.gz,
+// .tgz, or .tar.zst. Entries are named relative to the directory the names
+// have in common. Archives only work on local paths
+type Archive struct {
+	Names []string
+	To    string
+}
+
+func (a Archive) Paths() (string, string) { return a.Names[0], a.To }
+func (a Archive) MapPaths(fn func(string) string) Instruction {
+	names := make([]string, 0, len(a.Names))
+	for _, name := range a.Names {
+		names = append(names, fn(name))
+	}
+	return Archive{Names: names, To: fn(a.To)}
+}
+func (a Archive) String() string {
+	quoted := make([]string, 0, len(a.Names))
+	for _, name := range a.Names {
+		quoted = append(quoted, Quote(name))
+	}
+	return fmt.Sprintf("archive %s\n     -> %s", strings.Join(quoted, ", "), Quote(a.To))
+}
+func (a Archive) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return errors.New("exe archive: only local paths can be archived")
+	}
+	if _, err := os.Lstat(a.To); err == nil {
+		return fmt.Errorf("exe archive: %w", &ExistsError{Op: "archive", Dst: a.To})
+	}
+	if err := fsys.MkdirAll(filepath.Dir(a.To), 0777); err != nil {
+		return fmt.Errorf("exe mkdirall: %w", err)
+	}
+
+	// write next to the destination and rename into place, so a failure
+	// doesn't leave a partial archive
+	tmp, err := os.CreateTemp(filepath.Dir(a.To), ".vi-paths-archive-*")
+	if err != nil {
+		return fmt.Errorf("exe archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeArchive(contextOf(fsys), tmp, a.To, a.Names); err != nil {
+		return fmt.Errorf("exe archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("exe archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), a.To); err != nil {
+		return fmt.Errorf("exe archive: %w", err)
+	}
+	for _, name := range a.Names {
+		if err := fsys.RemoveAll(name); err != nil {
+			return fmt.Errorf("exe removeall: %w", err)
+		}
+	}
+	return nil
+}
+
+// archiveWriter adds entries to an archive, given their name relative to the
+// archive's root and their path on disk
+type archiveWriter interface {
+	add(name, path string, info fs.FileInfo) error
+	Close() error
+}
+
+// writeArchive writes the names to an archive in the format for to, stopping
+// between files when ctx is done
+func writeArchive(ctx context.Context, w io.Writer, to string, names []string) error {
+	aw, err := newArchiveWriter(w, to)
+	if err != nil {
+		return err
+	}
+	root := CommonDir(names)
+	for _, name := range names {
+		err := filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			return aw.add(filepath.ToSlash(rel), path, info)
+		})
+		if err != nil {
+			aw.Close()
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+func newArchiveWriter(w io.Writer, to string) (archiveWriter, error) {
+	switch lower := strings.ToLower(to); {
+	case strings.HasSuffix(lower, ".zip"):
+		return &zipWriter{zip.NewWriter(w)}, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return &tarWriter{tw: tar.NewWriter(w)}, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz := gzip.NewWriter(w)
+		return &tarWriter{tw: tar.NewWriter(gz), compressor: gz}, nil
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format for %q, expected .zip, .tar, .tar.gz, .tgz, or .tar.zst", to)
+	}
+}
+
+type tarWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (t *tarWriter) add(name, path string, info fs.FileInfo) error {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return copyFile(t.tw, path)
+}
+
+func (t *tarWriter) Close() error {
+	err := t.tw.Close()
+	if t.compressor != nil {
+		err = errors.Join(err, t.compressor.Close())
+	}
+	return err
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) add(name, path string, info fs.FileInfo) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else {
+		hdr.Method = zip.Deflate
+	}
+	w, err := z.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		// symlinks are stored with their target as the contents
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, link)
+		return err
+	case info.Mode().IsRegular():
+		return copyFile(w, path)
+	}
+	return nil
+}
+
+func (z *zipWriter) Close() error { return z.zw.Close() }
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// isLocal reports whether fsys is the local filesystem
+func isLocal(fsys FS) bool {
+	return unwrapFS(fsys) == OS
+}
+
+// mergeArchives combines archive instructions with the same destination into
+// the first of them, so lines from all over the buffer can go into one archive
+func mergeArchives(plan Plan) Plan {
+	first := map[string]int{}
+	merged := make(Plan, 0, len(plan))
+	for _, inst := range plan {
+		a, ok := inst.(Archive)
+		if !ok {
+			merged = append(merged, inst)
+			continue
+		}
+		if i, ok := first[a.To]; ok {
+			prev := merged[i].(Archive)
+			prev.Names = append(prev.Names, a.Names...)
+			merged[i] = prev
+			continue
+		}
+		first[a.To] = len(merged)
+		merged = append(merged, a)
+	}
+	return merged
+}
+
+// Extract unpacks an archive into a directory, optionally removing it
+// afterwards. The formats are the same as for Archive. Existing files are
+// never overwritten, and entries which would land outside of the directory
+// are rejected. Archives can only be extracted from local paths
+type Extract struct {
+	Name, Dir string
+	Remove    bool
+}
+
+func (e Extract) Paths() (string, string) { return e.Name, e.Dir }
+func (e Extract) MapPaths(fn func(string) string) Instruction {
+	return Extract{Name: fn(e.Name), Dir: fn(e.Dir), Remove: e.Remove}
+}
+func (e Extract) String() string {
+	verb := "extract"
+	if e.Remove {
+		verb = "extract and remove"
+	}
+	return fmt.Sprintf("%s %s\n  -> %s", verb, Quote(e.Name), Quote(e.Dir))
+}
+func (e Extract) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return errors.New("exe extract: only local archives can be extracted")
+	}
+	if err := fsys.MkdirAll(e.Dir, 0777); err != nil {
+		return fmt.Errorf("exe mkdirall: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(e.Dir)
+	if err != nil {
+		return fmt.Errorf("exe extract: %w", err)
+	}
+	f, err := os.Open(e.Name)
+	if err != nil {
+		return fmt.Errorf("exe extract: %w", err)
+	}
+	defer f.Close()
+	if err := readArchive(f, e.Name, root); err != nil {
+		return fmt.Errorf("exe extract %q: %w", e.Name, err)
+	}
+	if e.Remove {
+		f.Close()
+		if err := fsys.RemoveAll(e.Name); err != nil {
+			return fmt.Errorf("exe removeall: %w", err)
+		}
+	}
+	return nil
+}
+
+func readArchive(f *os.File, name string, root string) error {
+	switch lower := strings.ToLower(name); {
+	case strings.HasSuffix(lower, ".zip"):
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, stat.Size())
+		if err != nil {
+			return err
+		}
+		return extractZip(zr, root)
+	case strings.HasSuffix(lower, ".tar"):
+		return extractTar(tar.NewReader(f), root)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(tar.NewReader(gz), root)
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return extractTar(tar.NewReader(zr), root)
+	default:
+		return fmt.Errorf("unknown archive format, expected .zip, .tar, .tar.gz, .tgz, or .tar.zst")
+	}
+}
+
+func extractTar(tr *tar.Reader, root string) error {
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var mode fs.FileMode
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			mode = fs.ModeDir
+		case tar.TypeSymlink:
+			mode = fs.ModeSymlink
+		case tar.TypeReg:
+		default:
+			// hard links, devices, and fifos are skipped
+			continue
+		}
+		mode |= fs.FileMode(hdr.Mode).Perm()
+		if err := extractEntry(root, hdr.Name, mode, hdr.Linkname, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(zr *zip.Reader, root string) error {
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		var link string
+		if mode&fs.ModeSymlink != 0 {
+			// symlinks are stored with their target as the contents
+			r, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			b, err := io.ReadAll(io.LimitReader(r, 4096))
+			r.Close()
+			if err != nil {
+				return err
+			}
+			link = string(b)
+		}
+		if mode&^(fs.ModeDir|fs.ModeSymlink|fs.ModePerm) != 0 {
+			continue
+		}
+		err := func() error {
+			r, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return extractEntry(root, zf.Name, mode, link, r)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractEntry writes a single archive entry under root
+func extractEntry(root, name string, mode fs.FileMode, link string, r io.Reader) error {
+	name = filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if name == "" || name == "." {
+		return nil
+	}
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("entry %q is outside of the destination", name)
+	}
+	path := filepath.Join(root, name)
+
+	// a parent may be a symlink from an earlier entry, make sure the closest
+	// existing one still resolves to somewhere under root before creating more
+	existing := filepath.Dir(path)
+	for {
+		if _, err := os.Lstat(existing); err == nil || existing == root {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return fmt.Errorf("entry %q is outside of the destination", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	switch {
+	case mode.IsDir():
+		if err := os.Mkdir(path, mode.Perm()|0700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		return nil
+	case mode&fs.ModeSymlink != 0:
+		return os.Symlink(link, path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Compress compresses a single file with gzip or zstd, removing the original
+// unless Keep is set. Existing files are never overwritten. Only local files
+// can be compressed
+type Compress struct {
+	Name, To string
+	// Format is "gzip" or "zstd"
+	Format string
+	Keep   bool
+}
+
+func (c Compress) Paths() (string, string) { return c.Name, c.To }
+func (c Compress) MapPaths(fn func(string) string) Instruction {
+	return Compress{Name: fn(c.Name), To: fn(c.To), Format: c.Format, Keep: c.Keep}
+}
+func (c Compress) String() string {
+	return fmt.Sprintf("%s %s\n  -> %s", c.Format, Quote(c.Name), Quote(c.To))
+}
+func (c Compress) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return fmt.Errorf("exe %s: only local files can be compressed", c.Format)
+	}
+	in, err := os.Open(c.Name)
+	if err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	if !stat.Mode().IsRegular() {
+		return fmt.Errorf("exe %s: %q isn't a regular file", c.Format, c.Name)
+	}
+	if _, err := os.Lstat(c.To); err == nil {
+		return fmt.Errorf("exe %s: %w", c.Format, &ExistsError{Op: c.Format, Src: c.Name, Dst: c.To})
+	}
+	if err := fsys.MkdirAll(filepath.Dir(c.To), 0777); err != nil {
+		return fmt.Errorf("exe mkdirall: %w", err)
+	}
+
+	// write next to the destination and rename into place, so a failure
+	// doesn't leave a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(c.To), ".vi-paths-compress-*")
+	if err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var w io.WriteCloser
+	switch c.Format {
+	case "gzip":
+		gz := gzip.NewWriter(tmp)
+		gz.Name = filepath.Base(c.Name)
+		gz.ModTime = stat.ModTime()
+		w = gz
+	case "zstd":
+		if w, err = zstd.NewWriter(tmp); err != nil {
+			return fmt.Errorf("exe %s: %w", c.Format, err)
+		}
+	default:
+		return fmt.Errorf("exe compress: unknown format %q", c.Format)
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		w.Close()
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	if err := os.Rename(tmp.Name(), c.To); err != nil {
+		return fmt.Errorf("exe %s: %w", c.Format, err)
+	}
+	if !c.Keep {
+		in.Close()
+		if err := fsys.RemoveAll(c.Name); err != nil {
+			return fmt.Errorf("exe removeall: %w", err)
+		}
+	}
+	return nil
+}
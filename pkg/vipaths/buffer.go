@@ -0,0 +1,406 @@
+package vipaths
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// BufferExt is the extension of buffer files handed to an editor, so that
+// editors can pick up syntax highlighting and leftover files are identifiable
+const BufferExt = ".vipaths"
+
+// Header is written to the top of the buffer. Comment lines are ignored
+// when reading the buffer back
+var Header = []string{
+	"# vi-paths: edit a line to rename, change it to `rm` to remove, or use a command like `copy <dest>`",
+	"# vim: set filetype=vipaths:",
+}
+
+// WriteBuffer writes the header, any extra comments, and one line per path to w,
+// quoting paths which couldn't otherwise be written as a single line
+func WriteBuffer(w io.Writer, paths []string, comments ...string) error {
+	return WriteAnnotatedBuffer(w, paths, nil, comments...)
+}
+
+// WriteAnnotatedBuffer is like WriteBuffer, but also writes a comment line
+// from notes before the path with the same index, for example to title groups
+// of related paths
+func WriteAnnotatedBuffer(w io.Writer, paths []string, notes map[int]string, comments ...string) error {
+	return writeBuffer(w, paths, notes, Quote, comments)
+}
+
+// WriteTaggedBuffer is like WriteAnnotatedBuffer, but ends each line with a
+// tab and the path's id, like `#12`, counting from 1. Read it back with
+// ReadTaggedChanges, which matches lines to paths by their ids rather than
+// their positions, so lines can be sorted and moved around in the editor
+func WriteTaggedBuffer(w io.Writer, paths []string, notes map[int]string, comments ...string) error {
+	rows := make([][]string, len(paths))
+	for i, name := range paths {
+		rows[i] = []string{Quote(name), "#" + strconv.Itoa(i+1)}
+	}
+	return writeBuffer(w, paths, notes, alignRows(rows), comments)
+}
+
+// WritePairs is like WriteAnnotatedBuffer, but writes a line of
+// `source<TAB>destination` for each path, with the destination starting out
+// the same as the source. Read it back with ReadBuffer and ParsePairs
+func WritePairs(w io.Writer, paths []string, notes map[int]string, comments ...string) error {
+	dsts := make([]string, len(paths))
+	for i, name := range paths {
+		dsts[i] = Quote(name)
+	}
+	return WriteMappedPairs(w, paths, dsts, notes, comments...)
+}
+
+// WriteMappedPairs is like WritePairs, but with the destination side of each
+// line given. They're written as they are, so can be commands like
+// `copy <dest>` with a quoted path
+func WriteMappedPairs(w io.Writer, paths, dsts []string, notes map[int]string, comments ...string) error {
+	rows := make([][]string, len(paths))
+	for i, name := range paths {
+		rows[i] = []string{Quote(name), dsts[i]}
+	}
+	comments = append([]string{"each line is source<TAB>destination, edit either side or paste more lines"}, comments...)
+	return writeBuffer(w, paths, notes, alignRows(rows), comments)
+}
+
+// maxAlignWidth is the widest a column is padded to, so that one long name
+// doesn't push every other line's columns off the screen
+const maxAlignWidth = 80
+
+// alignRows joins the fields of each row with tabs, padding every field but
+// the last with spaces to the display width of the widest in its column, so
+// the columns line up in an editor even with wide CJK and emoji names. the
+// padding is trimmed when the buffer is read back. It returns a line func
+// for writeBuffer, giving the rows in order
+func alignRows(rows [][]string) func(string) string {
+	var widths []int
+	for _, row := range rows {
+		for i, field := range row[:max(len(row)-1, 0)] {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], min(displayWidth(field), maxAlignWidth))
+		}
+	}
+	var n int
+	return func(string) string {
+		row := slices.Clone(rows[n])
+		n++
+		for i := range row[:max(len(row)-1, 0)] {
+			row[i] += strings.Repeat(" ", max(widths[i]-displayWidth(row[i]), 0))
+		}
+		return strings.Join(row, "\t")
+	}
+}
+
+// displayWidth is how many terminal cells s takes up. east asian wide and
+// fullwidth characters, which include most emoji, take two, and combining
+// marks and joiners none
+func displayWidth(s string) int {
+	var n int
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), r == '\u200d', unicode.Is(unicode.Variation_Selector, r):
+		case width.LookupRune(r).Kind() == width.EastAsianWide, width.LookupRune(r).Kind() == width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func writeBuffer(w io.Writer, paths []string, notes map[int]string, line func(string) string, comments []string) error {
+	bw := bufio.NewWriter(w)
+	for _, line := range Header {
+		bw.WriteString(line + "\n")
+	}
+	for _, line := range comments {
+		bw.WriteString("# " + line + "\n")
+	}
+	for i, name := range paths {
+		if note, ok := notes[i]; ok {
+			bw.WriteString("# " + note + "\n")
+		}
+		bw.WriteString(line(name) + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing buffer: %w", err)
+	}
+	return nil
+}
+
+// ReadBuffer reads the lines of an edited buffer, skipping comments. Lines are
+// returned as written, to be unquoted by Parse
+func ReadBuffer(r io.Reader) ([]string, error) {
+	var lines []string
+	err := eachLine(r, func(line string) {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading buffer: %w", err)
+	}
+	return lines, nil
+}
+
+// eachLine calls fn with each line of r, without its line ending. unlike a
+// bufio.Scanner, lines can be any length, like a deep path or pasted data
+func eachLine(r io.Reader, fn func(line string)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(line, "\n")
+			fn(strings.TrimSuffix(line, "\r"))
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadChanges reads an edited buffer of the paths in before, returning only
+// the lines which were changed along with their original paths, ready for
+// Parse. Unlike ReadBuffer, unchanged lines aren't kept, so memory stays
+// proportional to the number of changes rather than the number of paths.
+// Lines of only mkdir commands are added lines, returned with an empty path
+func ReadChanges(r io.Reader, before []string) (changedBefore, changedAfter []string, err error) {
+	changes, err := ReadBufferChanges(r, before, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return changes.Before, changes.After, nil
+}
+
+// Changes are the changed lines of an edited buffer, as read by
+// ReadBufferChanges
+type Changes struct {
+	// Before are the original paths of the changed lines, and After what
+	// they were edited to, ready for Parse
+	Before, After []string
+	// Lines are the line numbers of the changed lines in the buffer, counting
+	// from 1 and including comments, so errors can point to the line to fix
+	Lines []int
+	// Index are the positions in before of the changed paths. an added line
+	// has the position of the path on the line above it, or of the one below
+	// it at the top or when a comment like a heading is in between
+	Index []int
+	// Edited are the paths with edited column values, along with all of their
+	// values as edited
+	Edited map[string][]string
+}
+
+// ReadBufferChanges is ReadChanges, or ReadColumnChanges when columns are
+// given, also returning the line number of each change
+func ReadBufferChanges(r io.Reader, before []string, columns [][]string) (Changes, error) {
+	changes := Changes{Edited: map[string][]string{}}
+	var added addedIndex
+	var n, num int
+	err := eachLine(r, func(line string) {
+		num++
+		if strings.HasPrefix(line, "#") {
+			added.comment()
+			return
+		}
+		if mkdirLine(line) {
+			changes.Before = append(changes.Before, "")
+			changes.After = append(changes.After, line)
+			changes.Lines = append(changes.Lines, num)
+			added.add(&changes)
+			return
+		}
+		added.path(&changes, n)
+		if n < len(before) && columns != nil {
+			line = splitColumns(line, before[n], columns[n], changes.Edited)
+		}
+		if n < len(before) && strings.TrimSpace(line) != Quote(before[n]) {
+			changes.Before = append(changes.Before, before[n])
+			changes.After = append(changes.After, line)
+			changes.Lines = append(changes.Lines, num)
+			changes.Index = append(changes.Index, n)
+		}
+		n++
+	})
+	if err != nil {
+		return Changes{}, fmt.Errorf("reading buffer: %w", err)
+	}
+	if n != len(before) {
+		return Changes{}, &LineCountError{Before: len(before), After: n}
+	}
+	return changes, nil
+}
+
+// addedIndex places added lines next to a path for Changes.Index, the path on
+// the line above, or at the top or after a comment, the path below
+type addedIndex struct {
+	// above is one more than the position of the path above, 0 at the top
+	above        int
+	afterComment bool
+	// pending are the changes waiting for the path below them
+	pending []int
+}
+
+func (a *addedIndex) comment() { a.afterComment = true }
+
+func (a *addedIndex) add(changes *Changes) {
+	if a.afterComment || a.above == 0 {
+		a.pending = append(a.pending, len(changes.Index))
+	}
+	changes.Index = append(changes.Index, a.above-1)
+}
+
+// path records the path at position i in before, read after any added lines
+func (a *addedIndex) path(changes *Changes, i int) {
+	for _, p := range a.pending {
+		changes.Index[p] = i
+	}
+	a.pending, a.afterComment, a.above = nil, false, i+1
+}
+
+// ReadTaggedChanges is ReadBufferChanges for a buffer written by
+// WriteTaggedBuffer, matching each line to its path by the id at its end.
+// Blank lines are ignored, lines of only mkdir commands without an id are
+// added as usual, and every path must have exactly one line, otherwise the error is an
+// IDError. Changes are in the order of the edited buffer
+func ReadTaggedChanges(r io.Reader, before []string) (Changes, error) {
+	changes := Changes{Edited: map[string][]string{}}
+	seen := make([]bool, len(before))
+	var idErr IDError
+	var added addedIndex
+	var num int
+	err := eachLine(r, func(line string) {
+		num++
+		if strings.HasPrefix(line, "#") {
+			added.comment()
+			return
+		}
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		i := strings.LastIndexByte(line, '\t')
+		if i < 0 && mkdirLine(line) {
+			changes.Before = append(changes.Before, "")
+			changes.After = append(changes.After, line)
+			changes.Lines = append(changes.Lines, num)
+			added.add(&changes)
+			return
+		}
+		if i < 0 {
+			idErr.Lines = append(idErr.Lines, num)
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(line[i+1:]), "#"))
+		if err != nil || id < 1 || id > len(before) || seen[id-1] {
+			idErr.Lines = append(idErr.Lines, num)
+			return
+		}
+		seen[id-1] = true
+		added.path(&changes, id-1)
+		if path := line[:i]; strings.TrimSpace(path) != Quote(before[id-1]) {
+			changes.Before = append(changes.Before, before[id-1])
+			changes.After = append(changes.After, path)
+			changes.Lines = append(changes.Lines, num)
+			changes.Index = append(changes.Index, id-1)
+		}
+	})
+	if err != nil {
+		return Changes{}, fmt.Errorf("reading buffer: %w", err)
+	}
+	for i, ok := range seen {
+		if !ok {
+			idErr.Missing = append(idErr.Missing, i+1)
+		}
+	}
+	if idErr.Missing != nil || idErr.Lines != nil {
+		return Changes{}, &idErr
+	}
+	return changes, nil
+}
+
+// WriteColumns is like WriteAnnotatedBuffer, but follows each path with its
+// values from columns, separated by tabs, so that things about the path can
+// be edited alongside it, like its SELinux context. Values are written as
+// given, so must not contain tabs or newlines. Read it back with
+// ReadColumnChanges
+func WriteColumns(w io.Writer, paths []string, columns [][]string, notes map[int]string, comments ...string) error {
+	rows := make([][]string, len(paths))
+	for i, name := range paths {
+		rows[i] = append([]string{Quote(name)}, columns[i]...)
+	}
+	return writeBuffer(w, paths, notes, alignRows(rows), comments)
+}
+
+// ReadColumnChanges is like ReadChanges for a buffer written by WriteColumns,
+// also returning the paths with edited values, along with all of their values
+// as edited. A line without enough tabs for its columns keeps its values
+func ReadColumnChanges(r io.Reader, before []string, columns [][]string) (changedBefore, changedAfter []string, edited map[string][]string, err error) {
+	changes, err := ReadBufferChanges(r, before, columns)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return changes.Before, changes.After, changes.Edited, nil
+}
+
+// splitColumns returns the part of a line holding the path, recording its
+// column values in edited if they differ from columns
+func splitColumns(line, before string, columns []string, edited map[string][]string) string {
+	fields := strings.Split(line, "\t")
+	if len(fields) <= len(columns) {
+		return line
+	}
+	path, values := fields[:len(fields)-len(columns)], fields[len(fields)-len(columns):]
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	if !slices.Equal(values, columns) {
+		edited[before] = values
+	}
+	return strings.Join(path, "\t")
+}
+
+// ParsePairs splits lines of `source<TAB>destination` as written by WritePairs
+// into sources and their edited destinations, ready for Parse. Sources may be
+// quoted, and are taken as they are, never expanded, so that every name
+// written by WritePairs reads back as itself. The number of lines doesn't
+// matter, and blank lines are ignored. A line of only mkdir commands needs no
+// source
+func ParsePairs(lines []string, _ ParseOptions) (before, after []string, err error) {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if mkdirLine(line) {
+			before = append(before, "")
+			after = append(after, line)
+			continue
+		}
+		src, dst, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: expected source<TAB>destination in %q", i+1, line)
+		}
+		src, err := Unquote(strings.TrimSpace(src))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if src == "" {
+			return nil, nil, fmt.Errorf("line %d: empty source", i+1)
+		}
+		before = append(before, src)
+		after = append(after, dst)
+	}
+	return before, after, nil
+}
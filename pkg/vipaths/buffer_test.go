@@ -0,0 +1,56 @@
+package vipaths
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPairsRoundTrip(t *testing.T) {
+	paths := []string{"a.txt", "~$report.docx", "$HOME", "rm", "new\nline", " spaced "}
+	var buf bytes.Buffer
+	if err := WritePairs(&buf, paths, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := ReadBuffer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ParseOptions{Expand: true}
+	before, after, err := ParsePairs(lines, opts)
+	if err != nil {
+		t.Fatalf("ParsePairs: %v", err)
+	}
+	if !reflect.DeepEqual(before, paths) {
+		t.Errorf("sources = %q, want %q", before, paths)
+	}
+	plan, err := Parse(before, after, opts)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(plan) != 0 {
+		t.Errorf("unchanged pairs planned %v", plan)
+	}
+}
+
+func TestParsePairs(t *testing.T) {
+	lines := []string{
+		"a\tb",
+		"",
+		`"~$x"` + "  \t" + `"~$y"`,
+		"mkdir new",
+	}
+	before, after, err := ParsePairs(lines, ParseOptions{Expand: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "~$x", ""}; !reflect.DeepEqual(before, want) {
+		t.Errorf("sources = %q, want %q", before, want)
+	}
+	if want := []string{"b", `"~$y"`, "mkdir new"}; !reflect.DeepEqual(after, want) {
+		t.Errorf("destinations = %q, want %q", after, want)
+	}
+	if _, _, err := ParsePairs([]string{"no tab"}, ParseOptions{}); err == nil {
+		t.Error("expected an error for a line without a tab")
+	}
+}
@@ -0,0 +1,204 @@
+package vipaths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Checks which can fail in Plan.Check
+const (
+	// CheckMissing is a source which doesn't exist
+	CheckMissing = "missing"
+	// CheckConflict is a destination which already exists
+	CheckConflict = "conflict"
+	// CheckName is a destination which isn't a valid name, or is too long
+	CheckName = "name"
+	// CheckPermission is a directory which can't be written to
+	CheckPermission = "permission"
+	// CheckSpace is a copy, or a rename onto another filesystem, which won't
+	// fit on its destination's filesystem, or in a quota it counts against
+	CheckSpace = "space"
+	// CheckDevice is a dedup across filesystems
+	CheckDevice = "device"
+)
+
+// Problem is a reason an instruction is expected to fail
+type Problem struct {
+	// Index is the instruction's position in the plan, starting at 1
+	Index   int    `json:"index"`
+	Op      string `json:"op"`
+	Src     string `json:"src"`
+	Dst     string `json:"dst,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	return fmt.Sprintf("operation %d, %s %s: %s: %s", p.Index, p.Op, Quote(p.Src), p.Check, p.Message)
+}
+
+// Check runs the plan's pre-flight checks against the current state of the
+// filesystem without executing anything, returning every problem found.
+// Paths created or removed by earlier instructions in the plan are taken into
+// account. Permissions, free space, lengths, and filesystem boundaries are
+// only checked on the local disk, where free space is only counted for copies
+func (p Plan) Check(fsys FS) []Problem {
+	c := checker{fsys: fsys, state: map[string]bool{}, need: map[string]int64{}, free: map[string]int64{}}
+	var problems []Problem
+	for i, inst := range p {
+		src, dst := inst.Paths()
+		for _, err := range c.check(inst) {
+			problems = append(problems, Problem{Index: i + 1, Op: OpName(inst), Src: src, Dst: dst, Check: err.check, Message: err.msg})
+		}
+		c.apply(inst)
+	}
+	return problems
+}
+
+type checkErr struct{ check, msg string }
+
+// checker tracks the paths the plan has created or removed so far
+type checker struct {
+	fsys FS
+	// state is whether a path exists after the instructions so far, for paths
+	// they've touched
+	state map[string]bool
+	// need and free are the bytes copied to, and available on, each
+	// filesystem and quota
+	need, free map[string]int64
+}
+
+func (c *checker) exists(path string) bool {
+	path = filepath.Clean(path)
+	if exists, ok := c.state[path]; ok {
+		return exists
+	}
+	for p := filepath.Dir(path); ; p = filepath.Dir(p) {
+		if exists, ok := c.state[p]; ok && !exists {
+			return false
+		}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	_, err := c.fsys.Stat(path)
+	return err == nil
+}
+
+// existingDir is path or its closest ancestor which exists on disk, where
+// creating it would start
+func existingDir(fsys FS, path string) string {
+	dir := filepath.Clean(path)
+	for {
+		if _, err := fsys.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (c *checker) check(inst Instruction) []checkErr {
+	var errs []checkErr
+	srcs := sources(inst)
+	if d, ok := inst.(Dedup); ok {
+		srcs = append(srcs, d.Original)
+	}
+	// a link being relinked may be broken, only the link itself has to exist
+	if l, ok := inst.(Relink); ok && isLocal(c.fsys) {
+		if _, err := os.Lstat(l.Name); err == nil {
+			srcs = nil
+		}
+	}
+	for _, src := range srcs {
+		if !c.exists(src) {
+			errs = append(errs, checkErr{CheckMissing, fmt.Sprintf("%s doesn't exist", Quote(src))})
+		}
+	}
+
+	_, dst := inst.Paths()
+	switch inst.(type) {
+	case Rename, Copy:
+		exists, ok := c.state[filepath.Clean(dst)]
+		if !ok {
+			_, exists = conflictDst(c.fsys, inst)
+		}
+		if exists {
+			errs = append(errs, checkErr{CheckConflict, fmt.Sprintf("%s already exists", Quote(dst))})
+		}
+	case Archive, Compress, Encrypt:
+		if c.exists(dst) {
+			errs = append(errs, checkErr{CheckConflict, fmt.Sprintf("%s already exists", Quote(dst))})
+		}
+	}
+
+	if _, ok := inst.(Dedup); !ok && dst != "" {
+		if err := validateName(dst); err != nil {
+			errs = append(errs, checkErr{CheckName, err.Error()})
+		} else if isLocal(c.fsys) {
+			if err := checkLength(dst); err != nil {
+				errs = append(errs, checkErr{CheckName, err.Error()})
+			}
+		}
+	}
+	if !isLocal(c.fsys) {
+		return errs
+	}
+
+	for _, dir := range writeDirs(c.fsys, inst) {
+		if err := writable(dir); err != nil {
+			errs = append(errs, checkErr{CheckPermission, fmt.Sprintf("can't write to %s: %v", Quote(dir), err)})
+		}
+	}
+	if err := crossDevice(c.fsys, inst); err != nil {
+		errs = append(errs, checkErr{CheckDevice, err.Error()})
+	}
+
+	if from, to, ok := spaceUse(c.fsys, inst); ok && c.exists(from) {
+		size := Size(c.fsys, from)
+		for _, limit := range spaceLimits(existingDir(c.fsys, filepath.Dir(to))) {
+			if _, ok := c.free[limit.id]; !ok {
+				c.free[limit.id] = limit.free
+			}
+			c.need[limit.id] += size
+			if c.need[limit.id] > c.free[limit.id] {
+				errs = append(errs, checkErr{CheckSpace, fmt.Sprintf("copies need %s, only %s %s", FormatBytes(c.need[limit.id]), FormatBytes(c.free[limit.id]), limit.what)})
+			}
+		}
+	}
+	return errs
+}
+
+// apply records the paths an instruction creates and removes
+func (c *checker) apply(inst Instruction) {
+	set := func(path string, exists bool) { c.state[filepath.Clean(path)] = exists }
+	switch inst := inst.(type) {
+	case Rename:
+		set(inst.Before, inst.Link)
+		set(inst.After, true)
+	case Remove:
+		set(inst.Name, false)
+	case Copy:
+		set(inst.To, true)
+	case Mkdir:
+		set(inst.Name, true)
+	case Archive:
+		for _, name := range inst.Names {
+			set(name, false)
+		}
+		set(inst.To, true)
+	case Extract:
+		set(inst.Dir, true)
+		if inst.Remove {
+			set(inst.Name, false)
+		}
+	case Compress:
+		if !inst.Keep {
+			set(inst.Name, false)
+		}
+		set(inst.To, true)
+	case Encrypt:
+		set(inst.Name, false)
+		set(inst.to(), true)
+	}
+}
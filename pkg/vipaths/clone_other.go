@@ -0,0 +1,10 @@
+//go:build !darwin && !windows
+
+package vipaths
+
+import "errors"
+
+// cloneFile is only supported on macOS and windows
+func cloneFile(from, to string) error {
+	return errors.ErrUnsupported
+}
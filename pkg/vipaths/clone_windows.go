@@ -0,0 +1,29 @@
+package vipaths
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procCopyFileW = windows.NewLazySystemDLL("kernel32.dll").NewProc("CopyFileW")
+
+// cloneFile copies from to to with CopyFileW, which unlike copying the
+// contents keeps alternate data streams like Zone.Identifier and attributes
+// like hidden and readonly. it fails if to exists. like a regular copy, a
+// symlink at from is followed
+func cloneFile(from, to string) error {
+	fromPtr, err := windows.UTF16PtrFromString(from)
+	if err != nil {
+		return err
+	}
+	toPtr, err := windows.UTF16PtrFromString(to)
+	if err != nil {
+		return err
+	}
+	// fail if exists
+	if ok, _, err := procCopyFileW.Call(uintptr(unsafe.Pointer(fromPtr)), uintptr(unsafe.Pointer(toPtr)), 1); ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package vipaths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ways of resolving a conflict, where an instruction's destination already
+// exists when it's about to run
+const (
+	// ConflictOverwrite removes the existing destination first
+	ConflictOverwrite = "overwrite"
+	// ConflictSkip doesn't run the instruction
+	ConflictSkip = "skip"
+	// ConflictRename picks a free destination like "a (2).txt" instead
+	ConflictRename = "rename"
+	// ConflictAbort stops executing the plan
+	ConflictAbort = "abort"
+)
+
+// conflictDst returns the destination of a rename or copy if it already
+// exists and running the instruction would replace it. directories copied or
+// merged onto directories, and renames which only change case, don't conflict
+func conflictDst(fsys FS, inst Instruction) (string, bool) {
+	var src, dst string
+	switch inst := inst.(type) {
+	case Rename:
+		src, dst = inst.Before, inst.After
+	case Copy:
+		src, dst = inst.From, inst.To
+	default:
+		return "", false
+	}
+	dstStat, err := fsys.Stat(dst)
+	if err != nil {
+		return "", false
+	}
+	srcStat, err := fsys.Stat(src)
+	if err != nil {
+		return "", false
+	}
+	if os.SameFile(srcStat, dstStat) {
+		return "", false
+	}
+	if srcStat.IsDir() && dstStat.IsDir() {
+		if r, ok := inst.(Rename); !ok || r.Merge != "" {
+			return "", false
+		}
+	}
+	return dst, true
+}
+
+// resolveConflict returns the instruction to run after resolving a conflict on
+// dst, or nil to skip it
+func resolveConflict(fsys FS, inst Instruction, dst string, resolution string) (Instruction, error) {
+	switch resolution {
+	case ConflictOverwrite:
+		if err := fsys.RemoveAll(dst); err != nil {
+			return nil, fmt.Errorf("removing %q: %w", dst, err)
+		}
+		return inst, nil
+	case ConflictSkip:
+		return nil, nil
+	case ConflictRename:
+		free := freeName(fsys, dst)
+		mapper, ok := inst.(PathMapper)
+		if !ok {
+			return nil, fmt.Errorf("can't rename the destination of %q", OpName(inst))
+		}
+		return mapper.MapPaths(func(path string) string {
+			if path == dst {
+				return free
+			}
+			return path
+		}), nil
+	case ConflictAbort:
+		src, _ := inst.Paths()
+		return nil, fmt.Errorf("aborted, %w", &ExistsError{Op: OpName(inst), Src: src, Dst: dst})
+	default:
+		return nil, fmt.Errorf("unknown conflict resolution %q", resolution)
+	}
+}
+
+// freeName returns a name like "a (2).txt" for name which doesn't exist yet
+func freeName(fsys FS, name string) string {
+	dir, base := filepath.Split(name)
+	ext := filepath.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	for n := 2; ; n++ {
+		free := fmt.Sprintf("%s%s (%d)%s", dir, stem, n, ext)
+		if _, err := fsys.Stat(free); err != nil {
+			return free
+		}
+	}
+}
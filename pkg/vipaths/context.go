@@ -0,0 +1,96 @@
+package vipaths
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// ctxFS is the filesystem instructions are executed against, carrying the
+// context of the instruction so that long copies and commands can be
+// cancelled part way through
+type ctxFS struct {
+	FS
+	ctx context.Context
+}
+
+// ContextCopier is implemented by filesystems whose copies can be cancelled
+// part way through, rather than only between instructions
+type ContextCopier interface {
+	CopyContext(ctx context.Context, from, to string) error
+}
+
+func (c ctxFS) Copy(from, to string) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if copier, ok := unwrapFS(c.FS).(ContextCopier); ok {
+		return copier.CopyContext(c.ctx, from, to)
+	}
+	return c.FS.Copy(from, to)
+}
+
+// contextOf returns the context an instruction is being executed with
+func contextOf(fsys FS) context.Context {
+	if c, ok := fsys.(ctxFS); ok {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// copyChunk is how much is copied between checks for cancellation. copying
+// in chunks of a limited reader keeps the zero copy paths of io.Copy
+const copyChunk = 8 << 20
+
+// copyContext is io.Copy, stopping when ctx is done, reporting progress to
+// any progressFunc it carries, and keeping to any rateLimiter
+func copyContext(ctx context.Context, w io.Writer, r io.Reader) error {
+	progress, limit := progressOf(ctx), rateLimitOf(ctx)
+	chunk := int64(copyChunk)
+	if limit != nil {
+		chunk = limit.chunk()
+	}
+	var copied int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.CopyN(w, r, chunk)
+		if copied += n; progress != nil && n > 0 {
+			progress(copied)
+		}
+		if limit != nil && n > 0 {
+			if err := limit.wait(ctx, n); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runContext runs cmd, killing it if ctx is done first
+func runContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package vipaths
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Dedup replaces a file with a hard link to an identical original. The
+// contents are compared again before linking. Only local files can be
+// deduplicated
+type Dedup struct{ Name, Original string }
+
+func (d Dedup) Paths() (string, string) { return d.Name, d.Original }
+func (d Dedup) MapPaths(fn func(string) string) Instruction {
+	return Dedup{Name: fn(d.Name), Original: fn(d.Original)}
+}
+func (d Dedup) String() string {
+	return fmt.Sprintf("dedup %s\n   => %s", Quote(d.Name), Quote(d.Original))
+}
+func (d Dedup) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return errors.New("exe dedup: only local files can be deduplicated")
+	}
+	nameStat, err := os.Lstat(d.Name)
+	if err != nil {
+		return fmt.Errorf("exe dedup: %w", err)
+	}
+	origStat, err := os.Lstat(d.Original)
+	if err != nil {
+		return fmt.Errorf("exe dedup: %w", err)
+	}
+	if !nameStat.Mode().IsRegular() || !origStat.Mode().IsRegular() {
+		return fmt.Errorf("exe dedup: %q and %q must be regular files", d.Name, d.Original)
+	}
+	if os.SameFile(nameStat, origStat) {
+		return nil
+	}
+	same, err := sameContents(d.Name, d.Original)
+	if err != nil {
+		return fmt.Errorf("exe dedup: %w", err)
+	}
+	if !same {
+		return fmt.Errorf("exe dedup: %q and %q have different contents", d.Name, d.Original)
+	}
+
+	// link next to the duplicate and rename over it, so it's never missing
+	tmp := filepath.Join(filepath.Dir(d.Name), fmt.Sprintf(".vi-paths-dedup-%d", os.Getpid()))
+	if err := os.Link(d.Original, tmp); err != nil {
+		return fmt.Errorf("exe dedup: %w", err)
+	}
+	if err := os.Rename(tmp, d.Name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("exe dedup: %w", err)
+	}
+	return nil
+}
+
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	ra, rb := bufio.NewReader(fa), bufio.NewReader(fb)
+	bufa, bufb := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		na, erra := io.ReadFull(ra, bufa)
+		nb, errb := io.ReadFull(rb, bufb)
+		if !bytes.Equal(bufa[:na], bufb[:nb]) {
+			return false, nil
+		}
+		doneA := errors.Is(erra, io.EOF) || errors.Is(erra, io.ErrUnexpectedEOF)
+		doneB := errors.Is(errb, io.EOF) || errors.Is(errb, io.ErrUnexpectedEOF)
+		switch {
+		case erra != nil && !doneA:
+			return false, erra
+		case errb != nil && !doneB:
+			return false, errb
+		case doneA || doneB:
+			return doneA == doneB, nil
+		}
+	}
+}
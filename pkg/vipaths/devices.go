@@ -0,0 +1,62 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CheckDevices checks that the plan's local dedups stay on one filesystem.
+// A hard link can't cross onto another mount, and would fail halfway through
+// the plan otherwise. Every offending instruction is reported. Renames onto
+// another filesystem are fine, they're copied and removed
+func (p Plan) CheckDevices() error {
+	var errs []error
+	for _, inst := range p {
+		if err := crossDevice(OS, inst); err != nil {
+			src, dst := inst.Paths()
+			errs = append(errs, fmt.Errorf("%s -> %s: %w", Quote(src), Quote(dst), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// crossDevice fails if inst would link a file onto another filesystem
+func crossDevice(fsys FS, inst Instruction) error {
+	dedup, ok := inst.(Dedup)
+	if !ok {
+		return nil
+	}
+	to := filepath.Dir(dedup.Name)
+	if otherDevice(fsys, dedup.Original, to) {
+		return fmt.Errorf("%s is on a different filesystem to %s, so can't be linked", Quote(dedup.Original), Quote(to))
+	}
+	return nil
+}
+
+// crossesDevice reports whether inst is a rename of a local path onto another
+// filesystem, which is a copy and remove
+func crossesDevice(fsys FS, inst Instruction) bool {
+	n, ok := inst.(Rename)
+	return ok && otherDevice(fsys, n.Before, existingDir(fsys, filepath.Dir(n.After)))
+}
+
+// otherDevice reports whether the local paths from and to are on different
+// filesystems, when both exist
+func otherDevice(fsys FS, from, to string) bool {
+	if !isLocal(fsys) {
+		return false
+	}
+	fromStat, err := os.Lstat(from)
+	if err != nil {
+		return false
+	}
+	toStat, err := os.Stat(to)
+	if err != nil {
+		return false
+	}
+	fromDev, ok1 := DeviceID(fromStat)
+	toDev, ok2 := DeviceID(toStat)
+	return ok1 && ok2 && fromDev != toDev
+}
@@ -0,0 +1,78 @@
+package vipaths
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Encrypt encrypts a file for a recipient, then removes the plaintext. age is
+// used for age and ssh public keys, writing <name>.age, and gpg for anything
+// else, writing <name>.gpg. Only local files can be encrypted
+type Encrypt struct{ Name, Recipient string }
+
+func (e Encrypt) Paths() (string, string) { return e.Name, e.to() }
+func (e Encrypt) MapPaths(fn func(string) string) Instruction {
+	return Encrypt{Name: fn(e.Name), Recipient: e.Recipient}
+}
+func (e Encrypt) String() string {
+	return fmt.Sprintf("encrypt %s\n     -> %s for %s", Quote(e.Name), Quote(e.to()), e.Recipient)
+}
+func (e Encrypt) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return fmt.Errorf("exe encrypt: only local files can be encrypted")
+	}
+	stat, err := os.Stat(e.Name)
+	if err != nil {
+		return fmt.Errorf("exe encrypt: %w", err)
+	}
+	if !stat.Mode().IsRegular() {
+		return fmt.Errorf("exe encrypt: %q isn't a regular file", e.Name)
+	}
+	to := e.to()
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("exe encrypt: %w", &ExistsError{Op: "encrypt", Src: e.Name, Dst: to})
+	}
+
+	// encrypt next to the destination and rename into place, so a failure
+	// doesn't leave a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(to), ".vi-paths-encrypt-*")
+	if err != nil {
+		return fmt.Errorf("exe encrypt: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	var cmd *exec.Cmd
+	if e.age() {
+		cmd = exec.Command("age", "--encrypt", "--recipient", e.Recipient, "--output", tmp.Name(), e.Name)
+	} else {
+		cmd = exec.Command("gpg", "--batch", "--yes", "--encrypt", "--recipient", e.Recipient, "--output", tmp.Name(), e.Name)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	if err := runContext(contextOf(fsys), cmd); err != nil {
+		return fmt.Errorf("exe encrypt: running %s: %w", cmd.Args[0], err)
+	}
+	if err := os.Rename(tmp.Name(), to); err != nil {
+		return fmt.Errorf("exe encrypt: %w", err)
+	}
+	if err := fsys.RemoveAll(e.Name); err != nil {
+		return fmt.Errorf("exe removeall: %w", err)
+	}
+	return nil
+}
+
+// age reports whether the recipient is an age or ssh public key
+func (e Encrypt) age() bool {
+	return strings.HasPrefix(e.Recipient, "age1") || strings.HasPrefix(e.Recipient, "ssh-")
+}
+
+func (e Encrypt) to() string {
+	if e.age() {
+		return e.Name + ".age"
+	}
+	return e.Name + ".gpg"
+}
@@ -0,0 +1,357 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Errors returned by parsing and execution. Each is wrapped by a typed error
+// with the details, like LineCountError, which can be found with errors.As
+var (
+	// ErrLineCountMismatch is an edited buffer with a different number of
+	// lines to the paths it was written with, see LineCountError
+	ErrLineCountMismatch = errors.New("line count mismatch")
+	// ErrDestinationExists is an instruction which would replace an existing
+	// path, see ExistsError
+	ErrDestinationExists = errors.New("destination exists")
+	// ErrCycle is renames which move paths onto each other in a loop, like
+	// swapping two names, see CycleError
+	ErrCycle = errors.New("renames form a cycle")
+	// ErrProtectedPath is an instruction which would remove or move a path
+	// which must be kept, see ProtectedError
+	ErrProtectedPath = errors.New("path is protected")
+	// ErrLocked is a file which couldn't be renamed or removed because
+	// another process has it open, on windows, see LockedError
+	ErrLocked = errors.New("file is locked by another process")
+	// ErrIDMismatch is an edited buffer written with WriteTaggedBuffer whose
+	// line ids don't match its paths one to one, see IDError
+	ErrIDMismatch = errors.New("line ids don't match the paths")
+	// ErrCaseConflict is destinations which differ only by case, so would be
+	// the same file on a target filesystem which ignores case, see
+	// CaseConflictError
+	ErrCaseConflict = errors.New("destinations differ only by case")
+	// ErrKeptReplaced is an instruction which would replace a listed path
+	// whose line was left as it is, see KeptError
+	ErrKeptReplaced = errors.New("would replace a path left as it is")
+	// ErrDuplicateDestination is two instructions which would both write the
+	// same path, so the second would replace the first, see DuplicateError
+	ErrDuplicateDestination = errors.New("destination used twice")
+	// ErrAbandoned is an instruction which timed out and couldn't be
+	// stopped, so was left running. It may still change its paths, see
+	// Options.Timeout
+	ErrAbandoned = errors.New("abandoned while still running")
+)
+
+// ErrLineCount is ErrLineCountMismatch.
+//
+// Deprecated: use ErrLineCountMismatch
+var ErrLineCount = ErrLineCountMismatch
+
+// LineCountError is returned when an edited buffer has a different number of
+// lines to the paths it was written with
+type LineCountError struct {
+	Before, After int
+}
+
+func (e *LineCountError) Error() string {
+	return fmt.Sprintf("%v: before %d, after %d", ErrLineCountMismatch, e.Before, e.After)
+}
+func (e *LineCountError) Unwrap() error { return ErrLineCountMismatch }
+
+// IDError is returned by ReadTaggedChanges when paths are missing their line,
+// or lines have no id, an unknown one, or one used already
+type IDError struct {
+	// Missing are the ids of the paths without a line
+	Missing []int
+	// Lines are the numbers of the lines with a bad id, counting from 1
+	Lines []int
+}
+
+func (e *IDError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		ids := make([]string, len(e.Missing))
+		for i, id := range e.Missing {
+			ids[i] = fmt.Sprintf("#%d", id)
+		}
+		parts = append(parts, "no lines for "+strings.Join(ids, ", "))
+	}
+	if len(e.Lines) > 0 {
+		nums := make([]string, len(e.Lines))
+		for i, n := range e.Lines {
+			nums[i] = fmt.Sprint(n)
+		}
+		lines := "lines"
+		if len(nums) == 1 {
+			lines = "line"
+		}
+		parts = append(parts, "missing, unknown, or repeated ids on "+lines+" "+strings.Join(nums, ", "))
+	}
+	return fmt.Sprintf("%v: %s", ErrIDMismatch, strings.Join(parts, ", "))
+}
+func (e *IDError) Unwrap() error { return ErrIDMismatch }
+
+// ExistsError is returned when an instruction's destination already exists
+// and it won't replace it
+type ExistsError struct {
+	// Op is the name of the instruction, like "archive", see OpName
+	Op string
+	// Src is empty for archives, which have several
+	Src, Dst string
+}
+
+func (e *ExistsError) Error() string { return fmt.Sprintf("%q already exists", e.Dst) }
+func (e *ExistsError) Unwrap() error { return ErrDestinationExists }
+
+// KeptError is returned by Plan.CheckKept for an instruction which would
+// replace Dst, a listed path whose line was left as it is
+type KeptError struct {
+	Op       string
+	Src, Dst string
+}
+
+func (e *KeptError) Error() string {
+	return fmt.Sprintf("%s would replace %s, which is listed and left as it is", Quote(e.Src), Quote(e.Dst))
+}
+func (e *KeptError) Unwrap() error { return ErrKeptReplaced }
+
+// CycleError is returned by Parse for renames which move paths onto each
+// other in a loop, since running them in any order would replace a path
+// before it was moved out of the way. Paths are the sources in the loop, each
+// renamed to the next, and the last to the first
+type CycleError struct {
+	Paths []string
+}
+
+func (e *CycleError) Error() string {
+	quoted := make([]string, 0, len(e.Paths)+1)
+	for _, path := range append(e.Paths, e.Paths[0]) {
+		quoted = append(quoted, Quote(path))
+	}
+	return fmt.Sprintf("%v: %s, rename one to a temporary name first", ErrCycle, strings.Join(quoted, " -> "))
+}
+func (e *CycleError) Unwrap() error { return ErrCycle }
+
+// DuplicateError is returned by Parse for an instruction whose destination
+// Dst is also the destination of an earlier one, from Other. Src is the source
+// of the later instruction
+type DuplicateError struct {
+	Src, Other, Dst string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%v: %s and %s both go to %s", ErrDuplicateDestination, Quote(e.Other), Quote(e.Src), Quote(e.Dst))
+}
+func (e *DuplicateError) Unwrap() error { return ErrDuplicateDestination }
+
+// ProtectedError is returned by Parse for an instruction which would remove or
+// move a protected path, see ParseOptions.Protected
+type ProtectedError struct {
+	Op   string
+	Path string
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("%v: can't %s %s", ErrProtectedPath, e.Op, Quote(e.Path))
+}
+func (e *ProtectedError) Unwrap() error { return ErrProtectedPath }
+
+// CaseConflictError is returned by Parse for a destination which differs only
+// by case from an earlier one, or from a directory of one, when checking
+// against a target filesystem which ignores case, see ParseOptions.TargetFS.
+// Src is the source of the instruction with the destination Dst
+type CaseConflictError struct {
+	TargetFS        string
+	Src, Dst, Other string
+}
+
+func (e *CaseConflictError) Error() string {
+	return fmt.Sprintf("%v on %s: %s and %s", ErrCaseConflict, e.TargetFS, Quote(e.Other), Quote(e.Dst))
+}
+func (e *CaseConflictError) Unwrap() error { return ErrCaseConflict }
+
+// LockedError is returned when a file is still locked by another process
+// after retrying. Processes are those holding it, like "WINWORD.EXE (1234)",
+// where they could be found. It unwraps to both ErrLocked and Err
+type LockedError struct {
+	Path      string
+	Processes []string
+	Err       error
+}
+
+func (e *LockedError) Error() string {
+	if len(e.Processes) == 0 {
+		return fmt.Sprintf("%s: %v", Quote(e.Path), ErrLocked)
+	}
+	return fmt.Sprintf("%s: file is locked by %s", Quote(e.Path), strings.Join(e.Processes, ", "))
+}
+func (e *LockedError) Unwrap() []error { return []error{ErrLocked, e.Err} }
+
+// UnknownCommandError is a line which looks like a mistyped command, like
+// `cpoy dest`, rather than a new name for Path. Parse fails with it when
+// ParseOptions.Strict is set
+type UnknownCommandError struct {
+	Path, Word string
+	// Command is the command Word is closest to
+	Command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unknown command %q, did you mean %s?", e.Word, e.Command)
+}
+
+// ParseError is returned by Parse for a line which couldn't be parsed. Path
+// is the line's original path, and Line what it was edited to
+type ParseError struct {
+	Path, Line string
+	Err        error
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// findCycle returns the first loop of renames in the plan, where each is
+// renamed onto the source of the next
+func findCycle(plan Plan) []string {
+	next := map[string]string{}
+	var order []string
+	for _, inst := range plan {
+		if r, ok := inst.(Rename); ok {
+			before, after := filepath.Clean(r.Before), filepath.Clean(r.After)
+			if before != after {
+				next[before] = after
+				order = append(order, before)
+			}
+		}
+	}
+	done := map[string]bool{}
+	for _, start := range order {
+		var path []string
+		seen := map[string]int{}
+		for p, ok := start, true; ok && !done[p]; p, ok = next[p] {
+			if i, loop := seen[p]; loop {
+				return path[i:]
+			}
+			seen[p] = len(path)
+			path = append(path, p)
+		}
+		for _, p := range path {
+			done[p] = true
+		}
+	}
+	return nil
+}
+
+// duplicateDst returns the first rename or copy onto the destination of an
+// earlier one. renames merging into a directory and copies of a directory's
+// contents add to what's there, so can share one
+func duplicateDst(plan Plan) *DuplicateError {
+	seen := map[string]string{}
+	for _, inst := range plan {
+		switch inst := inst.(type) {
+		case Rename:
+			if inst.Merge != "" {
+				continue
+			}
+		case Copy:
+			if inst.Contents {
+				continue
+			}
+		default:
+			continue
+		}
+		src, dst := inst.Paths()
+		clean := filepath.Clean(dst)
+		if other, ok := seen[clean]; ok {
+			return &DuplicateError{Src: src, Other: other, Dst: dst}
+		}
+		seen[clean] = src
+	}
+	return nil
+}
+
+// orderVacates moves each instruction which writes to a path, along with the
+// rest of its chain after it, to after a later one which moves or removes
+// what's there, like a -> b before b -> c, so nothing is replaced before it's
+// out of the way. depth order and removes-last can both put them the wrong
+// way round. cycles are found first, so the moves always settle
+func orderVacates(plan Plan) Plan {
+	for moved := true; moved; {
+		moved = false
+		for i, inst := range plan {
+			_, dst := inst.Paths()
+			if dst == "" || !replacesDst(inst) {
+				continue
+			}
+			dst = filepath.Clean(dst)
+			j := slices.IndexFunc(plan[i+1:], func(later Instruction) bool {
+				return slices.ContainsFunc(movedAway(later), func(p string) bool { return filepath.Clean(p) == dst })
+			})
+			if j < 0 {
+				continue
+			}
+			j += i + 1
+			// the chain after it works on what it wrote, so goes with it
+			end := i + 1
+			for end < j && slices.ContainsFunc(sources(plan[end]), func(p string) bool { return filepath.Clean(p) == dst }) {
+				end++
+			}
+			run := slices.Clone(plan[i:end])
+			plan = slices.Insert(slices.Delete(plan, i, end), j+1-len(run), run...)
+			moved = true
+			break
+		}
+	}
+	return plan
+}
+
+// replacesDst reports whether an instruction makes a new file or directory at
+// its destination. mkdir is fine with one already there, extract unpacks into
+// it, and dedup links to it
+func replacesDst(inst Instruction) bool {
+	switch inst.(type) {
+	case Mkdir, Extract, Dedup:
+		return false
+	}
+	return true
+}
+
+// movedAway returns the paths an instruction removes or moves away
+func movedAway(inst Instruction) []string {
+	switch inst := inst.(type) {
+	case Rename:
+		return []string{inst.Before}
+	case Remove:
+		return []string{inst.Name}
+	case Archive:
+		return inst.Names
+	case Extract:
+		if inst.Remove {
+			return []string{inst.Name}
+		}
+	case Compress:
+		if !inst.Keep {
+			return []string{inst.Name}
+		}
+	case Encrypt, Dedup:
+		src, _ := inst.Paths()
+		return []string{src}
+	}
+	return nil
+}
+
+// protected returns the path an instruction removes or moves away which is
+// protected, either by protect or by being a filesystem root, the current
+// directory, or its parent
+func protected(inst Instruction, protect func(string) bool) (string, bool) {
+	for _, path := range movedAway(inst) {
+		clean := filepath.Clean(path)
+		if clean == "." || clean == ".." || filepath.Dir(clean) == clean || protect != nil && protect(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
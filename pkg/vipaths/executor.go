@@ -0,0 +1,73 @@
+package vipaths
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Executor executes plans with the same Options, for tools which run many of
+// them, like a bot or a server. It's safe to use from several goroutines at
+// once, though plans executed together shouldn't touch the same paths.
+//
+// Hooks like Pre, Post, OnConflict, and Progress are called from every plan
+// being executed, so may be called concurrently when plans are. Stats, if
+// set, turns on totalling every plan executed, read with Executor.Stats
+// rather than from the Stats given, which isn't written to. Snapshot
+// belongs to a single listing, so is usually set per plan with ExecuteWith
+type Executor struct {
+	opts Options
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewExecutor returns an Executor for opts, which are copied
+func NewExecutor(opts Options) *Executor {
+	return &Executor{opts: opts}
+}
+
+// Options returns a copy of the executor's options
+func (e *Executor) Options() Options {
+	return e.opts
+}
+
+// Execute runs the plan as ExecuteContext does
+func (e *Executor) Execute(ctx context.Context, plan Plan) error {
+	return e.ExecuteWith(ctx, plan, nil)
+}
+
+// ExecuteWith runs the plan with the executor's options changed by fn, like
+// to set a Snapshot or turn on DryRun for one plan. fn gets a copy, so
+// changes don't last beyond the plan
+func (e *Executor) ExecuteWith(ctx context.Context, plan Plan, fn func(*Options)) error {
+	opts := e.opts
+	if fn != nil {
+		fn(&opts)
+	}
+	if opts.Stats == nil {
+		return ExecuteContext(ctx, plan, opts)
+	}
+	// each plan is counted on its own, then added to the total
+	var stats Stats
+	opts.Stats = &stats
+	err := ExecuteContext(ctx, plan, opts)
+	e.mu.Lock()
+	e.stats.add(stats)
+	e.mu.Unlock()
+	return err
+}
+
+// Stats returns the totals of every plan executed so far, when Options.Stats
+// was set
+func (e *Executor) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Stats{
+		Counts:  maps.Clone(e.stats.Counts),
+		Bytes:   maps.Clone(e.stats.Bytes),
+		Elapsed: e.stats.Elapsed,
+		Timings: slices.Clone(e.stats.Timings),
+	}
+}
@@ -0,0 +1,73 @@
+package vipaths
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// Expand replaces a leading ~ or ~user with a home directory, and $VAR or ${VAR}
+// with environment variables. Unset variables are an error, rather than
+// silently expanding to an empty path element
+func Expand(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		name, rest, _ := strings.Cut(path[1:], string(filepath.Separator))
+		var home string
+		if name == "" {
+			h, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("finding home dir: %w", err)
+			}
+			home = h
+		} else {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", fmt.Errorf("finding home dir for %q: %w", name, err)
+			}
+			home = u.HomeDir
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	var missing []string
+	path = os.Expand(path, func(key string) string {
+		v, ok := os.LookupEnv(key)
+		if !ok {
+			missing = append(missing, key)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unset variable $%s", strings.Join(missing, ", $"))
+	}
+	return path, nil
+}
+
+// ExpandTemplate replaces {dir}, {base}, {name}, and {ext} in a destination
+// with the directory, base name, base name without extension, and extension
+// of src, the path it was edited from. so `{dir}/archive/{base}` moves a file
+// into an archive directory next to it. Other braces are left alone, as is
+// everything when src is empty
+func ExpandTemplate(dst, src string) string {
+	if src == "" || !strings.Contains(dst, "{") {
+		return dst
+	}
+	base := filepath.Base(src)
+	ext := filepath.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	expanded := strings.NewReplacer(
+		"{dir}", filepath.Dir(src),
+		"{base}", base,
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", ext,
+	).Replace(dst)
+	if expanded == dst {
+		return dst
+	}
+	// {dir} of a name in the working directory is "."
+	return filepath.Clean(expanded)
+}
@@ -0,0 +1,121 @@
+package vipaths
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// finderTagsAttr holds a file's Finder tags, as a binary property list of
+// their names
+const finderTagsAttr = finderMetadataPrefix + "_kMDItemUserTags"
+
+// Tag sets the Finder tags of a file or directory on macOS, replacing any it
+// had. With no tags, they're cleared
+type Tag struct {
+	Name string
+	Tags []string
+}
+
+func (t Tag) Paths() (string, string) { return t.Name, "" }
+func (t Tag) MapPaths(fn func(string) string) Instruction {
+	return Tag{Name: fn(t.Name), Tags: t.Tags}
+}
+func (t Tag) String() string {
+	if len(t.Tags) == 0 {
+		return fmt.Sprintf("untag %s", Quote(t.Name))
+	}
+	return fmt.Sprintf("tag %s\n    => %s", Quote(t.Name), strings.Join(t.Tags, ", "))
+}
+func (t Tag) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return errors.New("exe tag: only local paths can be tagged")
+	}
+	if len(t.Tags) == 0 {
+		if err := removeXattr(t.Name, finderTagsAttr); err != nil && !errors.Is(err, errNoXattr) {
+			return fmt.Errorf("exe untag: %w", err)
+		}
+		return nil
+	}
+	if err := setXattr(t.Name, finderTagsAttr, encodeTags(t.Tags)); err != nil {
+		return fmt.Errorf("exe tag: %w", err)
+	}
+	return nil
+}
+
+// splitTags splits a comma separated list of tags, as typed after the tag
+// command
+func splitTags(s string) []string {
+	var tags []string
+	for tag := range strings.SplitSeq(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// encodeTags encodes tags as a binary property list holding an array of
+// strings, which is how Finder stores them
+func encodeTags(tags []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("bplist00")
+
+	// the array is the first object, referring to the strings after it by
+	// their index in the offset table
+	offsets := []int{buf.Len()}
+	writePlistMarker(&buf, 0xa0, len(tags))
+	for i := range tags {
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i+1)))
+	}
+	for _, tag := range tags {
+		offsets = append(offsets, buf.Len())
+		if isASCII(tag) {
+			writePlistMarker(&buf, 0x50, len(tag))
+			buf.WriteString(tag)
+			continue
+		}
+		units := utf16.Encode([]rune(tag))
+		writePlistMarker(&buf, 0x60, len(units))
+		for _, u := range units {
+			buf.Write(binary.BigEndian.AppendUint16(nil, u))
+		}
+	}
+
+	table := buf.Len()
+	for _, offset := range offsets {
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(offset)))
+	}
+	// the trailer gives 4 byte offsets, 2 byte object references, the number
+	// of objects, the top object, and where the offset table starts
+	buf.Write(make([]byte, 6))
+	buf.Write([]byte{4, 2})
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(len(offsets))))
+	buf.Write(binary.BigEndian.AppendUint64(nil, 0))
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(table)))
+	return buf.Bytes()
+}
+
+// writePlistMarker writes the marker of an object of kind with n elements.
+// counts of 15 or more follow the marker as a 4 byte integer object
+func writePlistMarker(buf *bytes.Buffer, kind byte, n int) {
+	if n < 15 {
+		buf.WriteByte(kind | byte(n))
+		return
+	}
+	buf.WriteByte(kind | 0x0f)
+	buf.WriteByte(0x12)
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
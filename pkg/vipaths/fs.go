@@ -0,0 +1,203 @@
+package vipaths
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FS is the filesystem instructions are executed against
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	Rename(oldname, newname string) error
+	RemoveAll(name string) error
+	// Copy copies the contents and mode of the regular file from to the path to
+	Copy(from, to string) error
+	MkdirAll(name string, perm fs.FileMode) error
+}
+
+// Globber is implemented by filesystems which can expand glob patterns, for
+// listing remote paths where a local shell can't
+type Globber interface {
+	Glob(pattern string) ([]string, error)
+}
+
+// OS is an FS backed by the local disk
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+func (osFS) Rename(oldname, newname string) error {
+	return retryLocked(func() error { return os.Rename(oldname, newname) })
+}
+func (osFS) RemoveAll(name string) error {
+	return retryLocked(func() error { return os.RemoveAll(name) })
+}
+func (osFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+func (osFS) Chmod(name string, mode fs.FileMode) error    { return os.Chmod(name, mode) }
+func (osFS) Chown(name string, uid, gid int) error        { return os.Chown(name, uid, gid) }
+func (osFS) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (f osFS) Copy(from, to string) error {
+	return f.CopyContext(context.Background(), from, to)
+}
+func (osFS) CopyContext(ctx context.Context, from, to string) error {
+	if err := copyContents(ctx, from, to); err != nil {
+		return err
+	}
+	// a new file is labeled for its directory, so keep the original's. like
+	// the contents, they come from where a symlink points
+	if target, err := filepath.EvalSymlinks(from); err == nil {
+		from = target
+	}
+	if err := copyXattrs(from, to); err != nil {
+		return fmt.Errorf("xattrs: %w", err)
+	}
+	return nil
+}
+
+// copyContents copies the file, removing a partial copy if it's cancelled
+// or fails part way through. special files are made again rather than read
+func copyContents(ctx context.Context, from, to string) error {
+	if stat, err := os.Stat(from); err == nil && isSpecial(stat.Mode()) {
+		return makeSpecial(to, stat)
+	}
+	// clone where possible, otherwise fall back to copying the contents
+	if err := cloneFile(from, to); err == nil {
+		return nil
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	if err := copyContext(ctx, out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return fmt.Errorf("copy: %w", err)
+	}
+	return out.Close()
+}
+
+// ReadDirer is implemented by filesystems which can list directories, needed
+// for merging directories
+type ReadDirer interface {
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// Chmoder is implemented by filesystems which can change modes, so that
+// directories can be created with an exact mode regardless of the umask, and
+// for the chmod command
+type Chmoder interface {
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// Symlinker is implemented by filesystems which can make symlinks, for
+// leaving one behind at a renamed path
+type Symlinker interface {
+	Symlink(oldname, newname string) error
+}
+
+// Chtimeser is implemented by filesystems which can change access and
+// modification times, for the touch command
+type Chtimeser interface {
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// Chowner is implemented by filesystems which can change owners, so that
+// directories can be created with the owner of their parent or a given one
+type Chowner interface {
+	Chown(name string, uid, gid int) error
+}
+
+// Owner is a numeric user and group id
+type Owner struct{ UID, GID int }
+
+// unwrapFS returns the filesystem under any wrapping done by Execute, for
+// checking optional interfaces
+func unwrapFS(fsys FS) FS {
+	for {
+		switch f := fsys.(type) {
+		case ctxFS:
+			fsys = f.FS
+		case dirFS:
+			fsys = f.FS
+		default:
+			return fsys
+		}
+	}
+}
+
+// dirFS sets the mode and owner of every directory it creates, or copies
+// them from the closest existing ancestor when inheriting and unset
+type dirFS struct {
+	FS
+	mode    fs.FileMode
+	owner   *Owner
+	inherit bool
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	var missing []string
+	var parent fs.FileInfo
+	for dir := filepath.Clean(name); ; dir = filepath.Dir(dir) {
+		if stat, err := d.FS.Stat(dir); err == nil {
+			parent = stat
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	mode, owner := d.mode, d.owner
+	if d.inherit && parent != nil {
+		if mode == 0 {
+			mode = parent.Mode() & (fs.ModePerm | fs.ModeSetgid | fs.ModeSticky)
+		}
+		if o, ok := FileOwner(parent); ok && owner == nil {
+			owner = &o
+		}
+	}
+	if err := d.FS.MkdirAll(name, cmp.Or(d.mode, perm)); err != nil {
+		return err
+	}
+	// filesystems without modes keep whatever MkdirAll gave them
+	chmoder, _ := d.FS.(Chmoder)
+	for i, dir := range missing {
+		// parents are asked for with 0777, anything else is a copied
+		// directory's own mode, which is only replaced by an exact mode
+		if chmoder != nil && mode != 0 && (i > 0 || perm == 0777 || d.mode != 0) {
+			if err := chmoder.Chmod(dir, mode); err != nil {
+				return err
+			}
+		}
+		if owner != nil {
+			chowner, ok := d.FS.(Chowner)
+			if !ok {
+				return errors.New("filesystem can't change owners")
+			}
+			if err := chowner.Chown(dir, owner.UID, owner.GID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package vipaths
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// syncInstruction flushes what a local copy or rename wrote to disk: the
+// copied file, and the directories an entry was added to or removed from.
+// directories created for the destination are new entries in their parents
+// too, so every directory up to the one shared with the source is synced.
+// other instructions are left alone
+func syncInstruction(inst Instruction) error {
+	src, dst := inst.Paths()
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	switch inst.(type) {
+	case Copy:
+		paths = append(paths, absDst)
+	case Rename:
+		paths = append(paths, filepath.Dir(absSrc))
+	default:
+		return nil
+	}
+	common := CommonDir([]string{absSrc, absDst})
+	for dir := filepath.Dir(absDst); ; dir = filepath.Dir(dir) {
+		paths = append(paths, dir)
+		if !isWithin(dir, common) || dir == common || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if err := syncPath(path); err != nil {
+			return fmt.Errorf("syncing %s: %w", Quote(path), err)
+		}
+	}
+	return nil
+}
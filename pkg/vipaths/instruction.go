@@ -0,0 +1,306 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Instruction is a single operation in a plan
+type Instruction interface {
+	String() string
+	Execute(fsys FS) error
+	// Paths returns the source and destination of the instruction, the
+	// destination being empty if there is none
+	Paths() (src, dst string)
+}
+
+// Rename moves a file or directory, creating the destination's parents. A
+// local path moved onto another filesystem is copied and then removed. If
+// Merge is set to one of the merge policies, a directory renamed onto an
+// existing directory has its contents merged into it
+type Rename struct {
+	Before, After string
+	Merge         string
+	// Link leaves a symlink at Before pointing to After, so references to the
+	// old path keep working
+	Link bool
+}
+
+func (n Rename) Paths() (string, string) { return n.Before, n.After }
+func (n Rename) MapPaths(fn func(string) string) Instruction {
+	return Rename{Before: fn(n.Before), After: fn(n.After), Merge: n.Merge, Link: n.Link}
+}
+func (n Rename) String() string {
+	if n.Link {
+		return fmt.Sprintf("rename %s\n    -> %s, leaving a symlink", Quote(n.Before), Quote(n.After))
+	}
+	return fmt.Sprintf("rename %s\n    -> %s", Quote(n.Before), Quote(n.After))
+}
+func (n Rename) Execute(fsys FS) error {
+	if err := n.move(fsys); err != nil {
+		return err
+	}
+	if n.Link {
+		linker, ok := unwrapFS(fsys).(Symlinker)
+		if !ok {
+			return errors.New("exe symlink: the filesystem can't make symlinks")
+		}
+		if err := linker.Symlink(linkTarget(n.Before, n.After), n.Before); err != nil {
+			return fmt.Errorf("exe symlink: %w", err)
+		}
+	}
+	return nil
+}
+
+func (n Rename) move(fsys FS) error {
+	if n.Merge != "" {
+		before, errBefore := fsys.Stat(n.Before)
+		after, errAfter := fsys.Stat(n.After)
+		if errBefore == nil && errAfter == nil && before.IsDir() && after.IsDir() {
+			if err := mergeDirs(fsys, n.Before, n.After, n.Merge); err != nil {
+				return fmt.Errorf("exe merge: %w", err)
+			}
+			return nil
+		}
+	}
+	if err := fsys.MkdirAll(filepath.Dir(n.After), 0777); err != nil {
+		return fmt.Errorf("exe mkdirall: %w", err)
+	}
+	if err := rename(fsys, n.Before, n.After); err != nil {
+		return fmt.Errorf("exe rename: %w", err)
+	}
+	return nil
+}
+
+// linkTarget is what a symlink at link points to reach target, relative to
+// the link's directory so the pair can be moved together, or target as it is
+// when one is absolute and the other isn't
+func linkTarget(link, target string) string {
+	rel, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		return target
+	}
+	return rel
+}
+
+// Remove removes a file or directory and everything in it. With Trash, a
+// local path is moved to the trash instead, see MoveToTrash
+type Remove struct {
+	Name  string
+	Trash bool
+}
+
+func (v Remove) Paths() (string, string) { return v.Name, "" }
+func (v Remove) MapPaths(fn func(string) string) Instruction {
+	return Remove{Name: fn(v.Name), Trash: v.Trash}
+}
+func (v Remove) String() string {
+	if v.Trash {
+		return fmt.Sprintf("remove %s, to the trash", Quote(v.Name))
+	}
+	return fmt.Sprintf("remove %s", Quote(v.Name))
+}
+func (v Remove) Execute(fsys FS) error {
+	if v.Trash {
+		if !isLocal(fsys) {
+			return errors.New("exe trash: only local paths can be moved to the trash")
+		}
+		entry, err := MoveToTrash(v.Name)
+		if err != nil {
+			return fmt.Errorf("exe trash: %w", err)
+		}
+		trashed(fsys, entry)
+		return nil
+	}
+	if err := fsys.RemoveAll(v.Name); err != nil {
+		return fmt.Errorf("exe remove all: %w", err)
+	}
+	return nil
+}
+
+// Mkdir makes a directory and any missing parents, so a reorganisation can
+// create the directories it then moves files into
+type Mkdir struct{ Name string }
+
+func (v Mkdir) Paths() (string, string) { return "", v.Name }
+func (v Mkdir) MapPaths(fn func(string) string) Instruction {
+	return Mkdir{Name: fn(v.Name)}
+}
+func (v Mkdir) String() string { return fmt.Sprintf("mkdir %s", Quote(v.Name)) }
+func (v Mkdir) Execute(fsys FS) error {
+	if err := fsys.MkdirAll(v.Name, 0777); err != nil {
+		return fmt.Errorf("exe mkdirall: %w", err)
+	}
+	return nil
+}
+
+// Copy copies a file, or creates an empty directory with the same mode. FIFOs
+// and device nodes are made again rather than read, failing with
+// ErrSpecialFile where they can't be, like sockets. With
+// Contents, like rsync with a trailing slash on the source, everything in the
+// directory From is copied into To, which may already exist
+type Copy struct {
+	From, To string
+	Contents bool
+}
+
+func (c Copy) Paths() (string, string) { return c.From, c.To }
+func (c Copy) MapPaths(fn func(string) string) Instruction {
+	return Copy{From: fn(c.From), To: fn(c.To), Contents: c.Contents}
+}
+func (c Copy) String() string {
+	if c.Contents {
+		return fmt.Sprintf("copy contents of %s\n  into %s", Quote(c.From), Quote(c.To))
+	}
+	return fmt.Sprintf("copy %s\n  -> %s", Quote(c.From), Quote(c.To))
+}
+func (c Copy) Execute(fsys FS) error {
+	stat, err := fsys.Stat(c.From)
+	if err != nil {
+		return fmt.Errorf("exe stat: %w", err)
+	}
+	if stat.IsDir() && c.Contents {
+		rd, ok := unwrapFS(fsys).(ReadDirer)
+		if !ok {
+			return errors.New("exe copy: copying contents isn't supported on this filesystem")
+		}
+		if err := copyDir(fsys, rd, c.From, c.To, stat); err != nil {
+			return fmt.Errorf("exe copy: %w", err)
+		}
+		return nil
+	}
+	if stat.IsDir() {
+		if err := fsys.MkdirAll(c.To, stat.Mode().Perm()); err != nil {
+			return fmt.Errorf("exe mkdirall: %w", err)
+		}
+		// files copied into it afterwards inherit its default ACL
+		if isLocal(fsys) {
+			if err := copyXattrs(c.From, c.To); err != nil {
+				return fmt.Errorf("exe xattrs: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := fsys.MkdirAll(filepath.Dir(c.To), 0777); err != nil {
+		return fmt.Errorf("exe mkdirall: %w", err)
+	}
+	if err := fsys.Copy(c.From, c.To); skipSpecial(fsys, c.From, err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("exe copy: %w", err)
+	}
+	return keepOwner(fsys, stat, c.To)
+}
+
+// copyDir copies the directory from, described by stat, and everything in it
+// into to, making to if it doesn't exist and replacing files already in it.
+// symlinks are copied as what they point to, like any copy, but links to
+// directories aren't descended into, so a loop can't copy forever
+func copyDir(fsys FS, rd ReadDirer, from, to string, stat fs.FileInfo) error {
+	if err := fsys.MkdirAll(to, stat.Mode().Perm()); err != nil {
+		return err
+	}
+	if isLocal(fsys) {
+		if err := copyXattrs(from, to); err != nil {
+			return err
+		}
+	}
+	entries, err := rd.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		src := filepath.Join(from, entry.Name())
+		dst := filepath.Join(to, entry.Name())
+		stat, err := fsys.Stat(src)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if err := copyDir(fsys, rd, src, dst, stat); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fsys.Copy(src, dst); skipSpecial(fsys, src, err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := keepOwner(fsys, stat, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepOwner gives a local copy of a file made as root the owner, group, exact
+// mode, and modification time of the original described by stat, so moving
+// between filesystems with copy and rm is indistinguishable from a rename.
+// other users can't give files away, so their copies are left as their own,
+// and copied directories follow the directory mode and owner options instead
+func keepOwner(fsys FS, stat fs.FileInfo, to string) error {
+	if _, ok := FileOwner(stat); !ok || !isLocal(fsys) || os.Geteuid() != 0 {
+		return nil
+	}
+	return keepMetadata(stat, to)
+}
+
+// keepMetadata gives the local path to the exact mode and modification time
+// of the original described by stat, and as root its owner and group
+func keepMetadata(stat fs.FileInfo, to string) error {
+	if owner, ok := FileOwner(stat); ok && os.Geteuid() == 0 {
+		if err := os.Lchown(to, owner.UID, owner.GID); err != nil {
+			return fmt.Errorf("exe chown: %w", err)
+		}
+	}
+	// changing the owner clears the setuid and setgid bits
+	if err := os.Chmod(to, stat.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return fmt.Errorf("exe chmod: %w", err)
+	}
+	if err := os.Chtimes(to, time.Time{}, stat.ModTime()); err != nil {
+		return fmt.Errorf("exe chtimes: %w", err)
+	}
+	return nil
+}
+
+// Shell runs an arbitrary shell command for a path. {} is replaced with the path,
+// {.} without its extension, {/} with its base name, {//} with its directory, and
+// {/.} with its base name without extension
+type Shell struct{ Name, Command string }
+
+func (s Shell) Paths() (string, string) { return s.Name, "" }
+func (s Shell) MapPaths(fn func(string) string) Instruction {
+	return Shell{Name: fn(s.Name), Command: s.Command}
+}
+func (s Shell) String() string { return fmt.Sprintf("shell %s", s.Expand()) }
+
+// Execute runs the command on the local machine, whatever the FS
+func (s Shell) Execute(fsys FS) error {
+	cmd := ShellCommand(s.Expand())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := runContext(contextOf(fsys), cmd); err != nil {
+		return fmt.Errorf("exe shell: %w", err)
+	}
+	return nil
+}
+
+// Expand returns the command with the placeholders replaced for the path,
+// each quoted for ShellCommand
+func (s Shell) Expand() string {
+	base := filepath.Base(s.Name)
+	return strings.NewReplacer(
+		"{}", ShellQuote(s.Name),
+		"{.}", ShellQuote(strings.TrimSuffix(s.Name, filepath.Ext(s.Name))),
+		"{/}", ShellQuote(base),
+		"{//}", ShellQuote(filepath.Dir(s.Name)),
+		"{/.}", ShellQuote(strings.TrimSuffix(base, filepath.Ext(base))),
+	).Replace(s.Command)
+}
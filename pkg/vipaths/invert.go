@@ -0,0 +1,70 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Invert returns a plan which undoes the plan, in reverse order. Renames are
+// reversed, copies are removed, and archives are extracted again. Removes,
+// extracts, and anything else which loses information can't be undone, and
+// are reported together as an error
+func (p Plan) Invert() (Plan, error) {
+	var inverted Plan
+	var errs []error
+	for i := len(p) - 1; i >= 0; i-- {
+		inst, err := invert(p[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("operation %d, %s %s: %w", i+1, OpName(p[i]), Quote(firstPath(p[i])), err))
+			continue
+		}
+		inverted = append(inverted, inst)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return inverted, nil
+}
+
+func invert(inst Instruction) (Instruction, error) {
+	switch inst := inst.(type) {
+	case Rename:
+		if inst.Merge != "" {
+			return nil, errors.New("can't undo a rename which may have merged directories")
+		}
+		if inst.Link {
+			return nil, errors.New("can't undo a rename which left a symlink")
+		}
+		return Rename{Before: inst.After, After: inst.Before}, nil
+	case Copy:
+		if inst.Contents {
+			return nil, errors.New("can't undo copying contents into a directory which may have existed before")
+		}
+		return Remove{Name: inst.To}, nil
+	case Archive:
+		return Extract{Name: inst.To, Dir: CommonDir(inst.Names), Remove: true}, nil
+	case Compress:
+		if !inst.Keep {
+			return nil, errors.New("can't undo compressing without keeping the original")
+		}
+		return Remove{Name: inst.To}, nil
+	case Remove:
+		if inst.Trash {
+			return nil, errors.New("can't undo a remove, restore it from the trash instead")
+		}
+		return nil, errors.New("can't undo a remove")
+	case Mkdir:
+		return nil, errors.New("can't undo a mkdir, the directory may have existed before")
+	}
+	return nil, fmt.Errorf("can't undo %s", OpName(inst))
+}
+
+// firstPath is the path an instruction is reported by, its first source, or
+// its destination when it has none
+func firstPath(inst Instruction) string {
+	if srcs := sources(inst); len(srcs) > 0 {
+		return srcs[0]
+	}
+	_, dst := inst.Paths()
+	return dst
+}
@@ -0,0 +1,46 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maxNameLen is the longest a single path element can be on common
+// filesystems, in bytes on unix and UTF-16 code units on windows
+const maxNameLen = 255
+
+// CheckLengths checks that the plan's local destinations fit within the
+// platform's path and name length limits, so that a long name fails before
+// anything has run rather than halfway through. Every offending destination
+// is reported
+func (p Plan) CheckLengths() error {
+	var errs []error
+	for _, inst := range p {
+		src, dst := inst.Paths()
+		if dst == "" {
+			continue
+		}
+		if err := checkLength(dst); err != nil {
+			errs = append(errs, fmt.Errorf("%s -> %s: %w", Quote(src), Quote(dst), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkLength(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, elem := range strings.Split(abs, string(filepath.Separator)) {
+		if n := pathLen(elem); n > maxNameLen {
+			return fmt.Errorf("name %q is %d long, over the limit of %d", elem, n, maxNameLen)
+		}
+	}
+	if n, max := pathLen(abs), maxPathLen(); n > max {
+		return fmt.Errorf("path is %d long, over the limit of %d%s", n, max, maxPathHint)
+	}
+	return nil
+}
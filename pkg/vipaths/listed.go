@@ -0,0 +1,137 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// CheckKept fails for the first rename or copy onto a listed path whose line
+// was left as it is, since it would be replaced without that being asked for
+// on its own line. Renames merging into a directory are asked for with
+// ParseOptions.Merge, and copies of a directory's contents only add to their
+// destination, like rsync. Listed are the paths in the buffer, and changed those
+// whose lines were edited, both as they are in the plan
+func (p Plan) CheckKept(listed, changed []string) error {
+	kept := map[string]bool{}
+	for _, path := range listed {
+		kept[filepath.Clean(path)] = true
+	}
+	for _, path := range changed {
+		delete(kept, filepath.Clean(path))
+	}
+	for _, inst := range p {
+		switch inst := inst.(type) {
+		case Rename:
+			if inst.Merge != "" {
+				continue
+			}
+		case Copy:
+			if inst.Contents {
+				continue
+			}
+		case Archive, Compress, Encrypt:
+		default:
+			continue
+		}
+		if src, dst := inst.Paths(); kept[filepath.Clean(dst)] {
+			return &KeptError{Op: OpName(inst), Src: src, Dst: dst}
+		}
+	}
+	return nil
+}
+
+// CheckAllowed fails with every operation in the plan whose name, see OpName,
+// allowed returns false for. A nil allowed allows everything
+func (p Plan) CheckAllowed(allowed func(op string) bool) error {
+	if allowed == nil {
+		return nil
+	}
+	var errs []error
+	for _, inst := range p {
+		if op := OpName(inst); !allowed(op) {
+			src, _ := inst.Paths()
+			errs = append(errs, fmt.Errorf("%s %s", op, Quote(src)))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("operations not allowed in this run:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Landing is a directory the plan moves or copies paths into from another
+// directory
+type Landing struct {
+	Dir string
+	// Arrivals is how many paths land in it
+	Arrivals int
+	// Existing are the names of the entries already in it which weren't
+	// listed, sorted
+	Existing []string
+}
+
+// Landings returns the directories the plan moves or copies paths into from
+// other directories, in plan order, so paths landing next to entries which
+// weren't in the buffer can be reported. Replacing are the instructions whose
+// destination is one of those entries. Directories are only read on fsys if
+// it's a ReadDirer
+func (p Plan) Landings(fsys FS, listed []string) (landings []Landing, replacing []Instruction) {
+	isListed := make(map[string]bool, len(listed))
+	for _, path := range listed {
+		isListed[filepath.Clean(path)] = true
+	}
+	rd, _ := unwrapFS(fsys).(ReadDirer)
+	byDir := map[string]int{}
+	for _, inst := range p {
+		var src, dst, dir string
+		switch inst := inst.(type) {
+		case Rename:
+			src, dst = inst.Before, inst.After
+		case Copy:
+			src, dst = inst.From, inst.To
+			if inst.Contents {
+				dir = filepath.Clean(dst)
+			}
+		default:
+			continue
+		}
+		src, dst = filepath.Clean(src), filepath.Clean(dst)
+		if dir == "" {
+			dir = filepath.Dir(dst)
+		}
+		if dir == filepath.Dir(src) {
+			continue
+		}
+		i, ok := byDir[dir]
+		if !ok {
+			i = len(landings)
+			byDir[dir] = i
+			landings = append(landings, Landing{Dir: dir, Existing: unlistedEntries(rd, dir, isListed)})
+		}
+		landings[i].Arrivals++
+		if dir != dst && !isListed[dst] && slices.Contains(landings[i].Existing, filepath.Base(dst)) {
+			replacing = append(replacing, inst)
+		}
+	}
+	return landings, replacing
+}
+
+// unlistedEntries are the names in dir, sorted, which weren't listed
+func unlistedEntries(rd ReadDirer, dir string, isListed map[string]bool) []string {
+	if rd == nil {
+		return nil
+	}
+	entries, err := rd.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if !isListed[filepath.Join(dir, entry.Name())] {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
@@ -0,0 +1,86 @@
+package vipaths
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckKept(t *testing.T) {
+	listed := []string{"a", "b", "dir"}
+	tests := []struct {
+		name    string
+		plan    Plan
+		changed []string
+		wantSrc string
+	}{
+		{"rename onto an edited line", Plan{Rename{Before: "a", After: "b"}, Rename{Before: "b", After: "c"}}, []string{"a", "b"}, ""},
+		{"rename onto a kept line", Plan{Rename{Before: "a", After: "b"}}, []string{"a"}, "a"},
+		{"copy onto a kept line", Plan{Copy{From: "a", To: "./b"}}, []string{"a"}, "a"},
+		{"copy contents into a kept directory", Plan{Copy{From: "a", To: "dir", Contents: true}}, []string{"a"}, ""},
+		{"merge into a kept directory", Plan{Rename{Before: "a", After: "dir", Merge: MergeSkip}}, []string{"a"}, ""},
+		{"rename onto an unlisted path", Plan{Rename{Before: "a", After: "c"}}, []string{"a"}, ""},
+		{"remove", Plan{Remove{Name: "a"}}, []string{"a"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.plan.CheckKept(listed, tt.changed)
+			var kept *KeptError
+			switch {
+			case tt.wantSrc == "" && err != nil:
+				t.Errorf("CheckKept = %v, want nil", err)
+			case tt.wantSrc != "" && (!errors.As(err, &kept) || !errors.Is(err, ErrKeptReplaced)):
+				t.Errorf("CheckKept = %v, want a KeptError", err)
+			case tt.wantSrc != "" && kept.Src != tt.wantSrc:
+				t.Errorf("KeptError.Src = %q, want %q", kept.Src, tt.wantSrc)
+			}
+		})
+	}
+}
+
+func TestCheckAllowed(t *testing.T) {
+	plan := Plan{Rename{Before: "a", After: "b"}, Remove{Name: "c"}, Copy{From: "d", To: "e"}}
+	if err := plan.CheckAllowed(nil); err != nil {
+		t.Errorf("CheckAllowed(nil) = %v", err)
+	}
+	if err := plan.CheckAllowed(func(string) bool { return true }); err != nil {
+		t.Errorf("CheckAllowed of everything = %v", err)
+	}
+	err := plan.CheckAllowed(func(op string) bool { return op == "rename" })
+	const msg = "operations not allowed in this run:\nremove c\ncopy d"
+	if err == nil || err.Error() != msg {
+		t.Errorf("CheckAllowed = %v, want\n%s", err, msg)
+	}
+}
+
+func TestLandings(t *testing.T) {
+	fsys := NewMemFS()
+	for _, name := range []string{"src/a", "src/b", "src/c", "dst/x", "dst/b", "dst/listed", "full/y"} {
+		if err := fsys.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plan := Plan{
+		Rename{Before: "src/a", After: "dst/a"},
+		Rename{Before: "src/b", After: "dst/b"},
+		Copy{From: "src/c", To: "full", Contents: true},
+		// staying in the same directory lands nowhere new
+		Rename{Before: "src/c", After: "src/d"},
+		Remove{Name: "src/a"},
+	}
+	landings, replacing := plan.Landings(fsys, []string{"src/a", "src/b", "src/c", "dst/listed"})
+	want := []Landing{
+		{Dir: "dst", Arrivals: 2, Existing: []string{"b", "x"}},
+		{Dir: "full", Arrivals: 1, Existing: []string{"y"}},
+	}
+	if !reflect.DeepEqual(landings, want) {
+		t.Errorf("landings = %+v, want %+v", landings, want)
+	}
+	if !reflect.DeepEqual(replacing, []Instruction{plan[1]}) {
+		t.Errorf("replacing = %v, want %v", replacing, plan[1])
+	}
+}
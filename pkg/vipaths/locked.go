@@ -0,0 +1,49 @@
+package vipaths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// an operation on a file locked by another process is retried lockRetries
+// times, waiting lockBackoff and then twice as long each time, since the lock
+// is often only held for a moment, like by a virus scanner or indexer
+const (
+	lockRetries = 5
+	lockBackoff = 100 * time.Millisecond
+)
+
+// retryLocked runs fn, retrying it while it fails because a file is locked
+// by another process. if it's still locked, the error is a LockedError with
+// the processes holding it, where they can be found
+func retryLocked(fn func() error) error {
+	err := fn()
+	for i, wait := 0, lockBackoff; i < lockRetries && locked(err); i, wait = i+1, wait*2 {
+		time.Sleep(wait)
+		err = fn()
+	}
+	if !locked(err) {
+		return err
+	}
+	path := errPath(err)
+	var holders []string
+	if abs, absErr := filepath.Abs(path); absErr == nil && path != "" {
+		holders = lockHolders(abs)
+	}
+	return &LockedError{Path: path, Processes: holders, Err: err}
+}
+
+// errPath is the path an error from the os package is about
+func errPath(err error) string {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Path
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Old
+	}
+	return ""
+}
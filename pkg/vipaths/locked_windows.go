@@ -0,0 +1,77 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	rstrtmgr                = windows.NewLazySystemDLL("rstrtmgr.dll")
+	procRmStartSession      = rstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources = rstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList           = rstrtmgr.NewProc("RmGetList")
+	procRmEndSession        = rstrtmgr.NewProc("RmEndSession")
+)
+
+// rmProcessInfo is RM_PROCESS_INFO
+type rmProcessInfo struct {
+	pid         uint32
+	startTime   windows.Filetime
+	appName     [256]uint16
+	serviceName [64]uint16
+	appType     uint32
+	appStatus   uint32
+	sessionID   uint32
+	restartable int32
+}
+
+// locked reports whether err is from a file being open in another process
+// without sharing, or having a region locked
+func locked(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
+
+// lockHolders asks the Restart Manager which processes have the file at the
+// absolute path open, like "WINWORD.EXE (1234)". it's nil if they can't be
+// found, like for processes of other users
+func lockHolders(path string) []string {
+	var session uint32
+	key := make([]uint16, 33) // CCH_RM_SESSION_KEY+1
+	if r, _, _ := procRmStartSession.Call(uintptr(unsafe.Pointer(&session)), 0, uintptr(unsafe.Pointer(&key[0]))); r != 0 {
+		return nil
+	}
+	defer procRmEndSession.Call(uintptr(session))
+
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil
+	}
+	names := []*uint16{name}
+	if r, _, _ := procRmRegisterResources.Call(uintptr(session), 1, uintptr(unsafe.Pointer(&names[0])), 0, 0, 0, 0); r != 0 {
+		return nil
+	}
+	procs := make([]rmProcessInfo, 4)
+	var n uint32
+	for {
+		var needed, reasons uint32
+		n = uint32(len(procs))
+		r, _, _ := procRmGetList.Call(uintptr(session), uintptr(unsafe.Pointer(&needed)), uintptr(unsafe.Pointer(&n)), uintptr(unsafe.Pointer(&procs[0])), uintptr(unsafe.Pointer(&reasons)))
+		if r == uintptr(windows.ERROR_MORE_DATA) {
+			// more processes opened it since asking
+			procs = make([]rmProcessInfo, needed+4)
+			continue
+		}
+		if r != 0 {
+			return nil
+		}
+		break
+	}
+	var holders []string
+	for _, proc := range procs[:n] {
+		holders = append(holders, fmt.Sprintf("%s (%d)", windows.UTF16ToString(proc.appName[:]), proc.pid))
+	}
+	return holders
+}
@@ -0,0 +1,208 @@
+package vipaths
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an in-memory FS, useful for tests and for simulating plans
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS containing only the root and current directories
+func NewMemFS() *MemFS {
+	now := time.Now()
+	return &MemFS{files: map[string]*memFile{
+		".":                        {mode: fs.ModeDir | 0755, modTime: now},
+		string(filepath.Separator): {mode: fs.ModeDir | 0755, modTime: now},
+	}}
+}
+
+// WriteFile creates or replaces a regular file, creating its parents
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := m.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[filepath.Clean(name)] = &memFile{data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+// ReadFile returns the contents of a regular file
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+// Paths returns every file and directory in the MemFS, sorted
+func (m *MemFS) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var paths []string
+	for name := range m.files {
+		if name == "." || name == string(filepath.Separator) {
+			continue
+		}
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memInfo{name: filepath.Base(name), file: f}, nil
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	f, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if parent, ok := m.files[filepath.Dir(newname)]; !ok || !parent.mode.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if newname == oldname {
+		return nil
+	}
+	if isWithin(newname, oldname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	// like os.Rename, which won't replace a directory, even an empty one
+	if dst, ok := m.files[newname]; ok {
+		switch {
+		case dst.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrExist}
+		case f.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fmt.Errorf("not a directory")}
+		}
+	}
+	for name, child := range m.files {
+		if isWithin(name, oldname) && name != oldname {
+			delete(m.files, name)
+			m.files[newname+strings.TrimPrefix(name, oldname)] = child
+		}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = f
+	return nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if f, ok := m.files[name]; !ok || !f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for path, f := range m.files {
+		if path != name && filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(path), file: f}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	for path := range m.files {
+		if isWithin(path, name) {
+			delete(m.files, path)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Copy(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	f, ok := m.files[from]
+	if !ok {
+		return &fs.PathError{Op: "copy", Path: from, Err: fs.ErrNotExist}
+	}
+	if f.mode.IsDir() {
+		return &fs.PathError{Op: "copy", Path: from, Err: fmt.Errorf("is a directory")}
+	}
+	if parent, ok := m.files[filepath.Dir(to)]; !ok || !parent.mode.IsDir() {
+		return &fs.PathError{Op: "copy", Path: to, Err: fs.ErrNotExist}
+	}
+	m.files[to] = &memFile{data: append([]byte(nil), f.data...), mode: f.mode, modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	var missing []string
+	for p := name; ; p = filepath.Dir(p) {
+		if f, ok := m.files[p]; ok {
+			if !f.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: fmt.Errorf("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, p)
+		if p == filepath.Dir(p) {
+			break
+		}
+	}
+	for _, p := range missing {
+		m.files[p] = &memFile{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+type memInfo struct {
+	name string
+	file *memFile
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.file.mode }
+func (i memInfo) ModTime() time.Time { return i.file.modTime }
+func (i memInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
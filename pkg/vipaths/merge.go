@@ -0,0 +1,103 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Merge policies for renaming a directory onto an existing one
+const (
+	// MergeFail refuses to merge if any file would be replaced, before
+	// moving anything
+	MergeFail = "fail"
+	// MergeSkip leaves conflicting files where they are
+	MergeSkip = "skip"
+	// MergeOverwrite replaces conflicting files
+	MergeOverwrite = "overwrite"
+)
+
+// mergeDirs moves the contents of the directory from into the existing
+// directory to, recursing into directories which exist in both. from is
+// removed if everything was moved out of it
+func mergeDirs(fsys FS, from, to, policy string) error {
+	rd, ok := unwrapFS(fsys).(ReadDirer)
+	if !ok {
+		return errors.New("merging isn't supported on this filesystem")
+	}
+	if policy == MergeFail {
+		conflicts, err := mergeConflicts(fsys, rd, from, to)
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%d files would be replaced, like %q", len(conflicts), conflicts[0])
+		}
+	}
+	return mergeInto(fsys, rd, from, to, policy)
+}
+
+func mergeInto(fsys FS, rd ReadDirer, from, to, policy string) error {
+	entries, err := rd.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		src := filepath.Join(from, entry.Name())
+		dst := filepath.Join(to, entry.Name())
+		dstStat, err := fsys.Stat(dst)
+		switch {
+		case err != nil:
+			if err := rename(fsys, src, dst); err != nil {
+				return err
+			}
+		case entry.IsDir() && dstStat.IsDir():
+			if err := mergeInto(fsys, rd, src, dst, policy); err != nil {
+				return err
+			}
+		case policy == MergeOverwrite:
+			if err := fsys.RemoveAll(dst); err != nil {
+				return err
+			}
+			if err := rename(fsys, src, dst); err != nil {
+				return err
+			}
+		case policy == MergeSkip:
+		default:
+			return &ExistsError{Op: "rename", Src: src, Dst: dst}
+		}
+	}
+	left, err := rd.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	if len(left) == 0 {
+		return fsys.RemoveAll(from)
+	}
+	return nil
+}
+
+// mergeConflicts returns the paths under to which merging from would replace
+func mergeConflicts(fsys FS, rd ReadDirer, from, to string) ([]string, error) {
+	entries, err := rd.ReadDir(from)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []string
+	for _, entry := range entries {
+		dst := filepath.Join(to, entry.Name())
+		dstStat, err := fsys.Stat(dst)
+		switch {
+		case err != nil:
+		case entry.IsDir() && dstStat.IsDir():
+			sub, err := mergeConflicts(fsys, rd, filepath.Join(from, entry.Name()), dst)
+			if err != nil {
+				return nil, err
+			}
+			conflicts = append(conflicts, sub...)
+		default:
+			conflicts = append(conflicts, dst)
+		}
+	}
+	return conflicts, nil
+}
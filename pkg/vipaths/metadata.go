@@ -0,0 +1,141 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Chmod changes the mode of a file or directory
+type Chmod struct {
+	Name string
+	Mode fs.FileMode
+}
+
+func (c Chmod) Paths() (string, string) { return c.Name, "" }
+func (c Chmod) MapPaths(fn func(string) string) Instruction {
+	return Chmod{Name: fn(c.Name), Mode: c.Mode}
+}
+func (c Chmod) String() string {
+	return fmt.Sprintf("chmod %s\n   => %s", Quote(c.Name), FormatMode(c.Mode))
+}
+func (c Chmod) Execute(fsys FS) error {
+	chmoder, ok := unwrapFS(fsys).(Chmoder)
+	if !ok {
+		return errors.New("exe chmod: the filesystem can't change modes")
+	}
+	if err := chmoder.Chmod(c.Name, c.Mode); err != nil {
+		return fmt.Errorf("exe chmod: %w", err)
+	}
+	return nil
+}
+
+// Touch sets the access and modification times of a file or directory
+type Touch struct {
+	Name string
+	Time time.Time
+}
+
+func (t Touch) Paths() (string, string) { return t.Name, "" }
+func (t Touch) MapPaths(fn func(string) string) Instruction {
+	return Touch{Name: fn(t.Name), Time: t.Time}
+}
+func (t Touch) String() string {
+	return fmt.Sprintf("touch %s\n   => %s", Quote(t.Name), t.Time.Format(time.DateTime))
+}
+func (t Touch) Execute(fsys FS) error {
+	chtimeser, ok := unwrapFS(fsys).(Chtimeser)
+	if !ok {
+		return errors.New("exe touch: the filesystem can't change times")
+	}
+	if err := chtimeser.Chtimes(t.Name, t.Time, t.Time); err != nil {
+		return fmt.Errorf("exe touch: %w", err)
+	}
+	return nil
+}
+
+// Relink points the symlink at Name to Target instead. The new link is made
+// beside the old one and renamed over it, so Name is never missing
+type Relink struct{ Name, Target string }
+
+func (l Relink) Paths() (string, string) { return l.Name, "" }
+func (l Relink) MapPaths(fn func(string) string) Instruction {
+	return Relink{Name: fn(l.Name), Target: l.Target}
+}
+func (l Relink) String() string {
+	return fmt.Sprintf("relink %s\n    => %s", Quote(l.Name), Quote(l.Target))
+}
+func (l Relink) Execute(fsys FS) error {
+	linker, ok := unwrapFS(fsys).(Symlinker)
+	if !ok {
+		return errors.New("exe relink: the filesystem can't make symlinks")
+	}
+	tmp := filepath.Join(filepath.Dir(l.Name), ".vi-paths-relink-"+filepath.Base(l.Name))
+	if err := linker.Symlink(l.Target, tmp); err != nil {
+		return fmt.Errorf("exe relink: %w", err)
+	}
+	if err := fsys.Rename(tmp, l.Name); err != nil {
+		_ = fsys.RemoveAll(tmp)
+		return fmt.Errorf("exe relink: %w", err)
+	}
+	return nil
+}
+
+// ParseMode parses an octal mode like 2775, including the setuid, setgid,
+// and sticky bits
+func ParseMode(s string) (fs.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 07777 {
+		return 0, fmt.Errorf("expected an octal mode like 0755")
+	}
+	mode := fs.FileMode(m & 0777)
+	if m&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode, nil
+}
+
+// FormatMode formats the permission and special bits of mode in octal, as
+// read by ParseMode
+func FormatMode(mode fs.FileMode) string {
+	m := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 01000
+	}
+	return fmt.Sprintf("%04o", m)
+}
+
+// timeLayouts are the layouts accepted by ParseTime, all in local time
+var timeLayouts = []string{time.DateOnly, "2006-01-02 15:04", time.DateTime, "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// ParseTime parses a time like 2020-01-01 or 2020-01-01 15:04:05 in local
+// time, an RFC 3339 time, or now
+func ParseTime(s string) (time.Time, error) {
+	if s == "now" {
+		return time.Now().Truncate(time.Second), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a time like 2020-01-01 or 2020-01-01 15:04:05, not %q", s)
+}
@@ -0,0 +1,88 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// rename renames from to to, or where they're local paths on different
+// filesystems, copies from and then removes it like mv does. the copy keeps
+// the mode, modification time, and extended attributes of everything in it,
+// and as root the owner and group, so it's indistinguishable from a rename
+func rename(fsys FS, from, to string) error {
+	err := fsys.Rename(from, to)
+	if !isLocal(fsys) || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	stat, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	_, errTo := os.Lstat(to)
+	if err := moveCopy(fsys, from, to, stat); err != nil {
+		// the source is untouched, so don't leave half of it behind too
+		if stat.IsDir() && errors.Is(errTo, fs.ErrNotExist) {
+			os.RemoveAll(to)
+		}
+		return fmt.Errorf("moving onto another filesystem: %w", err)
+	}
+	if err := fsys.RemoveAll(from); err != nil {
+		return fmt.Errorf("removing after moving onto another filesystem: %w", err)
+	}
+	return nil
+}
+
+// moveCopy copies the local path from, described by its Lstat, to to for
+// rename. unlike a copy, symlinks are made again rather than followed, and
+// special files which can't be made again fail rather than being skipped,
+// since the source is removed afterwards
+func moveCopy(fsys FS, from, to string, stat fs.FileInfo) error {
+	switch {
+	case stat.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(to); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := os.Symlink(target, to); err != nil {
+			return err
+		}
+		if owner, ok := FileOwner(stat); ok && os.Geteuid() == 0 {
+			return os.Lchown(to, owner.UID, owner.GID)
+		}
+		return nil
+	case stat.IsDir():
+		if err := os.Mkdir(to, 0700); err != nil {
+			return err
+		}
+		if err := copyXattrs(from, to); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if err := moveCopy(fsys, filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name()), info); err != nil {
+				return err
+			}
+		}
+		// after the contents, which change its modification time
+		return keepMetadata(stat, to)
+	default:
+		if err := fsys.Copy(from, to); err != nil {
+			return err
+		}
+		return keepMetadata(stat, to)
+	}
+}
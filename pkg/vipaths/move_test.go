@@ -0,0 +1,132 @@
+package vipaths
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// otherFilesystem returns a temp directory on a different filesystem to
+// t.TempDir, skipping the test if there isn't one
+func otherFilesystem(t *testing.T) (string, string) {
+	t.Helper()
+	local := t.TempDir()
+	other, err := os.MkdirTemp("/dev/shm", "vipaths")
+	if err != nil {
+		t.Skip("no /dev/shm to move onto")
+	}
+	t.Cleanup(func() { os.RemoveAll(other) })
+	if !otherDevice(OS, local, other) {
+		t.Skip("/dev/shm is on the same filesystem as the temp directory")
+	}
+	return local, other
+}
+
+func TestRenameAcrossFilesystems(t *testing.T) {
+	local, other := otherFilesystem(t)
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, dir := range []struct {
+		name string
+		mode fs.FileMode
+	}{{"dir", 0750}, {"dir/sub", 0705}} {
+		if err := os.Mkdir(filepath.Join(local, dir.name), dir.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, mode := range map[string]fs.FileMode{"dir/f": 0640, "dir/sub/g": 0604, "file": 0600} {
+		name = filepath.Join(local, name)
+		if err := os.WriteFile(name, []byte("data"), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("f", filepath.Join(local, "dir/link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dir/f", "dir/sub", "dir"} {
+		if err := os.Chtimes(filepath.Join(local, name), time.Time{}, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := os.Geteuid() == 0
+	if root {
+		if err := os.Lchown(filepath.Join(local, "dir/f"), 1234, 5678); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan := Plan{
+		Rename{Before: filepath.Join(local, "dir"), After: filepath.Join(other, "new/dir")},
+		Rename{Before: filepath.Join(local, "file"), After: filepath.Join(other, "file")},
+	}
+	if err := plan.CheckDevices(); err != nil {
+		t.Errorf("CheckDevices = %v, want renames allowed", err)
+	}
+	if err := Execute(plan, Options{}); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if entries, err := os.ReadDir(local); err != nil || len(entries) != 0 {
+		t.Errorf("left %v, %v in the source", entries, err)
+	}
+	for name, mode := range map[string]fs.FileMode{"new/dir": fs.ModeDir | 0750, "new/dir/sub": fs.ModeDir | 0705, "new/dir/f": 0640, "new/dir/sub/g": 0604, "file": 0600} {
+		stat, err := os.Lstat(filepath.Join(other, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if stat.Mode() != mode {
+			t.Errorf("%s has mode %v, want %v", name, stat.Mode(), mode)
+		}
+	}
+	for _, name := range []string{"new/dir", "new/dir/sub", "new/dir/f"} {
+		if stat, err := os.Stat(filepath.Join(other, name)); err == nil && !stat.ModTime().Equal(mtime) {
+			t.Errorf("%s was modified at %v, want %v", name, stat.ModTime(), mtime)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(other, "new/dir/link")); err != nil || target != "f" {
+		t.Errorf("link = %q, %v, want a symlink to f", target, err)
+	}
+	if root {
+		stat, err := os.Stat(filepath.Join(other, "new/dir/f"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner, _ := FileOwner(stat); owner != (Owner{1234, 5678}) {
+			t.Errorf("f is owned by %v, want 1234:5678", owner)
+		}
+	}
+}
+
+func TestRenameAcrossFilesystemsSocket(t *testing.T) {
+	local, other := otherFilesystem(t)
+	if err := os.WriteFile(filepath.Join(local, "a"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(local, "sock"))
+	if err != nil {
+		t.Skipf("making a socket: %v", err)
+	}
+	defer l.Close()
+
+	dst := filepath.Join(other, "dir")
+	err = Execute(Plan{Rename{Before: local, After: dst}}, Options{})
+	if !errors.Is(err, ErrSpecialFile) {
+		t.Fatalf("Execute = %v, want ErrSpecialFile", err)
+	}
+	// nothing is lost or left half moved
+	for _, name := range []string{"a", "sock"} {
+		if _, err := os.Lstat(filepath.Join(local, name)); err != nil {
+			t.Errorf("source %s: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(dst); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("partial move left at the destination: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package vipaths
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// OrderPolicy is how Parse orders a plan's instructions. Every policy is
+// deterministic, the same lines always make the same plan, and ties are kept
+// in the order of the lines. Whatever the policy, directories from mkdir
+// lines are made first unless it's OrderBuffer, the parts of a chain run in
+// the order they're written, and a rename or copy onto a path which another
+// instruction moves or removes runs after it
+type OrderPolicy string
+
+// Order policies, see OrderPolicy
+const (
+	// OrderDepth runs the deepest paths first, so that renaming a directory
+	// doesn't move the paths inside it out from under their own lines. Lines
+	// at the same depth run in the order they're in the buffer
+	OrderDepth OrderPolicy = "depth"
+	// OrderBuffer runs the lines in the order they're in the buffer
+	OrderBuffer OrderPolicy = "buffer"
+	// OrderRemovesLast is OrderDepth with every remove deferred to the end,
+	// after the renames and copies they may depend on have succeeded
+	OrderRemovesLast OrderPolicy = "removes-last"
+	// OrderDependency runs the lines in the order they're in the buffer,
+	// except that a line only runs once the lines for paths inside its path
+	// have, so it moves as little as it can from the buffer's order while
+	// keeping what OrderDepth guarantees
+	OrderDependency OrderPolicy = "dependency"
+)
+
+// Orders are the valid values of ParseOptions.Order
+var Orders = []OrderPolicy{OrderDepth, OrderBuffer, OrderRemovesLast, OrderDependency}
+
+// byDepth reports whether the lines are sorted deepest first before parsing
+func (o OrderPolicy) byDepth() bool {
+	return o == "" || o == OrderDepth || o == OrderRemovesLast
+}
+
+// dependencyOrder reorders the plan so that each instruction runs after the
+// instructions on paths inside its sources, keeping the plan's order
+// otherwise. instructions on the same path keep their order, so chains stay
+// together
+func dependencyOrder(plan Plan) Plan {
+	type source struct {
+		path  string
+		index int
+	}
+	var index []source
+	for i, inst := range plan {
+		for _, src := range sources(inst) {
+			index = append(index, source{filepath.Clean(src), i})
+		}
+	}
+	slices.SortFunc(index, func(a, b source) int { return strings.Compare(a.path, b.path) })
+
+	ordered := make(Plan, 0, len(plan))
+	emitted := make([]bool, len(plan))
+	var emit func(i int)
+	emit = func(i int) {
+		if emitted[i] {
+			return
+		}
+		emitted[i] = true
+		var inner []int
+		for _, src := range sources(plan[i]) {
+			prefix := filepath.Clean(src)
+			if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+				prefix += string(filepath.Separator)
+			}
+			start, _ := slices.BinarySearchFunc(index, prefix, func(s source, p string) int { return strings.Compare(s.path, p) })
+			for _, s := range index[start:] {
+				if !strings.HasPrefix(s.path, prefix) {
+					break
+				}
+				inner = append(inner, s.index)
+			}
+		}
+		slices.Sort(inner)
+		for _, j := range inner {
+			emit(j)
+		}
+		ordered = append(ordered, plan[i])
+	}
+	for i := range plan {
+		emit(i)
+	}
+	return ordered
+}
@@ -0,0 +1,71 @@
+package vipaths
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathMapper is implemented by instructions whose paths can be rewritten, for
+// example to resolve paths which were shown relative to some directory
+type PathMapper interface {
+	MapPaths(fn func(string) string) Instruction
+}
+
+// Join returns a copy of the plan with dir joined to every relative path.
+// Instructions which don't implement PathMapper are kept as they are
+func (p Plan) Join(dir string) Plan {
+	if dir == "" || dir == "." {
+		return p
+	}
+	join := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	joined := make(Plan, 0, len(p))
+	for _, inst := range p {
+		if mapper, ok := inst.(PathMapper); ok {
+			inst = mapper.MapPaths(join)
+		}
+		joined = append(joined, inst)
+	}
+	return joined
+}
+
+// CommonDir returns the deepest directory containing all of paths, or "" if
+// there is none
+func CommonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	sep := string(filepath.Separator)
+	common := strings.Split(filepath.Dir(filepath.Clean(paths[0])), sep)
+	for _, path := range paths[1:] {
+		elems := strings.Split(filepath.Dir(filepath.Clean(path)), sep)
+		n := 0
+		for n < len(common) && n < len(elems) && common[n] == elems[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	dir := strings.Join(common, sep)
+	if dir == "" && len(common) > 0 {
+		// the paths only share the root
+		return sep
+	}
+	return dir
+}
+
+// Rel returns paths relative to dir
+func Rel(dir string, paths []string) ([]string, error) {
+	rel := make([]string, 0, len(paths))
+	for _, path := range paths {
+		r, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		rel = append(rel, r)
+	}
+	return rel, nil
+}
@@ -0,0 +1,71 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+)
+
+// CheckPermissions checks that every local directory the plan adds entries
+// to or removes them from can be written, including the directories inside
+// ones being removed. Every directory which can't is reported at once, rather
+// than each failing its own instruction partway through the plan. Directories
+// which don't exist yet are made by the plan, so aren't checked
+func (p Plan) CheckPermissions() error {
+	seen := map[string]bool{}
+	var errs []error
+	for _, inst := range p {
+		for _, dir := range writeDirs(OS, inst) {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			if err := writable(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("%s %s: can't write to %s: %w", OpName(inst), Quote(firstPath(inst)), Quote(dir), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeDirs returns the local directories inst adds entries to or removes
+// them from. entries are removed from the source's directory and created in
+// the destination's. copies, shell commands, plugins, and metadata changes
+// leave the source alone, dedup replaces the duplicate in place, and removing
+// a directory empties every directory inside it too
+func writeDirs(fsys FS, inst Instruction) []string {
+	if !isLocal(fsys) {
+		return nil
+	}
+	var dirs []string
+	switch inst := inst.(type) {
+	case Copy, Mkdir, Shell, Plugin, Relabel, Tag, SetXattr, Chmod, Touch:
+	case Dedup:
+		dirs = append(dirs, filepath.Dir(filepath.Clean(inst.Name)))
+	case Remove:
+		dirs = append(dirs, filepath.Dir(filepath.Clean(inst.Name)))
+		_ = filepath.WalkDir(inst.Name, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+	default:
+		for _, src := range sources(inst) {
+			dirs = append(dirs, filepath.Dir(filepath.Clean(src)))
+		}
+	}
+	_, dst := inst.Paths()
+	switch inst.(type) {
+	case Dedup:
+	case Extract:
+		dirs = append(dirs, existingDir(fsys, dst))
+	default:
+		if dst != "" {
+			dirs = append(dirs, existingDir(fsys, filepath.Dir(dst)))
+		}
+	}
+	return slices.Compact(dirs)
+}
@@ -0,0 +1,185 @@
+package vipaths
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// csvColumns are the columns of a CSV plan. The first three are always
+// written, the rest only when an operation uses them
+var csvColumns = []string{"source", "destination", "operation", "merge", "link", "remove", "trash", "keep", "contents", "recipient", "command", "context", "tags", "attr", "value", "mode", "time", "target", "plugin", "arg"}
+
+// WritePlanCSV writes the plan as CSV with a header row, one row per
+// operation, or per source of an archive. It can be read back with
+// ReadPlanCSV, and edited in a spreadsheet in between
+func WritePlanCSV(w io.Writer, p Plan) error {
+	ops := planOps(p)
+	columns := slices.Clone(csvColumns[:3])
+	for _, col := range csvColumns[3:] {
+		if slices.ContainsFunc(ops, func(op planOp) bool { return csvValue(op, col) != "" }) {
+			columns = append(columns, col)
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	for _, op := range ops {
+		srcs := []string{op.Src}
+		if op.Srcs != nil {
+			srcs = op.Srcs
+		}
+		for _, src := range srcs {
+			op.Src = src
+			row := make([]string, 0, len(columns))
+			for _, col := range columns {
+				row = append(row, csvValue(op, col))
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing plan: %w", err)
+	}
+	return nil
+}
+
+func csvValue(op planOp, column string) string {
+	flag := func(b bool) string {
+		if b {
+			return "true"
+		}
+		return ""
+	}
+	switch column {
+	case "source":
+		return op.Src
+	case "destination":
+		return op.Dst
+	case "operation":
+		return op.Op
+	case "merge":
+		return op.Merge
+	case "link":
+		return flag(op.Link)
+	case "remove":
+		return flag(op.Remove)
+	case "trash":
+		return flag(op.Trash)
+	case "keep":
+		return flag(op.Keep)
+	case "contents":
+		return flag(op.Contents)
+	case "recipient":
+		return op.Recipient
+	case "command":
+		return op.Command
+	case "context":
+		return op.Context
+	case "tags":
+		return strings.Join(op.Tags, ", ")
+	case "attr":
+		return op.Attr
+	case "value":
+		return op.Value
+	case "mode":
+		return op.Mode
+	case "time":
+		return op.Time
+	case "target":
+		return op.Target
+	case "plugin":
+		return op.Plugin
+	case "arg":
+		return op.Arg
+	}
+	return ""
+}
+
+// ReadPlanCSV reads a plan from CSV with a header row naming the columns, as
+// written by WritePlanCSV. Only source is required, except to mkdir. A row with no operation
+// is a rename, or a remove if it has no destination too. Rows archiving to
+// the same destination become one archive
+func ReadPlanCSV(r io.Reader) (Plan, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	index := map[string]int{}
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if !slices.Contains(csvColumns, col) {
+			return nil, fmt.Errorf("unknown column %q, expected some of %s", col, strings.Join(csvColumns, ", "))
+		}
+		index[col] = i
+	}
+	if _, ok := index["source"]; !ok {
+		return nil, errors.New("missing source column")
+	}
+
+	var ops []planOp
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading plan: %w", err)
+		}
+		get := func(col string) string {
+			if i, ok := index[col]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		flag := func(col string) (bool, error) {
+			if v := get(col); v != "" {
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					return false, fmt.Errorf("row %d: invalid %s %q", row, col, v)
+				}
+				return b, nil
+			}
+			return false, nil
+		}
+		op := planOp{Op: get("operation"), Src: get("source"), Dst: get("destination"), Merge: get("merge"), Recipient: get("recipient"), Command: get("command"), Context: get("context"), Tags: splitTags(get("tags")), Attr: get("attr"), Value: get("value"), Mode: get("mode"), Time: get("time"), Target: get("target"), Plugin: get("plugin"), Arg: get("arg")}
+		if op.Link, err = flag("link"); err != nil {
+			return nil, err
+		}
+		if op.Remove, err = flag("remove"); err != nil {
+			return nil, err
+		}
+		if op.Trash, err = flag("trash"); err != nil {
+			return nil, err
+		}
+		if op.Keep, err = flag("keep"); err != nil {
+			return nil, err
+		}
+		if op.Contents, err = flag("contents"); err != nil {
+			return nil, err
+		}
+		switch {
+		case op.Src == "" && op.Op != "mkdir":
+			return nil, fmt.Errorf("row %d: missing source", row)
+		case op.Op == "" && op.Dst == "":
+			op.Op = "remove"
+		case op.Op == "":
+			op.Op = "rename"
+		case op.Op == "archive":
+			op.Src, op.Srcs = "", []string{op.Src}
+		}
+		ops = append(ops, op)
+	}
+	plan, err := planFromOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	return mergeArchives(plan), nil
+}
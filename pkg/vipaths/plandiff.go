@@ -0,0 +1,80 @@
+package vipaths
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Kinds of PlanDiff
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// PlanDiff is an operation which differs between two plans
+type PlanDiff struct {
+	Kind string
+	// OldIndex and NewIndex are the operation's positions in the old and new
+	// plans, starting at 1, or 0 if it isn't in that plan
+	OldIndex, NewIndex int
+	Old, New           Instruction
+}
+
+// DiffPlans compares two versions of a plan, returning the operations added
+// or changed in the order of the new plan, then those removed in the order of
+// the old. An operation is changed if one with the same op and source is in
+// both, but not the same, like a rename to another destination. Operations
+// which have only moved aren't reported
+func DiffPlans(from, to Plan) []PlanDiff {
+	oldOps, newOps := planOps(from), planOps(to)
+	same := func(op planOp) string {
+		b, _ := json.Marshal(op)
+		return string(b)
+	}
+	similar := func(op planOp) string {
+		return op.Op + "\x00" + op.Src + "\x00" + strings.Join(op.Srcs, "\x00")
+	}
+
+	// the old operations not yet matched, by either key, in order
+	matched := make([]bool, len(oldOps))
+	bySame, bySimilar := map[string][]int{}, map[string][]int{}
+	for i, op := range oldOps {
+		bySame[same(op)] = append(bySame[same(op)], i)
+		bySimilar[similar(op)] = append(bySimilar[similar(op)], i)
+	}
+	take := func(queues map[string][]int, key string) int {
+		for q := queues[key]; len(q) > 0; q = q[1:] {
+			if !matched[q[0]] {
+				matched[q[0]] = true
+				queues[key] = q[1:]
+				return q[0]
+			}
+		}
+		return -1
+	}
+
+	// identical operations are matched first, so that of several with the
+	// same source, only those which differ are changed
+	unmatched := make([]bool, len(newOps))
+	for j, op := range newOps {
+		unmatched[j] = take(bySame, same(op)) < 0
+	}
+	var diffs []PlanDiff
+	for j, op := range newOps {
+		if !unmatched[j] {
+			continue
+		}
+		if i := take(bySimilar, similar(op)); i >= 0 {
+			diffs = append(diffs, PlanDiff{Kind: DiffChanged, OldIndex: i + 1, NewIndex: j + 1, Old: from[i], New: to[j]})
+		} else {
+			diffs = append(diffs, PlanDiff{Kind: DiffAdded, NewIndex: j + 1, New: to[j]})
+		}
+	}
+	for i := range oldOps {
+		if !matched[i] {
+			diffs = append(diffs, PlanDiff{Kind: DiffRemoved, OldIndex: i + 1, Old: from[i]})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,243 @@
+package vipaths
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PlanSchemaVersion is the version of the plan file format written by
+// WritePlan. It only goes up for changes older readers would misunderstand,
+// new fields and operations aside, and ReadPlan rejects newer versions
+const PlanSchemaVersion = 1
+
+// PlanOps are the operations a plan file can hold, the values of op
+var PlanOps = []string{
+	"rename", "remove", "copy", "mkdir", "archive", "extract", "gzip", "zstd", "encrypt", "dedup",
+	"shell", "relabel", "tag", "untag", "setxattr", "rmxattr", "chmod", "touch", "relink", "plugin",
+}
+
+// planFile is the top level of a plan file. Metadata is free for tools
+// generating plans to describe them, and is ignored when reading
+type planFile struct {
+	SchemaVersion int             `json:"schema_version"`
+	Created       string          `json:"created,omitempty"`
+	Metadata      json.RawMessage `json:"metadata,omitempty"`
+	Operations    []planOp        `json:"operations"`
+}
+
+// planOp is an instruction as it's written to a plan file
+type planOp struct {
+	Op  string `json:"op"`
+	Src string `json:"src"`
+	// Srcs are the sources of an archive
+	Srcs      []string `json:"srcs,omitempty"`
+	Dst       string   `json:"dst,omitempty"`
+	Merge     string   `json:"merge,omitempty"`
+	Link      bool     `json:"link,omitempty"`
+	Remove    bool     `json:"remove,omitempty"`
+	Trash     bool     `json:"trash,omitempty"`
+	Keep      bool     `json:"keep,omitempty"`
+	Contents  bool     `json:"contents,omitempty"`
+	Recipient string   `json:"recipient,omitempty"`
+	Command   string   `json:"command,omitempty"`
+	Context   string   `json:"context,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Attr      string   `json:"attr,omitempty"`
+	Value     string   `json:"value,omitempty"`
+	Mode      string   `json:"mode,omitempty"`
+	Time      string   `json:"time,omitempty"`
+	// Target is where a relinked symlink points
+	Target string `json:"target,omitempty"`
+	// Plugin is the executable run by a plugin, given Arg
+	Plugin string `json:"plugin,omitempty"`
+	Arg    string `json:"arg,omitempty"`
+}
+
+// WritePlan writes the plan as a JSON object with its schema_version and
+// an array of operations, to be read back with ReadPlan and executed later
+func WritePlan(w io.Writer, p Plan) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	file := planFile{
+		SchemaVersion: PlanSchemaVersion,
+		Created:       time.Now().UTC().Format(time.RFC3339),
+		Operations:    planOps(p),
+	}
+	if err := enc.Encode(file); err != nil {
+		return fmt.Errorf("encoding plan: %w", err)
+	}
+	return nil
+}
+
+func planOps(p Plan) []planOp {
+	ops := make([]planOp, 0, len(p))
+	for _, inst := range p {
+		src, dst := inst.Paths()
+		op := planOp{Op: OpName(inst), Src: src, Dst: dst}
+		switch inst := inst.(type) {
+		case Rename:
+			op.Merge, op.Link = inst.Merge, inst.Link
+		case Remove:
+			op.Trash = inst.Trash
+		case Archive:
+			op.Src, op.Srcs = "", inst.Names
+		case Copy:
+			op.Contents = inst.Contents
+		case Extract:
+			op.Remove = inst.Remove
+		case Compress:
+			op.Keep = inst.Keep
+		case Encrypt:
+			op.Dst, op.Recipient = "", inst.Recipient
+		case Shell:
+			op.Command = inst.Command
+		case Relabel:
+			op.Context = inst.Context
+		case Tag:
+			op.Tags = inst.Tags
+		case SetXattr:
+			op.Attr, op.Value = inst.Attr, inst.Value
+		case Chmod:
+			op.Mode = FormatMode(inst.Mode)
+		case Touch:
+			op.Time = inst.Time.Format(time.RFC3339Nano)
+		case Relink:
+			op.Target = inst.Target
+		case Plugin:
+			op.Plugin, op.Arg = inst.Exec, inst.Arg
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// ReadPlan reads a plan written by WritePlan, or by another tool following
+// its schema. Unknown fields are ignored so plans from newer releases still
+// read, unless their schema_version is newer. A bare array of operations, as
+// written before plans were versioned, is read too
+func ReadPlan(r io.Reader) (Plan, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decoding plan: %w", err)
+	}
+	var file planFile
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(raw, &file.Operations); err != nil {
+			return nil, fmt.Errorf("decoding plan: %w", err)
+		}
+		return planFromOps(file.Operations)
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("decoding plan: %w", err)
+	}
+	switch {
+	case file.SchemaVersion < 1:
+		return nil, fmt.Errorf("plan has no schema_version")
+	case file.SchemaVersion > PlanSchemaVersion:
+		return nil, fmt.Errorf("plan schema_version %d is newer than this release supports, %d", file.SchemaVersion, PlanSchemaVersion)
+	}
+	return planFromOps(file.Operations)
+}
+
+func planFromOps(ops []planOp) (Plan, error) {
+	plan := make(Plan, 0, len(ops))
+	for i, op := range ops {
+		inst, err := op.instruction()
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+		plan = append(plan, inst)
+	}
+	return plan, nil
+}
+
+func (op planOp) instruction() (Instruction, error) {
+	if op.Src == "" && op.Op != "archive" && op.Op != "mkdir" {
+		return nil, fmt.Errorf("%s needs a src", op.Op)
+	}
+	needDst := func(inst Instruction) (Instruction, error) {
+		if op.Dst == "" {
+			return nil, fmt.Errorf("%s needs a dst", op.Op)
+		}
+		return inst, nil
+	}
+	switch op.Op {
+	case "rename":
+		return needDst(Rename{Before: op.Src, After: op.Dst, Merge: op.Merge, Link: op.Link})
+	case "remove":
+		return Remove{Name: op.Src, Trash: op.Trash}, nil
+	case "copy":
+		return needDst(Copy{From: op.Src, To: op.Dst, Contents: op.Contents})
+	case "mkdir":
+		return needDst(Mkdir{Name: op.Dst})
+	case "archive":
+		if len(op.Srcs) == 0 {
+			return nil, fmt.Errorf("archive needs srcs")
+		}
+		return needDst(Archive{Names: op.Srcs, To: op.Dst})
+	case "extract":
+		return needDst(Extract{Name: op.Src, Dir: op.Dst, Remove: op.Remove})
+	case "gzip", "zstd":
+		return needDst(Compress{Name: op.Src, To: op.Dst, Format: op.Op, Keep: op.Keep})
+	case "encrypt":
+		if op.Recipient == "" {
+			return nil, fmt.Errorf("encrypt needs a recipient")
+		}
+		return Encrypt{Name: op.Src, Recipient: op.Recipient}, nil
+	case "dedup":
+		return needDst(Dedup{Name: op.Src, Original: op.Dst})
+	case "shell":
+		if op.Command == "" {
+			return nil, fmt.Errorf("shell needs a command")
+		}
+		return Shell{Name: op.Src, Command: op.Command}, nil
+	case "relabel":
+		if op.Context == "" {
+			return nil, fmt.Errorf("relabel needs a context")
+		}
+		return Relabel{Name: op.Src, Context: op.Context}, nil
+	case "tag":
+		if len(op.Tags) == 0 {
+			return nil, fmt.Errorf("tag needs tags")
+		}
+		return Tag{Name: op.Src, Tags: op.Tags}, nil
+	case "untag":
+		return Tag{Name: op.Src}, nil
+	case "setxattr", "rmxattr":
+		if op.Attr == "" {
+			return nil, fmt.Errorf("%s needs an attr", op.Op)
+		}
+		if op.Op == "setxattr" && op.Value == "" {
+			return nil, fmt.Errorf("setxattr needs a value")
+		}
+		return SetXattr{Name: op.Src, Attr: op.Attr, Value: op.Value}, nil
+	case "chmod":
+		mode, err := ParseMode(op.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("chmod mode: %w", err)
+		}
+		return Chmod{Name: op.Src, Mode: mode}, nil
+	case "touch":
+		t, err := time.Parse(time.RFC3339Nano, op.Time)
+		if err != nil {
+			return nil, fmt.Errorf("touch time: %w", err)
+		}
+		return Touch{Name: op.Src, Time: t}, nil
+	case "relink":
+		if op.Target == "" {
+			return nil, fmt.Errorf("relink needs a target")
+		}
+		return Relink{Name: op.Src, Target: op.Target}, nil
+	case "plugin":
+		if op.Plugin == "" {
+			return nil, fmt.Errorf("plugin needs a plugin")
+		}
+		return Plugin{Name: op.Src, Exec: op.Plugin, Arg: op.Arg}, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q, expected one of %s", op.Op, strings.Join(PlanOps, ", "))
+	}
+}
@@ -0,0 +1,111 @@
+//go:build !windows
+
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ShellCommand returns a command which runs command with the system shell
+func ShellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// ShellQuote quotes s so it can be used as a single word in a ShellCommand
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func validateName(string) error { return nil }
+
+// maxPathLen is PATH_MAX less the terminating NUL
+func maxPathLen() int { return 4095 }
+
+const maxPathHint = ""
+
+// pathLen is the length of s in bytes, like unix limits
+func pathLen(s string) int { return len(s) }
+
+// writable checks that entries can be created and removed in dir
+func writable(dir string) error {
+	return unix.Access(dir, unix.W_OK|unix.X_OK)
+}
+
+// DeviceID returns the id of the filesystem holding the file described by
+// stat, if it came from the local disk
+func DeviceID(stat fs.FileInfo) (uint64, bool) {
+	st, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// makeSpecial makes a FIFO or device node at to like the one described by
+// stat. device nodes need root, and sockets can't be made, since they only
+// work for the process listening on them
+func makeSpecial(to string, stat fs.FileInfo) error {
+	perm := uint32(stat.Mode().Perm())
+	switch mode := stat.Mode(); {
+	case mode&fs.ModeNamedPipe != 0:
+		if err := unix.Mkfifo(to, perm); err != nil {
+			return fmt.Errorf("mkfifo: %w", err)
+		}
+	case mode&fs.ModeDevice != 0:
+		st, ok := stat.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("%w: device number unknown", ErrSpecialFile)
+		}
+		kind := uint32(unix.S_IFBLK)
+		if mode&fs.ModeCharDevice != 0 {
+			kind = unix.S_IFCHR
+		}
+		if err := mknod(unix.Mknod, to, kind|perm, st.Rdev); errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("%w: making a device node needs root", ErrSpecialFile)
+		} else if err != nil {
+			return fmt.Errorf("mknod: %w", err)
+		}
+	default:
+		return fmt.Errorf("%w: a socket only works for the process listening on it", ErrSpecialFile)
+	}
+	return nil
+}
+
+// mknod calls unix.Mknod, whose device numbers are a different type on each
+// system, as is the one in Stat_t
+func mknod[D, R int | int32 | uint32 | uint64](fn func(string, uint32, D) error, path string, mode uint32, rdev R) error {
+	return fn(path, mode, D(rdev))
+}
+
+// FileOwner returns the owner of the file described by stat, if it came from
+// the local disk
+func FileOwner(stat fs.FileInfo) (Owner, bool) {
+	st, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Owner{}, false
+	}
+	return Owner{UID: int(st.Uid), GID: int(st.Gid)}, true
+}
+
+// syncPath flushes the file or directory at name to disk, so that a
+// directory's entries survive a power loss as well as a file's contents
+func syncPath(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// files are never locked against renaming or removing outside windows
+func locked(error) bool           { return false }
+func lockHolders(string) []string { return nil }
@@ -0,0 +1,130 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// ShellCommand returns a command which runs command with cmd.exe
+func ShellCommand(command string) *exec.Cmd {
+	cmd := exec.Command("cmd.exe")
+	// pass the command line verbatim, since cmd.exe doesn't follow the usual
+	// quoting rules. delayed expansion is off so ! in a name is left alone
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: "/V:OFF /S /C \"" + command + "\""}
+	return cmd
+}
+
+// ShellQuote quotes s so it can be used as a single word in a ShellCommand. it's
+// quoted for the program's own argument parsing, then every character special
+// to cmd.exe, quotes included, is escaped with a caret, so %VARS% in names like
+// 100%done.txt aren't expanded and & or | can't end the command
+func ShellQuote(s string) string {
+	var b strings.Builder
+	for _, r := range syscall.EscapeArg(s) {
+		if strings.ContainsRune(`()%!^"<>&|`, r) {
+			b.WriteByte('^')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// validateName rejects reserved device names in any element of the path. long
+// paths don't need a \\?\ prefix here, the os package adds one when needed
+func validateName(path string) error {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	for _, elem := range strings.FieldsFunc(path, func(r rune) bool { return r == '\\' || r == '/' }) {
+		stem, _, _ := strings.Cut(elem, ".")
+		if _, ok := reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))]; ok {
+			return fmt.Errorf("%q is a reserved name", elem)
+		}
+	}
+	return nil
+}
+
+// maxPathLen is MAX_PATH less the terminating NUL, unless long paths are
+// enabled in the registry. the os package copes with long paths either way,
+// but explorer and most other programs don't
+func maxPathLen() int {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\FileSystem`, registry.QUERY_VALUE)
+	if err != nil {
+		return 259
+	}
+	defer key.Close()
+	if enabled, _, err := key.GetIntegerValue("LongPathsEnabled"); err == nil && enabled == 1 {
+		return 32766
+	}
+	return 259
+}
+
+const maxPathHint = ", see LongPathsEnabled"
+
+// pathLen is the length of s in UTF-16 code units, like windows' limits
+func pathLen(s string) int { return len(utf16.Encode([]rune(s))) }
+
+// writable always succeeds, since access on windows is decided by ACLs which
+// can't be checked cheaply
+func writable(string) error { return nil }
+
+// freeSpace returns the bytes available to the user on the volume holding
+// path, and the volume's name
+func freeSpace(path string) (uint64, string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, "", err
+	}
+	name, err := windows.UTF16PtrFromString(abs)
+	if err != nil {
+		return 0, "", err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &free, nil, nil); err != nil {
+		return 0, "", err
+	}
+	return free, strings.ToUpper(filepath.VolumeName(abs)), nil
+}
+
+// extended attributes aren't supported on windows, so there are never any to
+// get, set, or copy
+func listXattrs(string) ([]string, error)     { return nil, errors.ErrUnsupported }
+func getXattr(string, string) ([]byte, error) { return nil, errors.ErrUnsupported }
+func setXattr(string, string, []byte) error   { return errors.ErrUnsupported }
+func removeXattr(string, string) error        { return errors.ErrUnsupported }
+func noXattr(err error) bool                  { return errors.Is(err, errors.ErrUnsupported) }
+
+// errNoXattr is never returned, since there are no attributes to be missing
+var errNoXattr = errors.New("no such attribute")
+
+// DeviceID is never known on windows, where file info doesn't carry the
+// volume
+func DeviceID(fs.FileInfo) (uint64, bool) { return 0, false }
+
+// FileOwner is never known on windows, where files are owned by SIDs
+func FileOwner(fs.FileInfo) (Owner, bool) { return Owner{}, false }
+
+// makeSpecial fails, there are no FIFOs or device nodes to make on windows
+func makeSpecial(string, fs.FileInfo) error { return ErrSpecialFile }
+
+// syncPath flushes the file at name to disk. directories can't be opened for
+// flushing on windows, where NTFS journals their entries anyway
+func syncPath(name string) error {
+	if stat, err := os.Stat(name); err != nil || stat.IsDir() {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
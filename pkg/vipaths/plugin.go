@@ -0,0 +1,159 @@
+package vipaths
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Plugin runs an external executable for a path, for buffer commands which
+// aren't built in, like `upload s3://bucket/`. The executable is given a
+// PluginRequest as JSON on stdin.
+//
+// An Exec ending in .wasm is a WebAssembly module instead, run sandboxed
+// with WasmRuntime. It sees only the directory holding the path, at
+// WasmDir, and is also run when the plan is parsed to validate the
+// argument, with no access to the filesystem at all
+type Plugin struct {
+	Name string
+	// Exec is the plugin's executable, whose base name without extension is
+	// the command
+	Exec string
+	Arg  string
+}
+
+// Phases a plugin is run in, see PluginRequest
+const (
+	PhaseValidate = "validate"
+	PhaseExecute  = "execute"
+)
+
+// PluginRequest describes the operation to a plugin
+type PluginRequest struct {
+	Command string `json:"command"`
+	// Phase is PhaseExecute, or PhaseValidate when a WebAssembly plugin is
+	// checking the argument while the plan is parsed, where it should exit
+	// non-zero with a message on stderr if the argument is invalid
+	Phase string `json:"phase"`
+	Path  string `json:"path"`
+	Arg   string `json:"arg"`
+}
+
+// WasmRuntime is the WASI runtime WebAssembly plugins are run with
+const WasmRuntime = "wasmtime"
+
+// WasmDir is where a WebAssembly plugin sees the directory holding its path
+const WasmDir = "/work"
+
+func (p Plugin) Paths() (string, string) { return p.Name, "" }
+func (p Plugin) MapPaths(fn func(string) string) Instruction {
+	return Plugin{Name: fn(p.Name), Exec: p.Exec, Arg: p.Arg}
+}
+func (p Plugin) String() string {
+	return fmt.Sprintf("plugin %s %s %s", p.command(), Quote(p.Name), p.Arg)
+}
+
+// Execute runs the plugin on the local machine, whatever the FS
+func (p Plugin) Execute(fsys FS) error {
+	cmd, err := p.cmd(PhaseExecute)
+	if err != nil {
+		return fmt.Errorf("exe plugin: %w", err)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := runContext(contextOf(fsys), cmd); err != nil {
+		return fmt.Errorf("exe plugin %s: %w", p.command(), err)
+	}
+	return nil
+}
+
+// validate runs a WebAssembly plugin in PhaseValidate. Other plugins aren't
+// asked, since they weren't written expecting to be run more than once
+func (p Plugin) validate() error {
+	if !p.wasm() {
+		return nil
+	}
+	cmd, err := p.cmd(PhaseValidate)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", p.command(), msg)
+		}
+		return fmt.Errorf("%s: %w", p.command(), err)
+	}
+	return nil
+}
+
+// cmd is the command running the plugin with its request on stdin
+func (p Plugin) cmd(phase string) (*exec.Cmd, error) {
+	req := PluginRequest{Command: p.command(), Phase: phase, Path: p.Name, Arg: p.Arg}
+	var cmd *exec.Cmd
+	if p.wasm() {
+		runtime, err := exec.LookPath(WasmRuntime)
+		if err != nil {
+			return nil, fmt.Errorf("WebAssembly plugins need %s: %w", WasmRuntime, err)
+		}
+		// the path is only visible at WasmDir, and only when executing
+		req.Path = WasmDir + "/" + filepath.Base(p.Name)
+		args := []string{"run"}
+		if phase == PhaseExecute {
+			dir, err := filepath.Abs(filepath.Dir(p.Name))
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "--dir", dir+"::"+WasmDir)
+		}
+		cmd = exec.Command(runtime, append(args, p.Exec)...)
+	} else {
+		cmd = exec.Command(p.Exec)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	return cmd, nil
+}
+
+func (p Plugin) command() string {
+	return PluginName(p.Exec)
+}
+
+func (p Plugin) wasm() bool {
+	return strings.EqualFold(filepath.Ext(p.Exec), ".wasm")
+}
+
+// PluginName is the command a plugin executable provides, its base name
+// without extension
+func PluginName(exec string) string {
+	base := filepath.Base(exec)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// RegisterPlugin adds a command to Commands which runs the executable or
+// WebAssembly module at exec, named by PluginName. Built in commands can't be
+// replaced
+func RegisterPlugin(exec string) error {
+	name := PluginName(exec)
+	if name == "" || strings.ContainsAny(name, " \t;|\"") {
+		return fmt.Errorf("plugin %q isn't a valid command name", name)
+	}
+	if slices.ContainsFunc(Commands, func(cmd Command) bool { return cmd.Name == name }) {
+		return fmt.Errorf("plugin %q is already a command", name)
+	}
+	Commands = append(Commands, Command{Name: name, Usage: name + " <arg>", RawArg: true, Validate: func(before, arg string) error {
+		return Plugin{Name: before, Exec: exec, Arg: arg}.validate()
+	}, Instruction: func(before, arg string, _ ParseOptions) Instruction {
+		return Plugin{Name: before, Exec: exec, Arg: arg}
+	}})
+	return nil
+}
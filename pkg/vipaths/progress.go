@@ -0,0 +1,64 @@
+package vipaths
+
+import (
+	"context"
+	"sync"
+)
+
+// Kinds of ProgressEvent
+const (
+	ProgressStart   = "start"
+	ProgressBytes   = "bytes"
+	ProgressDone    = "done"
+	ProgressError   = "error"
+	ProgressSkipped = "skipped"
+)
+
+// ProgressEvent reports on one instruction while a plan executes, see
+// Options.Progress
+type ProgressEvent struct {
+	Kind        string
+	Instruction Instruction
+	// Index is the instruction's position in the plan, from 0, and Count the
+	// number of instructions in it
+	Index, Count int
+	// Bytes is how much of a copy has been written so far, and Total its
+	// size, for ProgressBytes. Only local copies report bytes, after each
+	// chunk of copyChunk
+	Bytes, Total int64
+	// Err is set for ProgressError
+	Err error
+}
+
+// progressFunc reports how many bytes have been copied so far
+type progressFunc func(n int64)
+
+type progressKey struct{}
+
+// withProgress returns ctx carrying fn, for copyContext to report to
+func withProgress(ctx context.Context, fn progressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progressOf(ctx context.Context) progressFunc {
+	fn, _ := ctx.Value(progressKey{}).(progressFunc)
+	return fn
+}
+
+// progressReporter serialises calls to Options.Progress, since with Jobs
+// above 1 instructions report from several goroutines
+type progressReporter struct {
+	mu    sync.Mutex
+	fn    func(ProgressEvent)
+	count int
+}
+
+func (r *progressReporter) report(e ProgressEvent) {
+	if r == nil {
+		return
+	}
+	e.Count = r.count
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fn(e)
+}
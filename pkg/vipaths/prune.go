@@ -0,0 +1,63 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// pruneEmpty removes the source directories of the plan's renames which were
+// left empty, then their parents if that left them empty too, stopping at the
+// first which isn't. The working directory and its parents are never removed.
+// removed is called with each directory removed
+func pruneEmpty(fsys FS, plan Plan, removed func(dir string)) error {
+	rd, ok := unwrapFS(fsys).(ReadDirer)
+	if !ok {
+		return errors.New("filesystem can't list directories")
+	}
+	var dirs []string
+	for _, inst := range plan {
+		if r, ok := inst.(Rename); ok {
+			dirs = append(dirs, filepath.Dir(filepath.Clean(r.Before)))
+		}
+	}
+	// deepest first, so a parent is only checked once its children have been
+	slices.SortStableFunc(dirs, func(a, b string) int { return depth(b) - depth(a) })
+	for _, dir := range slices.Compact(dirs) {
+		for dir != "." && filepath.Dir(dir) != dir && !holdsWorkingDir(fsys, dir) {
+			entries, err := rd.ReadDir(dir)
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", Quote(dir), err)
+			}
+			if len(entries) > 0 {
+				break
+			}
+			if err := fsys.RemoveAll(dir); err != nil {
+				return fmt.Errorf("removing %s: %w", Quote(dir), err)
+			}
+			removed(dir)
+			dir = filepath.Dir(dir)
+		}
+	}
+	return nil
+}
+
+// holdsWorkingDir reports whether the local directory dir is the working
+// directory or one of its parents
+func holdsWorkingDir(fsys FS, dir string) bool {
+	if !isLocal(fsys) {
+		return false
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return true
+	}
+	abs, err := filepath.Abs(dir)
+	return err != nil || isWithin(wd, abs)
+}
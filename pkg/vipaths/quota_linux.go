@@ -0,0 +1,86 @@
+package vipaths
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// quotactl values, from linux/quota.h and linux/fs.h, which x/sys/unix
+// doesn't have
+const (
+	qGetQuota      = 0x800007
+	qifBLimits     = 1
+	qifBlockSize   = 1024
+	fsIocGetXattr  = 0x801c581f
+	fsXflagInherit = 0x200
+)
+
+// quota types, by their number in quotactl
+var quotaTypes = []string{"user", "group", "project"}
+
+// ifDqblk is struct if_dqblk, a quota's limits and usage
+type ifDqblk struct {
+	bHardLimit, bSoftLimit, curSpace  uint64
+	iHardLimit, iSoftLimit, curInodes uint64
+	bTime, iTime                      uint64
+	valid                             uint32
+	_                                 uint32
+}
+
+// fsxattr is struct fsxattr, for a directory's project
+type fsxattr struct {
+	xflags, extsize, nextents, projid, cowextsize uint32
+	_                                             [8]byte
+}
+
+// quotaLimits returns the quotas a file written into dir counts against, for
+// its user, its group, and the project dir passes on to new files, with the
+// room left under each hard limit. filesystems without quotas, and kernels
+// without quotactl_fd, have none
+func quotaLimits(dir string) []spaceLimit {
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil
+	}
+	defer unix.Close(fd)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return nil
+	}
+	// new files in a setgid directory get its group
+	gid := uint32(os.Getegid())
+	if st.Mode&unix.S_ISGID != 0 {
+		gid = st.Gid
+	}
+	ids := [3]uint32{uint32(os.Geteuid()), gid, 0}
+	var attr fsxattr
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), fsIocGetXattr, uintptr(unsafe.Pointer(&attr))); errno == 0 && attr.xflags&fsXflagInherit != 0 {
+		ids[2] = attr.projid
+	}
+
+	var limits []spaceLimit
+	for typ, id := range ids {
+		if typ == 2 && id == 0 {
+			continue
+		}
+		var dq ifDqblk
+		// QCMD
+		cmd := uint32(qGetQuota)<<8 | uint32(typ)
+		if _, _, errno := unix.Syscall6(unix.SYS_QUOTACTL_FD, uintptr(fd), uintptr(cmd), uintptr(id), uintptr(unsafe.Pointer(&dq)), 0, 0); errno != 0 {
+			continue
+		}
+		if dq.valid&qifBLimits == 0 || dq.bHardLimit == 0 {
+			continue
+		}
+		limit := int64(dq.bHardLimit * qifBlockSize)
+		limits = append(limits, spaceLimit{
+			id:   fmt.Sprintf("%d %s %d", st.Dev, quotaTypes[typ], id),
+			free: max(limit-int64(dq.curSpace), 0),
+			what: fmt.Sprintf("left in the quota of %s %d", quotaTypes[typ], id),
+		})
+	}
+	return limits
+}
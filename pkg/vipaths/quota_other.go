@@ -0,0 +1,6 @@
+//go:build !linux
+
+package vipaths
+
+// quotaLimits returns no quotas, they're only read on linux
+func quotaLimits(string) []spaceLimit { return nil }
@@ -0,0 +1,131 @@
+package vipaths
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// QuoteExpandable makes Quote quote names starting with ~ or containing $,
+// which ParseOptions.Expand would expand when read back unquoted, like the
+// office lock file ~$report.docx. It should be set to match Expand
+var QuoteExpandable = true
+
+// Quote returns name as it should appear in the buffer. Names which can't be
+// written as a plain line, like ones containing newlines, bytes which aren't
+// valid UTF-8, leading or trailing spaces, or which look like a command, are
+// wrapped in double quotes with C style backslash escapes, as are ones which
+// would be expanded, see QuoteExpandable. Other names are returned unchanged
+func Quote(name string) string {
+	if !needsQuote(name) {
+		return name
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(name); i++ {
+		// keep valid multibyte characters as they are, and escape each invalid byte
+		if r, size := utf8.DecodeRuneInString(name[i:]); r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\x%02x`, name[i])
+			continue
+		} else if size > 1 {
+			b.WriteString(name[i : i+size])
+			i += size - 1
+			continue
+		}
+		switch c := name[i]; c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+				continue
+			}
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func needsQuote(name string) bool {
+	if strings.HasPrefix(name, "#") || strings.HasPrefix(name, `"`) || !utf8.ValidString(name) {
+		return true
+	}
+	if strings.TrimSpace(name) != name {
+		return true
+	}
+	if QuoteExpandable && (strings.HasPrefix(name, "~") || strings.Contains(name, "$")) {
+		return true
+	}
+	if _, _, ok := parseCommand(name); ok {
+		return true
+	}
+	if len(splitCommands("copy "+name)) > 1 || len(splitChain(name)) > 1 {
+		return true
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// Unquote is the inverse of Quote. Lines not starting with a double quote are
+// returned unchanged
+func Unquote(line string) (string, error) {
+	if !strings.HasPrefix(line, `"`) {
+		return line, nil
+	}
+	if len(line) < 2 || !strings.HasSuffix(line, `"`) {
+		return "", fmt.Errorf("unterminated quote in %s", line)
+	}
+	inner := line[1 : len(line)-1]
+	var b strings.Builder
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		if c == '"' {
+			return "", fmt.Errorf("unescaped quote in %s", line)
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(inner) {
+			return "", fmt.Errorf("trailing backslash in %s", line)
+		}
+		switch inner[i] {
+		case '\\', '"':
+			b.WriteByte(inner[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			if i+2 >= len(inner) {
+				return "", fmt.Errorf("short \\x escape in %s", line)
+			}
+			v, err := strconv.ParseUint(inner[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\x escape in %s", line)
+			}
+			b.WriteByte(byte(v))
+			i += 2
+		default:
+			return "", fmt.Errorf("unknown escape \\%c in %s", inner[i], line)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,66 @@
+package vipaths
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name, quoted string
+	}{
+		{"a.txt", "a.txt"},
+		{"dir/with space.txt", "dir/with space.txt"},
+		{"café ☕.txt", "café ☕.txt"},
+		{"new\nline", `"new\nline"`},
+		{"tab\there", `"tab\there"`},
+		{" leading", `" leading"`},
+		{"trailing ", `"trailing "`},
+		{"#comment", `"#comment"`},
+		{`"quoted"`, `"\"quoted\""`},
+		{`back\slash\n`, `back\slash\n`},
+		{"rm", `"rm"`},
+		{"copy b", `"copy b"`},
+		{"bell\x07", `"bell\x07"`},
+		{"bad\xffutf8", `"bad\xffutf8"`},
+		{"~$report.docx", `"~$report.docx"`},
+		{"price$5", `"price$5"`},
+		{"a~b", "a~b"},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.name); got != tt.quoted {
+			t.Errorf("Quote(%q) = %q, want %q", tt.name, got, tt.quoted)
+		}
+		got, err := Unquote(tt.quoted)
+		if err != nil {
+			t.Errorf("Unquote(%q): %v", tt.quoted, err)
+			continue
+		}
+		if got != tt.name {
+			t.Errorf("Unquote(%q) = %q, want %q", tt.quoted, got, tt.name)
+		}
+	}
+}
+
+func TestQuoteNotExpandable(t *testing.T) {
+	QuoteExpandable = false
+	defer func() { QuoteExpandable = true }()
+	for _, name := range []string{"~$report.docx", "price$5"} {
+		if got := Quote(name); got != name {
+			t.Errorf("Quote(%q) = %q, want it unchanged", name, got)
+		}
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	for _, line := range []string{
+		`"unterminated`,
+		`"`,
+		`"inner " quote"`,
+		`"trailing \"`,
+		`"short \x4"`,
+		`"bad \xzz"`,
+		`"unknown \q"`,
+	} {
+		if got, err := Unquote(line); err == nil {
+			t.Errorf("Unquote(%q) = %q, want an error", line, got)
+		}
+	}
+}
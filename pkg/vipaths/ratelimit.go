@@ -0,0 +1,56 @@
+package vipaths
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter paces writes to an average number of bytes a second, shared by
+// every copy of a plan so that parallel copies don't multiply the rate
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	// next is when the bytes written so far are due, writes after it are
+	// delayed until then
+	next time.Time
+}
+
+// wait records n bytes written, sleeping until they're within the rate
+func (l *rateLimiter) wait(ctx context.Context, n int64) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	until := l.next
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// chunk is how much to copy between waits, small enough that the rate is
+// kept smoothly rather than in bursts of copyChunk
+func (l *rateLimiter) chunk() int64 {
+	return min(copyChunk, max(l.rate/8, 32<<10))
+}
+
+type rateLimitKey struct{}
+
+// withRateLimit returns ctx carrying l, for copyContext to pace itself with
+func withRateLimit(ctx context.Context, l *rateLimiter) context.Context {
+	return context.WithValue(ctx, rateLimitKey{}, l)
+}
+
+func rateLimitOf(ctx context.Context) *rateLimiter {
+	l, _ := ctx.Value(rateLimitKey{}).(*rateLimiter)
+	return l
+}
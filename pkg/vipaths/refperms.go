@@ -0,0 +1,91 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// refDirMode is the mode directories take from ref. a file's mode gains
+// search permission wherever it's readable, so a 0644 file makes 0755
+// directories
+func refDirMode(ref fs.FileInfo) fs.FileMode {
+	if ref.IsDir() {
+		return ref.Mode() & (fs.ModePerm | fs.ModeSetgid | fs.ModeSticky)
+	}
+	perm := ref.Mode().Perm()
+	return perm | perm&0444>>2
+}
+
+// refFileMode is the mode files take from ref. a directory's mode loses its
+// search permission, so a 0755 directory makes 0644 files
+func refFileMode(ref fs.FileInfo) fs.FileMode {
+	if ref.IsDir() {
+		return ref.Mode().Perm() &^ 0111
+	}
+	return ref.Mode().Perm()
+}
+
+// refPerms gives the files a copy made the mode and owner of ref. the
+// directories it made already have them, from MkdirAll
+func refPerms(fsys FS, inst Instruction, ref fs.FileInfo) error {
+	c, ok := inst.(Copy)
+	if !ok {
+		return nil
+	}
+	stat, err := fsys.Stat(c.To)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return refPermsFile(fsys, c.To, ref)
+	}
+	if !c.Contents {
+		return nil
+	}
+	rd, ok := unwrapFS(fsys).(ReadDirer)
+	if !ok {
+		return nil
+	}
+	// only what was copied, not what was in the destination already
+	var walk func(from, to string) error
+	walk = func(from, to string) error {
+		entries, err := rd.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			src, dst := filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())
+			if entry.IsDir() {
+				err = walk(src, dst)
+			} else {
+				err = refPermsFile(fsys, dst, ref)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(c.From, c.To)
+}
+
+func refPermsFile(fsys FS, name string, ref fs.FileInfo) error {
+	// owner first, since changing it clears the setuid and setgid bits
+	if owner, ok := FileOwner(ref); ok {
+		chowner, ok := unwrapFS(fsys).(Chowner)
+		if !ok {
+			return errors.New("filesystem can't change owners")
+		}
+		if err := chowner.Chown(name, owner.UID, owner.GID); err != nil {
+			return fmt.Errorf("chown %s: %w", Quote(name), err)
+		}
+	}
+	if chmoder, ok := unwrapFS(fsys).(Chmoder); ok {
+		if err := chmoder.Chmod(name, refFileMode(ref)); err != nil {
+			return fmt.Errorf("chmod %s: %w", Quote(name), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package vipaths
+
+import (
+	"io/fs"
+	"os"
+)
+
+// alreadyDone reports whether an instruction looks like it has already run,
+// as when a plan which was interrupted is executed again. shell commands,
+// plugins, and extracts can't be told apart from not having run, so are never
+// done
+func alreadyDone(fsys FS, inst Instruction) bool {
+	exists := func(name string) bool {
+		_, err := fsys.Stat(name)
+		return err == nil
+	}
+	switch inst := inst.(type) {
+	case Rename:
+		if inst.Link {
+			// the old path is left as a symlink to the new one
+			info, err := os.Lstat(inst.Before)
+			return isLocal(fsys) && err == nil && info.Mode()&fs.ModeSymlink != 0 && exists(inst.After)
+		}
+		return !exists(inst.Before) && exists(inst.After)
+	case Remove:
+		return !exists(inst.Name)
+	case Copy:
+		// what's already in the directory can't tell how far a copy got
+		return !inst.Contents && sameCopy(fsys, inst.From, inst.To)
+	case Mkdir:
+		info, err := fsys.Stat(inst.Name)
+		return err == nil && info.IsDir()
+	case Archive:
+		for _, name := range inst.Names {
+			if exists(name) {
+				return false
+			}
+		}
+		return exists(inst.To)
+	case Compress:
+		return (inst.Keep || !exists(inst.Name)) && exists(inst.To)
+	case Encrypt:
+		return !exists(inst.Name) && exists(inst.to())
+	case Dedup:
+		if !isLocal(fsys) {
+			return false
+		}
+		name, errName := os.Lstat(inst.Name)
+		orig, errOrig := os.Lstat(inst.Original)
+		return errName == nil && errOrig == nil && os.SameFile(name, orig)
+	case Relabel:
+		if !isLocal(fsys) {
+			return false
+		}
+		context, err := Context(inst.Name)
+		return err == nil && context == inst.Context
+	case Chmod:
+		stat, err := fsys.Stat(inst.Name)
+		return err == nil && stat.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) == inst.Mode
+	case Touch:
+		stat, err := fsys.Stat(inst.Name)
+		return err == nil && stat.ModTime().Equal(inst.Time)
+	case Relink:
+		if !isLocal(fsys) {
+			return false
+		}
+		target, err := os.Readlink(inst.Name)
+		return err == nil && target == inst.Target
+	case SetXattr:
+		if !isLocal(fsys) {
+			return false
+		}
+		value, err := Xattr(inst.Name, inst.Attr)
+		return err == nil && value == inst.Value
+	}
+	return false
+}
+
+// sameCopy reports whether to is already a copy of from. directories only
+// need to exist, their contents are copied by their own instructions. files
+// are compared by contents, so only on the local disk
+func sameCopy(fsys FS, from, to string) bool {
+	fromStat, err := fsys.Stat(from)
+	if err != nil {
+		return false
+	}
+	toStat, err := fsys.Stat(to)
+	if err != nil || fromStat.IsDir() != toStat.IsDir() {
+		return false
+	}
+	if fromStat.IsDir() {
+		return true
+	}
+	if fromStat.Size() != toStat.Size() || !isLocal(fsys) {
+		return false
+	}
+	same, err := sameContents(from, to)
+	return err == nil && same
+}
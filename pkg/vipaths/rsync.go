@@ -0,0 +1,82 @@
+package vipaths
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// Copy engines, see Options.CopyEngine
+const (
+	// CopyBuiltin copies files with the filesystem's Copy, and copying a
+	// directory only makes an empty one
+	CopyBuiltin = "builtin"
+	// CopyRsync copies with rsync, resuming partial copies and sending only
+	// the changed parts of files which already exist. Directories are copied
+	// with everything in them
+	CopyRsync = "rsync"
+)
+
+// CopyEngines are the valid values of Options.CopyEngine
+var CopyEngines = []string{CopyBuiltin, CopyRsync}
+
+// Commander is implemented by remote filesystems which can run commands on
+// the machine holding the files, like over ssh, so copies within them can be
+// made there with rsync rather than streamed through the local machine
+type Commander interface {
+	Command(ctx context.Context, name string, args ...string) error
+}
+
+// rsyncArgs keep the copy's metadata, like a copy made with cp -a, and keep
+// what's been sent if interrupted, to resume from next time
+var rsyncArgs = []string{"--archive", "--partial"}
+
+// rsyncCopy runs the copy with rsync, locally or with a Commander. ok is false
+// if the filesystem can do neither, and it should be copied as usual
+func rsyncCopy(ctx context.Context, fsys FS, c Copy, opts Options) (ok bool, err error) {
+	commander, isCommander := unwrapFS(fsys).(Commander)
+	if !isLocal(fsys) && !isCommander {
+		return false, nil
+	}
+	stat, err := fsys.Stat(c.From)
+	if err != nil {
+		return true, fmt.Errorf("exe stat: %w", err)
+	}
+	from := c.From
+	if stat.IsDir() {
+		// the contents of from, into to
+		from += "/"
+	}
+	// the directory gets fsys's modes and owner, like any other copy
+	if err := fsys.MkdirAll(filepath.Dir(c.To), 0777); err != nil {
+		return true, fmt.Errorf("exe mkdirall: %w", err)
+	}
+	args := slices.Clone(rsyncArgs)
+	if opts.BandwidthLimit > 0 {
+		// in KiB a second
+		args = append(args, fmt.Sprintf("--bwlimit=%d", max(opts.BandwidthLimit/1024, 1)))
+	}
+	for _, pattern := range opts.CopyExclude {
+		args = append(args, "--exclude="+pattern)
+	}
+	args = append(args, "--", from, c.To)
+	if isCommander {
+		if err := commander.Command(ctx, "rsync", args...); err != nil {
+			return true, fmt.Errorf("exe rsync: %w", err)
+		}
+		return true, nil
+	}
+	rsync, err := exec.LookPath("rsync")
+	if err != nil {
+		return true, fmt.Errorf("exe rsync: %w", err)
+	}
+	cmd := exec.Command(rsync, args...)
+	cmd.Stderr = os.Stderr
+	if err := runContext(ctx, cmd); err != nil {
+		return true, fmt.Errorf("exe rsync: %w", err)
+	}
+	return true, nil
+}
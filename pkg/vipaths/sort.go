@@ -0,0 +1,21 @@
+package vipaths
+
+import "sort"
+
+type multiSortable[T any] struct {
+	data  []T
+	extra [][]T
+	less  func(a, b T) bool
+}
+
+func (m *multiSortable[T]) Len() int           { return len(m.data) }
+func (m *multiSortable[T]) Less(i, j int) bool { return m.less(m.data[i], m.data[j]) }
+func (m *multiSortable[T]) Swap(i, j int) {
+	for _, d := range append([][]T{m.data}, m.extra...) {
+		d[i], d[j] = d[j], d[i]
+	}
+}
+
+func multiSortStable[T any](data []T, extra [][]T, less func(a, b T) bool) {
+	sort.Stable(&multiSortable[T]{data, extra, less})
+}
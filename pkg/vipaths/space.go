@@ -0,0 +1,83 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// CheckSpace checks that each local filesystem the plan writes to has room
+// for everything written to it, totalling the copies onto it and the renames
+// onto it from another filesystem. On linux, the user, group, and project
+// quotas the destinations count against are checked the same way. Every
+// filesystem or quota short of space is reported, rather than the plan
+// failing partway through when one fills up. Space freed by removes isn't
+// counted, since they may run after the copies
+func (p Plan) CheckSpace() error {
+	type usage struct {
+		spaceLimit
+		dir   string
+		need  int64
+		count int
+	}
+	byID := map[string]*usage{}
+	var ids []string
+	for _, inst := range p {
+		from, to, ok := spaceUse(OS, inst)
+		if !ok {
+			continue
+		}
+		dir := existingDir(OS, filepath.Dir(to))
+		size := Size(OS, from)
+		for _, limit := range spaceLimits(dir) {
+			u, ok := byID[limit.id]
+			if !ok {
+				u = &usage{spaceLimit: limit, dir: dir}
+				byID[limit.id] = u
+				ids = append(ids, limit.id)
+			}
+			u.need += size
+			u.count++
+		}
+	}
+	var errs []error
+	for _, id := range ids {
+		if u := byID[id]; u.need > u.free {
+			errs = append(errs, fmt.Errorf("%d operations onto the filesystem of %s need %s, only %s %s", u.count, Quote(u.dir), FormatBytes(u.need), FormatBytes(u.free), u.what))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// spaceLimit is room left for writing, on a filesystem or under a quota
+type spaceLimit struct {
+	// id is shared by every directory under the same limit
+	id   string
+	free int64
+	// what the room is, after how much of it there is, like "free"
+	what string
+}
+
+// spaceLimits returns the room left on the filesystem of the existing
+// directory dir, and under any quotas a file written into it counts against
+func spaceLimits(dir string) []spaceLimit {
+	var limits []spaceLimit
+	if free, id, err := freeSpace(dir); err == nil {
+		limits = append(limits, spaceLimit{id: id, free: int64(free), what: "free"})
+	}
+	return append(limits, quotaLimits(dir)...)
+}
+
+// spaceUse returns the source and destination of an instruction which writes
+// a copy of its source's data, taking up space on the destination's filesystem
+func spaceUse(fsys FS, inst Instruction) (string, string, bool) {
+	switch inst := inst.(type) {
+	case Copy:
+		return inst.From, inst.To, true
+	case Rename:
+		if crossesDevice(fsys, inst) {
+			return inst.Before, inst.After, true
+		}
+	}
+	return "", "", false
+}
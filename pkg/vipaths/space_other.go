@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package vipaths
+
+import "errors"
+
+// freeSpace is unknown, so CheckSpace skips the filesystem, since statfs
+// doesn't report it the same way everywhere
+func freeSpace(string) (uint64, string, error) { return 0, "", errors.ErrUnsupported }
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package vipaths
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the bytes available to the user on the filesystem holding
+// path, and an id which is the same for paths on the same filesystem
+func freeSpace(path string) (uint64, string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, "", err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), fmt.Sprint(st.Fsid), nil
+}
@@ -0,0 +1,39 @@
+package vipaths
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+)
+
+// ErrSpecialFile is a FIFO, socket, or device node which couldn't be
+// recreated by a copy. Their contents aren't data, so they're never read,
+// which would block on a FIFO or copy a whole disk from a device node
+var ErrSpecialFile = errors.New("special file")
+
+// isSpecial is whether mode is a FIFO, socket, or device node
+func isSpecial(mode fs.FileMode) bool {
+	return mode&(fs.ModeNamedPipe|fs.ModeSocket|fs.ModeDevice|fs.ModeCharDevice) != 0
+}
+
+type skipSpecialKey struct{}
+
+// withSkipSpecial returns ctx carrying fn, for copies to call with special
+// files they skip rather than failing on
+func withSkipSpecial(ctx context.Context, fn func(path string, err error)) context.Context {
+	return context.WithValue(ctx, skipSpecialKey{}, fn)
+}
+
+// skipSpecial is whether err is a special file from a copy of from which is
+// to be skipped, calling the function the instruction's context carries
+func skipSpecial(fsys FS, from string, err error) bool {
+	if !errors.Is(err, ErrSpecialFile) {
+		return false
+	}
+	fn, _ := contextOf(fsys).Value(skipSpecialKey{}).(func(string, error))
+	if fn == nil {
+		return false
+	}
+	fn(from, err)
+	return true
+}
@@ -0,0 +1,79 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrStale is returned by Execute when a source was moved or changed by
+// something else after its snapshot was taken
+var ErrStale = errors.New("source changed since listing")
+
+// Snapshot is the state of paths when they were listed, so that Execute can
+// notice sources which another process moved or changed while the buffer was
+// being edited, rather than acting on the wrong file
+type Snapshot map[string]fs.FileInfo
+
+// TakeSnapshot stats each of the paths. Paths which can't be stat'd aren't
+// recorded, and so aren't checked
+func TakeSnapshot(fsys FS, paths []string) Snapshot {
+	s := make(Snapshot, len(paths))
+	for _, path := range paths {
+		if info, err := fsys.Stat(path); err == nil {
+			s[filepath.Clean(path)] = info
+		}
+	}
+	return s
+}
+
+// check compares the current state of name with the snapshot. files must
+// have the same size and modification time. directories only need to still
+// exist, since the plan's own deeper operations change their modification
+// time. on the local disk both must also still be the same file
+func (s Snapshot) check(fsys FS, name string) error {
+	before, ok := s[filepath.Clean(name)]
+	if !ok {
+		return nil
+	}
+	after, err := fsys.Stat(name)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %s was moved or removed", ErrStale, Quote(name))
+	case before.IsDir() != after.IsDir():
+		return fmt.Errorf("%w: %s was replaced", ErrStale, Quote(name))
+	case unwrapFS(fsys) == OS && !os.SameFile(before, after):
+		return fmt.Errorf("%w: %s was replaced", ErrStale, Quote(name))
+	case !before.IsDir() && (before.Size() != after.Size() || !before.ModTime().Equal(after.ModTime())):
+		return fmt.Errorf("%w: %s was modified", ErrStale, Quote(name))
+	}
+	return nil
+}
+
+// sources are the paths an instruction reads from
+func sources(inst Instruction) []string {
+	if a, ok := inst.(Archive); ok {
+		return a.Names
+	}
+	src, _ := inst.Paths()
+	if src == "" {
+		return nil
+	}
+	return []string{src}
+}
+
+// touched reports whether path is, or is inside, one of paths. those were
+// changed by the plan itself, so aren't expected to match the snapshot
+func touched(paths map[string]bool, path string) bool {
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if paths[p] {
+			return true
+		}
+		if filepath.Dir(p) == p || !strings.ContainsRune(p, filepath.Separator) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package vipaths
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Stats summarises an executed plan. Pass one in Options to have Execute fill it
+type Stats struct {
+	// Counts and Bytes are keyed by operation name, like "rename"
+	Counts  map[string]int
+	Bytes   map[string]int64
+	Elapsed time.Duration
+	// Timings are the durations of each instruction, slowest first
+	Timings []Timing
+}
+
+// Timing is how long an instruction took to execute
+type Timing struct {
+	Instruction Instruction
+	Duration    time.Duration
+}
+
+func (s *Stats) record(inst Instruction, size int64, dur time.Duration) {
+	if s.Counts == nil {
+		s.Counts = map[string]int{}
+		s.Bytes = map[string]int64{}
+	}
+	op := OpName(inst)
+	s.Counts[op]++
+	s.Bytes[op] += size
+	s.Timings = append(s.Timings, Timing{inst, dur})
+}
+
+func (s *Stats) finish(elapsed time.Duration) {
+	s.Elapsed = elapsed
+	s.sortTimings()
+}
+
+// add totals other into s, for an Executor running several plans
+func (s *Stats) add(other Stats) {
+	for op, n := range other.Counts {
+		if s.Counts == nil {
+			s.Counts = map[string]int{}
+			s.Bytes = map[string]int64{}
+		}
+		s.Counts[op] += n
+		s.Bytes[op] += other.Bytes[op]
+	}
+	s.Elapsed += other.Elapsed
+	s.Timings = append(s.Timings, other.Timings...)
+	s.sortTimings()
+}
+
+// Percentile is how long the given fraction of op's instructions took at
+// most, like 0.9 for the 90th percentile, or zero if none ran
+func (s *Stats) Percentile(op string, p float64) time.Duration {
+	var durs []time.Duration
+	for _, t := range s.Timings {
+		if OpName(t.Instruction) == op {
+			durs = append(durs, t.Duration)
+		}
+	}
+	if len(durs) == 0 {
+		return 0
+	}
+	slices.Sort(durs)
+	i := int(math.Ceil(p*float64(len(durs)))) - 1
+	return durs[min(max(i, 0), len(durs)-1)]
+}
+
+func (s *Stats) sortTimings() {
+	sort.SliceStable(s.Timings, func(i, j int) bool { return s.Timings[i].Duration > s.Timings[j].Duration })
+}
+
+// OpName is the name of an instruction's operation, the first word of its String
+func OpName(inst Instruction) string {
+	name, _, _ := strings.Cut(inst.String(), " ")
+	return name
+}
+
+// Size is the total size of the files at name. directories are only walked on
+// the OS filesystem, elsewhere they count as their own size
+func Size(fsys FS, name string) int64 {
+	stat, err := fsys.Stat(name)
+	if err != nil {
+		return 0
+	}
+	if !stat.IsDir() || fsys != OS {
+		return stat.Size()
+	}
+	var total int64
+	filepath.WalkDir(name, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// FormatBytes formats a number of bytes with a binary unit, like 1.5 MiB
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseBytes parses a size like 1.5G, 500MB, 100KiB, or 42, where units are
+// powers of 1024 whether or not they're written with an i
+func ParseBytes(s string) (int64, error) {
+	num := strings.TrimRight(strings.TrimSpace(s), "BbIi")
+	var shift int
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGTPE", byte(unicode.ToUpper(rune(num[n-1])))); i >= 0 {
+			num, shift = num[:n-1], 10*(i+1)
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("expected a size like 1.5G or 500M, not %q", s)
+	}
+	return int64(v * float64(int64(1)<<shift)), nil
+}
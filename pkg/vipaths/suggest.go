@@ -0,0 +1,84 @@
+package vipaths
+
+import (
+	"strings"
+	"unicode"
+)
+
+// nearCommand returns the command the first word of an edited line was
+// probably meant to be, like copy for `cpoy dest`, when it isn't a command
+// already. commands which take no argument count when they're the whole
+// line, like `rn`. quoted lines and words with a path separator or an
+// extension are names
+func nearCommand(line string) (string, string, bool) {
+	if strings.HasPrefix(line, `"`) {
+		return "", "", false
+	}
+	if _, _, ok := parseCommand(line); ok {
+		return "", "", false
+	}
+	word, rest, hasArg := strings.Cut(line, " ")
+	if strings.ContainsAny(word, `/\.;|`) || !strings.ContainsFunc(word, unicode.IsLetter) {
+		return "", "", false
+	}
+	for _, cmd := range Commands {
+		if hasArg && strings.TrimSpace(rest) == "" || !hasArg && cmd.Auto == nil {
+			continue
+		}
+		if typoOf(word, cmd.Name) {
+			return word, cmd.Name, true
+		}
+	}
+	return "", "", false
+}
+
+// typoOf is whether word is name typed with a slip: a different case, two
+// letters swapped, or for longer names, a letter missing, extra, or wrong.
+// short names only allow the first two, since most short words are a letter
+// away from one
+func typoOf(word, name string) bool {
+	if word == name {
+		return false
+	}
+	if strings.EqualFold(word, name) {
+		return true
+	}
+	a, b := []rune(strings.ToLower(word)), []rune(name)
+	if len(b) > 3 {
+		return typoDistance(a, b) <= 1+len(b)/7
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i+1 < len(a); i++ {
+		if a[i] != b[i] {
+			return a[i] == b[i+1] && a[i+1] == b[i] && string(a[i+2:]) == string(b[i+2:])
+		}
+	}
+	return false
+}
+
+// typoDistance is the number of letters inserted, removed, changed, or swapped
+// with their neighbour to get from a to b
+func typoDistance(a, b []rune) int {
+	// rows for a[:i-2], a[:i-1], and a[:i]
+	prev2, prev, cur := make([]int, len(b)+1), make([]int, len(b)+1), make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,121 @@
+package vipaths
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TargetFilesystems are the filesystems destinations can be checked against
+// with ParseOptions.TargetFS
+var TargetFilesystems = []string{"ext4", "ntfs", "exfat", "apfs"}
+
+// reservedNames can't be used as file names on windows, with or without an extension
+var reservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// validateTarget checks each element of path against the naming rules of the
+// target filesystem
+func validateTarget(target, path string) error {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	for _, elem := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if elem == "." || elem == ".." {
+			continue
+		}
+		if err := validateTargetElem(target, elem); err != nil {
+			return fmt.Errorf("%q on %s: %w", elem, target, err)
+		}
+	}
+	return nil
+}
+
+func validateTargetElem(target, elem string) error {
+	switch target {
+	case "ext4":
+		if len(elem) > 255 {
+			return fmt.Errorf("longer than 255 bytes")
+		}
+		if strings.ContainsRune(elem, 0) {
+			return fmt.Errorf("contains a NUL byte")
+		}
+	case "apfs":
+		if !utf8.ValidString(elem) {
+			return fmt.Errorf("not valid UTF-8")
+		}
+		if len(elem) > 255 {
+			return fmt.Errorf("longer than 255 bytes")
+		}
+		if strings.ContainsRune(elem, 0) {
+			return fmt.Errorf("contains a NUL byte")
+		}
+	case "ntfs", "exfat":
+		if len(utf16.Encode([]rune(elem))) > 255 {
+			return fmt.Errorf("longer than 255 UTF-16 characters")
+		}
+		if i := strings.IndexFunc(elem, func(r rune) bool { return r < 0x20 || strings.ContainsRune(`<>:"\|?*`, r) }); i >= 0 {
+			return fmt.Errorf("contains %q, which isn't allowed", elem[i:i+1])
+		}
+		if strings.HasSuffix(elem, ".") || strings.HasSuffix(elem, " ") {
+			return fmt.Errorf("ends with a dot or space, which windows strips")
+		}
+		stem, _, _ := strings.Cut(elem, ".")
+		if _, ok := reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))]; ok {
+			return fmt.Errorf("a reserved name on windows")
+		}
+	default:
+		return fmt.Errorf("unknown filesystem, expected one of %s", strings.Join(TargetFilesystems, ", "))
+	}
+	return nil
+}
+
+// foldTarget returns the name which elem is looked up by on the target
+// filesystem, so names which land on the same file have the same key. ntfs
+// and exfat ignore case, and apfs, by default, ignores case and normalisation
+func foldTarget(target, elem string) (string, bool) {
+	switch target {
+	case "ntfs", "exfat":
+		return cases.Fold().String(elem), true
+	case "apfs":
+		return cases.Fold().String(norm.NFC.String(elem)), true
+	}
+	return elem, false
+}
+
+// caseConflict returns the first destination in the plan which differs from
+// an earlier one only by case, on a target filesystem which ignores case,
+// along with the source of the instruction. directories count too, so
+// Photos/a.jpg and photos/b.jpg, which would end up in the same directory,
+// conflict
+func caseConflict(target string, plan Plan) *CaseConflictError {
+	if _, ok := foldTarget(target, ""); !ok {
+		return nil
+	}
+	seen := map[string]string{}
+	for _, inst := range plan {
+		src, dst := inst.Paths()
+		if dst == "" {
+			continue
+		}
+		clean := filepath.Clean(dst)
+		vol := filepath.VolumeName(clean)
+		var prefix, key string
+		for _, elem := range strings.FieldsFunc(clean[len(vol):], func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+			prefix = filepath.Join(prefix, elem)
+			folded, _ := foldTarget(target, elem)
+			key = filepath.Join(key, folded)
+			if other, ok := seen[key]; ok && other != prefix {
+				return &CaseConflictError{TargetFS: target, Src: src, Dst: vol + prefix, Other: vol + other}
+			}
+			seen[key] = prefix
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package vipaths
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrashEntry is a path moved to the trash by MoveToTrash
+type TrashEntry struct {
+	// Path is where it was, and Trashed where it is in the trash
+	Path    string `json:"path"`
+	Trashed string `json:"trashed"`
+	// Info is its .trashinfo file, which tells file managers where it was
+	Info    string    `json:"info"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// trashInfoTime is the layout of DeletionDate in a .trashinfo file, in local
+// time
+const trashInfoTime = "2006-01-02T15:04:05"
+
+// MoveToTrash moves the local path name to the trash as laid out by the
+// freedesktop.org trash spec, so it can be restored by a file manager too. The
+// trash is in $XDG_DATA_HOME, or for paths on another filesystem a .Trash-<uid>
+// directory at the top of theirs, since moving there would mean copying
+func MoveToTrash(name string) (TrashEntry, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	stat, err := os.Lstat(abs)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	dir, err := trashDir(abs, stat)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return TrashEntry{}, fmt.Errorf("making trash: %w", err)
+		}
+	}
+	now := time.Now()
+	base := filepath.Base(abs)
+	for n := 1; ; n++ {
+		trashName := base
+		if n > 1 {
+			trashName = fmt.Sprintf("%s.%d", base, n)
+		}
+		// the info file is made first and exclusively, claiming the name
+		info := filepath.Join(dir, "info", trashName+".trashinfo")
+		f, err := os.OpenFile(info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return TrashEntry{}, fmt.Errorf("writing trash info: %w", err)
+		}
+		escaped := (&url.URL{Path: filepath.ToSlash(abs)}).EscapedPath()
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, now.Format(trashInfoTime))
+		if err := errors.Join(err, f.Close()); err != nil {
+			os.Remove(info)
+			return TrashEntry{}, fmt.Errorf("writing trash info: %w", err)
+		}
+		trashed := filepath.Join(dir, "files", trashName)
+		if err := os.Rename(abs, trashed); err != nil {
+			os.Remove(info)
+			return TrashEntry{}, err
+		}
+		return TrashEntry{Path: abs, Trashed: trashed, Info: info, Deleted: now}, nil
+	}
+}
+
+// trashDir is the trash for the path abs, described by stat. that's the home
+// trash if it's on the same filesystem, or where devices can't be told apart
+func trashDir(abs string, stat fs.FileInfo) (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("finding home dir: %w", err)
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	home := filepath.Join(data, "Trash")
+	dev, ok := DeviceID(stat)
+	if !ok {
+		return home, nil
+	}
+	// the closest directory to the trash which exists
+	for dir := home; ; dir = filepath.Dir(dir) {
+		if dirStat, err := os.Stat(dir); err == nil {
+			if homeDev, ok := DeviceID(dirStat); !ok || homeDev == dev {
+				return home, nil
+			}
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			return home, nil
+		}
+	}
+	top := filepath.Dir(abs)
+	for top != filepath.Dir(top) {
+		parent, err := os.Stat(filepath.Dir(top))
+		if err != nil {
+			return "", err
+		}
+		if parentDev, _ := DeviceID(parent); parentDev != dev {
+			break
+		}
+		top = filepath.Dir(top)
+	}
+	return filepath.Join(top, fmt.Sprintf(".Trash-%d", os.Getuid())), nil
+}
+
+type trashedKey struct{}
+
+// withTrashed returns ctx carrying fn, for removes to call with where they
+// moved each path in the trash
+func withTrashed(ctx context.Context, fn func(TrashEntry)) context.Context {
+	return context.WithValue(ctx, trashedKey{}, fn)
+}
+
+// trashed calls the function the instruction's context carries with entry
+func trashed(fsys FS, entry TrashEntry) {
+	if fn, _ := contextOf(fsys).Value(trashedKey{}).(func(TrashEntry)); fn != nil {
+		fn(entry)
+	}
+}
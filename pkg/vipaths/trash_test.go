@@ -0,0 +1,53 @@
+package vipaths
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMoveToTrash(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+	var entries []TrashEntry
+	for range 2 {
+		name := filepath.Join(dir, "a b%.txt")
+		if err := os.WriteFile(name, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := MoveToTrash(name)
+		if err != nil {
+			t.Fatalf("MoveToTrash: %v", err)
+		}
+		if entry.Path != name {
+			t.Errorf("Path = %q, want %q", entry.Path, name)
+		}
+		if _, err := os.Lstat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after trashing", name)
+		}
+		entries = append(entries, entry)
+	}
+
+	trash := filepath.Join(dir, "data", "Trash")
+	for i, want := range []string{"a b%.txt", "a b%.txt.2"} {
+		if entries[i].Trashed != filepath.Join(trash, "files", want) {
+			t.Errorf("Trashed = %q, want it named %q", entries[i].Trashed, want)
+		}
+		if _, err := os.Stat(entries[i].Trashed); err != nil {
+			t.Error(err)
+		}
+		info, err := os.ReadFile(entries[i].Info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "Path=" + filepath.ToSlash(dir) + "/a%20b%25.txt\n"; !strings.Contains(string(info), want) {
+			t.Errorf("trash info\n%s\nwant a line %q", info, want)
+		}
+	}
+
+	if _, err := MoveToTrash(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("MoveToTrash of a missing path = %v, want not exist", err)
+	}
+}
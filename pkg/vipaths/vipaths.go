@@ -0,0 +1,926 @@
+// Package vipaths is the engine behind vi-paths. It turns a list of paths and an
+// edited copy of that list into a Plan of instructions, and executes them.
+package vipaths
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plan is an ordered list of instructions
+type Plan []Instruction
+
+// What a cleared line means, see ParseOptions
+const (
+	// EmptyDelete removes the path
+	EmptyDelete = "delete"
+	// EmptyKeep leaves the path alone
+	EmptyKeep = "keep"
+	// EmptyError fails parsing with ErrEmptyLine
+	EmptyError = "error"
+)
+
+// What a line edited to a new path means, see ParseOptions
+const (
+	// DefaultRename moves the path to the new one
+	DefaultRename = "rename"
+	// DefaultCopy copies the path to the new one, keeping the original
+	DefaultCopy = "copy"
+)
+
+// ErrEmptyLine is returned by Parse for a cleared line when ParseOptions.Empty
+// is EmptyError
+var ErrEmptyLine = errors.New("line was cleared")
+
+// ParseOptions control how edited lines are parsed
+type ParseOptions struct {
+	// Expand expands ~, environment variables, and templates like {base} in
+	// unquoted destinations, see ExpandTemplate
+	Expand bool
+	// RemoveExtracted removes archives after the extract command unpacks them
+	RemoveExtracted bool
+	// KeepCompressed keeps the originals of files compressed by the gzip and
+	// zstd commands
+	KeepCompressed bool
+	// Duplicates maps paths to an identical file they can be replaced with
+	// by the dedup command
+	Duplicates map[string]string
+	// Merge is the merge policy for renames onto existing directories, see
+	// Rename. Empty means don't merge
+	Merge string
+	// LeaveSymlink leaves a symlink at the old path of every rename, pointing
+	// to the new one, for migrating gradually
+	LeaveSymlink bool
+	// Trash moves removed paths to the trash rather than deleting them, see
+	// Remove
+	Trash bool
+	// TargetFS, if set, checks destinations against the naming rules of one
+	// of TargetFilesystems, for when the files are headed to another system.
+	// On those which ignore case, destinations differing only by case are a
+	// CaseConflictError
+	TargetFS string
+	// Empty is what a cleared line means, one of EmptyDelete, EmptyKeep, or
+	// EmptyError. It defaults to EmptyDelete
+	Empty string
+	// DefaultOp is what a line edited to a new path means, DefaultRename or
+	// DefaultCopy, for deriving a tree from sources which mustn't change. It
+	// defaults to DefaultRename. Commands after it in a chain run on the copy
+	DefaultOp string
+	// Order is how the instructions are ordered, one of Orders. It defaults
+	// to OrderDepth
+	Order OrderPolicy
+	// Taken, if set, reports whether a name is in use, for commands like dup
+	// which pick a free one. It defaults to checking the names in before,
+	// which isn't enough when only changed lines are passed to Parse
+	Taken func(name string) bool
+	// Protected, if set, reports whether a path mustn't be removed or moved,
+	// failing Parse with a ProtectedError if a line would. Filesystem roots
+	// and the current directory are always protected
+	Protected func(path string) bool
+	// Strict fails lines which look like a mistyped command, like
+	// `cpoy dest`, with an UnknownCommandError, rather than renaming to a
+	// file named that
+	Strict bool
+	// NearCommand, if set, is called with the UnknownCommandError for each
+	// line which looks like a mistyped command when Strict isn't set, to
+	// warn about the rename it's parsed as
+	NearCommand func(*UnknownCommandError)
+}
+
+// Parse compares the original paths with their edited lines and returns the
+// instructions needed to get from one to the other. Edited lines may be quoted as
+// by Quote. Unchanged lines may be left out, see ReadChanges. The inputs are not
+// modified
+func Parse(before, after []string, opts ParseOptions) (Plan, error) {
+	if len(after) != len(before) {
+		return nil, &LineCountError{Before: len(before), After: len(after)}
+	}
+	if opts.Order != "" && !slices.Contains(Orders, opts.Order) {
+		return nil, fmt.Errorf("unknown order %q", opts.Order)
+	}
+	if opts.DefaultOp != "" && opts.DefaultOp != DefaultRename && opts.DefaultOp != DefaultCopy {
+		return nil, fmt.Errorf("unknown default operation %q", opts.DefaultOp)
+	}
+	before = append([]string(nil), before...)
+	after = append([]string(nil), after...)
+
+	// make sure we do the deepest operations first
+	if opts.Order.byDepth() {
+		multiSortStable(before, [][]string{after}, func(a, b string) bool {
+			return depth(a) > depth(b)
+		})
+	}
+
+	// names which commands like dup shouldn't pick
+	taken := map[string]bool{}
+	if opts.Taken == nil {
+		for _, name := range before {
+			taken[name] = true
+		}
+	}
+	isTaken := func(name string) bool {
+		return taken[name] || opts.Taken != nil && opts.Taken(name)
+	}
+
+	// parseLine parses one part of an edited line, the whole line unless it's
+	// a chain
+	parseLine := func(before, after string) (Plan, error) {
+		if after == Quote(before) {
+			return nil, nil
+		}
+		var plan Plan
+		if _, _, ok := parseCommand(after); ok {
+			for _, line := range splitCommands(after) {
+				cmd, arg, ok := parseCommand(line)
+				if !ok {
+					return nil, fmt.Errorf("parsing line: unknown command %q", line)
+				}
+				switch {
+				case cmd.Auto != nil && strings.HasPrefix(arg, ";"):
+					return nil, fmt.Errorf("parsing line: unknown command after %s in %q", cmd.Name, line)
+				case cmd.Auto != nil && arg == "":
+					arg = cmd.Auto(before, isTaken, opts)
+					if arg == "" {
+						return nil, fmt.Errorf("parsing line: %s needs an argument for %q", cmd.Name, before)
+					}
+				case !cmd.RawArg:
+					var err error
+					if arg, err = parsePath(arg, before, opts); err != nil {
+						return nil, fmt.Errorf("parsing %s argument: %w", cmd.Name, err)
+					}
+				}
+				if cmd.Validate != nil {
+					if err := cmd.Validate(before, arg); err != nil {
+						return nil, fmt.Errorf("parsing %s argument: %w", cmd.Name, err)
+					}
+				}
+				inst := cmd.Instruction(before, arg, opts)
+				if _, dst := inst.Paths(); dst != "" {
+					taken[dst] = true
+				}
+				plan = append(plan, inst)
+			}
+			return plan, nil
+		}
+		if word, cmd, ok := nearCommand(after); ok {
+			err := &UnknownCommandError{Path: before, Word: word, Command: cmd}
+			if opts.Strict {
+				return nil, err
+			}
+			if opts.NearCommand != nil {
+				opts.NearCommand(err)
+			}
+		}
+		after, err := parsePath(after, before, opts)
+		if err != nil {
+			return nil, fmt.Errorf("parsing line: %w", err)
+		}
+
+		switch {
+		case after == "" && opts.Empty == EmptyKeep:
+		case after == "" && opts.Empty == EmptyError:
+			return nil, fmt.Errorf("%w: %s", ErrEmptyLine, Quote(before))
+		case after == "":
+			plan = append(plan, Remove{Name: before, Trash: opts.Trash})
+		case after != before && opts.DefaultOp == DefaultCopy:
+			plan = append(plan, copyInstruction(before, after, opts))
+		case after != before:
+			plan = append(plan, Rename{Before: before, After: after, Merge: opts.Merge, Link: opts.LeaveSymlink})
+		}
+		return plan, nil
+	}
+
+	var plan Plan
+	for i := range before {
+		// only the edited line is trimmed, significant spaces in names are quoted
+		before := before[i]
+		after := strings.TrimSpace(after[i])
+		if after == Quote(before) {
+			continue
+		}
+		// each part of a chain runs on the path as the part before renamed it
+		path := before
+		for _, part := range splitChain(after) {
+			insts, err := parseLine(path, part)
+			if err != nil {
+				return nil, &ParseError{Path: before, Line: after, Err: err}
+			}
+			_, _, isCommand := parseCommand(part)
+			for _, inst := range insts {
+				switch inst := inst.(type) {
+				case Rename:
+					path = inst.After
+				case Copy:
+					// a copy in place of a rename, not one asked for
+					if !isCommand {
+						path = inst.To
+					}
+				}
+			}
+			plan = append(plan, insts...)
+		}
+	}
+
+	plan = mergeArchives(plan)
+	// directories from mkdir lines are made before anything moves into them
+	if opts.Order != OrderBuffer {
+		var mkdirs, rest Plan
+		for _, inst := range plan {
+			if isMkdir(inst) {
+				mkdirs = append(mkdirs, inst)
+			} else {
+				rest = append(rest, inst)
+			}
+		}
+		plan = append(mkdirs, rest...)
+	}
+	if opts.Order == OrderDependency {
+		plan = dependencyOrder(plan)
+	}
+	if opts.Order == OrderRemovesLast {
+		var rest, removes Plan
+		for _, inst := range plan {
+			if _, ok := inst.(Remove); ok {
+				removes = append(removes, inst)
+			} else {
+				rest = append(rest, inst)
+			}
+		}
+		plan = append(rest, removes...)
+	}
+
+	for _, inst := range plan {
+		if path, ok := protected(inst, opts.Protected); ok {
+			return nil, &ProtectedError{Op: OpName(inst), Path: path}
+		}
+		if _, dst := inst.Paths(); dst != "" {
+			if err := validateName(dst); err != nil {
+				return nil, fmt.Errorf("invalid destination %q: %w", dst, err)
+			}
+			if opts.TargetFS != "" {
+				if err := validateTarget(opts.TargetFS, dst); err != nil {
+					return nil, fmt.Errorf("invalid destination %q: %w", dst, err)
+				}
+			}
+		}
+	}
+	if opts.TargetFS != "" {
+		if err := caseConflict(opts.TargetFS, plan); err != nil {
+			return nil, err
+		}
+	}
+	if err := duplicateDst(plan); err != nil {
+		return nil, err
+	}
+	if cycle := findCycle(plan); cycle != nil {
+		return nil, &CycleError{Paths: cycle}
+	}
+	plan = orderVacates(plan)
+
+	return plan, nil
+}
+
+// Unchanged reports whether the edited lines are the same as the original
+// paths, ignoring surrounding whitespace. It is a cheap check before Parse
+func Unchanged(before, after []string) bool {
+	if len(before) != len(after) {
+		return false
+	}
+	for i := range before {
+		if strings.TrimSpace(after[i]) != Quote(before[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePath unquotes an edited path, or expands it if it isn't quoted. src
+// is the path of the line, for templates like {base}, or empty if it has none
+func parsePath(line, src string, opts ParseOptions) (string, error) {
+	if strings.HasPrefix(line, `"`) || !opts.Expand || line == "" {
+		return Unquote(line)
+	}
+	path, err := Expand(line)
+	if err != nil {
+		return "", err
+	}
+	return ExpandTemplate(path, src), nil
+}
+
+// depth is the number of path separators in path, ignoring any volume name. both
+// slashes count on windows
+func depth(path string) int {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	return strings.Count(filepath.ToSlash(path), "/")
+}
+
+// Options control how a plan is executed
+type Options struct {
+	// FS is the filesystem to execute against, defaulting to OS
+	FS FS
+	// DryRun skips executing instructions. Pre and Post are still called
+	DryRun bool
+	// Pre is called before each instruction. An error aborts execution
+	Pre func(Instruction) error
+	// Post is called after each instruction. An error aborts execution
+	Post func(Instruction) error
+	// Stats, if set, is filled with a summary of what was executed
+	Stats *Stats
+	// DirMode is the mode of directories created by instructions. Zero means
+	// 0777 less the umask for parents, and the source's mode for copied
+	// directories
+	DirMode fs.FileMode
+	// DirOwner, if set, is the owner of directories created by instructions,
+	// rather than whoever is running them
+	DirOwner *Owner
+	// InheritDirs gives directories created by instructions the mode and
+	// owner of their closest existing ancestor, where DirMode and DirOwner
+	// aren't set. Only local ancestors have a known owner
+	InheritDirs bool
+	// RefPerms, if set, gives the files and directories copies make, and
+	// directories made for any instruction, the owner and mode of a reference
+	// file or directory, like chmod and chown --reference. Directories made
+	// from a file's mode are searchable wherever it's readable, and files
+	// from a directory's aren't executable. DirMode and DirOwner still apply
+	// to directories where they're set
+	RefPerms fs.FileInfo
+	// Jobs is the number of copies to run at once, for plans with many small
+	// files. Zero or one runs everything in order
+	Jobs int
+	// OnConflict, if set, is called before a rename or copy whose destination
+	// already exists, returning one of the conflict resolutions. Unset, the
+	// destination is replaced as by the filesystem's rename or copy
+	OnConflict func(inst Instruction, dst string) string
+	// NoMkdir fails instructions whose destination directory doesn't exist,
+	// rather than creating it
+	NoMkdir bool
+	// Snapshot, if set, fails an instruction whose source was moved or
+	// changed since the snapshot was taken, with ErrStale. Paths changed by
+	// earlier instructions in the plan aren't checked
+	Snapshot Snapshot
+	// SkipDone, if set, skips instructions which look like they've already
+	// run, like a rename whose source is gone and destination exists, so an
+	// interrupted plan can be executed again. It's called with each of them
+	SkipDone func(Instruction)
+	// PruneEmpty, if set, removes the source directories of renames left
+	// empty once the whole plan has run, and their parents left empty in turn,
+	// calling it with each. The working directory and its parents are kept
+	PruneEmpty func(dir string)
+	// OnDenied, if set, is called when an instruction fails with a permission
+	// error, so it can be retried some other way, like with more privileges.
+	// Its error replaces the original, and nil counts the instruction as run
+	OnDenied func(inst Instruction, err error) error
+	// Fsync flushes copied files and the directories of copies and renames to
+	// disk after each, so a power loss can't leave them half written or
+	// unlinked. Only local paths are synced
+	Fsync bool
+	// Timeout, if set, is how long each try of an instruction may run before
+	// it's cancelled, failing with context.DeadlineExceeded once there are no
+	// Retries left. One stuck in a system call which can't be cancelled, like
+	// on a dead network mount, is given up on and left running in the
+	// background. It isn't retried, and execution stops with ErrAbandoned,
+	// since it may still change its paths. Nothing else should touch them
+	// until the process exits
+	Timeout time.Duration
+	// Retries is how many more times an instruction which timed out is tried,
+	// and OnRetry, if set, is called before each of them
+	Retries int
+	OnRetry func(inst Instruction, attempt int, err error)
+	// SlowAfter and OnSlow, if both set, call OnSlow once for each instruction
+	// still running after SlowAfter, from another goroutine, to warn about
+	// something like a hung network mount while it's happening
+	SlowAfter time.Duration
+	OnSlow    func(inst Instruction, elapsed time.Duration)
+	// Progress, if set, is called as each instruction starts, as local copies
+	// write, and as each finishes, fails, or is skipped, for showing live
+	// progress. Calls are never concurrent, even with Jobs above 1, so it
+	// should return quickly
+	Progress func(ProgressEvent)
+	// CopyEngine is how copies are made, one of CopyEngines, defaulting to
+	// CopyBuiltin. CopyRsync only applies to local paths and filesystems
+	// which are a Commander, others copy as usual
+	CopyEngine string
+	// BandwidthLimit, if above 0, limits local copies to this many bytes a
+	// second, shared between them with Jobs above 1. rsync copies are each
+	// given the limit
+	BandwidthLimit int64
+	// CopyExclude are rsync patterns like ".git" or "node_modules/" to skip
+	// inside directories copied with CopyRsync. The builtin engine doesn't
+	// copy inside directories, so has nothing to skip
+	CopyExclude []string
+	// OnSpecial, if set, is called with each special file a copy can't make
+	// again, like a socket, or a device node without root, with an error
+	// wrapping ErrSpecialFile saying why. The file is skipped rather than
+	// failing the copy. With Jobs above 1 it can be called concurrently
+	OnSpecial func(inst Instruction, path string, err error)
+	// OnTrash, if set, is called with where each Remove with Trash moved its
+	// path, for restoring it later
+	OnTrash func(inst Instruction, entry TrashEntry)
+}
+
+// Execute is ExecuteContext with a context which is never cancelled
+func Execute(plan Plan, opts Options) error {
+	return ExecuteContext(context.Background(), plan, opts)
+}
+
+// ExecuteContext runs the plan's instructions in order, stopping at the first
+// error. With Jobs above 1, runs of independent copies are executed
+// concurrently. Pre is called for each of them before any run, and Post after
+// all have. Instructions skipped by OnConflict or SkipDone don't get a Post.
+//
+// Once ctx is done no more instructions are started, and local copies and
+// commands which are running are stopped, removing partial copies. Other
+// instructions finish first. The error then wraps ctx.Err()
+func ExecuteContext(ctx context.Context, plan Plan, opts Options) error {
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = OS
+	}
+	execFS := fsys
+	dirMode, dirOwner := opts.DirMode, opts.DirOwner
+	if opts.RefPerms != nil {
+		if dirMode == 0 {
+			dirMode = refDirMode(opts.RefPerms)
+		}
+		if owner, ok := FileOwner(opts.RefPerms); ok && dirOwner == nil {
+			dirOwner = &owner
+		}
+	}
+	if dirMode != 0 || dirOwner != nil || opts.InheritDirs {
+		execFS = dirFS{fsys, dirMode, dirOwner, opts.InheritDirs}
+	}
+	start := time.Now()
+	if opts.Stats != nil {
+		defer func() { opts.Stats.finish(time.Since(start)) }()
+	}
+	// paths changed by the plan so far, which won't match the snapshot
+	changed := map[string]bool{}
+	var progress *progressReporter
+	if opts.Progress != nil {
+		progress = &progressReporter{fn: opts.Progress, count: len(plan)}
+	}
+	if opts.BandwidthLimit > 0 {
+		ctx = withRateLimit(ctx, &rateLimiter{rate: opts.BandwidthLimit})
+	}
+	original := plan
+	var offset int
+	for len(plan) > 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("executing: %w", err)
+		}
+		batch := plan[:batchLen(plan, opts.Jobs)]
+		plan = plan[len(batch):]
+		index := offset
+		offset += len(batch)
+
+		// copy since conflicts can change or skip instructions
+		batch = append(Plan(nil), batch...)
+		sizes := make([]int64, len(batch))
+		for i, inst := range batch {
+			if opts.SkipDone != nil && alreadyDone(fsys, inst) {
+				opts.SkipDone(inst)
+				batch[i] = nil
+				progress.report(ProgressEvent{Kind: ProgressSkipped, Instruction: inst, Index: index + i})
+				continue
+			}
+			if opts.Snapshot != nil {
+				for _, src := range sources(inst) {
+					if touched(changed, src) {
+						continue
+					}
+					if err := opts.Snapshot.check(fsys, src); err != nil {
+						return fmt.Errorf("checking source: %w", err)
+					}
+				}
+			}
+			if opts.Pre != nil {
+				if err := opts.Pre(inst); err != nil {
+					return fmt.Errorf("pre: %w", err)
+				}
+			}
+			if dst, ok := conflictDst(fsys, inst); ok && opts.OnConflict != nil && !opts.DryRun {
+				resolved, err := resolveConflict(execFS, inst, dst, opts.OnConflict(inst, dst))
+				if err != nil {
+					return fmt.Errorf("conflict: %w", err)
+				}
+				if batch[i] = resolved; resolved == nil {
+					progress.report(ProgressEvent{Kind: ProgressSkipped, Instruction: inst, Index: index + i})
+					continue
+				}
+			}
+			if opts.Stats != nil || progress != nil {
+				src, _ := inst.Paths()
+				sizes[i] = Size(fsys, src)
+			}
+		}
+
+		errs := make([]error, len(batch))
+		durs := make([]time.Duration, len(batch))
+		exec := func(i int) {
+			if batch[i] == nil {
+				return
+			}
+			inst, instCtx := batch[i], ctx
+			if progress != nil {
+				event := ProgressEvent{Instruction: inst, Index: index + i, Total: sizes[i]}
+				instCtx = withProgress(ctx, func(n int64) {
+					event.Kind, event.Bytes = ProgressBytes, n
+					progress.report(event)
+				})
+				progress.report(ProgressEvent{Kind: ProgressStart, Instruction: inst, Index: index + i, Total: sizes[i]})
+				defer func() {
+					if errs[i] != nil {
+						progress.report(ProgressEvent{Kind: ProgressError, Instruction: inst, Index: index + i, Err: errs[i]})
+					} else {
+						progress.report(ProgressEvent{Kind: ProgressDone, Instruction: inst, Index: index + i, Bytes: sizes[i], Total: sizes[i]})
+					}
+				}()
+			}
+			if opts.OnSpecial != nil {
+				instCtx = withSkipSpecial(instCtx, func(path string, err error) { opts.OnSpecial(inst, path, err) })
+			}
+			if opts.OnTrash != nil {
+				instCtx = withTrashed(instCtx, func(entry TrashEntry) { opts.OnTrash(inst, entry) })
+			}
+			if opts.SlowAfter > 0 && opts.OnSlow != nil && !opts.DryRun {
+				slow := time.AfterFunc(opts.SlowAfter, func() { opts.OnSlow(inst, opts.SlowAfter) })
+				defer slow.Stop()
+			}
+			instStart := time.Now()
+			errs[i] = execute(instCtx, inst, fsys, execFS, opts)
+			durs[i] = time.Since(instStart)
+		}
+		if len(batch) == 1 {
+			exec(0)
+		} else {
+			var wg sync.WaitGroup
+			next := make(chan int)
+			for range min(opts.Jobs, len(batch)) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range next {
+						exec(i)
+					}
+				}()
+			}
+			for i := range batch {
+				next <- i
+			}
+			close(next)
+			wg.Wait()
+		}
+
+		for i, inst := range batch {
+			if errs[i] != nil {
+				return errs[i]
+			}
+			if inst == nil {
+				// skipped after a conflict, or already done
+				continue
+			}
+			if opts.Snapshot != nil {
+				for _, src := range sources(inst) {
+					changed[filepath.Clean(src)] = true
+				}
+				if _, dst := inst.Paths(); dst != "" {
+					changed[filepath.Clean(dst)] = true
+				}
+			}
+			if opts.Stats != nil {
+				opts.Stats.record(inst, sizes[i], durs[i])
+			}
+			if opts.Post != nil {
+				if err := opts.Post(inst); err != nil {
+					return fmt.Errorf("post: %w", err)
+				}
+			}
+		}
+	}
+	if opts.PruneEmpty != nil && !opts.DryRun {
+		if err := pruneEmpty(fsys, original, opts.PruneEmpty); err != nil {
+			return fmt.Errorf("pruning empty directories: %w", err)
+		}
+	}
+	return nil
+}
+
+func execute(ctx context.Context, inst Instruction, fsys, execFS FS, opts Options) error {
+	if opts.DryRun {
+		return nil
+	}
+	// a mkdir is asked for, so only makes its parents like a rename would
+	// without NoMkdir
+	if _, dst := inst.Paths(); opts.NoMkdir && dst != "" && !isMkdir(inst) {
+		if _, err := fsys.Stat(filepath.Dir(dst)); err != nil {
+			return fmt.Errorf("executing: destination directory: %w", err)
+		}
+	}
+	err := executeTimeout(ctx, inst, execFS, opts)
+	// one which stopped when cancelled, removing any partial copy, can be
+	// tried again
+	for attempt := 1; attempt <= opts.Retries && errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrAbandoned) && ctx.Err() == nil; attempt++ {
+		if opts.OnRetry != nil {
+			opts.OnRetry(inst, attempt, err)
+		}
+		err = executeTimeout(ctx, inst, execFS, opts)
+	}
+	if err != nil && opts.OnDenied != nil && errors.Is(err, fs.ErrPermission) {
+		err = opts.OnDenied(inst, err)
+	}
+	if err != nil {
+		return fmt.Errorf("executing: %w", err)
+	}
+	if opts.RefPerms != nil {
+		if err := refPerms(fsys, inst, opts.RefPerms); err != nil {
+			return fmt.Errorf("executing: reference permissions: %w", err)
+		}
+	}
+	if opts.Fsync && isLocal(fsys) {
+		if err := syncInstruction(inst); err != nil {
+			return fmt.Errorf("executing: %w", err)
+		}
+	}
+	return nil
+}
+
+// timeoutGrace is how long an instruction which timed out gets to stop, and
+// clean up after itself, before it's given up on
+const timeoutGrace = time.Second
+
+// executeTimeout is executeWith, cancelled once the timeout passes, and
+// given up on a grace period later even when it's stuck in a system call
+// which can't be interrupted, like a read from a dead network mount, so one
+// hung instruction can't wedge the whole run. it's left running in the
+// background, failing with ErrAbandoned
+func executeTimeout(ctx context.Context, inst Instruction, execFS FS, opts Options) error {
+	if opts.Timeout <= 0 {
+		return executeWith(ctx, inst, execFS, opts)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- executeWith(ctx, inst, execFS, opts) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// cancelling the run waits for running instructions as usual
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = <-done
+			break
+		}
+		select {
+		case err = <-done:
+		case <-time.After(timeoutGrace):
+			return fmt.Errorf("timed out after %v, %w: %w", opts.Timeout, ErrAbandoned, ctx.Err())
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v: %w", opts.Timeout, err)
+	}
+	return err
+}
+
+// executeWith executes the instruction, with the copy engine for copies
+func executeWith(ctx context.Context, inst Instruction, execFS FS, opts Options) error {
+	if c, ok := inst.(Copy); ok && opts.CopyEngine == CopyRsync {
+		if ok, err := rsyncCopy(ctx, execFS, c, opts); ok {
+			return err
+		}
+	}
+	return inst.Execute(ctxFS{execFS, ctx})
+}
+
+// batchLen is the number of instructions at the start of the plan which can
+// run concurrently. that's a run of copies which don't read or write each
+// other's destinations
+func batchLen(plan Plan, jobs int) int {
+	if jobs <= 1 {
+		return 1
+	}
+	froms, tos := map[string]bool{}, map[string]bool{}
+	for n, inst := range plan {
+		c, ok := inst.(Copy)
+		if !ok || tos[c.From] || tos[c.To] || froms[c.To] {
+			return max(n, 1)
+		}
+		froms[c.From], tos[c.To] = true, true
+	}
+	return len(plan)
+}
+
+// Command is a command which can be typed on a line in the buffer, like `copy <dest>`.
+// Several commands can share a line separated by "; ", like `copy a; copy b`
+type Command struct {
+	Name  string
+	Usage string
+	// RawArg passes the argument through without unquoting, for commands whose
+	// argument isn't a path
+	RawArg bool
+	// Auto, if set, picks the argument when the command is given without one,
+	// avoiding names which are taken
+	Auto func(before string, taken func(string) bool, opts ParseOptions) string
+	// Validate, if set, checks the argument before the instruction is made
+	Validate    func(before, arg string) error
+	Instruction func(before, arg string, opts ParseOptions) Instruction
+}
+
+// Commands is the table of commands understood in the buffer. It is also used
+// to generate editor syntax files
+var Commands = []Command{
+	{Name: "copy", Usage: "copy <dest>", Instruction: copyInstruction},
+	{Name: "mkdir", Usage: "mkdir <dir>", Instruction: func(_, arg string, _ ParseOptions) Instruction { return Mkdir{Name: arg} }},
+	{Name: "dup", Usage: "dup", Auto: dupName, Instruction: copyInstruction},
+	{Name: "archive", Usage: "archive <archive file>", Instruction: func(before, arg string, _ ParseOptions) Instruction { return Archive{Names: []string{before}, To: arg} }},
+	{Name: "extract", Usage: "extract [dest dir]", Auto: func(before string, _ func(string) bool, _ ParseOptions) string { return filepath.Dir(before) }, Instruction: func(before, arg string, opts ParseOptions) Instruction {
+		return Extract{Name: before, Dir: arg, Remove: opts.RemoveExtracted}
+	}},
+	{Name: "gzip", Usage: "gzip [dest]", Auto: func(before string, _ func(string) bool, _ ParseOptions) string { return before + ".gz" }, Instruction: func(before, arg string, opts ParseOptions) Instruction {
+		return Compress{Name: before, To: arg, Format: "gzip", Keep: opts.KeepCompressed}
+	}},
+	{Name: "zstd", Usage: "zstd [dest]", Auto: func(before string, _ func(string) bool, _ ParseOptions) string { return before + ".zst" }, Instruction: func(before, arg string, opts ParseOptions) Instruction {
+		return Compress{Name: before, To: arg, Format: "zstd", Keep: opts.KeepCompressed}
+	}},
+	{Name: "encrypt", Usage: "encrypt <recipient>", RawArg: true, Instruction: func(before, arg string, _ ParseOptions) Instruction { return Encrypt{Name: before, Recipient: arg} }},
+	{Name: "dedup", Usage: "dedup [original]", Auto: func(before string, _ func(string) bool, opts ParseOptions) string { return opts.Duplicates[before] }, Instruction: func(before, arg string, _ ParseOptions) Instruction {
+		return Dedup{Name: before, Original: arg}
+	}},
+	{Name: "rm", Usage: "rm", Auto: func(before string, _ func(string) bool, _ ParseOptions) string { return before }, Validate: func(before, arg string) error {
+		if arg != before {
+			return fmt.Errorf("rm only removes its own line's path, not %q", arg)
+		}
+		return nil
+	}, Instruction: func(before, _ string, opts ParseOptions) Instruction { return Remove{Name: before, Trash: opts.Trash} }},
+	{Name: "tag", Usage: "tag <tag>[, <tag>...]", RawArg: true, Instruction: func(before, arg string, _ ParseOptions) Instruction { return Tag{Name: before, Tags: splitTags(arg)} }},
+	{Name: "untag", Usage: "untag", Auto: func(before string, _ func(string) bool, _ ParseOptions) string { return before }, Validate: func(before, arg string) error {
+		if arg != before {
+			return fmt.Errorf("untag only clears its own line's path, not %q", arg)
+		}
+		return nil
+	}, Instruction: func(before, _ string, _ ParseOptions) Instruction { return Tag{Name: before} }},
+	{Name: "chmod", Usage: "chmod <octal mode>", Validate: func(_, arg string) error {
+		_, err := ParseMode(arg)
+		return err
+	}, Instruction: func(before, arg string, _ ParseOptions) Instruction {
+		mode, _ := ParseMode(arg)
+		return Chmod{Name: before, Mode: mode}
+	}},
+	{Name: "touch", Usage: "touch [time]", Auto: func(string, func(string) bool, ParseOptions) string { return "now" }, Validate: func(_, arg string) error {
+		_, err := ParseTime(arg)
+		return err
+	}, Instruction: func(before, arg string, _ ParseOptions) Instruction {
+		t, _ := ParseTime(arg)
+		return Touch{Name: before, Time: t}
+	}},
+	{Name: "!", Usage: "! <shell command with {}>", RawArg: true, Instruction: func(before, arg string, _ ParseOptions) Instruction { return Shell{Name: before, Command: arg} }},
+}
+
+func parseCommand(line string) (Command, string, bool) {
+	line = expandAlias(line)
+	for _, cmd := range Commands {
+		// commands with an automatic argument can be followed directly by
+		// another command, like `dup; dup`
+		if cmd.Auto != nil && (line == cmd.Name || strings.HasPrefix(line, cmd.Name+"; ")) {
+			return cmd, strings.TrimSpace(strings.TrimPrefix(line, cmd.Name)), true
+		}
+		if strings.HasPrefix(line, cmd.Name+" ") {
+			return cmd, strings.TrimSpace(strings.TrimPrefix(line, cmd.Name)), true
+		}
+	}
+	return Command{}, "", false
+}
+
+func isMkdir(inst Instruction) bool {
+	_, ok := inst.(Mkdir)
+	return ok
+}
+
+// mkdirLine reports whether a line is only mkdir commands, like
+// `mkdir a; mkdir b`. such a line is added to the buffer rather than standing
+// for a path, so doesn't take up one of the paths' lines
+func mkdirLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if _, _, ok := parseCommand(line); !ok || len(splitChain(line)) > 1 {
+		return false
+	}
+	for _, part := range splitCommands(line) {
+		if cmd, _, _ := parseCommand(part); cmd.Name != "mkdir" {
+			return false
+		}
+	}
+	return true
+}
+
+// copyInstruction is the instruction for copy and dup. like rsync, a source
+// with a trailing slash copies what's in the directory rather than itself
+func copyInstruction(before, arg string, _ ParseOptions) Instruction {
+	from := strings.TrimRight(before, "/"+string(filepath.Separator))
+	if from == "" || from == filepath.VolumeName(before) {
+		return Copy{From: before, To: arg}
+	}
+	return Copy{From: from, To: arg, Contents: from != before}
+}
+
+// dupName is a name for a copy of name next to it, like "a copy.txt", then
+// "a copy 2.txt" and so on if that's taken
+func dupName(name string, taken func(string) bool, _ ParseOptions) string {
+	dir, base := filepath.Split(name)
+	ext := filepath.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	dup := dir + stem + " copy" + ext
+	for n := 2; taken(dup); n++ {
+		dup = fmt.Sprintf("%s%s copy %d%s", dir, stem, n, ext)
+	}
+	return dup
+}
+
+// splitCommands splits a line of commands separated by "; ". the search for a
+// separator starts after a quoted argument, and a raw argument takes the rest
+// of the line
+func splitCommands(line string) []string {
+	var lines []string
+	for {
+		cmd, arg, ok := parseCommand(line)
+		if !ok || cmd.RawArg {
+			return append(lines, line)
+		}
+		from := len(line) - len(arg)
+		if strings.HasPrefix(arg, `"`) {
+			from += quotedLen(arg)
+		}
+		sep := -1
+		for i := from; i < len(line); i++ {
+			if strings.HasPrefix(line[i:], "; ") {
+				if _, _, ok := parseCommand(strings.TrimLeft(line[i+2:], " ")); ok {
+					sep = i
+					break
+				}
+			}
+		}
+		if sep < 0 {
+			return append(lines, line)
+		}
+		lines = append(lines, strings.TrimSpace(line[:sep]))
+		line = strings.TrimSpace(line[sep+2:])
+	}
+}
+
+// splitChain splits a line into parts chained with " | ", like
+// `new.jpg | chmod 644`, each part a destination or commands. like
+// splitCommands, a separator only counts when a command follows it, the
+// search starts after a quoted name, and a raw argument takes the rest of
+// the line
+func splitChain(line string) []string {
+	var parts []string
+	for {
+		from, to := 0, len(line)
+		if strings.HasPrefix(line, `"`) {
+			from = quotedLen(line)
+		}
+		if _, _, ok := parseCommand(line); ok {
+			cmds := splitCommands(line)
+			if cmd, _, _ := parseCommand(cmds[len(cmds)-1]); cmd.RawArg {
+				to = len(line) - len(cmds[len(cmds)-1])
+			}
+		}
+		sep := -1
+		for i := from; i < to; i++ {
+			if strings.HasPrefix(line[i:], " | ") {
+				if _, _, ok := parseCommand(strings.TrimLeft(line[i+3:], " ")); ok {
+					sep = i
+					break
+				}
+			}
+		}
+		if sep < 0 {
+			return append(parts, line)
+		}
+		parts = append(parts, strings.TrimSpace(line[:sep]))
+		line = strings.TrimSpace(line[sep+3:])
+	}
+}
+
+// quotedLen is the length of the quoted string at the start of s, including
+// its quotes
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,256 @@
+package vipaths
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []string
+		opts          ParseOptions
+		want          Plan
+	}{
+		{
+			name:   "unchanged",
+			before: []string{"a", "b"},
+			after:  []string{"a", " b "},
+		},
+		{
+			name:   "rename",
+			before: []string{"a", "b"},
+			after:  []string{"a", "c"},
+			want:   Plan{Rename{Before: "b", After: "c"}},
+		},
+		{
+			name:   "cleared line removes",
+			before: []string{"a"},
+			after:  []string{""},
+			want:   Plan{Remove{Name: "a"}},
+		},
+		{
+			name:   "cleared line kept",
+			before: []string{"a"},
+			after:  []string{""},
+			opts:   ParseOptions{Empty: EmptyKeep},
+		},
+		{
+			name:   "rm command",
+			before: []string{"a"},
+			after:  []string{"rm"},
+			want:   Plan{Remove{Name: "a"}},
+		},
+		{
+			name:   "quoted destination",
+			before: []string{"a"},
+			after:  []string{`"b\nc "`},
+			want:   Plan{Rename{Before: "a", After: "b\nc "}},
+		},
+		{
+			name:   "quoted source unchanged",
+			before: []string{"rm"},
+			after:  []string{`"rm"`},
+		},
+		{
+			name:   "copy command",
+			before: []string{"a"},
+			after:  []string{"copy b"},
+			want:   Plan{Copy{From: "a", To: "b"}},
+		},
+		{
+			name:   "copy contents",
+			before: []string{"dir/"},
+			after:  []string{"copy other"},
+			want:   Plan{Copy{From: "dir", To: "other", Contents: true}},
+		},
+		{
+			name:   "default copy",
+			before: []string{"a"},
+			after:  []string{"b"},
+			opts:   ParseOptions{DefaultOp: DefaultCopy},
+			want:   Plan{Copy{From: "a", To: "b"}},
+		},
+		{
+			name:   "chain runs on the renamed path",
+			before: []string{"a"},
+			after:  []string{"b | copy c"},
+			want:   Plan{Rename{Before: "a", After: "b"}, Copy{From: "b", To: "c"}},
+		},
+		{
+			name:   "deepest first",
+			before: []string{"a", "a/b", "a/b/c"},
+			after:  []string{"x", "a/y", "a/b/z"},
+			want: Plan{
+				Rename{Before: "a/b/c", After: "a/b/z"},
+				Rename{Before: "a/b", After: "a/y"},
+				Rename{Before: "a", After: "x"},
+			},
+		},
+		{
+			name:   "buffer order",
+			before: []string{"a", "a/b"},
+			after:  []string{"x", "a/y"},
+			opts:   ParseOptions{Order: OrderBuffer},
+			want: Plan{
+				Rename{Before: "a", After: "x"},
+				Rename{Before: "a/b", After: "a/y"},
+			},
+		},
+		{
+			name:   "mkdirs first",
+			before: []string{"a", ""},
+			after:  []string{"new/a", "mkdir new"},
+			want:   Plan{Mkdir{Name: "new"}, Rename{Before: "a", After: "new/a"}},
+		},
+		{
+			name:   "leave symlink",
+			before: []string{"a"},
+			after:  []string{"b"},
+			opts:   ParseOptions{LeaveSymlink: true},
+			want:   Plan{Rename{Before: "a", After: "b", Link: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.before, tt.after, tt.opts)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []string
+		opts          ParseOptions
+		target        error
+	}{
+		{"line count", []string{"a", "b"}, []string{"a"}, ParseOptions{}, ErrLineCountMismatch},
+		{"swap", []string{"a", "b"}, []string{"b", "a"}, ParseOptions{}, ErrCycle},
+		{"same destination", []string{"a", "b"}, []string{"c", "./c"}, ParseOptions{}, ErrDuplicateDestination},
+		{"copy onto a rename", []string{"a", "b"}, []string{"c", "copy c"}, ParseOptions{}, ErrDuplicateDestination},
+		{"cleared line", []string{"a"}, []string{""}, ParseOptions{Empty: EmptyError}, ErrEmptyLine},
+		{"protected", []string{"a"}, []string{"rm"}, ParseOptions{Protected: func(p string) bool { return p == "a" }}, ErrProtectedPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Parse(tt.before, tt.after, tt.opts)
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("Parse = %v, %v, want %v", plan, err, tt.target)
+			}
+		})
+	}
+}
+
+func TestParseSharedDestination(t *testing.T) {
+	// merges and copies of contents add to a directory, so can share one
+	tests := []struct {
+		name  string
+		after []string
+		opts  ParseOptions
+	}{
+		{"merge", []string{"c", "c"}, ParseOptions{Merge: MergeSkip}},
+		{"copy contents", []string{"copy c", "copy c"}, ParseOptions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]string{"a/", "b/"}, tt.after, tt.opts); err != nil {
+				t.Errorf("Parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseDoesntModifyInputs(t *testing.T) {
+	before := []string{"a", "a/b"}
+	after := []string{"x", "a/y"}
+	if _, err := Parse(before, after, ParseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, []string{"a", "a/b"}) || !reflect.DeepEqual(after, []string{"x", "a/y"}) {
+		t.Errorf("inputs modified to %q and %q", before, after)
+	}
+}
+
+// hangFS is a MemFS whose first hangs copies run until they're cancelled,
+// and whose renames are stuck until release is closed, like on a dead mount
+type hangFS struct {
+	*MemFS
+	hangs, copies int
+	release       chan struct{}
+}
+
+func (h *hangFS) CopyContext(ctx context.Context, from, to string) error {
+	if h.copies++; h.copies <= h.hangs {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return h.MemFS.Copy(from, to)
+}
+
+func (h *hangFS) Rename(oldname, newname string) error {
+	<-h.release
+	return h.MemFS.Rename(oldname, newname)
+}
+
+func TestExecuteRetries(t *testing.T) {
+	fsys := &hangFS{MemFS: NewMemFS(), hangs: 2}
+	if err := fsys.WriteFile("a", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var retries []int
+	opts := Options{
+		FS:      fsys,
+		Timeout: 10 * time.Millisecond,
+		Retries: 2,
+		OnRetry: func(_ Instruction, attempt int, _ error) { retries = append(retries, attempt) },
+	}
+	if err := Execute(Plan{Copy{From: "a", To: "b"}}, opts); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !reflect.DeepEqual(retries, []int{1, 2}) {
+		t.Errorf("retries = %v, want [1 2]", retries)
+	}
+
+	fsys.copies, opts.Retries = 0, 1
+	err := Execute(Plan{Copy{From: "a", To: "c"}}, opts)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrAbandoned) {
+		t.Errorf("Execute = %v, want a timeout", err)
+	}
+}
+
+func TestExecuteAbandoned(t *testing.T) {
+	fsys := &hangFS{MemFS: NewMemFS(), release: make(chan struct{})}
+	defer close(fsys.release)
+	for _, name := range []string{"a", "b"} {
+		if err := fsys.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var retried bool
+	opts := Options{
+		FS:      fsys,
+		Timeout: 10 * time.Millisecond,
+		Retries: 3,
+		OnRetry: func(Instruction, int, error) { retried = true },
+	}
+	err := Execute(Plan{Rename{Before: "a", After: "x"}, Remove{Name: "b"}}, opts)
+	if !errors.Is(err, ErrAbandoned) {
+		t.Fatalf("Execute = %v, want ErrAbandoned", err)
+	}
+	if retried {
+		t.Error("an abandoned instruction was retried")
+	}
+	if _, err := fsys.Stat("b"); err != nil {
+		t.Error("execution went on past an abandoned instruction")
+	}
+}
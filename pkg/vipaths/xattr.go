@@ -0,0 +1,155 @@
+package vipaths
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SELinuxAttr is the extended attribute holding a file's SELinux security
+// context
+const SELinuxAttr = "security.selinux"
+
+// POSIX ACLs are stored in extended attributes on linux, the default ACL only
+// on directories
+const (
+	aclAccessAttr  = "system.posix_acl_access"
+	aclDefaultAttr = "system.posix_acl_default"
+)
+
+// macOS keeps Spotlight metadata like Finder tags and where a file was
+// downloaded from in attributes under finderMetadataPrefix, and flags files
+// from the internet for Gatekeeper with quarantineAttr
+const (
+	finderMetadataPrefix = "com.apple.metadata:"
+	quarantineAttr       = "com.apple.quarantine"
+)
+
+// DropQuarantine stops copies keeping the macOS quarantine flag, so copies of
+// downloaded files open without Gatekeeper asking first. Clones keep every
+// attribute, so it's removed from them afterwards
+var DropQuarantine bool
+
+// preservedXattr reports whether the extended attribute attr is copied along
+// with a file's contents, and whether failing to copy it is an error rather
+// than being skipped, as when the destination's filesystem doesn't support
+// it. renames keep attributes without any help, since the inode moves with
+// the file
+func preservedXattr(attr string) (preserve, required bool) {
+	switch {
+	case attr == aclAccessAttr, attr == aclDefaultAttr:
+		return true, true
+	case attr == SELinuxAttr, strings.HasPrefix(attr, finderMetadataPrefix):
+		return true, false
+	case attr == quarantineAttr:
+		return !DropQuarantine, false
+	}
+	return false, false
+}
+
+// Relabel sets the SELinux security context of a file or directory, like
+// chcon. Only local paths can be relabeled
+type Relabel struct{ Name, Context string }
+
+func (l Relabel) Paths() (string, string) { return l.Name, "" }
+func (l Relabel) MapPaths(fn func(string) string) Instruction {
+	return Relabel{Name: fn(l.Name), Context: l.Context}
+}
+func (l Relabel) String() string {
+	return fmt.Sprintf("relabel %s\n     => %s", Quote(l.Name), l.Context)
+}
+func (l Relabel) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return errors.New("exe relabel: only local paths can be relabeled")
+	}
+	if err := setXattr(l.Name, SELinuxAttr, []byte(l.Context)); err != nil {
+		return fmt.Errorf("exe relabel: %w", err)
+	}
+	return nil
+}
+
+// Context returns the SELinux security context of the local path at name, or
+// an empty string if it has none, as when SELinux isn't in use
+func Context(name string) (string, error) {
+	value, err := Xattr(name, SELinuxAttr)
+	return strings.TrimRight(value, "\x00"), err
+}
+
+// SetXattr sets an extended attribute of a file or directory, or removes it
+// if Value is empty. Only local paths can have their attributes set
+type SetXattr struct{ Name, Attr, Value string }
+
+func (x SetXattr) Paths() (string, string) { return x.Name, "" }
+func (x SetXattr) MapPaths(fn func(string) string) Instruction {
+	return SetXattr{Name: fn(x.Name), Attr: x.Attr, Value: x.Value}
+}
+func (x SetXattr) String() string {
+	if x.Value == "" {
+		return fmt.Sprintf("rmxattr %s\n     => %s", Quote(x.Name), x.Attr)
+	}
+	return fmt.Sprintf("setxattr %s\n      => %s=%s", Quote(x.Name), x.Attr, Quote(x.Value))
+}
+func (x SetXattr) Execute(fsys FS) error {
+	if !isLocal(fsys) {
+		return errors.New("exe setxattr: only local paths have attributes")
+	}
+	if x.Value == "" {
+		if err := removeXattr(x.Name, x.Attr); err != nil && !errors.Is(err, errNoXattr) {
+			return fmt.Errorf("exe rmxattr: %w", err)
+		}
+		return nil
+	}
+	if err := setXattr(x.Name, x.Attr, []byte(x.Value)); err != nil {
+		return fmt.Errorf("exe setxattr: %w", err)
+	}
+	return nil
+}
+
+// Xattr returns the value of the extended attribute attr of the local path at
+// name, or an empty string if it isn't set or the filesystem doesn't support
+// attributes
+func Xattr(name, attr string) (string, error) {
+	value, err := getXattr(name, attr)
+	if noXattr(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// copyXattrs copies the preserved extended attributes of from to to, skipping
+// any which from doesn't have, or which aren't required and the filesystem of
+// to doesn't support
+func copyXattrs(from, to string) error {
+	if DropQuarantine {
+		if err := removeXattr(to, quarantineAttr); err != nil && !noXattr(err) {
+			return fmt.Errorf("removing %s: %w", quarantineAttr, err)
+		}
+	}
+	attrs, err := listXattrs(from)
+	if noXattr(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("listing: %w", err)
+	}
+	for _, attr := range attrs {
+		preserve, required := preservedXattr(attr)
+		if !preserve {
+			continue
+		}
+		value, err := getXattr(from, attr)
+		if noXattr(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", attr, err)
+		}
+		if err := setXattr(to, attr, value); err != nil && (required || !noXattr(err)) {
+			return fmt.Errorf("setting %s: %w", attr, err)
+		}
+	}
+	return nil
+}
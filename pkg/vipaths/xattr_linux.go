@@ -0,0 +1,7 @@
+package vipaths
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned when getting or removing an extended attribute which
+// isn't set
+const errNoXattr = unix.ENODATA
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package vipaths
+
+import "errors"
+
+// extended attributes can't be read without following symlinks here, so
+// there are never any to get, set, or copy
+func listXattrs(string) ([]string, error)     { return nil, errors.ErrUnsupported }
+func getXattr(string, string) ([]byte, error) { return nil, errors.ErrUnsupported }
+func setXattr(string, string, []byte) error   { return errors.ErrUnsupported }
+func removeXattr(string, string) error        { return errors.ErrUnsupported }
+func noXattr(err error) bool                  { return errors.Is(err, errors.ErrUnsupported) }
@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package vipaths
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned when getting or removing an extended attribute which
+// isn't set
+const errNoXattr = unix.ENOATTR
@@ -0,0 +1,69 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package vipaths
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// getXattr returns the value of the extended attribute attr of name, without
+// following symlinks
+func getXattr(name, attr string) ([]byte, error) {
+	for {
+		size, err := unix.Lgetxattr(name, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		n, err := unix.Lgetxattr(name, attr, value)
+		if errors.Is(err, unix.ERANGE) {
+			// grew since asking its size
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+}
+
+// listXattrs returns the names of the extended attributes of name, without
+// following symlinks
+func listXattrs(name string) ([]string, error) {
+	for {
+		size, err := unix.Llistxattr(name, nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := unix.Llistxattr(name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00"), nil
+	}
+}
+
+// setXattr sets the extended attribute attr of name, without following
+// symlinks
+func setXattr(name, attr string, value []byte) error {
+	return unix.Lsetxattr(name, attr, value, 0)
+}
+
+// removeXattr removes the extended attribute attr of name, without following
+// symlinks
+func removeXattr(name, attr string) error {
+	return unix.Lremovexattr(name, attr)
+}
+
+// noXattr reports whether err means the attribute isn't set, or the
+// filesystem doesn't support extended attributes at all
+func noXattr(err error) bool {
+	return errors.Is(err, errNoXattr) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
@@ -0,0 +1,184 @@
+// Package vipathstest builds trees of files from a declarative map, runs
+// edited buffers of them through vipaths, and checks the layout left behind,
+// for testing rename logic without hand-rolled fixtures. Trees can be on the
+// local disk, under a test's temp directory, or in a vipaths.MemFS
+package vipathstest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// Tree is a layout of files, keyed by slash separated paths relative to its
+// root, to their contents. Keys ending in a slash are directories, whose
+// values are ignored. Parents are implied, so only empty directories need
+// keys of their own, and Read only gives them keys
+type Tree map[string]string
+
+// Build writes tree to a new temp directory, removed when the test ends, and
+// returns the directory
+func Build(t testing.TB, tree Tree) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := write(root, tree, func(name string) error { return os.MkdirAll(name, 0755) }, func(name string, data []byte) error {
+		return os.WriteFile(name, data, 0644)
+	}); err != nil {
+		t.Fatalf("building tree: %v", err)
+	}
+	return root
+}
+
+// BuildMem writes tree to a new MemFS, under its current directory
+func BuildMem(t testing.TB, tree Tree) *vipaths.MemFS {
+	t.Helper()
+	fsys := vipaths.NewMemFS()
+	if err := write(".", tree, func(name string) error { return fsys.MkdirAll(name, 0755) }, func(name string, data []byte) error {
+		return fsys.WriteFile(name, data, 0644)
+	}); err != nil {
+		t.Fatalf("building tree: %v", err)
+	}
+	return fsys
+}
+
+func write(root string, tree Tree, mkdir func(string) error, writeFile func(string, []byte) error) error {
+	for _, key := range slices.Sorted(maps.Keys(tree)) {
+		name := filepath.Join(root, filepath.FromSlash(key))
+		if strings.HasSuffix(key, "/") {
+			if err := mkdir(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mkdir(filepath.Dir(name)); err != nil {
+			return err
+		}
+		if err := writeFile(name, []byte(tree[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads the layout under root on fsys, which is the local disk or a
+// MemFS, or another vipaths.FS which can list directories and read files
+func Read(t testing.TB, fsys vipaths.FS, root string) Tree {
+	t.Helper()
+	rd, ok := fsys.(vipaths.ReadDirer)
+	if fsys == vipaths.OS || !ok {
+		rd = osReadDir{}
+	}
+	readFile := os.ReadFile
+	if r, ok := fsys.(interface{ ReadFile(string) ([]byte, error) }); ok {
+		readFile = r.ReadFile
+	}
+	tree := Tree{}
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		entries, err := rd.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 && rel != "" {
+			tree[rel+"/"] = ""
+		}
+		for _, entry := range entries {
+			name, key := filepath.Join(dir, entry.Name()), path.Join(rel, entry.Name())
+			if entry.IsDir() {
+				if err := walk(name, key); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := readFile(name)
+			if err != nil {
+				return err
+			}
+			tree[key] = string(data)
+		}
+		return nil
+	}
+	if err := walk(root, ""); err != nil {
+		t.Fatalf("reading tree: %v", err)
+	}
+	return tree
+}
+
+// withoutParents is tree without the keys of directories which have other
+// keys inside them, as Read gives it
+func withoutParents(tree Tree) Tree {
+	out := maps.Clone(tree)
+	for key := range tree {
+		for dir := path.Dir(strings.TrimSuffix(key, "/")); dir != "."; dir = path.Dir(dir) {
+			delete(out, dir+"/")
+		}
+	}
+	return out
+}
+
+type osReadDir struct{}
+
+func (osReadDir) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// Edit lists the paths under root which edits has keys for, edits their lines
+// to its values as if in the buffer, and parses and executes the result on
+// fsys, returning the plan which ran. Keys and destinations are relative to
+// root, like the buffer with -strip-prefix. The test fails if the edits don't
+// parse or the plan fails
+func Edit(t testing.TB, fsys vipaths.FS, root string, edits map[string]string, opts vipaths.ParseOptions) vipaths.Plan {
+	t.Helper()
+	before := slices.Sorted(maps.Keys(edits))
+	after := make([]string, len(before))
+	for i, key := range before {
+		after[i] = edits[key]
+		before[i] = filepath.FromSlash(key)
+	}
+	plan, err := vipaths.Parse(before, after, opts)
+	if err != nil {
+		t.Fatalf("parsing edits: %v", err)
+	}
+	plan = plan.Join(root)
+	if err := vipaths.Execute(plan, vipaths.Options{FS: fsys}); err != nil {
+		t.Fatalf("executing plan: %v\n%s", err, plan)
+	}
+	return plan
+}
+
+// Equal checks the layout under root on fsys is want, failing the test with
+// every path which is missing, unexpected, or has other contents
+func Equal(t testing.TB, fsys vipaths.FS, root string, want Tree) {
+	t.Helper()
+	if err := diff(Read(t, fsys, root), want); err != nil {
+		t.Errorf("tree under %s:\n%v", root, err)
+	}
+}
+
+// diff is every difference between got and want, in path order
+func diff(got, want Tree) error {
+	want = withoutParents(want)
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(want)) {
+		got, ok := got[key]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("missing %s", key))
+		case !strings.HasSuffix(key, "/") && got != want[key]:
+			errs = append(errs, fmt.Errorf("%s has %q, want %q", key, got, want[key]))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(got)) {
+		if _, ok := want[key]; !ok {
+			errs = append(errs, fmt.Errorf("unexpected %s", key))
+		}
+	}
+	return errors.Join(errs...)
+}
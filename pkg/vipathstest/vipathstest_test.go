@@ -0,0 +1,197 @@
+package vipathstest
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// build is a way to write a tree, run each test on the disk and in memory
+type build struct {
+	name  string
+	build func(testing.TB, Tree) (vipaths.FS, string)
+}
+
+var builds = []build{
+	{"disk", func(t testing.TB, tree Tree) (vipaths.FS, string) { return vipaths.OS, Build(t, tree) }},
+	{"mem", func(t testing.TB, tree Tree) (vipaths.FS, string) { return BuildMem(t, tree), "." }},
+}
+
+func TestBuildRead(t *testing.T) {
+	tree := Tree{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "", "empty/": "", "dir/": ""}
+	for _, b := range builds {
+		t.Run(b.name, func(t *testing.T) {
+			fsys, root := b.build(t, tree)
+			got := Read(t, fsys, root)
+			if err := diff(got, tree); err != nil {
+				t.Errorf("read back:\n%v", err)
+			}
+			if _, ok := got["dir/"]; ok {
+				t.Error("Read gave a key to a directory with files in it")
+			}
+			Equal(t, fsys, root, tree)
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := Tree{"a": "a", "b": "other", "extra": "", "empty/": ""}
+	want := Tree{"a": "a", "b": "b", "missing": "", "empty/": ""}
+	err := diff(got, want)
+	if err == nil {
+		t.Fatal("diff of different trees is nil")
+	}
+	const msg = "b has \"other\", want \"b\"\nmissing missing\nunexpected extra"
+	if err.Error() != msg {
+		t.Errorf("diff =\n%v\nwant\n%s", err, msg)
+	}
+	if err := diff(got, got); err != nil {
+		t.Errorf("diff of the same tree = %v", err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name   string
+		tree   Tree
+		edits  []map[string]string
+		opts   vipaths.ParseOptions
+		result Tree
+	}{
+		{
+			name:   "rename and remove",
+			tree:   Tree{"a.txt": "a", "old/b.txt": "b"},
+			edits:  []map[string]string{{"a.txt": "new/a.txt", "old/b.txt": "rm"}},
+			result: Tree{"new/a.txt": "a", "old/": ""},
+		},
+		{
+			name: "nested renames",
+			tree: Tree{"dir/sub/f.txt": "f", "dir/g.txt": "g"},
+			edits: []map[string]string{{
+				"dir":           "top",
+				"dir/sub":       "dir/inner",
+				"dir/sub/f.txt": "dir/sub/renamed.txt",
+			}},
+			result: Tree{"top/inner/renamed.txt": "f", "top/g.txt": "g"},
+		},
+		{
+			name: "swap through a temporary name",
+			tree: Tree{"a": "a", "b": "b"},
+			edits: []map[string]string{
+				{"a": "tmp", "b": "a"},
+				{"tmp": "b"},
+			},
+			result: Tree{"a": "b", "b": "a"},
+		},
+		{
+			name:   "copy",
+			tree:   Tree{"a": "a"},
+			edits:  []map[string]string{{"a": "copy b"}},
+			result: Tree{"a": "a", "b": "a"},
+		},
+		{
+			name:   "default copy",
+			tree:   Tree{"a": "a"},
+			edits:  []map[string]string{{"a": "dir/b"}},
+			opts:   vipaths.ParseOptions{DefaultOp: vipaths.DefaultCopy},
+			result: Tree{"a": "a", "dir/b": "a"},
+		},
+	}
+	for _, tt := range tests {
+		for _, b := range builds {
+			t.Run(tt.name+"/"+b.name, func(t *testing.T) {
+				fsys, root := b.build(t, tt.tree)
+				for _, edits := range tt.edits {
+					Edit(t, fsys, root, edits, tt.opts)
+				}
+				Equal(t, fsys, root, tt.result)
+			})
+		}
+	}
+}
+
+func TestCycle(t *testing.T) {
+	for _, b := range builds {
+		t.Run(b.name, func(t *testing.T) {
+			tree := Tree{"a": "a", "b": "b", "c": "c"}
+			fsys, root := b.build(t, tree)
+			_, err := vipaths.Parse([]string{"a", "b", "c"}, []string{"b", "c", "a"}, vipaths.ParseOptions{})
+			var cycle *vipaths.CycleError
+			if !errors.As(err, &cycle) || !errors.Is(err, vipaths.ErrCycle) {
+				t.Fatalf("Parse of a cycle = %v, want a CycleError", err)
+			}
+			// nothing ran, so the tree is as it was
+			Equal(t, fsys, root, tree)
+		})
+	}
+}
+
+// TestRenameOnto checks the FS's Rename onto an existing path, which MemFS
+// refuses for a directory like os.Rename
+func TestRenameOnto(t *testing.T) {
+	tests := []struct {
+		name     string
+		tree     Tree
+		old, new string
+		wantErr  bool
+		result   Tree
+	}{
+		{
+			name:   "file onto file",
+			tree:   Tree{"a": "a", "b": "b"},
+			old:    "a",
+			new:    "b",
+			result: Tree{"b": "a"},
+		},
+		{
+			name:    "directory onto empty directory",
+			tree:    Tree{"dir/f": "f", "empty/": ""},
+			old:     "dir",
+			new:     "empty",
+			wantErr: true,
+			result:  Tree{"dir/f": "f", "empty/": ""},
+		},
+		{
+			name:    "directory onto full directory",
+			tree:    Tree{"dir/f": "f", "full/g": "g"},
+			old:     "dir",
+			new:     "full",
+			wantErr: true,
+			result:  Tree{"dir/f": "f", "full/g": "g"},
+		},
+		{
+			name:    "file onto directory",
+			tree:    Tree{"a": "a", "empty/": ""},
+			old:     "a",
+			new:     "empty",
+			wantErr: true,
+			result:  Tree{"a": "a", "empty/": ""},
+		},
+		{
+			name:    "directory onto file",
+			tree:    Tree{"dir/f": "f", "b": "b"},
+			old:     "dir",
+			new:     "b",
+			wantErr: true,
+			result:  Tree{"dir/f": "f", "b": "b"},
+		},
+	}
+	for _, tt := range tests {
+		for _, b := range builds {
+			t.Run(tt.name+"/"+b.name, func(t *testing.T) {
+				if b.name == "disk" && runtime.GOOS == "windows" {
+					t.Skip("os.Rename replaces paths differently on windows")
+				}
+				fsys, root := b.build(t, tt.tree)
+				err := fsys.Rename(filepath.Join(root, tt.old), filepath.Join(root, tt.new))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Rename = %v, want error %t", err, tt.wantErr)
+				}
+				Equal(t, fsys, root, tt.result)
+			})
+		}
+	}
+}
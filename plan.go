@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// savePlan writes the plan to path for running later with apply. local paths
+// are made absolute so that it can be applied from any directory
+func savePlan(path string, plan vipaths.Plan, fsys vipaths.FS) error {
+	if fsys == vipaths.OS {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting working directory: %w", err)
+		}
+		plan = plan.Join(wd)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := planWriter(path)(f, plan); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// apply executes a plan saved with -save-plan. operations which look like
+// they've already run are skipped, so a plan which was interrupted can be
+// applied again
+func apply(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "don't execute any operations, just print")
+	jobs := flags.Int("jobs", 1, "number of copies to run at once")
+	onConflict := flags.String("on-conflict", conflictAsk, "what to do when a destination exists: ask, overwrite, skip, rename, or abort")
+	onlyOps := flags.String("only", "", "only run these operations, by number like 1,4-9")
+	skipOps := flags.String("skip", "", "don't run these operations, by number like 2,10-12")
+	saveRest := flags.String("save-rest", "", "write the operations left out by -only or -skip to this file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s apply [-dry-run] [-jobs n] [-on-conflict resolution] [-only ops] [-skip ops] [-save-rest file] plan.json", program)
+	}
+	if !validConflict(*onConflict) {
+		return fmt.Errorf("invalid -on-conflict %q, expected ask, overwrite, skip, rename, or abort", *onConflict)
+	}
+	only, err := parseOpRanges(*onlyOps)
+	if err != nil {
+		return fmt.Errorf("invalid -only %q: %w", *onlyOps, err)
+	}
+	skip, err := parseOpRanges(*skipOps)
+	if err != nil {
+		return fmt.Errorf("invalid -skip %q: %w", *skipOps, err)
+	}
+
+	plan, err := readPlan(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(plan) == 0 {
+		return &exitError{exitNothingToDo, errors.New("the plan is empty")}
+	}
+	plan, rest, err := selectOps(plan, only, skip)
+	if err != nil {
+		return err
+	}
+	if *saveRest != "" && len(rest) > 0 {
+		if err := savePlan(*saveRest, rest, vipaths.OS); err != nil {
+			return fmt.Errorf("saving rest of plan: %w", err)
+		}
+		log.Printf("saved %d remaining operations to %s", len(rest), *saveRest)
+	}
+	if len(plan) == 0 {
+		return &exitError{exitNothingToDo, errors.New("no operations selected")}
+	}
+	return executePlan(plan, nil, options{
+		fs:         vipaths.OS,
+		dryRun:     *dryRun,
+		jobs:       *jobs,
+		onConflict: *onConflict,
+		skipDone:   true,
+	})
+}
+
+// check runs the pre-flight checks on a saved plan against the current state
+// of the filesystem, without running anything. any problem exits with
+// exitInvalidPlan, for gating in CI
+func check(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the problems as a JSON array")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s check [-json] plan.json", program)
+	}
+	plan, err := readPlan(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	problems := plan.Check(vipaths.OS)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(append([]vipaths.Problem{}, problems...)); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return &exitError{exitInvalidPlan, fmt.Errorf("found %d problems in %d operations", len(problems), len(plan))}
+	}
+	return nil
+}
+
+// invert prints a plan which undoes a saved plan, for rehearsing a migration
+// and its way back. it's printed in the same format as the saved plan
+func invert(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s invert plan.json|manifest.jsonl", program)
+	}
+	plan, err := readPlan(args[0])
+	if err != nil {
+		return err
+	}
+	inverted, err := plan.Invert()
+	if err != nil {
+		return &exitError{exitInvalidPlan, fmt.Errorf("inverting plan:\n%w", err)}
+	}
+	return planWriter(args[0])(os.Stdout, inverted)
+}
+
+func readPlan(path string) (vipaths.Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening plan: %w", err)
+	}
+	defer f.Close()
+	read := vipaths.ReadPlan
+	switch {
+	case isCSV(path):
+		read = vipaths.ReadPlanCSV
+	case isManifest(path):
+		read = readManifest
+	}
+	plan, err := read(f)
+	if err != nil {
+		return nil, &exitError{exitInvalidPlan, fmt.Errorf("reading plan: %w", err)}
+	}
+	return plan, nil
+}
+
+// planWriter picks the format of a plan file by its extension, CSV for .csv
+// and JSON otherwise
+func planWriter(path string) func(io.Writer, vipaths.Plan) error {
+	if isCSV(path) {
+		return vipaths.WritePlanCSV
+	}
+	return vipaths.WritePlan
+}
+
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+func isManifest(path string) bool {
+	ext := filepath.Ext(path)
+	return strings.EqualFold(ext, ".jsonl") || strings.EqualFold(ext, ".ndjson")
+}
+
+// planDiff prints the operations added, removed, or changed between two saved
+// plans, for reviewing iterations of a migration. plans with the same
+// operations exit with exitNothingToDo
+func planDiff(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s plan-diff old.json new.json", program)
+	}
+	from, err := readPlan(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := readPlan(args[1])
+	if err != nil {
+		return err
+	}
+	diffs := vipaths.DiffPlans(from, to)
+	counts := map[string]int{}
+	for _, d := range diffs {
+		counts[d.Kind]++
+		switch d.Kind {
+		case vipaths.DiffAdded:
+			fmt.Printf("+ %d %s\n", d.NewIndex, oneLine(d.New))
+		case vipaths.DiffRemoved:
+			fmt.Printf("- %d %s\n", d.OldIndex, oneLine(d.Old))
+		case vipaths.DiffChanged:
+			fmt.Printf("~ %d %s\n", d.NewIndex, oneLine(d.New))
+			fmt.Printf("    was %d %s\n", d.OldIndex, oneLine(d.Old))
+		}
+	}
+	if len(diffs) == 0 {
+		return &exitError{exitNothingToDo, errors.New("the plans have the same operations")}
+	}
+	log.Printf("%d added, %d removed, %d changed", counts[vipaths.DiffAdded], counts[vipaths.DiffRemoved], counts[vipaths.DiffChanged])
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// loadPlugins registers a buffer command for each executable or .wasm module
+// in $XDG_CONFIG_HOME/vi-paths/plugins, named after the file without its
+// extension. a line like `upload s3://bucket/` then runs plugins/upload
+func loadPlugins() error {
+	dir, err := configDir()
+	if err != nil {
+		return fmt.Errorf("finding config: %w", err)
+	}
+	dir = filepath.Join(dir, "plugins")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading plugins: %w", err)
+	}
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if !executable(info) && !strings.EqualFold(filepath.Ext(entry.Name()), ".wasm") {
+			continue
+		}
+		if err := vipaths.RegisterPlugin(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
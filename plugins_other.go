@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+// executable reports whether a plugin file has an execute bit set
+func executable(info fs.FileInfo) bool {
+	return info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// executable reports whether a plugin file has one of the extensions in
+// %PATHEXT%, like .exe or .bat
+func executable(info fs.FileInfo) bool {
+	ext := strings.ToUpper(filepath.Ext(info.Name()))
+	return ext != "" && slices.Contains(strings.Split(strings.ToUpper(os.Getenv("PATHEXT")), ";"), ext)
+}
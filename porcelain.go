@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// Statuses of operations in -porcelain output
+const (
+	porcelainDone    = "done"
+	porcelainDryRun  = "dry-run"
+	porcelainSkipped = "skipped"
+	porcelainFailed  = "failed"
+	// porcelainPending operations never ran, because one before them failed
+	// or the run was interrupted
+	porcelainPending = "pending"
+)
+
+// porcelain collects the outcome of each operation in the plan, to write as
+// stable tab separated lines for scripts when the run ends
+type porcelain struct {
+	plan     vipaths.Plan
+	statuses []string
+}
+
+func newPorcelain(plan vipaths.Plan) *porcelain {
+	statuses := make([]string, len(plan))
+	for i := range statuses {
+		statuses[i] = porcelainPending
+	}
+	return &porcelain{plan: plan, statuses: statuses}
+}
+
+// set records the status of the i-th operation. a nil porcelain records
+// nothing
+func (p *porcelain) set(i int, status string) {
+	if p == nil || i >= len(p.statuses) {
+		return
+	}
+	p.statuses[i] = status
+}
+
+// failed is the index of the operation which stopped the run: the first
+// which failed, or else the first which never ran, as when its hook failed.
+// It's -1 if every operation finished
+func (p *porcelain) failed() int {
+	if i := slices.Index(p.statuses, porcelainFailed); i >= 0 {
+		return i
+	}
+	return slices.Index(p.statuses, porcelainPending)
+}
+
+// finished is the number of operations which ran or were skipped
+func (p *porcelain) finished() int {
+	var n int
+	for _, status := range p.statuses {
+		if status != porcelainPending && status != porcelainFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// write writes a line of status, operation, source, and destination for each
+// operation in plan order. paths are quoted as in the buffer, so they never
+// contain tabs or newlines, and an operation without a destination has an
+// empty last field
+func (p *porcelain) write(w io.Writer) error {
+	if p == nil {
+		return nil
+	}
+	bw := bufio.NewWriter(w)
+	for i, inst := range p.plan {
+		src, dst := inst.Paths()
+		if dst != "" {
+			dst = vipaths.Quote(dst)
+		}
+		if src != "" {
+			src = vipaths.Quote(src)
+		}
+		bw.WriteString(strings.Join([]string{p.statuses[i], vipaths.OpName(inst), src, dst}, "\t") + "\n")
+	}
+	return bw.Flush()
+}
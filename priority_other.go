@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// lowerPriority gives vi-paths, and the commands it starts, the lowest CPU
+// priority. disk priority can't be changed here, so only -bwlimit helps
+func lowerPriority() error {
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, 19)
+}
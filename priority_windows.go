@@ -0,0 +1,9 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// lowerPriority puts vi-paths in background mode, which lowers its CPU, disk,
+// and memory priority. commands it starts aren't affected
+func lowerPriority() error {
+	return windows.SetPriorityClass(windows.CurrentProcess(), windows.PROCESS_MODE_BACKGROUND_BEGIN)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// startProfile starts a CPU profile and an execution trace in dir, returning
+// a func which stops them and writes a heap profile too. the files are
+// cpu.pprof, heap.pprof, and trace.out, for go tool pprof and go tool trace
+func startProfile(dir string) (stop func() error, err error) {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	cpu, err := os.Create(filepath.Join(dir, "cpu.pprof"))
+	if err != nil {
+		return nil, err
+	}
+	tr, err := os.Create(filepath.Join(dir, "trace.out"))
+	if err != nil {
+		cpu.Close()
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		cpu.Close()
+		tr.Close()
+		return nil, fmt.Errorf("starting cpu profile: %w", err)
+	}
+	if err := trace.Start(tr); err != nil {
+		pprof.StopCPUProfile()
+		cpu.Close()
+		tr.Close()
+		return nil, fmt.Errorf("starting trace: %w", err)
+	}
+	return func() error {
+		trace.Stop()
+		pprof.StopCPUProfile()
+		errs := []error{cpu.Close(), tr.Close(), writeHeapProfile(filepath.Join(dir, "heap.pprof"))}
+		return errors.Join(errs...)
+	}, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// collect first so the profile shows what's live, not what's awaiting
+	// collection
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
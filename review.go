@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// reviewPlanInEditor writes the plan to a temp file, one numbered operation
+// per line, and opens it in the editor. deleted lines are skipped and the
+// remaining operations run in their new order. the skipped operations are
+// returned too, in their original order
+func reviewPlanInEditor(plan vipaths.Plan, editor []string, temp tempFiles) (reviewed, skipped vipaths.Plan, err error) {
+	tmp, err := temp.create(program + "-plan-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating temp file: %w", err)
+	}
+	defer temp.remove(tmp.Name())
+	defer tmp.Close()
+
+	fmt.Fprintf(tmp, "# %s: delete lines to skip operations, or reorder them\n", program)
+	fmt.Fprintf(tmp, "# save and quit to run, or delete every line to cancel\n")
+	for i, inst := range plan {
+		fmt.Fprintf(tmp, "%d %s\n", i+1, oneLine(inst))
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, nil, fmt.Errorf("closing temp file: %w", err)
+	}
+
+	if err := runEditor(editor, tmp.Name()); err != nil {
+		return nil, nil, fmt.Errorf("reviewing plan: %w", err)
+	}
+	edited, err := os.Open(tmp.Name())
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening edited temp file: %w", err)
+	}
+	defer edited.Close()
+	lines, err := vipaths.ReadBuffer(edited)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reviewing plan: %w", err)
+	}
+
+	seen := map[int]bool{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		num, _, _ := strings.Cut(line, " ")
+		i, err := strconv.Atoi(num)
+		if err != nil || i < 1 || i > len(plan) {
+			return nil, nil, &exitError{exitInvalidPlan, fmt.Errorf("reviewing plan: unknown operation %q", line)}
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		reviewed = append(reviewed, plan[i-1])
+	}
+	for i, inst := range plan {
+		if !seen[i+1] {
+			skipped = append(skipped, inst)
+		}
+	}
+	return reviewed, skipped, nil
+}
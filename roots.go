@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// walkRoots returns everything inside each of the root directories, for
+// -roots. roots can't be inside one another, or their paths would belong to
+// both. with oneFS, directories mounted inside a root aren't descended into,
+// and ignored paths are left out
+func walkRoots(roots []string, oneFS bool, ignores *ignoreRules) ([]string, error) {
+	for i, root := range roots {
+		stat, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			return nil, fmt.Errorf("%s isn't a directory", vipaths.Quote(root))
+		}
+		for _, other := range roots[:i] {
+			if _, ok := within(other, root); ok {
+				return nil, fmt.Errorf("%s is inside %s", vipaths.Quote(root), vipaths.Quote(other))
+			}
+			if _, ok := within(root, other); ok {
+				return nil, fmt.Errorf("%s is inside %s", vipaths.Quote(other), vipaths.Quote(root))
+			}
+		}
+	}
+	var paths []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == root {
+				return nil
+			}
+			if skip, err := ignores.skip(path, d); skip {
+				return err
+			}
+			if oneFS && d.IsDir() {
+				mount, err := otherFilesystem(path, root)
+				if err != nil {
+					return err
+				}
+				if mount {
+					return filepath.SkipDir
+				}
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// groupRoots orders paths by the root they're in, keeping their order within
+// each, and makes them relative to it. the root of each path is returned
+// alongside, and notes name the roots at the start of their groups
+func groupRoots(roots, paths []string) (rel, rootOf []string, notes map[int]string, err error) {
+	groups := make([][]string, len(roots))
+	for _, path := range paths {
+		i := slices.IndexFunc(roots, func(root string) bool {
+			r, ok := within(root, path)
+			return ok && r != "."
+		})
+		if i < 0 {
+			return nil, nil, nil, fmt.Errorf("%s isn't inside any of the roots", vipaths.Quote(path))
+		}
+		groups[i] = append(groups[i], path)
+	}
+	notes = map[int]string{}
+	for i, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		r, err := vipaths.Rel(roots[i], group)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		notes[len(rel)] = "root " + vipaths.Quote(roots[i])
+		rel = append(rel, r...)
+		for range group {
+			rootOf = append(rootOf, roots[i])
+		}
+	}
+	return rel, rootOf, notes, nil
+}
+
+// rootIndex is the root a change belongs to, the root of its path, or for an
+// added line, of the path above it
+func rootIndex(changes vipaths.Changes, i int) int {
+	return max(changes.Index[i], 0)
+}
+
+// joinRoots returns the changes with their paths joined to their roots, for
+// pointing errors to their lines
+func joinRoots(changes vipaths.Changes, rootOf []string) vipaths.Changes {
+	joined := changes
+	joined.Before = make([]string, len(changes.Before))
+	for i, before := range changes.Before {
+		if before != "" {
+			joined.Before[i] = filepath.Join(rootOf[rootIndex(changes, i)], before)
+		}
+	}
+	return joined
+}
+
+// parseRoots parses the changed lines under each root separately, since the
+// same relative path can be in several, and joins each plan to its root
+func parseRoots(changes vipaths.Changes, rootOf []string, lines bufferLines, opts vipaths.ParseOptions) (vipaths.Plan, error) {
+	var order []string
+	byRoot := map[string]*vipaths.Changes{}
+	for i := range changes.Before {
+		root := rootOf[rootIndex(changes, i)]
+		c, ok := byRoot[root]
+		if !ok {
+			c = &vipaths.Changes{}
+			byRoot[root] = c
+			order = append(order, root)
+		}
+		c.Before = append(c.Before, changes.Before[i])
+		c.After = append(c.After, changes.After[i])
+	}
+	var plan vipaths.Plan
+	for _, root := range order {
+		rootOpts := opts
+		if taken := opts.Taken; taken != nil {
+			rootOpts.Taken = func(name string) bool { return taken(filepath.Join(root, name)) }
+		}
+		p, err := parseLines(byRoot[root].Before, byRoot[root].After, root, lines, rootOpts)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, p.Join(root)...)
+	}
+	return plan, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// runLog appends a JSON lines record of each planned and executed instruction
+// to a file, independent of terminal output
+type runLog struct {
+	f      *os.File
+	logger *slog.Logger
+}
+
+func openRunLog(path string) (*runLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening log: %w", err)
+	}
+	logger := slog.New(slog.NewJSONHandler(f, nil)).With("pid", os.Getpid())
+	return &runLog{f: f, logger: logger}, nil
+}
+
+// instruction records an event like "planned" or "executed" for inst. a nil
+// runLog records nothing
+func (l *runLog) instruction(event string, inst vipaths.Instruction, dryRun bool, err error) {
+	if l == nil {
+		return
+	}
+	src, dst := inst.Paths()
+	attrs := []any{"op", vipaths.OpName(inst), "src", src}
+	if dst != "" {
+		attrs = append(attrs, "dst", dst)
+	}
+	if dryRun {
+		attrs = append(attrs, "dry_run", true)
+	}
+	if err != nil {
+		l.logger.Error(event, append(attrs, "error", err.Error())...)
+		return
+	}
+	l.logger.Info(event, attrs...)
+}
+
+func (l *runLog) close() {
+	if l == nil {
+		return
+	}
+	l.f.Close()
+}
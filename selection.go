@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// opRanges are inclusive ranges of operation numbers, starting at 1, as given
+// to -only and -skip
+type opRanges [][2]int
+
+// parseOpRanges parses a list of numbers and ranges like 1,4-9
+func parseOpRanges(spec string) (opRanges, error) {
+	var ranges opRanges
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("%q isn't an operation number", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || end < start {
+				return nil, fmt.Errorf("%q isn't a range of operations", part)
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
+
+func (r opRanges) contains(n int) bool {
+	for _, rng := range r {
+		if n >= rng[0] && n <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// selectOps splits the plan into the operations to run now and the rest, by
+// their numbers. with only, just those run. with skip, those don't
+func selectOps(plan vipaths.Plan, only, skip opRanges) (selected, rest vipaths.Plan, err error) {
+	for _, r := range append(only, skip...) {
+		if r[1] > len(plan) {
+			return nil, nil, fmt.Errorf("operation %d is out of range, the plan has %d", r[1], len(plan))
+		}
+	}
+	for i, inst := range plan {
+		n := i + 1
+		if only != nil && !only.contains(n) || skip.contains(n) {
+			rest = append(rest, inst)
+		} else {
+			selected = append(selected, inst)
+		}
+	}
+	return selected, rest, nil
+}
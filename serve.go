@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// JSON-RPC 2.0 error codes used by serve
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	// rpcFailed is a plan which couldn't be made, or failed while running
+	rpcFailed = 1
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// rpcResult is the outcome of one operation run by apply or undo, with a
+// status as printed by -porcelain
+type rpcResult struct {
+	Status string `json:"status"`
+	Op     string `json:"op"`
+	Src    string `json:"src,omitempty"`
+	Dst    string `json:"dst,omitempty"`
+}
+
+// server answers JSON-RPC requests from file managers and editor plugins,
+// one JSON object a line. plans only run one at a time, whichever
+// connection they come from
+type server struct {
+	running sync.Mutex
+}
+
+// serve listens on a unix socket for JSON-RPC requests, so file managers and
+// editor plugins can list paths, plan edits, and apply and undo plans without
+// starting a process and writing a buffer for each
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	socket := flags.String("socket", "", "path of the unix socket to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" || flags.NArg() != 0 {
+		return fmt.Errorf("usage: %s serve -socket path", program)
+	}
+	// a socket left behind by a server which didn't exit cleanly
+	if stat, err := os.Lstat(*socket); err == nil && stat.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", *socket); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is already being served", *socket)
+		}
+		os.Remove(*socket)
+	}
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	// only whoever started the server can drive it
+	if err := os.Chmod(*socket, 0600); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	log.Printf("serving on %s", *socket)
+
+	var srv server
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go srv.handle(ctx, conn)
+	}
+}
+
+// handle answers each request on the connection in turn, until it's closed
+func (s *server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(nil, 64<<20)
+	enc := json.NewEncoder(conn)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var req rpcRequest
+		resp := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			resp.Error = &rpcError{Code: rpcParseError, Message: err.Error()}
+		} else {
+			result, err := s.call(ctx, req)
+			if req.ID == nil {
+				// a notification, which gets no response
+				continue
+			}
+			resp.ID, resp.Result = req.ID, result
+			if err != nil {
+				var rerr *rpcError
+				if !errors.As(err, &rerr) {
+					rerr = &rpcError{Code: rpcFailed, Message: err.Error()}
+				}
+				resp.Error = rerr
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) call(ctx context.Context, req rpcRequest) (any, error) {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}
+	}
+	switch req.Method {
+	case "list":
+		var params struct {
+			Dir string `json:"dir"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return rpcList(params.Dir)
+	case "plan":
+		var params struct {
+			Paths []string `json:"paths"`
+			Lines []string `json:"lines"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return rpcPlan(params.Paths, params.Lines)
+	case "apply", "undo":
+		var params struct {
+			Plan       json.RawMessage `json:"plan"`
+			DryRun     bool            `json:"dry_run"`
+			OnConflict string          `json:"on_conflict"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if params.OnConflict == "" {
+			params.OnConflict = vipaths.ConflictAbort
+		}
+		if params.OnConflict == conflictAsk || !validConflict(params.OnConflict) {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("invalid on_conflict %q, expected overwrite, skip, rename, or abort", params.OnConflict)}
+		}
+		plan, err := vipaths.ReadPlan(bytes.NewReader(params.Plan))
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		if req.Method == "undo" {
+			if plan, err = plan.Invert(); err != nil {
+				return nil, fmt.Errorf("inverting plan: %w", err)
+			}
+		}
+		s.running.Lock()
+		defer s.running.Unlock()
+		return rpcApply(ctx, plan, params.DryRun, params.OnConflict)
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// rpcList returns the paths in dir, sorted, and their lines as they'd appear
+// in a buffer listing them
+func rpcList(dir string) (any, error) {
+	if dir == "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "list needs a dir"}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	slices.Sort(paths)
+	lines := make([]string, 0, len(paths))
+	for _, p := range paths {
+		lines = append(lines, vipaths.Quote(p))
+	}
+	return map[string][]string{"paths": paths, "lines": lines}, nil
+}
+
+// rpcPlan parses edited lines against the paths they were listed from, and
+// returns the plan as a saved plan file, ready to pass to apply
+func rpcPlan(paths, lines []string) (any, error) {
+	plan, err := vipaths.Parse(paths, lines, vipaths.ParseOptions{Expand: true})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := vipaths.WritePlan(&buf, plan); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+// rpcApply runs the plan, returning the outcome of each operation. if it
+// fails, the outcomes are the error's data
+func rpcApply(ctx context.Context, plan vipaths.Plan, dryRun bool, onConflict string) (any, error) {
+	statuses := newPorcelain(plan)
+	err := vipaths.ExecuteContext(ctx, plan, vipaths.Options{
+		FS:         vipaths.OS,
+		DryRun:     dryRun,
+		OnConflict: func(vipaths.Instruction, string) string { return onConflict },
+		Progress: func(e vipaths.ProgressEvent) {
+			switch {
+			case e.Kind == vipaths.ProgressDone && dryRun:
+				statuses.set(e.Index, porcelainDryRun)
+			case e.Kind == vipaths.ProgressDone:
+				statuses.set(e.Index, porcelainDone)
+			case e.Kind == vipaths.ProgressSkipped:
+				statuses.set(e.Index, porcelainSkipped)
+			case e.Kind == vipaths.ProgressError:
+				statuses.set(e.Index, porcelainFailed)
+			}
+		},
+	})
+	results := make([]rpcResult, 0, len(plan))
+	for i, inst := range plan {
+		src, dst := inst.Paths()
+		results = append(results, rpcResult{Status: statuses.statuses[i], Op: vipaths.OpName(inst), Src: src, Dst: dst})
+	}
+	if err != nil {
+		return nil, &rpcError{Code: rpcFailed, Message: err.Error(), Data: map[string]any{"results": results}}
+	}
+	return map[string]any{"results": results}, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+// editSession is an editing session saved with -session, so one which is
+// interrupted or put off can be picked up where it was left
+type editSession struct {
+	path string
+	// keep is set when editing didn't finish, so the session is kept
+	keep bool
+
+	// Args are the paths given on the command line, listed again on resuming
+	Args []string `json:"args"`
+	// Paths are the listing the buffer was written for
+	Paths []string `json:"paths,omitempty"`
+	// Buffer is the buffer as the editor last saved it
+	Buffer string `json:"buffer,omitempty"`
+}
+
+// loadSession reads the session saved at path, or returns a new one if there
+// isn't one yet
+func loadSession(path string) (*editSession, error) {
+	sess := &editSession{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sess, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return sess, nil
+}
+
+func (s *editSession) save() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, buf.Bytes(), 0600)
+}
+
+// resume returns the saved buffer for the listing, or false if editing it
+// hasn't started. a listing which has changed since can't be resumed, since
+// the buffer's lines would be matched with the wrong paths
+func (s *editSession) resume(before []string) (string, bool, error) {
+	if s.Paths == nil {
+		return "", false, nil
+	}
+	if !slices.Equal(s.Paths, before) {
+		return "", false, fmt.Errorf("the paths have changed since session %s was saved, remove it to start again", s.path)
+	}
+	return s.Buffer, true, nil
+}
+
+// finish removes the session once it's done with, unless editing was
+// interrupted or the buffer couldn't be parsed, so it can be fixed up
+func (s *editSession) finish(err error) error {
+	var exitErr *exitError
+	if s.keep || errors.As(err, &exitErr) && exitErr.code == exitInvalidPlan {
+		return fmt.Errorf("%w\nsaved session to %s, run again with the same -session to resume", err, s.path)
+	}
+	if rerr := os.Remove(s.path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+		return fmt.Errorf("removing session: %w", rerr)
+	}
+	return err
+}
+
+// saveSession saves the buffer at name as the session's, as the editor left it
+func saveSession(s *editSession, before []string, name string) error {
+	buffer, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	s.Paths, s.Buffer = before, string(buffer)
+	return s.save()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// filesystems whose snapshots -snapshot takes
+const (
+	fsBtrfs = "btrfs"
+	fsZFS   = "zfs"
+)
+
+// btrfsSnapshotDir is the directory in a btrfs subvolume its snapshots are
+// made in, since a subvolume's parent often can't be written to
+const btrfsSnapshotDir = ".vi-paths-snapshots"
+
+// fsSnapshot is a btrfs subvolume or zfs dataset to snapshot before running
+// a plan, for -snapshot
+type fsSnapshot struct {
+	fs string
+	// of is the root of the subvolume, or the name of the dataset
+	of string
+}
+
+// planSnapshots returns the btrfs subvolumes and zfs datasets holding the
+// paths the plan changes, failing if any are on another filesystem, since
+// the snapshots couldn't roll everything back
+func planSnapshots(plan vipaths.Plan) ([]fsSnapshot, error) {
+	var snaps []fsSnapshot
+	for _, inst := range plan {
+		paths := planSources(inst)
+		if dst := planDst(inst); dst != "" {
+			paths = append(paths, dst)
+		}
+		for _, path := range paths {
+			existing, err := closestExisting(path)
+			if err != nil {
+				return nil, err
+			}
+			typ, err := snapshotFilesystem(existing)
+			if err != nil {
+				return nil, err
+			}
+			snap := fsSnapshot{fs: typ}
+			switch typ {
+			case fsBtrfs:
+				snap.of, err = btrfsSubvolume(existing)
+			case fsZFS:
+				snap.of, err = zfsDataset(existing)
+			default:
+				return nil, fmt.Errorf("%s isn't on btrfs or zfs", vipaths.Quote(path))
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(snaps, snap) {
+				snaps = append(snaps, snap)
+			}
+		}
+	}
+	return snaps, nil
+}
+
+// closestExisting returns path, or the closest directory above it which
+// exists, for destinations which haven't been made yet
+func closestExisting(path string) (string, error) {
+	for {
+		_, err := os.Lstat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		path = parent
+	}
+}
+
+// zfsDataset returns the name of the zfs dataset holding path
+func zfsDataset(path string) (string, error) {
+	out, err := exec.Command("zfs", "list", "-H", "-o", "name", path).Output()
+	if err != nil {
+		return "", fmt.Errorf("finding the dataset of %s: %w", vipaths.Quote(path), commandError(err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// takeSnapshots snapshots each subvolume and dataset, read-only and named for
+// the time, logging where each is so the run can be rolled back by hand
+func takeSnapshots(snaps []fsSnapshot, dryRun bool) error {
+	name := "vi-paths-" + time.Now().Format("20060102-150405")
+	for _, snap := range snaps {
+		var cmd *exec.Cmd
+		var at string
+		switch snap.fs {
+		case fsBtrfs:
+			dir := filepath.Join(snap.of, btrfsSnapshotDir)
+			at = filepath.Join(dir, name)
+			if !dryRun {
+				if err := os.MkdirAll(dir, 0o700); err != nil {
+					return err
+				}
+			}
+			cmd = exec.Command("btrfs", "subvolume", "snapshot", "-r", snap.of, at)
+		case fsZFS:
+			at = snap.of + "@" + name
+			cmd = exec.Command("zfs", "snapshot", at)
+		}
+		if dryRun {
+			log.Printf("would snapshot %s to %s", vipaths.Quote(snap.of), vipaths.Quote(at))
+			continue
+		}
+		if _, err := cmd.Output(); err != nil {
+			return fmt.Errorf("snapshotting %s: %w", vipaths.Quote(snap.of), commandError(err))
+		}
+		log.Printf("snapshotted %s to %s", vipaths.Quote(snap.of), vipaths.Quote(at))
+	}
+	return nil
+}
+
+// commandError adds what a failed command printed to its error
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// statfs magic numbers of the filesystems which can be snapshotted
+const (
+	btrfsMagic = 0x9123683e
+	zfsMagic   = 0x2fc12fc1
+)
+
+// btrfsSubvolumeIno is the inode number of the root of every btrfs subvolume
+const btrfsSubvolumeIno = 256
+
+// snapshotFilesystem returns which of btrfs or zfs the local path is on, or ""
+// if it's on neither
+func snapshotFilesystem(path string) (string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", err
+	}
+	switch uint32(st.Type) {
+	case btrfsMagic:
+		return fsBtrfs, nil
+	case zfsMagic:
+		return fsZFS, nil
+	}
+	return "", nil
+}
+
+// btrfsSubvolume returns the root of the btrfs subvolume holding path, the
+// closest directory above it with the inode number subvolume roots have
+func btrfsSubvolume(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		stat, err := os.Stat(dir)
+		if err != nil {
+			return "", err
+		}
+		if st, ok := stat.Sys().(*syscall.Stat_t); ok && stat.IsDir() && st.Ino == btrfsSubvolumeIno {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no btrfs subvolume holds %s", vipaths.Quote(path))
+		}
+		dir = parent
+	}
+}
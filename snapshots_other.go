@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// snapshotFilesystem can't tell filesystems apart here, so nothing can be
+// snapshotted
+func snapshotFilesystem(string) (string, error) {
+	return "", errors.New("snapshots are only supported on linux")
+}
+
+func btrfsSubvolume(string) (string, error) {
+	return "", errors.New("snapshots are only supported on linux")
+}
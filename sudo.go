@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// sudoRetrier retries operations which were denied permission by applying
+// them alone with sudo, asking on the terminal first unless always is set.
+// choices made with an upper case letter apply to every denial after
+type sudoRetrier struct {
+	always, never bool
+	tmpDir        string
+	onConflict    string
+}
+
+func (s *sudoRetrier) retry(inst vipaths.Instruction, denied error) error {
+	if s.never || !s.always && !s.ask(inst, denied) {
+		return denied
+	}
+	dir, err := os.MkdirTemp(s.tmpDir, program+"-sudo-")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "plan.json")
+	if err := savePlan(path, vipaths.Plan{inst}, vipaths.OS); err != nil {
+		return fmt.Errorf("saving plan for sudo: %w", err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding %s: %w", program, err)
+	}
+	// the temp dir is private to us, but root can still read it
+	cmd := exec.Command("sudo", self, "apply", "-on-conflict", s.onConflict, path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w, then with sudo: %w", denied, err)
+	}
+	return nil
+}
+
+func (s *sudoRetrier) ask(inst vipaths.Instruction, denied error) bool {
+	in, out, err := openTTY()
+	if err != nil {
+		// nobody to ask
+		return false
+	}
+	defer in.Close()
+	defer out.Close()
+
+	keys := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "%v\nretry %s with sudo? [y]es, [n]o (upper case for all)? ", denied, vipaths.OpName(inst))
+		line, err := keys.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		line = strings.TrimSpace(line)
+		switch line {
+		case "Y":
+			s.always = true
+		case "N":
+			s.never = true
+		}
+		switch strings.ToLower(line) {
+		case "y":
+			return true
+		case "n":
+			return false
+		}
+	}
+}
+
+// sudoAvailable reports whether sudo can be run to retry denied operations
+func sudoAvailable() bool {
+	_, err := exec.LookPath("sudo")
+	return err == nil && os.Geteuid() != 0
+}
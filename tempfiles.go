@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// tempFiles creates the buffers handed to the editor, which can list names
+// other users of the machine shouldn't see, in a directory private to the
+// user. with shred they're overwritten before being removed
+type tempFiles struct {
+	dir   string
+	shred bool
+}
+
+// newTempFiles makes the user's private directory under dir, or $TMPDIR.
+// it's only readable by its owner, and one owned by anyone else is refused,
+// since it could have been made to watch what's written to it
+func newTempFiles(dir string, shred bool) (tempFiles, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	name := program
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	private := filepath.Join(dir, name)
+	if err := os.Mkdir(private, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return tempFiles{}, err
+	}
+	stat, err := os.Lstat(private)
+	if err != nil {
+		return tempFiles{}, err
+	}
+	if !stat.IsDir() {
+		return tempFiles{}, fmt.Errorf("%s isn't a directory", private)
+	}
+	// the owner can't be checked on windows, where the temp dir is per user
+	if owner, ok := vipaths.FileOwner(stat); ok {
+		if owner.UID != os.Getuid() {
+			return tempFiles{}, fmt.Errorf("%s is owned by another user", private)
+		}
+		if stat.Mode().Perm()&0077 != 0 {
+			if err := os.Chmod(private, 0700); err != nil {
+				return tempFiles{}, err
+			}
+		}
+	}
+	return tempFiles{dir: private, shred: shred}, nil
+}
+
+// create makes a new temp file readable only by the user, see os.CreateTemp
+func (t tempFiles) create(pattern string) (*os.File, error) {
+	return os.CreateTemp(t.dir, pattern)
+}
+
+// remove removes a temp file, first overwriting it with zeros if shredding.
+// on SSDs and copy-on-write filesystems the old blocks may survive anyway
+func (t tempFiles) remove(name string) {
+	if t.shred {
+		if err := shredFile(name); err != nil {
+			log.Printf("shredding %s: %v", name, err)
+		}
+	}
+	os.Remove(name)
+}
+
+func shredFile(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, zeros{}, stat.Size()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// zeros is an endless reader of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
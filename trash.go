@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// trashRecordPath is $XDG_DATA_HOME/vi-paths/trash.jsonl, which lists the
+// paths -trash moved to the trash, one JSON object a line, for -restore
+func trashRecordPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, program, "trash.jsonl"), nil
+}
+
+// trashRecordMu keeps lines from removes running at once whole
+var trashRecordMu sync.Mutex
+
+// recordTrashed adds an entry to the trash record
+func recordTrashed(entry vipaths.TrashEntry) error {
+	trashRecordMu.Lock()
+	defer trashRecordMu.Unlock()
+	path, err := trashRecordPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pruneTrashRecord reads the trash record, dropping entries which are no
+// longer in the trash, because they were restored or the trash was emptied.
+// their .trashinfo files are removed too, so file managers don't list them.
+// the entries left are returned newest first
+func pruneTrashRecord() ([]vipaths.TrashEntry, error) {
+	trashRecordMu.Lock()
+	defer trashRecordMu.Unlock()
+	path, err := trashRecordPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []vipaths.TrashEntry
+	var pruned bool
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var entry vipaths.TrashEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if _, err := os.Lstat(entry.Trashed); err != nil {
+			os.Remove(entry.Info)
+			pruned = true
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	f.Close()
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if pruned {
+		if err := writeTrashRecord(path, entries); err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// writeTrashRecord replaces the trash record with entries
+func writeTrashRecord(path string, entries []vipaths.TrashEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".trash-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// trashListing lists what -trash moved to the trash and is still there, as
+// pairs lines restoring each to where it was, newest first. each run's
+// entries are noted with when they were removed
+func trashListing() ([]string, map[string]string, map[int]string, error) {
+	entries, err := pruneTrashRecord()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading trash record: %w", err)
+	}
+	paths := make([]string, 0, len(entries))
+	dsts := map[string]string{}
+	notes := map[int]string{}
+	var last string
+	for i, entry := range entries {
+		paths = append(paths, entry.Trashed)
+		dsts[entry.Trashed] = vipaths.Quote(entry.Path)
+		if when := entry.Deleted.Local().Format("2006-01-02 15:04"); when != last {
+			notes[i] = "removed " + when
+			last = when
+		}
+	}
+	return paths, dsts, notes, nil
+}
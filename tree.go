@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// layout is the listed paths as they'll be once a plan has run, each with
+// notes on how it got there
+type layout map[string][]string
+
+// planLayout simulates the plan on the listed paths, without touching the
+// filesystem. paths inside a renamed directory move with it, and removed
+// paths are kept, noted as removed, so they show in the tree too
+func planLayout(listed []string, plan vipaths.Plan) layout {
+	l := layout{}
+	for _, path := range listed {
+		l[filepath.Clean(path)] = nil
+	}
+	for _, inst := range plan {
+		switch inst := inst.(type) {
+		case vipaths.Rename:
+			l.move(inst.Before, inst.After)
+			if inst.Link {
+				l.note(inst.Before, tr("symlink to %s", vipaths.Quote(inst.After)))
+			}
+		case vipaths.Copy:
+			l.note(inst.To, tr("copy of %s", vipaths.Quote(inst.From)))
+		case vipaths.Mkdir:
+			l.note(inst.Name, tr("new"))
+		case vipaths.Remove:
+			l.remove(inst.Name, tr("removed"))
+		case vipaths.Archive:
+			for _, name := range inst.Names {
+				l.remove(name, tr("archived"))
+			}
+			l.note(inst.To, tr("new archive"))
+		case vipaths.Compress:
+			if !inst.Keep {
+				l.remove(inst.Name, tr("compressed"))
+			}
+			l.note(inst.To, tr("new"))
+		case vipaths.Extract:
+			if inst.Remove {
+				l.remove(inst.Name, tr("extracted"))
+			}
+			l.note(inst.Dir, tr("extracted from %s", vipaths.Quote(inst.Name)))
+		default:
+			src, dst := inst.Paths()
+			l.note(cmp.Or(dst, src), vipaths.OpName(inst))
+		}
+	}
+	return l
+}
+
+// move renames from to to, along with everything inside it
+func (l layout) move(from, to string) {
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	moved := layout{}
+	for path, notes := range l {
+		rel, ok := within(from, path)
+		if !ok {
+			continue
+		}
+		delete(l, path)
+		if rel == "." {
+			notes = append(slices.Clip(notes), tr("from %s", vipaths.Quote(from)))
+		}
+		moved[filepath.Join(to, rel)] = notes
+	}
+	if len(moved) == 0 {
+		moved[to] = []string{tr("from %s", vipaths.Quote(from))}
+	}
+	for path, notes := range moved {
+		l[path] = notes
+	}
+}
+
+// remove notes path, and everything inside it, as gone
+func (l layout) remove(name, why string) {
+	name = filepath.Clean(name)
+	l.note(name, why)
+	for path, notes := range l {
+		if rel, ok := within(name, path); ok && rel != "." && !slices.Contains(notes, why) {
+			l[path] = append(notes, why)
+		}
+	}
+}
+
+func (l layout) note(path, note string) {
+	path = filepath.Clean(path)
+	l[path] = append(l[path], note)
+}
+
+// within returns path relative to dir if it's dir or inside it
+func within(dir, path string) (string, bool) {
+	if path == dir {
+		return ".", true
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// confirmTree prints the layout and asks on the terminal before running the
+// plan's n operations. a dry run only prints it, to stdout, since nothing runs
+// anyway. without a terminal to ask on, the plan doesn't run
+func confirmTree(l layout, n int, dryRun bool) bool {
+	if dryRun {
+		return printTree(os.Stdout, l) == nil
+	}
+	in, out, err := openTTY()
+	if err != nil {
+		return false
+	}
+	defer in.Close()
+	defer out.Close()
+
+	if err := printTree(out, l); err != nil {
+		return false
+	}
+	fmt.Fprint(out, tr("run these %d operations? [y/N] ", n))
+	line, err := bufio.NewReader(in).ReadString('\n')
+	return err == nil && answeredYes(line)
+}
+
+// printTree prints the layout as a tree like the tree command's, from the
+// common directory of its paths, with the notes after each entry
+func printTree(w io.Writer, l layout) error {
+	paths := make([]string, 0, len(l))
+	for path := range l {
+		paths = append(paths, path)
+	}
+	// relative paths in different directories only share the working one
+	root := cmp.Or(vipaths.CommonDir(paths), ".")
+	children := map[string][]string{}
+	for _, path := range paths {
+		// add directories between the root and each path too
+		for path != root && path != filepath.Dir(path) {
+			dir := filepath.Dir(path)
+			if !slices.Contains(children[dir], path) {
+				children[dir] = append(children[dir], path)
+			}
+			path = dir
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, vipaths.Quote(root))
+	var walk func(dir, indent string)
+	walk = func(dir, indent string) {
+		entries := children[dir]
+		slices.Sort(entries)
+		for i, path := range entries {
+			branch, next := "├── ", "│   "
+			if i == len(entries)-1 {
+				branch, next = "└── ", "    "
+			}
+			fmt.Fprintf(bw, "%s%s%s", indent, branch, vipaths.Quote(filepath.Base(path)))
+			if notes := l[path]; len(notes) > 0 {
+				fmt.Fprintf(bw, " (%s)", strings.Join(notes, ", "))
+			}
+			fmt.Fprintln(bw)
+			walk(path, indent+next)
+		}
+	}
+	walk(root, "")
+	return bw.Flush()
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// openTTY opens the controlling terminal for reading and writing, for prompts
+// which work even when stdin is redirected
+func openTTY() (in, out *os.File, err error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
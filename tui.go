@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/term"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+// errAborted is returned when the user quits an interactive review
+var errAborted = &exitError{exitNothingToDo, errors.New("aborted")}
+
+// reviewPlan shows the plan in a full screen list where operations can be
+// toggled and reordered before running. it returns the enabled operations in
+// their new order, and the disabled ones
+func reviewPlan(plan vipaths.Plan) (reviewed, skipped vipaths.Plan, err error) {
+	t, err := openTerminal()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.close()
+
+	items := make([]reviewItem, len(plan))
+	for i, inst := range plan {
+		items[i] = reviewItem{inst: inst, enabled: true}
+	}
+
+	var cursor, top int
+	for {
+		// header, blank, list, blank, details
+		listHeight := max(t.height()-8, 1)
+		if cursor < top {
+			top = cursor
+		}
+		if cursor >= top+listHeight {
+			top = cursor - listHeight + 1
+		}
+		drawReview(t.out, items, cursor, top, listHeight)
+
+		key, err := readKey(t.keys)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading key: %w", err)
+		}
+		switch key {
+		case "j", "\x1b[B":
+			cursor = min(cursor+1, len(items)-1)
+		case "k", "\x1b[A":
+			cursor = max(cursor-1, 0)
+		case "g", "\x1b[H":
+			cursor = 0
+		case "G", "\x1b[F":
+			cursor = len(items) - 1
+		case " ", "x":
+			items[cursor].enabled = !items[cursor].enabled
+		case "J":
+			if cursor < len(items)-1 {
+				items[cursor], items[cursor+1] = items[cursor+1], items[cursor]
+				cursor++
+			}
+		case "K":
+			if cursor > 0 {
+				items[cursor], items[cursor-1] = items[cursor-1], items[cursor]
+				cursor--
+			}
+		case "\r", "\n", "y":
+			for _, item := range items {
+				if item.enabled {
+					reviewed = append(reviewed, item.inst)
+				} else {
+					skipped = append(skipped, item.inst)
+				}
+			}
+			return reviewed, skipped, nil
+		case "q", "\x1b", "\x03":
+			return nil, nil, errAborted
+		}
+	}
+}
+
+type reviewItem struct {
+	inst    vipaths.Instruction
+	enabled bool
+}
+
+func drawReview(out *os.File, items []reviewItem, cursor, top, listHeight int) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	enabled := 0
+	for _, item := range items {
+		if item.enabled {
+			enabled++
+		}
+	}
+	b.WriteString(tr("%s: %d of %d operations enabled", program, enabled, len(items)) + "\r\n")
+	b.WriteString(tr("j/k move, space toggle, J/K reorder, enter run, q quit") + "\r\n\r\n")
+	for i := top; i < len(items) && i < top+listHeight; i++ {
+		mark := "[ ]"
+		if items[i].enabled {
+			mark = "[x]"
+		}
+		line := fmt.Sprintf("%s %s", mark, oneLine(items[i].inst))
+		if i == cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString(line + "\r\n")
+	}
+	if len(items) > 0 {
+		b.WriteString("\r\n")
+		b.WriteString(strings.ReplaceAll(items[cursor].inst.String(), "\n", "\r\n"))
+		b.WriteString("\r\n")
+	}
+	out.WriteString(b.String())
+}
+
+// terminal is the controlling terminal in raw mode, showing the alternate
+// screen until closed
+type terminal struct {
+	in, out *os.File
+	keys    *bufio.Reader
+	state   *term.State
+}
+
+func openTerminal() (*terminal, error) {
+	in, out, err := openTTY()
+	if err != nil {
+		return nil, fmt.Errorf("opening terminal: %w", err)
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		in.Close()
+		out.Close()
+		return nil, fmt.Errorf("making terminal raw: %w", err)
+	}
+	// alternate screen and hidden cursor, restored on close
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	return &terminal{in: in, out: out, keys: bufio.NewReader(in), state: state}, nil
+}
+
+func (t *terminal) height() int {
+	_, height, err := term.GetSize(int(t.out.Fd()))
+	if err != nil {
+		return 24
+	}
+	return height
+}
+
+func (t *terminal) close() {
+	fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(t.in.Fd()), t.state)
+	t.in.Close()
+	t.out.Close()
+}
+
+var lineBreaks = regexp.MustCompile(`\s*\n\s*`)
+
+// oneLine is an instruction's String without line breaks
+func oneLine(inst vipaths.Instruction) string {
+	return lineBreaks.ReplaceAllString(inst.String(), " ")
+}
+
+// readKey reads a key press, including whole escape sequences for arrow keys
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if c != 0x1b || r.Buffered() == 0 {
+		return string(c), nil
+	}
+	seq := []byte{c}
+	for r.Buffered() > 0 {
+		c, _ := r.ReadByte()
+		seq = append(seq, c)
+		if len(seq) > 2 && (c >= 'A' && c <= 'Z' || c == '~') {
+			break
+		}
+	}
+	return string(seq), nil
+}
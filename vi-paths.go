@@ -1,204 +1,1886 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"maps"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
 )
 
 const program = "vi-paths"
 
+// exit codes, so that scripts can tell what happened
+const (
+	exitSuccess     = 0
+	exitNothingToDo = 1 // the buffer was saved without changes
+	exitUsage       = 2 // bad arguments or config, or the editor failed
+	exitInvalidPlan = 3 // the edited buffer couldn't be turned into a plan
+	exitExecution   = 4 // some operations may have run before one failed
+)
+
+// exitError is an error with the exit code it should cause
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// errNothingToDo is returned by run when the plan is empty
+var errNothingToDo = &exitError{exitNothingToDo, errors.New("no changes")}
+
+func fatalf(code int, format string, a ...any) {
+	log.Printf(format, a...)
+	os.Exit(code)
+}
+
 func init() {
 	log.SetFlags(0)
 }
 
+// subcommand is run instead of editing paths when its name is the first argument
+type subcommand struct {
+	name string
+	// args are completions for the subcommand's argument
+	args []string
+	run  func(args []string) error
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{name: "editor-setup", args: []string{"vim", "nvim", "helix"}, run: editorSetup},
+		{name: "completion", args: []string{"bash", "zsh", "fish"}, run: completion},
+		{name: "apply", run: apply},
+		{name: "check", run: check},
+		{name: "invert", run: invert},
+		{name: "plan-diff", run: planDiff},
+		{name: "audit-verify", run: auditVerify},
+		{name: "map", run: mapPaths},
+		{name: "serve", run: serve},
+	}
+}
+
 func main() {
 	dryRun := flag.Bool("dry-run", false, "don't execute any operations, just print")
-	flag.Parse()
+	editorCmd := flag.String("editor", envOr("EDITOR", defaultEditor), "editor command to use, may include arguments (default $EDITOR)")
+	tmpDir := flag.String("tmpdir", "", "directory to make a private directory for temp buffers in (default $TMPDIR)")
+	shred := flag.Bool("shred", false, "overwrite temp buffers with zeros before removing them")
+	preHook := flag.String("pre", "", "shell command to run before each operation, with {src} and {dst} substituted")
+	postHook := flag.String("post", "", "shell command to run after each operation, with {src} and {dst} substituted")
+	postRunHook := flag.String("post-run", "", "shell command to run once after all operations")
+	var postMatch []matchHook
+	flag.Func("post-match", "`hook` like '*.go -> goimports -w {dst}', a shell command to run after renames and copies onto destinations matching the pattern, may be repeated", func(s string) error {
+		h, err := parseMatchHook(s)
+		if err != nil {
+			return err
+		}
+		postMatch = append(postMatch, h)
+		return nil
+	})
+	stripPrefix := flag.Bool("strip-prefix", false, "show paths relative to their common directory")
+	noExpand := flag.Bool("no-expand", false, "don't expand ~ and $VARS in edited destinations")
+	absolute := flag.Bool("absolute", false, "show paths as absolute, cleaned paths")
+	relative := flag.Bool("relative", false, "show paths relative to the current directory")
+	resolve := flag.Bool("resolve", false, "follow symlinks to edit the files they point to, and drop paths which are the same file as another")
+	empty := flag.String("empty", vipaths.EmptyError, "what a cleared line means: delete, keep, or error")
+	defaultOp := flag.String("default-op", vipaths.DefaultRename, "what a line edited to a new path means: rename, or copy to leave the sources alone")
+	var orders []string
+	for _, o := range vipaths.Orders {
+		orders = append(orders, string(o))
+	}
+	order := flag.String("order", string(vipaths.OrderDepth), "order to run operations in: "+strings.Join(orders, ", "))
+	explicitDelete := flag.Bool("explicit-delete", false, "only remove paths changed to `rm`, never cleared lines, overriding -empty delete")
+	renameOnly := flag.Bool("rename-only", false, "only allow renames, failing before anything runs otherwise")
+	noRemove := flag.Bool("no-remove", false, "don't allow removes, failing before anything runs otherwise")
+	noCopy := flag.Bool("no-copy", false, "don't allow copies, failing before anything runs otherwise")
+	checkOpenFiles := flag.String("check-open", "", "before renaming or removing paths open in other processes, warn or ask")
+	confirmDeletes := flag.Bool("confirm-deletes", false, "list the removes and ask before running them, running everything else either way")
+	expr := flag.String("expr", "", "rename without an editor using a substitution like 's/(\\d{4})-(\\d{2})/\\2-\\1/', with flags g, i, and b for the base name only")
+	glob := flag.String("glob", "", "rename paths matching a glob like 'IMG_*.jpg' without an editor, using the -to template")
+	to := flag.String("to", "", "template for -glob like 'photo-{1}.jpg', where {1} is what the first wildcard matched")
+	extMap := flag.String("ext-map", "", "change extensions without an editor, like jpeg=jpg,tif=tiff,tar.gz=tgz, ignoring case")
+	contentAddr := -1
+	flag.Func("content-address", "rename files without an editor to the sha256 of their contents, in `depth` levels of directories like ab/cd/abcdef....jpg for 2", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("expected a depth like 2")
+		}
+		contentAddr = n
+		return nil
+	})
+	mapCmd := flag.String("map-cmd", "", "rename without an editor to the first line a shell `command` prints for each path, given on its stdin and as {}, like exiftool or a script")
+	lower := flag.Bool("lower", false, "rename the base name of every path to lower case without an editor")
+	upper := flag.Bool("upper", false, "rename the base name of every path to upper case without an editor")
+	locale := flag.String("locale", "", "language for -lower, -upper, and case changes in -expr and -to, like tr for the dotted and dotless i (default from $LANG)")
+	list := flag.Bool("list", false, "print the buffer which would be edited and exit")
+	ids := flag.Bool("ids", false, "end each line with its path's #id and match lines to paths by it, so lines can be sorted or moved around in the editor")
+	pairs := flag.Bool("pairs", false, "edit lines of source<TAB>destination, so either side can be edited or mappings pasted in")
+	selinux := flag.Bool("selinux", false, "show each path's SELinux context after a tab, editing it to relabel the path")
+	editLinks := flag.Bool("edit-links", false, "only edit symlinks, showing each one's target after a tab, editing it to point the link somewhere else")
+	xattrs := flag.String("xattr", "", "comma separated extended attributes to show after each path in tab separated columns, editing one to set it")
+	annotate := flag.String("annotate", "", "comma separated read-only columns to show after each path: "+strings.Join(annotationKinds, ", "))
+	var annotateCmds []string
+	flag.Func("annotate-cmd", "shell `command` like 'mediainfo --Inform=\"General;%Duration/String%\" {}' whose first line of output is a read-only column after each path, with {} replaced by the path, may be repeated", func(s string) error {
+		annotateCmds = append(annotateCmds, s)
+		return nil
+	})
+	chunk := flag.Int("chunk", 0, "edit the paths in sessions of this many lines, running everything at the end")
+	jobs := flag.Int("jobs", 1, "number of copies to run at once, for plans with many small files")
+	loop := flag.Bool("loop", false, "after running, edit the updated paths again until nothing changes")
+	rootDirs := flag.Bool("roots", false, "given directories, edit everything in each, grouped under a comment naming it and shown relative to it")
+	diff := flag.Bool("diff", false, "given two directories, only edit the paths which are in one but not the other")
+	mirror := flag.Bool("mirror", false, "given directories src and dst, edit pairs of src's files and copies of them to the same place under dst, for a one-shot sync")
+	trash := flag.Bool("trash", false, "move removed paths to the trash rather than deleting them, to put back with -restore")
+	restore := flag.Bool("restore", false, "edit pairs of the paths -trash moved to the trash and where they were, restoring the lines kept")
+	minSize := flag.String("min-size", "", "only edit paths at least this size, like 1G or 500M, counting everything in directories")
+	maxSize := flag.String("max-size", "", "only edit paths at most this size, like 1G or 500M, counting everything in directories")
+	newerThan := flag.String("newer-than", "", "only edit paths modified within an age like 30d, 2w, or 1y, or since a time like 2020-01-01")
+	olderThan := flag.String("older-than", "", "only edit paths not modified within an age like 30d, 2w, or 1y, or since a time like 2020-01-01")
+	sortOrder := flag.String("sort", "", "sort the paths by name, comparing bytes, or locale, using the collation rules of $LC_COLLATE or $LANG")
+	oneFS := flag.Bool("one-file-system", false, "skip paths on other filesystems to the rest, and don't descend into mounts with -diff")
+	findDupes := flag.Bool("find-dupes", false, "only edit files with identical contents, grouped together, for use with the dedup command")
+	pick := flag.Bool("pick", false, "fuzzy filter the paths in a terminal UI first, editing only the chosen ones")
+	review := flag.Bool("review", false, "review the plan in the editor before running, deleting lines to skip operations")
+	graph := flag.String("graph", "", "print the order of the plan's operations and why as a graph in this format, dot for Graphviz, instead of running it")
+	tree := flag.Bool("tree", false, "print the layout the plan leaves behind as a tree, marking moved and removed paths, and ask before running it")
+	tui := flag.Bool("tui", false, "review the plan in a terminal UI before running, toggling and reordering operations")
+	logPath := flag.String("log", "", "append a JSON lines record of every planned and executed operation to this file")
+	savePlanPath := flag.String("save-plan", "", "write the plan to this file instead of running it, for running later with apply")
+	onlyOps := flag.String("only", "", "only run these operations, by number like 1,4-9")
+	skipOps := flag.String("skip", "", "don't run these operations, by number like 2,10-12")
+	saveRest := flag.String("save-rest", "", "write the operations left out by -only, -skip, -review, or -tui to this file, for running later with apply")
+	auditPath := flag.String("audit", "", "append every operation run, with the time, user, host, and directory, to this hash-chained log, see audit-verify")
+	manifestPath := flag.String("manifest", "", "write a JSON lines record of every completed operation to this file, with checksums of copies")
+	dirMode := flag.String("dir-mode", "", "octal mode for directories created by renames and copies (default 0777 less the umask)")
+	dirOwner := flag.String("dir-owner", "", "user[:group] to own directories created by renames and copies, or inherit to copy the owner and mode of their closest existing parent")
+	refPermsPath := flag.String("ref-perms", "", "give copies and created directories the owner and mode of this reference `path`, like chmod --reference")
+	extractRemove := flag.Bool("extract-remove", false, "remove archives after the extract command unpacks them")
+	dropQuarantine := flag.Bool("drop-quarantine", false, "don't keep the macOS quarantine flag on copies of downloaded files")
+	compressKeep := flag.Bool("compress-keep", false, "keep the originals of files compressed by the gzip and zstd commands")
+	onConflict := flag.String("on-conflict", conflictAsk, "what to do when a destination exists: ask, overwrite, skip, rename, or abort")
+	targetFS := flag.String("target-fs", "", "check destinations against the naming rules of a filesystem: "+strings.Join(vipaths.TargetFilesystems, ", "))
+	merge := flag.String("merge", "", "merge directories renamed onto existing ones, with a policy for conflicting files: fail, skip, or overwrite")
+	leaveSymlink := flag.Bool("leave-symlink", false, "leave a symlink at the old path of every rename pointing to the new one, so references keep working")
+	profileDir := flag.String("profile", "", "write CPU and heap profiles and a trace of running the plan to this directory, for reporting performance problems")
+	opTimeout := flag.Duration("op-timeout", 0, "cancel any operation which runs longer than this, like 10m, failing the run once it's out of retries")
+	opRetries := flag.Int("op-retries", 0, "try an operation which hit -op-timeout this many more times before failing the run")
+	slowAfter := flag.Duration("slow-after", time.Minute, "warn about any operation still running after this long, like a copy from a hung mount, or 0 to never warn")
+	var copyExclude []string
+	flag.Func("copy-exclude", "`pattern` like .git or node_modules for rsync to skip inside copied directories, with -copy-engine rsync, may be repeated", func(s string) error {
+		copyExclude = append(copyExclude, s)
+		return nil
+	})
+	bwlimit := flag.String("bwlimit", "", "limit copies to this many bytes a second, like 10M, shared by parallel copies")
+	nice := flag.Bool("nice", false, "lower the CPU and disk priority of vi-paths and the commands it runs, like nice and ionice -c3")
+	copyEngine := flag.String("copy-engine", vipaths.CopyBuiltin, "how copies are made: builtin, or rsync to copy whole directories and resume interrupted copies")
+	notify := flag.Bool("notify", false, "send a desktop notification when the plan finishes or fails, for long runs")
+	fsync := flag.Bool("fsync", false, "flush copied files and the directories of copies and renames to disk after each, for migrations which must survive a power loss")
+	sudo := flag.Bool("sudo", false, "retry operations denied permission with sudo without asking first")
+	fromFile := flag.String("from-file", "", "read the paths to edit from `file`, one a line quoted as in the buffer, like the output of -list, rather than the arguments")
+	stdinBuffer := flag.Bool("stdin-buffer", false, "don't start an editor, read the edited buffer from stdin instead, for editor plugins. the paths come from -from-file")
+	watchDir := flag.String("watch", "", "watch `dir`, editing the paths which arrive in it as they settle, until interrupted")
+	watchInterval := flag.Duration("watch-interval", 0, "with -watch, open a buffer of new paths at most this often, like 1h. SIGUSR1 opens one now")
+	porcelainOut := flag.Bool("porcelain", false, "when the run ends, print a tab separated line of status, operation, source, and destination for each operation, for scripts")
+	strict := flag.Bool("strict", false, "fail lines which look like a mistyped command, like cpoy dest, rather than warning and renaming to a file named that")
+	mark := flag.Bool("mark", false, "don't change anything, print the paths of lines marked with a leading ! instead, for reviewing big trees")
+	fsSnapshot := flag.Bool("snapshot", false, "before running, snapshot the btrfs subvolumes or zfs datasets the plan changes, for rolling the whole tree back")
+	pruneEmpty := flag.Bool("prune-empty", false, "after running, remove directories left empty by renames, and their parents left empty in turn")
+	noMkdir := flag.Bool("no-mkdir", false, "fail rather than create missing destination directories")
+	noLock := flag.Bool("no-lock", false, "don't lock the edited tree against other sessions")
+	noIgnore := flag.Bool("no-ignore", false, "don't leave out paths matched by the .viignore files in the working and config directories")
+	host := flag.String("host", "", "edit and run on paths on a remote host like user@server over sftp, with only the editor local")
+	sessionPath := flag.String("session", "", "save the listing and buffer to this file if editing is interrupted or the buffer is invalid, and resume from it")
+	cwd := flag.String("cwd", "", "resolve relative paths, in arguments and the buffer, against this directory")
+	var aliases []string
+	flag.Func("alias", "another name for a buffer command, like `c=copy`, may be repeated", func(s string) error {
+		aliases = append(aliases, s)
+		return nil
+	})
+
+	if err := loadPlugins(); err != nil {
+		fatalf(exitUsage, "loading plugins: %v", err)
+	}
 
+	if len(os.Args) > 1 {
+		for _, sub := range subcommands {
+			if os.Args[1] != sub.name {
+				continue
+			}
+			if err := sub.run(os.Args[2:]); err != nil {
+				code := exitUsage
+				var exitErr *exitError
+				if errors.As(err, &exitErr) {
+					code = exitErr.code
+				}
+				fatalf(code, "%s: %v", sub.name, err)
+			}
+			return
+		}
+	}
+
+	// leading @name arguments pick profiles, bundles of flags loaded after the
+	// config file
+	args := os.Args[1:]
+	var profiles []string
+	for len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		profiles = append(profiles, args[0][1:])
+		args = args[1:]
+	}
+	if err := loadConfig(flag.CommandLine); err != nil {
+		fatalf(exitUsage, "loading config: %v", err)
+	}
+	for _, name := range profiles {
+		if err := loadProfile(flag.CommandLine, name); err != nil {
+			fatalf(exitUsage, "loading profile: %v", err)
+		}
+	}
+	if err := loadEnv(flag.CommandLine); err != nil {
+		fatalf(exitUsage, "loading environment: %v", err)
+	}
+	flag.CommandLine.Parse(args)
+	for _, a := range aliases {
+		alias, name, ok := strings.Cut(a, "=")
+		if !ok {
+			fatalf(exitUsage, "invalid -alias %q, expected alias=command", a)
+		}
+		if err := vipaths.RegisterAlias(strings.TrimSpace(alias), strings.TrimSpace(name)); err != nil {
+			fatalf(exitUsage, "invalid -alias: %v", err)
+		}
+	}
+
+	startDir, _ := os.Getwd()
+	if *cwd != "" {
+		if err := os.Chdir(*cwd); err != nil {
+			fatalf(exitUsage, "changing directory: %v", err)
+		}
+	}
+
+	var err error
 	paths := flag.Args()
+	if *fromFile != "" {
+		if len(paths) > 0 {
+			fatalf(exitUsage, "-from-file can't be used with paths as arguments")
+		}
+		if paths, err = readListing(*fromFile); err != nil {
+			fatalf(exitUsage, "reading paths: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "%s lists no paths", *fromFile)
+		}
+	}
+	if *stdinBuffer {
+		switch {
+		case *fromFile == "":
+			fatalf(exitUsage, "-stdin-buffer needs the listing the buffer was edited from as -from-file")
+		case *sessionPath != "" || *loop || *chunk > 0 || *list || *tui || *review:
+			fatalf(exitUsage, "-stdin-buffer can't be used with -session, -loop, -chunk, -list, -tui, or -review")
+		case *expr != "" || *glob != "" || *extMap != "" || contentAddr >= 0 || *mapCmd != "" || *lower || *upper:
+			fatalf(exitUsage, "-stdin-buffer can't be used with -expr, -glob, -ext-map, -content-address, -map-cmd, -lower, or -upper")
+		}
+	}
+	if *mark {
+		switch {
+		case *sessionPath != "" || *loop || *list || *review || *watchDir != "":
+			fatalf(exitUsage, "-mark can't be used with -session, -loop, -list, -review, or -watch")
+		case *expr != "" || *glob != "" || *extMap != "" || contentAddr >= 0 || *mapCmd != "" || *lower || *upper:
+			fatalf(exitUsage, "-mark can't be used with -expr, -glob, -ext-map, -content-address, -map-cmd, -lower, or -upper")
+		}
+	}
+	if *watchDir != "" {
+		switch {
+		case len(paths) > 0:
+			fatalf(exitUsage, "-watch can't be used with paths as arguments")
+		case *sessionPath != "" || *loop || *chunk > 0 || *list || *stdinBuffer:
+			fatalf(exitUsage, "-watch can't be used with -session, -loop, -chunk, -list, or -stdin-buffer")
+		case *mirror || *diff || *rootDirs || isURL(*watchDir):
+			fatalf(exitUsage, "-watch needs a local directory, and can't be used with -mirror, -diff, or -roots")
+		}
+		if stat, err := os.Stat(*watchDir); err != nil || !stat.IsDir() {
+			fatalf(exitUsage, "-watch %s isn't a directory", *watchDir)
+		}
+		// stands in for the paths to come while setting up
+		paths = []string{*watchDir}
+	}
+	var sess *editSession
+	if *sessionPath != "" {
+		if *loop || *chunk > 0 || *list || *expr != "" || *glob != "" || *extMap != "" || contentAddr >= 0 || *mapCmd != "" || *lower || *upper {
+			fatalf(exitUsage, "-session can't be used with -loop, -chunk, -list, -expr, -glob, -ext-map, -content-address, -map-cmd, -lower, or -upper")
+		}
+		if sess, err = loadSession(*sessionPath); err != nil {
+			fatalf(exitUsage, "loading session: %v", err)
+		}
+		switch {
+		case len(paths) == 0:
+			paths = sess.Args
+		case sess.Args != nil && !slices.Equal(paths, sess.Args):
+			fatalf(exitUsage, "session %s is for other paths, run without paths to resume it", *sessionPath)
+		}
+		sess.Args = paths
+	}
+	var restored []string
+	var restoreDsts map[string]string
+	var restoreNotes map[int]string
+	if *restore {
+		switch {
+		case len(paths) > 0:
+			fatalf(exitUsage, "-restore can't be used with paths as arguments")
+		case *trash || *mirror || *diff || *rootDirs || *sortOrder != "":
+			fatalf(exitUsage, "-restore can't be used with -trash, -mirror, -diff, -roots, or -sort")
+		}
+		if restored, restoreDsts, restoreNotes, err = trashListing(); err != nil {
+			fatalf(exitUsage, "%v", err)
+		}
+		if len(restored) == 0 {
+			fatalf(exitNothingToDo, "nothing in the trash to restore")
+		}
+		paths = restored
+		*pairs = true
+	}
 	if len(paths) == 0 {
-		log.Fatalf("please provide a list of paths\nfor example using your shell's path globbing like ./**")
+		fatalf(exitUsage, "please provide a list of paths\nfor example using your shell's path globbing like ./**")
+	}
+
+	// without a usable editor, fall back to the built-in line editor
+	var editor []string
+	switch {
+	case *list, *stdinBuffer, (*expr != "" || *glob != "" || *extMap != "" || contentAddr >= 0 || *mapCmd != "" || *lower || *upper) && !*review:
+	case *editorCmd == "":
+		log.Printf("$EDITOR not set and no -editor provided, using the built-in line editor")
+	default:
+		if editor, err = splitArgs(*editorCmd); err != nil {
+			fatalf(exitUsage, "parsing editor %q: %v", *editorCmd, err)
+		}
+		if len(editor) == 0 {
+			fatalf(exitUsage, "editor %q is empty", *editorCmd)
+		}
+		if _, err := exec.LookPath(editor[0]); err != nil {
+			log.Printf("editor %q not found in $PATH, using the built-in line editor", editor[0])
+			editor = nil
+		}
 	}
 
-	editor, ok := os.LookupEnv("EDITOR")
-	if !ok {
-		log.Fatalf("$EDITOR not set")
+	var mode fs.FileMode
+	if *dirMode != "" {
+		if mode, err = vipaths.ParseMode(*dirMode); err != nil {
+			fatalf(exitUsage, "invalid -dir-mode %q: %v", *dirMode, err)
+		}
 	}
-	if _, err := exec.LookPath(editor); err != nil {
-		log.Fatalf("$EDITOR %q not found in $PATH", editor)
+	var owner *vipaths.Owner
+	if *dirOwner != "" && *dirOwner != ownerInherit {
+		if owner, err = parseOwner(*dirOwner); err != nil {
+			fatalf(exitUsage, "invalid -dir-owner %q: %v", *dirOwner, err)
+		}
+	}
+	var refPerms fs.FileInfo
+	if *refPermsPath != "" {
+		if refPerms, err = os.Stat(*refPermsPath); err != nil {
+			fatalf(exitUsage, "invalid -ref-perms: %v", err)
+		}
 	}
 
-	if err := run(paths, editor, *dryRun); err != nil {
-		log.Fatalf("running: %v", err)
+	if *host != "" {
+		if paths, err = hostURLs(*host, paths); err != nil {
+			fatalf(exitUsage, "invalid -host: %v", err)
+		}
 	}
-}
 
-func run(before []string, editor string, dryRun bool) error {
-	tmp, err := os.CreateTemp("", filepath.Base(program))
+	lockKey := "local:"
+	if isURL(paths[0]) {
+		u, _ := url.Parse(paths[0])
+		lockKey = u.Scheme + "://" + u.Host
+	}
+
+	fsys, paths, closer, err := openFS(paths)
 	if err != nil {
-		return fmt.Errorf("creating temp file: %w", err)
+		fatalf(exitUsage, "opening paths: %v", err)
 	}
-	defer os.Remove(tmp.Name())
-	defer tmp.Close()
 
-	after, err := editPaths(tmp, editor, before)
+	if *resolve {
+		if fsys != vipaths.OS {
+			fatalf(exitUsage, "-resolve only works with local paths")
+		}
+		if paths, err = resolvePaths(paths); err != nil {
+			fatalf(exitUsage, "resolving paths: %v", err)
+		}
+	}
+	switch {
+	case *absolute && *relative:
+		fatalf(exitUsage, "-absolute and -relative can't be used together")
+	case (*absolute || *relative) && fsys != vipaths.OS:
+		fatalf(exitUsage, "-absolute and -relative only work with local paths")
+	case *absolute:
+		paths, err = absPaths(paths)
+	case *relative:
+		paths, err = relPaths(paths)
+	}
 	if err != nil {
-		return fmt.Errorf("editing paths: %w", err)
+		fatalf(exitUsage, "normalising paths: %v", err)
+	}
+
+	// local listings leave out paths matched by .viignore files
+	var ignores *ignoreRules
+	if fsys == vipaths.OS && !*noIgnore {
+		if ignores, err = loadIgnores(); err != nil {
+			fatalf(exitUsage, "loading %s: %v", ignoreFile, err)
+		}
 	}
-	if len(after) != len(before) {
-		return fmt.Errorf("line count mismatch: before %d, after %d", len(before), len(after))
+
+	if *trash && fsys != vipaths.OS {
+		fatalf(exitUsage, "-trash only works with local paths")
 	}
 
-	instructions, err := parseInstructions(before, after)
-	if err != nil {
-		return fmt.Errorf("parse instructions: %w", err)
+	notes := restoreNotes
+	mirrored := restoreDsts
+	if *mirror {
+		if fsys != vipaths.OS || len(paths) != 2 || *diff {
+			fatalf(exitUsage, "-mirror needs two local directories, and can't be used with -diff")
+		}
+		if paths, mirrored, err = mirrorTrees(paths[0], paths[1], ignores); err != nil {
+			fatalf(exitUsage, "mirroring directories: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "everything is already mirrored")
+		}
+		*pairs = true
+	}
+	if *diff {
+		if fsys != vipaths.OS || len(paths) != 2 {
+			fatalf(exitUsage, "-diff needs two local directories")
+		}
+		if paths, notes, err = diffTrees(paths[0], paths[1], *oneFS, ignores); err != nil {
+			fatalf(exitUsage, "comparing directories: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "no differences found")
+		}
+	}
+	var roots []string
+	if *rootDirs {
+		if fsys != vipaths.OS || *diff || *mirror {
+			fatalf(exitUsage, "-roots needs local directories, and can't be used with -diff or -mirror")
+		}
+		for _, root := range paths {
+			roots = append(roots, filepath.Clean(root))
+		}
+		if paths, err = walkRoots(roots, *oneFS, ignores); err != nil {
+			fatalf(exitUsage, "listing roots: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "the roots are empty")
+		}
+	}
+	if ignores != nil && !*mirror && !*diff && !*rootDirs && !*restore {
+		if paths = ignores.filter(paths); len(paths) == 0 {
+			fatalf(exitNothingToDo, "every path is ignored by %s", ignoreFile)
+		}
+	}
+	if *oneFS && !*diff && !*rootDirs {
+		if fsys != vipaths.OS {
+			fatalf(exitUsage, "-one-file-system only works with local paths")
+		}
+		if paths, err = oneFilesystem(paths); err != nil {
+			fatalf(exitUsage, "checking filesystems: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "no paths left to edit")
+		}
+	}
+	var sizeAge sizeAgeFilter
+	if *minSize != "" {
+		if sizeAge.minSize, err = vipaths.ParseBytes(*minSize); err != nil {
+			fatalf(exitUsage, "invalid -min-size: %v", err)
+		}
+	}
+	if *maxSize != "" {
+		if sizeAge.maxSize, err = vipaths.ParseBytes(*maxSize); err != nil {
+			fatalf(exitUsage, "invalid -max-size: %v", err)
+		}
+	}
+	if *newerThan != "" {
+		if sizeAge.newer, err = parseAge(*newerThan); err != nil {
+			fatalf(exitUsage, "invalid -newer-than: %v", err)
+		}
+	}
+	if *olderThan != "" {
+		if sizeAge.older, err = parseAge(*olderThan); err != nil {
+			fatalf(exitUsage, "invalid -older-than: %v", err)
+		}
+	}
+	if sizeAge.enabled() {
+		if paths, err = sizeAge.filter(fsys, paths); err != nil {
+			fatalf(exitUsage, "filtering paths: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "no paths match the size and age filters")
+		}
+	}
+	if err := sortPaths(paths, *sortOrder); err != nil {
+		fatalf(exitUsage, "invalid -sort: %v", err)
+	}
+
+	if !validMerge(*merge) {
+		fatalf(exitUsage, "invalid -merge %q, expected fail, skip, or overwrite", *merge)
+	}
+	switch *empty {
+	case vipaths.EmptyDelete, vipaths.EmptyKeep, vipaths.EmptyError:
+	default:
+		fatalf(exitUsage, "invalid -empty %q, expected delete, keep, or error", *empty)
+	}
+	switch *defaultOp {
+	case vipaths.DefaultRename, vipaths.DefaultCopy:
+	default:
+		fatalf(exitUsage, "invalid -default-op %q, expected rename or copy", *defaultOp)
+	}
+	if !slices.Contains(orders, *order) {
+		fatalf(exitUsage, "invalid -order %q, expected one of %s", *order, strings.Join(orders, ", "))
+	}
+	if *explicitDelete && *empty == vipaths.EmptyDelete {
+		*empty = vipaths.EmptyError
+	}
+	switch *checkOpenFiles {
+	case "", openWarn, openAsk:
+	default:
+		fatalf(exitUsage, "invalid -check-open %q, expected warn or ask", *checkOpenFiles)
+	}
+	if !slices.Contains(vipaths.CopyEngines, *copyEngine) {
+		fatalf(exitUsage, "invalid -copy-engine %q, expected one of %s", *copyEngine, strings.Join(vipaths.CopyEngines, ", "))
+	}
+	if len(copyExclude) > 0 && *copyEngine != vipaths.CopyRsync {
+		fatalf(exitUsage, "-copy-exclude needs -copy-engine rsync, the builtin engine doesn't copy inside directories")
+	}
+	var bandwidth int64
+	if *bwlimit != "" {
+		if bandwidth, err = vipaths.ParseBytes(*bwlimit); err != nil || bandwidth <= 0 {
+			fatalf(exitUsage, "invalid -bwlimit %q, expected a size like 10M", *bwlimit)
+		}
+	}
+	if *nice {
+		if err := lowerPriority(); err != nil {
+			log.Printf("lowering priority: %v", err)
+		}
+	}
+	if !validConflict(*onConflict) {
+		fatalf(exitUsage, "invalid -on-conflict %q, expected ask, overwrite, skip, rename, or abort", *onConflict)
 	}
-	for _, instruction := range instructions {
-		log.Printf("%s", instruction)
-		if dryRun {
+	vipaths.DropQuarantine = *dropQuarantine
+	var attrs []string
+	if *editLinks {
+		attrs = append(attrs, linkAttr)
+	}
+	if *selinux {
+		attrs = append(attrs, vipaths.SELinuxAttr)
+	}
+	for attr := range strings.SplitSeq(*xattrs, ",") {
+		if attr = strings.TrimSpace(attr); attr != "" && !slices.Contains(attrs, attr) {
+			attrs = append(attrs, attr)
+		}
+	}
+	if len(attrs) > 0 && (*pairs || fsys != vipaths.OS) {
+		fatalf(exitUsage, "-edit-links, -selinux, and -xattr only work with local paths, and not with -pairs")
+	}
+	if *editLinks && *resolve {
+		fatalf(exitUsage, "-edit-links and -resolve can't be used together, -resolve replaces symlinks with what they point to")
+	}
+	var annotations []string
+	for kind := range strings.SplitSeq(*annotate, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" || slices.Contains(annotations, kind) {
 			continue
 		}
-		if err := instruction.Execute(); err != nil {
-			return fmt.Errorf("executing: %w", err)
+		if !slices.Contains(annotationKinds, kind) {
+			fatalf(exitUsage, "invalid -annotate %q, expected some of %s", kind, strings.Join(annotationKinds, ", "))
+		}
+		annotations = append(annotations, kind)
+	}
+	for _, command := range annotateCmds {
+		if strings.TrimSpace(command) == "" {
+			fatalf(exitUsage, "-annotate-cmd is empty")
+		}
+		annotations = append(annotations, annotateCmd+command)
+	}
+	if len(annotations) > 0 && (*pairs || fsys != vipaths.OS) {
+		fatalf(exitUsage, "-annotate and -annotate-cmd only work with local paths, and not with -pairs")
+	}
+	if *ids && (*pairs || len(attrs) > 0 || len(annotations) > 0) {
+		fatalf(exitUsage, "-ids doesn't work with -pairs, -mirror, -selinux, -xattr, -annotate, or -annotate-cmd")
+	}
+	lang := userLanguage("LC_CTYPE")
+	if *locale != "" {
+		if lang, err = language.Parse(*locale); err != nil {
+			fatalf(exitUsage, "invalid -locale %q: %v", *locale, err)
+		}
+	}
+	var renamers int
+	for _, set := range []bool{*expr != "", *glob != "", *extMap != "", contentAddr >= 0, *mapCmd != "", *lower, *upper} {
+		if set {
+			renamers++
+		}
+	}
+	var subst *substitution
+	switch {
+	case renamers > 1:
+		fatalf(exitUsage, "only one of -expr, -glob, -ext-map, -content-address, -map-cmd, -lower, and -upper can be used")
+	case (*glob == "") != (*to == ""):
+		fatalf(exitUsage, "-glob and -to must be used together")
+	case *expr != "":
+		if subst, err = parseExpr(*expr, lang); err != nil {
+			fatalf(exitUsage, "invalid -expr: %v", err)
+		}
+	case *glob != "":
+		if subst, err = parseGlob(*glob, *to, lang); err != nil {
+			fatalf(exitUsage, "invalid -glob: %v", err)
+		}
+	case *extMap != "":
+		if subst, err = parseExtMap(*extMap); err != nil {
+			fatalf(exitUsage, "invalid -ext-map: %v", err)
+		}
+	case contentAddr >= 0:
+		if fsys != vipaths.OS {
+			fatalf(exitUsage, "-content-address only works with local paths")
 		}
+		if subst, err = contentAddress(contentAddr); err != nil {
+			fatalf(exitUsage, "invalid -content-address %d: %v", contentAddr, err)
+		}
+	case *mapCmd != "":
+		if fsys != vipaths.OS {
+			fatalf(exitUsage, "-map-cmd only works with local paths")
+		}
+		if subst, err = mapCommand(*mapCmd); err != nil {
+			fatalf(exitUsage, "invalid -map-cmd: %v", err)
+		}
+	case *lower, *upper:
+		subst = caseSubstitution(*upper, lang)
+	}
+	if subst != nil && (*list || *pairs || *loop || *chunk > 0 || len(attrs) > 0) {
+		fatalf(exitUsage, "-expr, -glob, -ext-map, -content-address, -map-cmd, -lower, and -upper don't edit a buffer, so can't be used with -list, -pairs, -loop, -chunk, -selinux, or -xattr")
+	}
+	if *rootDirs && (*pairs || *stripPrefix || *findDupes || subst != nil || len(attrs) > 0 || len(annotations) > 0) {
+		fatalf(exitUsage, "-roots can't be used with -pairs, -strip-prefix, -find-dupes, a renamer without an editor, or columns like -xattr and -annotate")
+	}
+	if *graph != "" && !slices.Contains(graphFormats, *graph) {
+		fatalf(exitUsage, "invalid -graph %q, expected one of %s", *graph, strings.Join(graphFormats, ", "))
+	}
+	if *fsSnapshot && fsys != vipaths.OS {
+		fatalf(exitUsage, "-snapshot only works with local paths")
+	}
+	if *savePlanPath != "" && *loop {
+		fatalf(exitUsage, "-save-plan and -loop can't be used together")
+	}
+	only, err := parseOpRanges(*onlyOps)
+	if err != nil {
+		fatalf(exitUsage, "invalid -only %q: %v", *onlyOps, err)
+	}
+	skip, err := parseOpRanges(*skipOps)
+	if err != nil {
+		fatalf(exitUsage, "invalid -skip %q: %v", *skipOps, err)
+	}
+	if (only != nil || skip != nil || *saveRest != "") && *loop {
+		fatalf(exitUsage, "-only, -skip, and -save-rest can't be used with -loop")
+	}
+	if *targetFS != "" && !slices.Contains(vipaths.TargetFilesystems, *targetFS) {
+		fatalf(exitUsage, "invalid -target-fs %q, expected one of %s", *targetFS, strings.Join(vipaths.TargetFilesystems, ", "))
+	}
+	if *chunk < 0 {
+		fatalf(exitUsage, "-chunk must be positive")
+	}
+	if *opRetries < 0 {
+		fatalf(exitUsage, "-op-retries must be positive")
+	}
+	if *opRetries > 0 && *opTimeout == 0 {
+		fatalf(exitUsage, "-op-retries needs -op-timeout")
+	}
+	if len(paths) > chunkHint && *chunk == 0 {
+		log.Printf("editing %d paths, if your editor struggles try -chunk %d", len(paths), chunkHint)
 	}
 
-	return nil
-}
+	if *editLinks {
+		if paths = symlinks(paths); len(paths) == 0 {
+			fatalf(exitNothingToDo, "no symlinks found")
+		}
+	}
 
-func editPaths(tmp *os.File, editor string, before []string) ([]string, error) {
-	for _, name := range before {
-		tmp.WriteString(name + "\n")
+	var dupes *dupeGroups
+	if *findDupes {
+		if fsys != vipaths.OS {
+			fatalf(exitUsage, "-find-dupes only works with local paths")
+		}
+		if dupes, err = groupDupes(paths); err != nil {
+			fatalf(exitUsage, "finding duplicates: %v", err)
+		}
+		if len(dupes.paths) == 0 {
+			fatalf(exitNothingToDo, "no duplicates found")
+		}
+		paths, notes = dupes.paths, dupes.notes
 	}
 
-	cmd := exec.Command(editor, tmp.Name())
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("running %q: %v", editor, err)
+	if *pick {
+		if paths, err = pickPaths(paths); errors.Is(err, errAborted) {
+			fatalf(exitNothingToDo, "%v", err)
+		}
+		if err != nil {
+			fatalf(exitUsage, "picking paths: %v", err)
+		}
+		if len(paths) == 0 {
+			fatalf(exitNothingToDo, "no paths picked")
+		}
 	}
-	tmp.Seek(0, io.SeekStart)
 
-	var after []string
-	for r := bufio.NewScanner(tmp); r.Scan(); {
-		after = append(after, r.Text())
+	var lock *treeLock
+	if !*noLock && !*dryRun && !*list {
+		root := vipaths.CommonDir(paths)
+		if fsys == vipaths.OS {
+			abs, err := absPaths(paths)
+			if err != nil {
+				fatalf(exitUsage, "finding root: %v", err)
+			}
+			root = vipaths.CommonDir(abs)
+		}
+		if lock, err = lockTree(lockKey, root); err != nil {
+			fatalf(exitUsage, "locking: %v", err)
+		}
 	}
 
-	return after, nil
-}
+	temp, err := newTempFiles(*tmpDir, *shred)
+	if err != nil {
+		fatalf(exitUsage, "creating temp dir: %v", err)
+	}
 
-func parseInstructions(before, after []string) ([]instruction, error) {
-	// make sure we do the deepest operations first
-	depth := func(path string) int { return strings.Count(path, string(filepath.Separator)) }
-	multiSortStable(before, [][]string{after}, func(a, b string) bool {
-		return depth(a) > depth(b)
-	})
+	var runLog *runLog
+	if *logPath != "" {
+		if runLog, err = openRunLog(*logPath); err != nil {
+			fatalf(exitUsage, "%v", err)
+		}
+	}
 
-	var instructions []instruction
-	for i := range before {
-		before := strings.TrimSpace(before[i])
-		after := strings.TrimSpace(after[i])
+	var manifest *manifest
+	if *manifestPath != "" {
+		if manifest, err = openManifest(*manifestPath, fsys); err != nil {
+			fatalf(exitUsage, "%v", err)
+		}
+	}
 
-		var arg string
-		command := func(name string) bool {
-			arg = strings.TrimSpace(strings.TrimPrefix(after, name))
-			return strings.HasPrefix(after, fmt.Sprintf("%s ", name))
+	var audit *auditLog
+	if *auditPath != "" {
+		if audit, err = openAuditLog(*auditPath, startDir, fsys); err != nil {
+			fatalf(exitUsage, "%v", err)
 		}
+	}
 
-		switch {
-		case command("copy"):
-			instructions = append(instructions, copy{from: before, to: arg})
-		case after == "":
-			instructions = append(instructions, remove{name: before})
-		case after != before:
-			instructions = append(instructions, rename{before: before, after: after})
+	opts := options{
+		runLog:         runLog,
+		audit:          audit,
+		manifest:       manifest,
+		tui:            *tui,
+		review:         *review,
+		tree:           *tree,
+		fs:             fsys,
+		temp:           temp,
+		dryRun:         *dryRun,
+		pre:            *preHook,
+		post:           *postHook,
+		postRun:        *postRunHook,
+		postMatch:      postMatch,
+		stripPrefix:    *stripPrefix,
+		roots:          roots,
+		graph:          *graph,
+		fsSnapshot:     *fsSnapshot,
+		porcelain:      *porcelainOut,
+		stdinBuffer:    *stdinBuffer,
+		mark:           *mark,
+		dirMode:        mode,
+		dirOwner:       owner,
+		inheritDirs:    *dirOwner == ownerInherit,
+		refPerms:       refPerms,
+		noMkdir:        *noMkdir,
+		pruneEmpty:     *pruneEmpty,
+		sudo:           *sudo,
+		fsync:          *fsync,
+		opTimeout:      *opTimeout,
+		opRetries:      *opRetries,
+		slowAfter:      *slowAfter,
+		notify:         *notify,
+		copyEngine:     *copyEngine,
+		bandwidth:      bandwidth,
+		copyExclude:    copyExclude,
+		profileDir:     *profileDir,
+		dupes:          dupes,
+		notes:          notes,
+		flags:          setFlags(flag.CommandLine),
+		mirrored:       mirrored,
+		chunk:          *chunk,
+		jobs:           *jobs,
+		onConflict:     *onConflict,
+		savePlan:       *savePlanPath,
+		only:           only,
+		skip:           skip,
+		saveRest:       *saveRest,
+		pairs:          *pairs,
+		ids:            *ids,
+		attrs:          attrs,
+		annotations:    annotations,
+		expr:           subst,
+		list:           *list,
+		confirmRemoves: *confirmDeletes,
+		checkOpen:      *checkOpenFiles,
+		session:        sess,
+		allowed:        allowedOps(*renameOnly, *noRemove, *noCopy),
+		parse: vipaths.ParseOptions{
+			// names from -expr and -glob are taken literally
+			Expand:          !*noExpand && subst == nil,
+			RemoveExtracted: *extractRemove,
+			KeepCompressed:  *compressKeep,
+			Merge:           *merge,
+			LeaveSymlink:    *leaveSymlink,
+			Trash:           *trash,
+			Empty:           *empty,
+			DefaultOp:       *defaultOp,
+			Order:           vipaths.OrderPolicy(*order),
+			TargetFS:        *targetFS,
+			Strict:          *strict,
+			NearCommand: func(err *vipaths.UnknownCommandError) {
+				log.Printf("warning: %s: %q looks like a mistyped %s, renaming to a file named that. -strict makes it an error", vipaths.Quote(err.Path), err.Word, err.Command)
+			},
+			// only changed lines are parsed, so check the filesystem for names in use
+			Taken: func(name string) bool { _, err := fsys.Stat(name); return err == nil },
+		},
+	}
+	vipaths.QuoteExpandable = opts.parse.Expand
+	var watch *watcher
+	if *watchDir != "" {
+		if watch, err = newWatcher(*watchDir, ignores); err != nil {
+			fatalf(exitUsage, "watching %s: %v", *watchDir, err)
+		}
+		log.Printf("watching %s for new paths", *watchDir)
+	}
+	var passes int
+	for {
+		if watch != nil {
+			if paths, err = watch.wait(*watchInterval); err != nil || paths == nil {
+				break
+			}
+		}
+		var plan vipaths.Plan
+		plan, err = run(paths, editor, opts)
+		if watch != nil {
+			// a batch which fails is reported, and the watch goes on, unless
+			// an operation left running could still change its paths
+			watch.done(paths, plan)
+			if errors.Is(err, vipaths.ErrAbandoned) {
+				break
+			}
+			if err != nil {
+				log.Printf("%v", err)
+			}
+			opts.dupes, opts.notes = nil, nil
+			continue
+		}
+		if err != nil || !*loop {
+			break
+		}
+		passes++
+		paths = relist(fsys, paths, plan)
+		if len(paths) == 0 {
+			break
 		}
+		// groups and notes only apply to the first pass
+		opts.dupes, opts.notes = nil, nil
+	}
+	if passes > 0 && errors.Is(err, errNothingToDo) {
+		err = nil
+	}
+	if sess != nil {
+		err = sess.finish(err)
+	}
+	if *restore && !*dryRun {
+		// forget what was put back, and its .trashinfo file
+		if _, perr := pruneTrashRecord(); perr != nil {
+			log.Printf("warning: updating trash record: %v", perr)
+		}
+	}
+	runLog.close()
+	audit.close()
+	if cerr := manifest.close(); cerr != nil && err == nil {
+		err = fmt.Errorf("closing manifest: %w", cerr)
+	}
+	closer.Close()
+	lock.release()
+	if errors.Is(err, errNothingToDo) {
+		fatalf(exitNothingToDo, "%v", err)
 	}
+	if err != nil {
+		code := exitUsage
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		}
+		fatalf(code, "running: %v", err)
+	}
+}
 
-	return instructions, nil
+type options struct {
+	fs        vipaths.FS
+	temp      tempFiles
+	dryRun    bool
+	pre, post string
+	postRun   string
+	// postMatch are hooks run after renames and copies onto matching
+	// destinations
+	postMatch []matchHook
+	// stripPrefix shows paths relative to their common directory
+	stripPrefix bool
+	runLog      *runLog
+	manifest    *manifest
+	// audit, if set, is appended every operation run, for -audit
+	audit       *auditLog
+	tui         bool
+	review      bool
+	dirMode     fs.FileMode
+	dirOwner    *vipaths.Owner
+	inheritDirs bool
+	noMkdir     bool
+	parse       vipaths.ParseOptions
+	// dupes, if set, groups the paths and notes their originals for dedup
+	dupes *dupeGroups
+	// notes are comments shown before the path with the same index
+	notes map[int]string
+	// lines are the changed lines of the buffer, for errors to point to
+	lines bufferLines
+	// flags are the flags which were set, shown in the buffer's header
+	flags []string
+	// mirrored, if set, are the destination sides of the pairs for -mirror
+	mirrored map[string]string
+	// chunk, if set, edits the paths in sessions of this many lines
+	chunk int
+	jobs  int
+	// onConflict is a conflict resolution, or ask to prompt
+	onConflict string
+	// confirmRemoves asks before running any removes
+	confirmRemoves bool
+	// checkOpen, if set, warns or asks about renaming or removing paths open
+	// in other processes
+	checkOpen string
+	// session, if set, saves the buffer for resuming an interrupted edit
+	session *editSession
+	// allowed, if set, reports whether an operation like "copy" may run
+	allowed func(op string) bool
+	// list prints the buffer rather than editing it
+	list bool
+	// pairs edits lines of source<TAB>destination
+	pairs bool
+	// ids ends each line with its path's #id, matching lines to paths by it
+	ids bool
+	// attrs are extended attributes edited in columns after each path
+	attrs []string
+	// annotations are read-only columns shown after the attributes
+	annotations []string
+	// expr, if set, renames with a substitution from -expr or -glob instead
+	// of an editor
+	expr *substitution
+	// savePlan, if set, is a file to write the plan to instead of running it
+	savePlan string
+	// only and skip pick operations to run by number
+	only, skip opRanges
+	// saveRest, if set, is a file to write operations left out to
+	saveRest string
+	// skipDone skips operations which look like they've already run
+	skipDone bool
+	// pruneEmpty removes directories left empty by renames after running
+	pruneEmpty bool
+	// sudo retries operations denied permission with sudo without asking
+	sudo bool
+	// fsync flushes copies and renames to disk after each
+	fsync bool
+	// opTimeout, if set, cancels operations which run longer, trying them
+	// again opRetries times
+	opTimeout time.Duration
+	opRetries int
+	// slowAfter, if set, warns about operations which run longer
+	slowAfter time.Duration
+	// notify sends a desktop notification once the plan has run
+	notify bool
+	// copyEngine is how copies are made, one of vipaths.CopyEngines
+	copyEngine string
+	// bandwidth, if above 0, limits copies to this many bytes a second
+	bandwidth int64
+	// copyExclude are patterns for rsync to skip inside copied directories
+	copyExclude []string
+	// profileDir, if set, is where profiles of running the plan are written
+	profileDir string
+	// tree prints the layout left by the plan and asks before running it
+	tree bool
+	// roots, if set, are directories to group the paths under, shown
+	// relative to them
+	roots []string
+	// graph, if set, is the format to print the plan's order in instead of
+	// running it
+	graph string
+	// fsSnapshot snapshots the filesystems the plan changes before running it
+	fsSnapshot bool
+	// porcelain writes the outcome of each operation to stdout when the run
+	// ends, for scripts
+	porcelain bool
+	// stdinBuffer reads the edited buffer from stdin rather than an editor
+	stdinBuffer bool
+	// mark prints the paths of lines marked with a leading `!` rather than
+	// running anything
+	mark bool
+	// refPerms is the reference file or directory whose owner and mode copies
+	// and created directories get
+	refPerms fs.FileInfo
 }
 
-type instruction interface {
-	String() string
-	Execute() error
+// run edits the paths and executes the resulting plan, returning the plan
+func run(before []string, editor []string, opts options) (vipaths.Plan, error) {
+	var err error
+	var prefix string
+	comments := headerComments(before, opts)
+	if opts.parse.Empty == vipaths.EmptyDelete {
+		comments = append(comments, "clear a line to remove it")
+	}
+	if opts.parse.DefaultOp == vipaths.DefaultCopy {
+		comments = append(comments, "a line edited to a new path is copied there, keeping the original")
+	}
+	if opts.ids {
+		comments = append(comments, "lines are matched to paths by the #id at their end, so they can be sorted or moved, but keep the ids")
+	}
+	// remember the sources as they were before editing, to notice files
+	// another process moves or changes in the meantime
+	var snapshot vipaths.Snapshot
+	if opts.fs == vipaths.OS {
+		snapshot = vipaths.TakeSnapshot(opts.fs, before)
+	}
+	var columns [][]string
+	if len(opts.attrs) > 0 {
+		if columns, err = readAttrs(before, opts.attrs); err != nil {
+			return nil, err
+		}
+		if slices.Equal(opts.attrs, []string{linkAttr}) {
+			comments = append(comments, "after each symlink, separated by a tab: its target. edit it to point the link there instead")
+		} else {
+			comments = append(comments, "after each path, separated by tabs: "+strings.Join(opts.attrs, ", ")+". edit a value to set it, or clear it to remove it")
+		}
+	}
+	if len(opts.annotations) > 0 {
+		annotations := readAnnotations(before, opts.annotations)
+		if columns == nil {
+			columns = make([][]string, len(before))
+		}
+		for i := range columns {
+			columns[i] = append(columns[i], annotations[i]...)
+		}
+		if len(opts.attrs) > 0 {
+			comments = append(comments, "then read-only: "+strings.Join(opts.annotations, ", ")+". edits to these are ignored")
+		} else {
+			comments = append(comments, "after each path, separated by tabs, read-only: "+strings.Join(opts.annotations, ", ")+". edits to these are ignored")
+		}
+	}
+	if opts.stripPrefix {
+		prefix = vipaths.CommonDir(before)
+		if before, err = vipaths.Rel(prefix, before); err != nil {
+			return nil, fmt.Errorf("stripping prefix: %w", err)
+		}
+		comments = append(comments, "relative to "+vipaths.Quote(prefix))
+		if taken := opts.parse.Taken; taken != nil {
+			opts.parse.Taken = func(name string) bool { return taken(filepath.Join(prefix, name)) }
+		}
+	}
+
+	// paths under each root are shown relative to it, after a comment naming it
+	var rootOf []string
+	if opts.roots != nil {
+		if before, rootOf, opts.notes, err = groupRoots(opts.roots, before); err != nil {
+			return nil, err
+		}
+		comments = append(comments, "paths are relative to the root in the comment above them, and so are new directories")
+	}
+
+	if opts.dupes != nil {
+		opts.parse.Duplicates = map[string]string{}
+		for i, orig := range opts.dupes.original {
+			if i != orig {
+				opts.parse.Duplicates[before[i]] = before[orig]
+			}
+		}
+	}
+
+	var changedBefore, changedAfter []string
+	var editedAttrs map[string][]string
+	var changes vipaths.Changes
+	var lines bufferLines
+	if opts.expr != nil {
+		if changedBefore, changedAfter, err = exprChanges(opts.fs, opts.expr, prefix, before); err != nil {
+			return nil, &exitError{exitInvalidPlan, err}
+		}
+	} else {
+		if changes, err = editChunks(editor, opts, before, columns, comments); err != nil {
+			return nil, err
+		}
+		changedBefore, changedAfter, editedAttrs = changes.Before, changes.After, changes.Edited
+		if rootOf != nil {
+			lines = newBufferLines("", joinRoots(changes, rootOf))
+		} else {
+			lines = newBufferLines(prefix, changes)
+		}
+	}
+	if opts.list {
+		return nil, nil
+	}
+	if opts.mark {
+		if rootOf != nil {
+			changes, prefix = joinRoots(changes, rootOf), ""
+		}
+		marked := markedPaths(prefix, changes)
+		if len(marked) == 0 {
+			return nil, errNothingToDo
+		}
+		for _, path := range marked {
+			fmt.Println(vipaths.Quote(path))
+		}
+		return nil, nil
+	}
+	// only the attributes can be edited, not the annotations after them
+	if len(opts.annotations) > 0 {
+		for i, path := range before {
+			values, ok := editedAttrs[path]
+			if !ok {
+				continue
+			}
+			values = values[:len(opts.attrs)]
+			if slices.Equal(values, columns[i][:len(opts.attrs)]) {
+				delete(editedAttrs, path)
+			} else {
+				editedAttrs[path] = values
+			}
+		}
+	}
+	if len(changedBefore) == 0 && len(editedAttrs) == 0 {
+		return nil, errNothingToDo
+	}
+
+	var plan vipaths.Plan
+	if rootOf != nil {
+		plan, err = parseRoots(changes, rootOf, lines, opts.parse)
+	} else {
+		plan, err = parseLines(changedBefore, changedAfter, prefix, lines, opts.parse)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// set attributes first, while the paths still have their original names
+	if len(editedAttrs) > 0 {
+		attrPlan, err := attrInstructions(before, columns, editedAttrs, opts.attrs)
+		if err != nil {
+			return nil, &exitError{exitInvalidPlan, err}
+		}
+		plan = append(attrPlan, plan...)
+	}
+	plan = plan.Join(prefix)
+	listed := make([]string, 0, len(before))
+	for i, path := range before {
+		dir := prefix
+		if rootOf != nil {
+			dir = rootOf[i]
+		}
+		listed = append(listed, filepath.Join(dir, path))
+	}
+	changed := make([]string, 0, len(changedBefore))
+	if rootOf != nil {
+		changed = joinRoots(changes, rootOf).Before
+	} else {
+		for _, path := range changedBefore {
+			if path != "" {
+				changed = append(changed, filepath.Join(prefix, path))
+			}
+		}
+	}
+	if err := plan.CheckKept(listed, changed); err != nil {
+		var kept *vipaths.KeptError
+		errors.As(err, &kept)
+		return nil, &exitError{exitInvalidPlan, lines.at(kept.Src, fmt.Errorf("%w. move or remove it on its own line first", err))}
+	}
+	if err := plan.CheckAllowed(opts.allowed); err != nil {
+		return nil, &exitError{exitInvalidPlan, err}
+	}
+	if opts.fs == vipaths.OS {
+		if err := plan.CheckLengths(); err != nil {
+			return nil, &exitError{exitInvalidPlan, fmt.Errorf("checking lengths:\n%w", err)}
+		}
+		if err := plan.CheckDevices(); err != nil {
+			return nil, &exitError{exitInvalidPlan, fmt.Errorf("checking filesystems:\n%w", err)}
+		}
+		if err := plan.CheckSpace(); err != nil {
+			return nil, &exitError{exitInvalidPlan, fmt.Errorf("checking free space:\n%w", err)}
+		}
+		if err := plan.CheckPermissions(); err != nil {
+			// with sudo, denied operations can still be retried as they run
+			if !sudoAvailable() {
+				return nil, &exitError{exitInvalidPlan, fmt.Errorf("checking permissions:\n%w", err)}
+			}
+			log.Printf("some operations will be denied without sudo:\n%v", err)
+		}
+		checkLanding(plan, listed)
+	}
+	if len(plan) == 0 {
+		return nil, errNothingToDo
+	}
+	// operations left out by -only, -skip, or a review, for -save-rest
+	var rest, skipped vipaths.Plan
+	if plan, rest, err = selectOps(plan, opts.only, opts.skip); err != nil {
+		return nil, &exitError{exitUsage, err}
+	}
+	if opts.review && len(plan) > 0 {
+		if plan, skipped, err = reviewPlanInEditor(plan, editor, opts.temp); err != nil {
+			return nil, err
+		}
+		rest = append(rest, skipped...)
+	}
+	if opts.tui && len(plan) > 0 {
+		if plan, skipped, err = reviewPlan(plan); err != nil {
+			return nil, err
+		}
+		rest = append(rest, skipped...)
+	}
+	if opts.saveRest != "" && len(rest) > 0 {
+		if err := savePlan(opts.saveRest, rest, opts.fs); err != nil {
+			return nil, fmt.Errorf("saving rest of plan: %w", err)
+		}
+		log.Printf("saved %d remaining operations to %s", len(rest), opts.saveRest)
+	}
+	if len(plan) == 0 {
+		return nil, errNothingToDo
+	}
+	if opts.savePlan != "" {
+		if err := savePlan(opts.savePlan, plan, opts.fs); err != nil {
+			return nil, fmt.Errorf("saving plan: %w", err)
+		}
+		log.Printf("saved %d operations to %s", len(plan), opts.savePlan)
+		return nil, nil
+	}
+	if opts.graph != "" {
+		if err := writeDot(os.Stdout, plan); err != nil {
+			return nil, fmt.Errorf("writing graph: %w", err)
+		}
+		return nil, nil
+	}
+	if opts.tree {
+		if !confirmTree(planLayout(listed, plan), len(plan), opts.dryRun) {
+			log.Printf("not running")
+			return nil, errNothingToDo
+		}
+	}
+	if opts.confirmRemoves && !opts.dryRun {
+		if plan = confirmRemoves(plan); len(plan) == 0 {
+			return nil, errNothingToDo
+		}
+	}
+	if opts.checkOpen != "" && !opts.dryRun && opts.fs == vipaths.OS {
+		if err := checkOpen(plan, opts.checkOpen); errors.Is(err, errOpenDeclined) {
+			log.Printf("not running, %v", err)
+			return nil, errNothingToDo
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	// snapshots last, so only a plan which is really going to run gets one
+	if opts.fsSnapshot {
+		snaps, err := planSnapshots(plan)
+		if err != nil {
+			return nil, &exitError{exitInvalidPlan, fmt.Errorf("-snapshot: %w", err)}
+		}
+		if err := takeSnapshots(snaps, opts.dryRun); err != nil {
+			return nil, &exitError{exitExecution, err}
+		}
+	}
+	opts.lines = lines
+	if err := executePlan(plan, snapshot, opts); err != nil {
+		return nil, err
+	}
+	return plan, nil
 }
 
-type rename struct{ before, after string }
+// executePlan runs the plan, logging and running hooks for each operation
+func executePlan(plan vipaths.Plan, snapshot vipaths.Snapshot, opts options) (err error) {
+	for _, inst := range plan {
+		opts.runLog.instruction("planned", inst, opts.dryRun, nil)
+	}
+
+	var stats vipaths.Stats
+	defer printStats(&stats, opts.dryRun)
+	// statuses of each operation by its index in the plan, since with -jobs
+	// they finish out of order
+	results := newPorcelain(plan)
+	if opts.porcelain {
+		defer func() {
+			if werr := results.write(os.Stdout); werr != nil && err == nil {
+				err = &exitError{exitExecution, fmt.Errorf("writing results: %w", werr)}
+			}
+		}()
+	}
+	if opts.notify && !opts.dryRun {
+		start := time.Now()
+		defer func() { notifyDone(&stats, len(plan), time.Since(start), err) }()
+	}
 
-func (n rename) String() string { return fmt.Sprintf("rename %s\n    -> %s", n.before, n.after) }
-func (n rename) Execute() error {
-	if err := os.MkdirAll(filepath.Dir(n.after), 0755); err != nil {
-		return fmt.Errorf("exe mkdirall: %w", err)
+	var prompter conflictPrompter
+	execOpts := vipaths.Options{
+		FS:             opts.fs,
+		DryRun:         opts.dryRun,
+		Stats:          &stats,
+		DirMode:        opts.dirMode,
+		DirOwner:       opts.dirOwner,
+		InheritDirs:    opts.inheritDirs,
+		RefPerms:       opts.refPerms,
+		Fsync:          opts.fsync,
+		Timeout:        opts.opTimeout,
+		Retries:        opts.opRetries,
+		SlowAfter:      opts.slowAfter,
+		CopyEngine:     opts.copyEngine,
+		BandwidthLimit: opts.bandwidth,
+		CopyExclude:    opts.copyExclude,
+		NoMkdir:        opts.noMkdir,
+		Jobs:           opts.jobs,
+		Snapshot:       snapshot,
+		OnSpecial: func(_ vipaths.Instruction, path string, err error) {
+			log.Printf("warning: not copying %s: %v", vipaths.Quote(path), err)
+		},
+		OnTrash: func(_ vipaths.Instruction, entry vipaths.TrashEntry) {
+			if err := recordTrashed(entry); err != nil {
+				log.Printf("warning: recording %s in the trash for -restore: %v", vipaths.Quote(entry.Path), err)
+			}
+		},
+		OnSlow: func(inst vipaths.Instruction, elapsed time.Duration) {
+			src, _ := inst.Paths()
+			log.Printf("warning: %s %s still running after %s", vipaths.OpName(inst), vipaths.Quote(src), elapsed)
+		},
+		OnRetry: func(inst vipaths.Instruction, attempt int, err error) {
+			src, _ := inst.Paths()
+			log.Printf("warning: %s %s %v, trying again (%d of %d)", vipaths.OpName(inst), vipaths.Quote(src), err, attempt, opts.opRetries)
+		},
+		OnConflict: func(inst vipaths.Instruction, dst string) string {
+			resolution := opts.onConflict
+			if resolution == conflictAsk {
+				resolution = prompter.resolve(dst)
+			}
+			if resolution == vipaths.ConflictSkip {
+				opts.runLog.instruction("skipped", inst, opts.dryRun, nil)
+			}
+			return resolution
+		},
+		Pre: func(inst vipaths.Instruction) error {
+			log.Printf("%s", inst)
+			src, dst := inst.Paths()
+			return runHook(opts.pre, src, dst, opts.dryRun)
+		},
+		Progress: func(e vipaths.ProgressEvent) {
+			switch {
+			case e.Kind == vipaths.ProgressDone && opts.dryRun:
+				results.set(e.Index, porcelainDryRun)
+			case e.Kind == vipaths.ProgressDone:
+				results.set(e.Index, porcelainDone)
+			case e.Kind == vipaths.ProgressSkipped:
+				results.set(e.Index, porcelainSkipped)
+			case e.Kind == vipaths.ProgressError:
+				results.set(e.Index, porcelainFailed)
+			}
+		},
+		Post: func(inst vipaths.Instruction) error {
+			opts.runLog.instruction("executed", inst, opts.dryRun, nil)
+			if !opts.dryRun {
+				if err := opts.manifest.record(inst); err != nil {
+					return err
+				}
+				if err := opts.audit.record(inst, nil); err != nil {
+					return err
+				}
+			}
+			if err := runMatchHooks(opts.postMatch, inst, opts.dryRun); err != nil {
+				return err
+			}
+			src, dst := inst.Paths()
+			return runHook(opts.post, src, dst, opts.dryRun)
+		},
+	}
+	if opts.fs == vipaths.OS && sudoAvailable() {
+		retrier := &sudoRetrier{always: opts.sudo, tmpDir: opts.temp.dir, onConflict: opts.onConflict}
+		execOpts.OnDenied = retrier.retry
+	}
+	if opts.pruneEmpty {
+		execOpts.PruneEmpty = func(dir string) {
+			log.Printf("pruned empty directory %s", vipaths.Quote(dir))
+		}
+	}
+	if opts.skipDone {
+		execOpts.SkipDone = func(inst vipaths.Instruction) {
+			log.Printf("already done: %s", inst)
+			opts.runLog.instruction("skipped", inst, opts.dryRun, nil)
+		}
+	}
+	if opts.profileDir != "" {
+		stop, err := startProfile(opts.profileDir)
+		if err != nil {
+			return fmt.Errorf("starting profile: %w", err)
+		}
+		defer func() {
+			if err := stop(); err != nil {
+				log.Printf("writing profile: %v", err)
+			}
+		}()
+	}
+	// the first interrupt stops the running operation cleanly, removing a
+	// partial copy, and the next kills as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	defer stop()
+	if err := vipaths.ExecuteContext(ctx, plan, execOpts); err != nil {
+		failed := results.failed()
+		if failed >= 0 {
+			results.set(failed, porcelainFailed)
+			opts.runLog.instruction("failed", plan[failed], opts.dryRun, err)
+			if !opts.dryRun {
+				if aerr := opts.audit.record(plan[failed], err); aerr != nil {
+					log.Printf("%v", aerr)
+				}
+			}
+		}
+		if errors.Is(err, context.Canceled) {
+			err = fmt.Errorf("interrupted after %d of %d operations", results.finished(), len(plan))
+		} else if failed >= 0 {
+			if src, _ := plan[failed].Paths(); src != "" {
+				err = opts.lines.at(filepath.Clean(src), err)
+			}
+		}
+		return &exitError{exitExecution, err}
 	}
-	if err := os.Rename(n.before, n.after); err != nil {
-		return fmt.Errorf("exe rename: %w", err)
+	if err := runHook(opts.postRun, "", "", opts.dryRun); err != nil {
+		return &exitError{exitExecution, fmt.Errorf("running post run hook: %w", err)}
 	}
 	return nil
 }
 
-type remove struct{ name string }
+// printStats prints a summary of operations by type, bytes affected, total time,
+// latency percentiles of each type, and the slowest operations
+func printStats(stats *vipaths.Stats, dryRun bool) {
+	if len(stats.Counts) == 0 {
+		return
+	}
+	var ops []string
+	for op := range stats.Counts {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
 
-func (v remove) String() string { return fmt.Sprintf("remove %s", v.name) }
-func (v remove) Execute() error {
-	if err := os.RemoveAll(v.name); err != nil {
-		return fmt.Errorf("exe remove all: %w", err)
+	var counts, sizes []string
+	for _, op := range ops {
+		counts = append(counts, fmt.Sprintf("%d %s", stats.Counts[op], op))
+		if b := stats.Bytes[op]; b > 0 {
+			sizes = append(sizes, fmt.Sprintf("%s %s", op, vipaths.FormatBytes(b)))
+		}
+	}
+	verb := "done"
+	if dryRun {
+		verb = "would run"
+	}
+	log.Printf("%s: %s in %s", verb, strings.Join(counts, ", "), stats.Elapsed.Round(time.Millisecond))
+	if len(sizes) > 0 {
+		log.Printf("  %s", strings.Join(sizes, ", "))
+	}
+	const slowest = 3
+	if dryRun || len(stats.Timings) <= slowest {
+		return
+	}
+	// percentiles of a handful of operations say nothing the slowest don't
+	const percentileMin = 10
+	for _, op := range ops {
+		if stats.Counts[op] < percentileMin {
+			continue
+		}
+		log.Printf("  %s latency: p50 %s, p90 %s, p99 %s", op,
+			stats.Percentile(op, 0.5).Round(time.Microsecond), stats.Percentile(op, 0.9).Round(time.Microsecond), stats.Percentile(op, 0.99).Round(time.Microsecond))
+	}
+	log.Printf("  slowest:")
+	for _, t := range stats.Timings[:slowest] {
+		src, _ := t.Instruction.Paths()
+		log.Printf("    %s %s %s", t.Duration.Round(time.Millisecond), vipaths.OpName(t.Instruction), vipaths.Quote(src))
+	}
+}
+
+// runHook runs a user provided shell command, substituting {src} and {dst}
+// with shell quoted paths
+func runHook(hook string, src, dst string, dryRun bool) error {
+	if hook == "" {
+		return nil
+	}
+	command := strings.NewReplacer("{src}", vipaths.ShellQuote(src), "{dst}", vipaths.ShellQuote(dst)).Replace(hook)
+	log.Printf("hook %s", command)
+	if dryRun {
+		return nil
+	}
+	cmd := vipaths.ShellCommand(command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %q: %w", command, err)
 	}
 	return nil
 }
 
-type copy struct{ from, to string }
+// editChunks edits the paths in before, in chunks if asked, returning the
+// changed lines and their paths, and the paths whose attributes were edited.
+// every chunk's changes are parsed together at the end so that operations are
+// still ordered across chunks. unchanged lines aren't kept, the plan only
+// needs the changes
+func editChunks(editor []string, opts options, before []string, columns [][]string, comments []string) (vipaths.Changes, error) {
+	size := len(before)
+	if opts.chunk > 0 {
+		size = opts.chunk
+	}
+	changes := vipaths.Changes{Edited: map[string][]string{}}
+	for start := 0; start < len(before); start += size {
+		end := min(start+size, len(before))
+		var chunkColumns [][]string
+		if columns != nil {
+			chunkColumns = columns[start:end]
+		}
+		chunkComments := comments
+		chunkNotes := map[int]string{}
+		for i, note := range opts.notes {
+			if i >= start && i < end {
+				chunkNotes[i-start] = note
+			}
+		}
+		if size < len(before) {
+			chunkComments = append(chunkComments[:len(chunkComments):len(chunkComments)],
+				fmt.Sprintf("part %d of %d", start/size+1, (len(before)+size-1)/size))
+		}
+		if opts.list {
+			if err := writeBuffer(os.Stdout, opts, before[start:end], chunkColumns, chunkNotes, chunkComments); err != nil {
+				return vipaths.Changes{}, err
+			}
+			continue
+		}
+		part, err := editPaths(editor, opts, before[start:end], chunkColumns, chunkNotes, chunkComments)
+		if errors.Is(err, vipaths.ErrLineCount) || errors.Is(err, vipaths.ErrIDMismatch) {
+			if size < len(before) {
+				err = fmt.Errorf("part %d: %w", start/size+1, err)
+			}
+			return vipaths.Changes{}, &exitError{exitInvalidPlan, fmt.Errorf("parse instructions: %w", err)}
+		}
+		if err != nil {
+			return vipaths.Changes{}, fmt.Errorf("editing paths: %w", err)
+		}
+		changes.Before = append(changes.Before, part.Before...)
+		changes.After = append(changes.After, part.After...)
+		changes.Lines = append(changes.Lines, part.Lines...)
+		for _, i := range part.Index {
+			changes.Index = append(changes.Index, start+i)
+		}
+		maps.Copy(changes.Edited, part.Edited)
+	}
+	return changes, nil
+}
 
-func (c copy) String() string { return fmt.Sprintf("copy %s\n  -> %s", c.from, c.to) }
-func (c copy) Execute() error {
-	stat, err := os.Stat(c.from)
+// parseLines parses the changed lines of paths relative to prefix, pointing
+// any error to the line it's on
+func parseLines(changedBefore, changedAfter []string, prefix string, lines bufferLines, opts vipaths.ParseOptions) (vipaths.Plan, error) {
+	plan, err := vipaths.Parse(changedBefore, changedAfter, opts)
+	if errors.Is(err, vipaths.ErrEmptyLine) {
+		err = fmt.Errorf("%w, change it to rm to remove it", err)
+	}
+	var parseErr *vipaths.ParseError
+	var protectedErr *vipaths.ProtectedError
+	var caseErr *vipaths.CaseConflictError
+	var dupErr *vipaths.DuplicateError
+	switch {
+	case errors.As(err, &parseErr) && parseErr.Path == "":
+		err = lines.at(parseErr.Line, err)
+	case errors.As(err, &parseErr):
+		err = lines.at(filepath.Join(prefix, parseErr.Path), err)
+	case errors.As(err, &protectedErr):
+		err = lines.at(filepath.Join(prefix, protectedErr.Path), err)
+	case errors.As(err, &caseErr):
+		err = lines.at(filepath.Join(prefix, caseErr.Src), err)
+	case errors.As(err, &dupErr):
+		err = lines.at(filepath.Join(prefix, dupErr.Src), err)
+	}
 	if err != nil {
-		return fmt.Errorf("exe stat: %w", err)
+		return nil, &exitError{exitInvalidPlan, fmt.Errorf("parse instructions: %w", err)}
 	}
-	if stat.IsDir() {
-		if err := os.MkdirAll(c.to, stat.Mode()); err != nil {
-			return fmt.Errorf("exe mkdirall: %w", err)
+	return plan, nil
+}
+
+// writeBuffer writes the buffer for the paths as it's handed to the editor.
+// columns, if set, are the paths' attributes
+func writeBuffer(w io.Writer, opts options, paths []string, columns [][]string, notes map[int]string, comments []string) error {
+	switch {
+	case opts.mirrored != nil:
+		dsts := make([]string, len(paths))
+		for i, path := range paths {
+			dsts[i] = opts.mirrored[path]
 		}
-		return nil
+		return vipaths.WriteMappedPairs(w, paths, dsts, notes, comments...)
+	case opts.ids:
+		return vipaths.WriteTaggedBuffer(w, paths, notes, comments...)
+	case opts.pairs:
+		return vipaths.WritePairs(w, paths, notes, comments...)
+	case columns != nil:
+		return vipaths.WriteColumns(w, paths, columns, notes, comments...)
+	}
+	return vipaths.WriteAnnotatedBuffer(w, paths, notes, comments...)
+}
+
+// editPaths edits a buffer of the paths in before, returning the changed lines
+// and their paths, and the paths whose attributes were edited
+func editPaths(editor []string, opts options, before []string, columns [][]string, notes map[int]string, comments []string) (vipaths.Changes, error) {
+	if opts.stdinBuffer {
+		return readEdited(os.Stdin, opts, before, columns)
 	}
-	parentStat, err := os.Stat(filepath.Dir(c.from))
+	tmp, err := opts.temp.create(program + "-*" + vipaths.BufferExt)
 	if err != nil {
-		return fmt.Errorf("exe stat: %w", err)
+		return vipaths.Changes{}, fmt.Errorf("creating temp file: %w", err)
+	}
+	defer opts.temp.remove(tmp.Name())
+	defer tmp.Close()
+
+	var resumed bool
+	if opts.session != nil {
+		var buffer string
+		if buffer, resumed, err = opts.session.resume(before); err != nil {
+			return vipaths.Changes{}, err
+		}
+		if resumed {
+			log.Printf("resuming session %s", opts.session.path)
+			if _, err := io.WriteString(tmp, buffer); err != nil {
+				return vipaths.Changes{}, fmt.Errorf("writing temp file: %w", err)
+			}
+		}
+	}
+	if !resumed {
+		if err := writeBuffer(tmp, opts, before, columns, notes, comments); err != nil {
+			return vipaths.Changes{}, err
+		}
 	}
-	if err := os.MkdirAll(filepath.Dir(c.to), parentStat.Mode()); err != nil {
-		return fmt.Errorf("exe mkdirall: %w", err)
+	if err := tmp.Close(); err != nil {
+		return vipaths.Changes{}, fmt.Errorf("closing temp file: %w", err)
+	}
+	err = runEditor(editor, tmp.Name())
+	if opts.session != nil {
+		if serr := saveSession(opts.session, before, tmp.Name()); serr != nil {
+			return vipaths.Changes{}, fmt.Errorf("saving session: %w", serr)
+		}
+		opts.session.keep = err != nil
 	}
-	input, err := os.ReadFile(c.from)
 	if err != nil {
-		return fmt.Errorf("exe read: %w", err)
+		return vipaths.Changes{}, err
 	}
-	if err := os.WriteFile(c.to, input, stat.Mode()); err != nil {
-		return fmt.Errorf("exe write: %w", err)
+
+	// open by name again, since some editors replace the file rather than write to it
+	edited, err := os.Open(tmp.Name())
+	if err != nil {
+		return vipaths.Changes{}, fmt.Errorf("opening edited temp file: %w", err)
+	}
+	defer edited.Close()
+	return readEdited(edited, opts, before, columns)
+}
+
+// readEdited reads the changes from an edited buffer of before
+func readEdited(edited io.Reader, opts options, before []string, columns [][]string) (vipaths.Changes, error) {
+	if opts.pairs {
+		lines, err := vipaths.ReadBuffer(edited)
+		if err != nil {
+			return vipaths.Changes{}, err
+		}
+		changedBefore, changedAfter, err := vipaths.ParsePairs(lines, opts.parse)
+		if err != nil {
+			return vipaths.Changes{}, &exitError{exitInvalidPlan, fmt.Errorf("parse pairs: %w", err)}
+		}
+		return vipaths.Changes{Before: changedBefore, After: changedAfter}, nil
+	}
+	if opts.ids {
+		return vipaths.ReadTaggedChanges(edited, before)
+	}
+	return vipaths.ReadBufferChanges(edited, before, columns)
+}
+
+// runEditor edits the file at name
+func runEditor(editor []string, name string) error {
+	if len(editor) == 0 {
+		return lineEdit(name)
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], name)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %q: %v", editor[0], err)
 	}
 	return nil
 }
 
-type multiSortable[T any] struct {
-	data  []T
-	extra [][]T
-	less  func(a, b T) bool
+// chunkHint is the number of paths above which -chunk is suggested
+const chunkHint = 50_000
+
+// relist returns the paths which exist after executing the plan, each
+// followed by any new destinations it was copied or moved to
+func relist(fsys vipaths.FS, paths []string, plan vipaths.Plan) []string {
+	dsts := map[string][]string{}
+	for _, inst := range plan {
+		// skip destinations which are just the source's directory, like for
+		// extracting in place
+		if src, dst := inst.Paths(); dst != "" && dst != filepath.Dir(src) {
+			dsts[src] = append(dsts[src], dst)
+		}
+	}
+	seen := map[string]bool{}
+	var updated []string
+	add := func(path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		if _, err := fsys.Stat(path); err == nil {
+			updated = append(updated, path)
+		}
+	}
+	for _, path := range paths {
+		add(path)
+		for _, dst := range dsts[path] {
+			add(dst)
+		}
+	}
+	return updated
+}
+
+func absPaths(paths []string) ([]string, error) {
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		a, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		abs = append(abs, a)
+	}
+	return abs, nil
 }
 
-func (m *multiSortable[T]) Len() int           { return len(m.data) }
-func (m *multiSortable[T]) Less(i, j int) bool { return m.less(m.data[i], m.data[j]) }
-func (m *multiSortable[T]) Swap(i, j int) {
-	for _, d := range append([][]T{m.data}, m.extra...) {
-		d[i], d[j] = d[j], d[i]
+// resolvePaths replaces each path with the absolute path of the file it
+// refers to, following symlinks. paths which are the same file as an earlier
+// one, through another symlink or a hard link, are dropped, so that no file
+// can be given two conflicting lines
+func resolvePaths(paths []string) ([]string, error) {
+	type file struct {
+		path string
+		stat fs.FileInfo
 	}
+	bySize := map[int64][]file{}
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, err
+		}
+		if real, err = filepath.Abs(real); err != nil {
+			return nil, err
+		}
+		stat, err := os.Stat(real)
+		if err != nil {
+			return nil, err
+		}
+		same := slices.IndexFunc(bySize[stat.Size()], func(f file) bool { return os.SameFile(f.stat, stat) })
+		if same >= 0 {
+			log.Printf("skipping %s, the same file as %s", vipaths.Quote(path), vipaths.Quote(bySize[stat.Size()][same].path))
+			continue
+		}
+		bySize[stat.Size()] = append(bySize[stat.Size()], file{real, stat})
+		resolved = append(resolved, real)
+	}
+	return resolved, nil
 }
 
-func multiSortStable[T any](data []T, extra [][]T, less func(a, b T) bool) {
-	sort.Stable(&multiSortable[T]{data, extra, less})
+func relPaths(paths []string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	abs, err := absPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	return vipaths.Rel(wd, abs)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// splitArgs splits a command line into words, respecting single and double
+// quotes and backslash escapes, so that editors like `code --wait` work. on
+// windows backslashes are path separators, not escapes
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	var inWord bool
+	var quote rune
+	var escaped bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'' && os.PathSeparator != '\\':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests in the copy of the test binary
+// runCLI starts
+func TestMain(m *testing.M) {
+	if os.Getenv("VI_PATHS_TEST_MAIN") != "" {
+		os.Args = append([]string{program}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs vi-paths in dir with args, the edited buffer on stdin, and
+// returns its exit code, stdout, and stderr
+func runCLI(t *testing.T, dir, buffer string, args ...string) (int, string, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(buffer)
+	cmd.Env = append(os.Environ(), "VI_PATHS_TEST_MAIN=1", "XDG_CONFIG_HOME="+t.TempDir(), "XDG_DATA_HOME="+t.TempDir(), "VI_PATHS_OPTS=")
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stdout.String(), stderr.String()
+	}
+	if err != nil {
+		t.Fatalf("running: %v", err)
+	}
+	return 0, stdout.String(), stderr.String()
+}
+
+func TestDuplicateDestination(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "list"), []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-stdin-buffer", "-from-file", "list"},
+		{"-stdin-buffer", "-from-file", "list", "-on-conflict", "overwrite"},
+		{"-stdin-buffer", "-from-file", "list", "-save-plan", "plan.json"},
+	} {
+		code, _, stderr := runCLI(t, dir, "c\nc\n", args...)
+		if code != exitInvalidPlan {
+			t.Errorf("%v: exit %d, want %d\n%s", args, code, exitInvalidPlan, stderr)
+		}
+		if !strings.Contains(stderr, "both go to c") {
+			t.Errorf("%v: stderr doesn't name the destination:\n%s", args, stderr)
+		}
+		for _, name := range []string{"a", "b"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("%v: %s was moved: %v", args, name, err)
+			}
+		}
+		for _, name := range []string{"c", "plan.json"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				t.Errorf("%v: %s was written", args, name)
+			}
+		}
+	}
+}
+
+func TestPorcelainOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "y"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "list"), []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the copies run at once, and the one onto y is skipped before any of
+	// them finish, but each status is reported against its own operation
+	code, stdout, stderr := runCLI(t, dir, "copy x\ncopy y\ncopy z\n", "-stdin-buffer", "-from-file", "list", "-jobs", "3", "-on-conflict", "skip", "-porcelain")
+	if code != 0 {
+		t.Fatalf("exit %d\n%s", code, stderr)
+	}
+	const want = "done\tcopy\ta\tx\nskipped\tcopy\tb\ty\ndone\tcopy\tc\tz\n"
+	if stdout != want {
+		t.Errorf("porcelain =\n%s\nwant\n%s", stdout, want)
+	}
+}
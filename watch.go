@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"go.senan.xyz/vi-paths/pkg/vipaths"
+)
+
+const (
+	// watchSettle is how long arrivals have to stop changing before they're
+	// edited, so downloads and scans in progress are finished first
+	watchSettle = 2 * time.Second
+	// watchPoll is how often the directory is read where there are no
+	// events, and how often the timing is checked where there are
+	watchPoll = time.Second
+)
+
+// arrival is what's known of a path which arrived in a watched directory, to
+// tell when it's stopped changing
+type arrival struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher finds paths which arrive in a directory, for -watch. paths there
+// when it started, or which were edited already, are seen and not edited
+// again
+type watcher struct {
+	dir     string
+	ignores *ignoreRules
+	// seen are absolute, since plans can name a path either way
+	seen map[string]bool
+	wake <-chan struct{}
+	// opened is when the last buffer of arrivals was opened, or when
+	// watching started
+	opened time.Time
+}
+
+func newWatcher(dir string, ignores *ignoreRules) (*watcher, error) {
+	w := &watcher{dir: dir, ignores: ignores, seen: map[string]bool{}, opened: time.Now()}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		w.see(filepath.Join(dir, entry.Name()))
+	}
+	if w.wake, err = watchEvents(dir); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// arrivals reads the directory for paths which haven't been seen
+func (w *watcher) arrivals() (map[string]arrival, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	arrivals := map[string]arrival{}
+	for _, entry := range entries {
+		path := filepath.Join(w.dir, entry.Name())
+		if w.seen[absPath(path)] || w.ignores.ignored(path, entry.IsDir()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// gone again already
+			continue
+		}
+		arrivals[path] = arrival{size: info.Size(), modTime: info.ModTime()}
+	}
+	return arrivals, nil
+}
+
+// next waits for paths to arrive, returning them sorted once they've settled
+// and interval has passed since the last buffer was opened. a triage signal
+// returns them without waiting. it returns ctx's error if it's cancelled
+// first
+func (w *watcher) next(ctx context.Context, interval time.Duration) ([]string, error) {
+	demand := make(chan os.Signal, 1)
+	if len(triageSignals) > 0 {
+		signal.Notify(demand, triageSignals...)
+		defer signal.Stop(demand)
+	}
+	tick := time.NewTicker(watchPoll)
+	defer tick.Stop()
+
+	var last map[string]arrival
+	var changed time.Time
+	var demanded bool
+	dirty := true
+	for {
+		if dirty {
+			arrivals, err := w.arrivals()
+			if err != nil {
+				return nil, err
+			}
+			if !maps.Equal(arrivals, last) {
+				last, changed = arrivals, time.Now()
+			}
+			dirty = false
+		}
+		switch {
+		case len(last) == 0:
+			demanded = false
+		case demanded,
+			time.Since(changed) >= watchSettle && time.Since(w.opened) >= interval:
+			return slices.Sorted(maps.Keys(last)), nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.wake:
+			dirty = true
+		case <-demand:
+			demanded, dirty = true, true
+		case <-tick.C:
+			// without events, poll. with them, only the timing needs checking,
+			// unless something's still arriving and may change without an
+			// event, like a file being appended to over nfs
+			dirty = w.wake == nil || len(last) > 0
+		}
+	}
+}
+
+// done marks the paths edited in a batch, and where the plan put them, as
+// seen, so they aren't edited again
+func (w *watcher) done(batch []string, plan vipaths.Plan) {
+	w.opened = time.Now()
+	for _, path := range batch {
+		w.see(path)
+	}
+	for _, inst := range plan {
+		if dst := planDst(inst); dst != "" {
+			w.see(dst)
+		}
+	}
+}
+
+func (w *watcher) see(path string) {
+	w.seen[absPath(path)] = true
+}
+
+// absPath is path made absolute, or as it is if it can't be
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// wait is next until it's interrupted, when it returns no paths
+func (w *watcher) wait(interval time.Duration) ([]string, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	paths, err := w.next(ctx, interval)
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%d new paths in %s", len(paths), w.dir)
+	return paths, nil
+}
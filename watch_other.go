@@ -0,0 +1,18 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// triageSignals open a buffer of what's arrived in a watched directory
+// straight away
+var triageSignals = []os.Signal{syscall.SIGUSR1}
+
+// watchEvents has no events to wake the watcher with here, so the directory
+// is polled
+func watchEvents(string) (<-chan struct{}, error) {
+	return nil, nil
+}
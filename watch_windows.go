@@ -0,0 +1,12 @@
+package main
+
+import "os"
+
+// triageSignals are none on windows, which can't send them
+var triageSignals []os.Signal
+
+// watchEvents has no events to wake the watcher with here, so the directory
+// is polled
+func watchEvents(string) (<-chan struct{}, error) {
+	return nil, nil
+}